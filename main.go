@@ -12,11 +12,14 @@ Copyright (c) 2020 Red Hat, Inc.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
-	"strings"
+	"syscall"
 	"time"
 
 	"github.com/stolostron/search-collector/pkg/config"
@@ -26,6 +29,8 @@ import (
 	tr "github.com/stolostron/search-collector/pkg/transforms"
 
 	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/stolostron/search-collector/pkg/send"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -70,6 +75,31 @@ func main() {
 		go wait.Forever(leaseReconciler.Reconcile, time.Duration(leaseReconciler.LeaseDurationSeconds)*time.Second)
 	}
 
+	if config.Cfg.MetricsPort > 0 {
+		prometheus.MustRegister(tr.Metrics()...)
+		prometheus.MustRegister(send.Metrics()...)
+		go serveMetrics(config.Cfg.MetricsPort)
+	}
+
+	// With several replicas, only the leader collects. The standby replicas wait for the lease.
+	if config.Cfg.LeaderElection {
+		// The Lease is released on shutdown, so a standby takes over without waiting for it to expire.
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+		defer stop()
+		elector := lease.NewLeaderElector(config.GetKubeClient(config.GetKubeConfig()))
+		elector.Run(ctx, func(ctx context.Context) { collect(ctx, numThreads) }, func() {
+			glog.Warning("Stopping the collector, a standby takes over")
+			glog.Flush()
+			os.Exit(0) // Restarts on standby
+		})
+		return
+	}
+	collect(context.Background(), numThreads)
+}
+
+// Watches the resources, transforms them and sends them to the aggregator. Returns once ctx is done and nothing is
+// sent anymore, never returns otherwise.
+func collect(ctx context.Context, numThreads int) {
 	// Create input channel
 	transformChannel := make(chan *tr.Event)
 
@@ -86,6 +116,17 @@ func main() {
 	// Get kubernetes client for discovering resource types
 	discoveryClient := config.GetDiscoveryClient()
 
+	// The events go straight into the transformer, or through the queue collapsing the events of each resource.
+	sendToTransformer := func(event *tr.Event) {
+		upsertTransformer.Input <- event // Send resource into the transformer input channel
+	}
+	var eventQueue *tr.EventQueue
+	if config.Cfg.EventQueueSize > 0 {
+		eventQueue = tr.NewEventQueue(config.Cfg.EventQueueSize)
+		go eventQueue.Forward(upsertTransformer.Input)
+		sendToTransformer = eventQueue.Add
+	}
+
 	// These functions return handler functions, which are then used in creation of the informers.
 	createInformerAddHandler := func(resourceName string) func(interface{}) {
 		return func(obj interface{}) {
@@ -96,7 +137,7 @@ func main() {
 				Resource:       resource,
 				ResourceString: resourceName,
 			}
-			upsertTransformer.Input <- &upsert // Send resource into the transformer input channel
+			sendToTransformer(&upsert)
 		}
 	}
 
@@ -109,20 +150,29 @@ func main() {
 				Resource:       resource,
 				ResourceString: resourceName,
 			}
-			upsertTransformer.Input <- &upsert // Send resource into the transformer input channel
+			sendToTransformer(&upsert)
 		}
 	}
 
 	informerDeleteHandler := func(obj interface{}) {
 		resource := obj.(*unstructured.Unstructured)
+		if eventQueue != nil {
+			eventQueue.Forget(resource)
+		}
 		// We don't actually have anything to transform in the case of a deletion, so we manually construct the NodeEvent
 		ne := tr.NodeEvent{
 			Time:      time.Now().Unix(),
 			Operation: tr.Delete,
 			Node: tr.Node{
-				UID: strings.Join([]string{config.Cfg.ClusterName, string(resource.GetUID())}, "/"),
+				UID: tr.PrefixedUID(resource.GetKind(), resource.GetUID()),
 			},
 		}
+		// A coalesced Event is merged into the node of its involved object and reason, the node is updated instead.
+		if resource.GetKind() == "Event" {
+			if coalesced, ok := tr.CoalescedEventDelete(resource.GetUID(), ne.Time); ok {
+				ne = coalesced
+			}
+		}
 		reconciler.Input <- ne
 	}
 
@@ -182,9 +232,30 @@ func main() {
 
 	glog.Info("Waiting for informers to load initial state...")
 	for !informersStarted {
+		if ctx.Err() != nil {
+			return
+		}
 		time.Sleep(time.Duration(100) * time.Millisecond)
 	}
+	if eventQueue != nil {
+		eventQueue.WaitForwarded() // The events of the initial sync are counted once they're transformed
+	}
+	upsertTransformer.SyncComplete()
+	if ctx.Err() != nil {
+		return
+	}
 
 	glog.Info("Starting the sender.")
-	sender.StartSendLoop()
+	sender.StartSendLoop(ctx)
+}
+
+// Serves the registered Prometheus metrics on /metrics, and the resources skipped by RBAC_PROBE on /status.
+// The collector keeps running if the server stops.
+func serveMetrics(port int) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/status", inform.ServeStatus)
+	server := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	glog.Info("Serving the metrics on port ", port)
+	glog.Error("Metrics server stopped: ", server.ListenAndServe())
 }
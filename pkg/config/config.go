@@ -17,6 +17,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/golang/glog"
 	"github.com/tkanos/gonfig"
@@ -31,14 +32,30 @@ const (
 	DEFAULT_AGGREGATOR_HOST    = "https://localhost"
 	DEFAULT_AGGREGATOR_PORT    = "3010"
 	DEFAULT_CLUSTER_NAME       = "local-cluster"
+	DEFAULT_FLATTEN_MAX_KEYS   = 100
 	DEFAULT_POD_NAMESPACE      = "open-cluster-management"
 	DEFAULT_HEARTBEAT_MS       = 300000 // 5 min
+	DEFAULT_KAFKA_TOPIC        = "search-collector"
+	DEFAULT_LEADER_FAILOVER_MS = 15000 // 15 seconds
+	DEFAULT_LEADER_LEASE       = "search-collector-leader"
 	DEFAULT_MAX_BACKOFF_MS     = 600000 // 10 min
+	DEFAULT_NODE_IMAGES_MAX    = 50
+	DEFAULT_PAYLOAD_VERSION    = 1
+	DEFAULT_PENDING_EDGES_MAX  = 10000
+	DEFAULT_PENDING_EDGE_TTL   = 600000 // 10 min
 	DEFAULT_REDISCOVER_RATE_MS = 120000 // 2 min
 	DEFAULT_REPORT_RATE_MS     = 5000   // 5 seconds
+	DEFAULT_RETRY_BACKOFF_MS   = 1000   // 1 second
 	DEFAULT_RUNTIME_MODE       = "production"
 )
 
+// The noisy annotations left out of the annotation property unless METADATA_KEYS_DENY is set.
+var DEFAULT_METADATA_KEYS_DENY = []string{
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"control-plane.alpha.kubernetes.io/leader",
+	"kapp.k14s.io/original*",
+}
+
 // Configuration options for the search-collector.
 type Config struct {
 	AggregatorConfig     *rest.Config // Config object for hub. Used to get TLS credentials.
@@ -50,12 +67,82 @@ type Config struct {
 	ClusterNamespace     string       `env:"CLUSTER_NAMESPACE"`  // The namespace of this cluster
 	PodNamespace         string       `env:"POD_NAMESPACE"`      // The namespace of this pod
 	DeployedInHub        bool         `env:"DEPLOYED_IN_HUB"`    // Tracks if deployed in the Hub or Managed cluster
+	CompressPayloads     bool         `env:"COMPRESS_PAYLOADS"`  // Gzip the payloads sent to the aggregator
 	HeartbeatMS          int          `env:"HEARTBEAT_MS"`       // Interval(ms) to send empty payload to ensure connection
 	KubeConfig           string       `env:"KUBECONFIG"`         // Local kubeconfig path
 	MaxBackoffMS         int          `env:"MAX_BACKOFF_MS"`     // Maximum backoff in ms to wait after error
+	MetricsPort          int          `env:"METRICS_PORT"`       // Port to serve the Prometheus metrics, 0 disables it
+	PayloadVersion       int          `env:"PAYLOAD_VERSION"`    // Latest payload version negotiated with the aggregator
+	RBACProbe            bool         `env:"RBAC_PROBE"`         // Skip the resources the collector can't list and watch
 	RediscoverRateMS     int          `env:"REDISCOVER_RATE_MS"` // Interval(ms) to poll for changes to CRDs
 	ReportRateMS         int          `env:"REPORT_RATE_MS"`     // Interval(ms) to send changes to the aggregator
 	RuntimeMode          string       `env:"RUNTIME_MODE"`       // Running mode (development or production)
+
+	// Options to keep the state sent across restarts, and to send it somewhere other than the aggregator.
+	LastSentStateFile      string            `env:"LAST_SENT_STATE_FILE"`      // File keeping the state sent
+	SenderBackend          string            `env:"SENDER_BACKEND"`            // aggregator, webhook or kafka
+	WebhookURL             string            `env:"WEBHOOK_URL"`               // URL the webhook backend posts to
+	WebhookHeaders         map[string]string `env:"WEBHOOK_HEADERS"`           // Headers of the webhook requests
+	KafkaRestURL           string            `env:"KAFKA_REST_URL"`            // URL of the Kafka REST proxy
+	KafkaTopic             string            `env:"KAFKA_TOPIC"`               // Topic of the records
+	KafkaTopicPerOperation bool              `env:"KAFKA_TOPIC_PER_OPERATION"` // One topic for each operation
+
+	// Options to run several replicas, only the leader collects.
+	LeaderElection           bool   `env:"LEADER_ELECTION"`             // Only the replica holding the lease collects
+	LeaderElectionFailoverMS int    `env:"LEADER_ELECTION_FAILOVER_MS"` // Time(ms) before a standby takes over
+	LeaderElectionLease      string `env:"LEADER_ELECTION_LEASE"`       // Name of the lease of the leader
+
+	// Options to retry the resources that failed to transform.
+	TransformRetries        int `env:"TRANSFORM_RETRIES"`          // Retries before giving up on a resource
+	TransformRetryBackoffMS int `env:"TRANSFORM_RETRY_BACKOFF_MS"` // Time(ms) before the first retry
+
+	// Options to control the properties extracted by the transforms.
+	CoalesceEvents       bool              `env:"COALESCE_EVENTS"`        // One Event node per involved object and reason
+	CollectAnnotations   bool              `env:"COLLECT_ANNOTATIONS"`    // Adds the annotations of each resource
+	CollectAPIPath       bool              `env:"COLLECT_API_PATH"`       // Adds the _apiPath property to each resource
+	CollectCategory      bool              `env:"COLLECT_CATEGORY"`       // Adds the _category property to each resource
+	CollectFinalizers    bool              `env:"COLLECT_FINALIZERS"`     // Adds the finalizers of each resource
+	CompressPropertySize int               `env:"COMPRESS_PROPERTY_SIZE"` // Compress larger string properties (bytes)
+	ContainerCommands    bool              `env:"CONTAINER_COMMANDS"`     // Adds the command and args of pod containers
+	ContainerNodes       bool              `env:"CONTAINER_NODES"`        // Adds a node for each container of a pod
+	DaemonSetCoverage    bool              `env:"DAEMONSET_COVERAGE"`     // Finds the tainted nodes DaemonSets can't run on
+	DataKeyNames         bool              `env:"DATA_KEY_NAMES"`         // Adds the data keys of Secrets and ConfigMaps
+	DedupSymmetricEdges  bool              `env:"DEDUP_SYMMETRIC_EDGES"`  // Sends one direction of the symmetric edges
+	DeferDanglingEdges   bool              `env:"DEFER_DANGLING_EDGES"`   // Hold back edges until both endpoints exist
+	EdgeDirection        bool              `env:"EDGE_DIRECTION"`         // Adds the direction to the edges
+	EligibleNodeEdges    bool              `env:"ELIGIBLE_NODE_EDGES"`    // Adds edges from pods to their eligible nodes
+	EventQueueSize       int               `env:"EVENT_QUEUE_SIZE"`       // Max resources queued to collapse their events
+	EventSummary         bool              `env:"EVENT_SUMMARY"`          // Summarize Events onto their involved object
+	ExcludedNamespaces   []string          `env:"EXCLUDED_NAMESPACES"`    // Namespaces whose resources aren't sent
+	FlattenDepth         int               `env:"FLATTEN_DEPTH"`          // Max depth of the flattened properties
+	FlattenMaxKeys       int               `env:"FLATTEN_MAX_KEYS"`       // Max number of flattened properties
+	HeartbeatNodeMS      int               `env:"HEARTBEAT_NODE_MS"`      // Interval(ms) to emit the heartbeat node
+	HelmReleases         bool              `env:"HELM_RELEASES"`          // Adds a node for each Helm 3 release
+	InternProperties     bool              `env:"INTERN_PROPERTIES"`      // Share the repeated property values across nodes
+	KindCategories       map[string]string `env:"KIND_CATEGORIES"`        // Category of each kind, over the default ones
+	KindQualifiedUIDs    bool              `env:"KIND_QUALIFIED_UIDS"`    // Adds the kind to UIDs, like cluster/Pod/uid
+	KindRateLimits       map[string]string `env:"KIND_RATE_LIMITS"`       // Max nodes per second of each kind
+	KindWorkerPools      map[string]string `env:"KIND_WORKER_POOLS"`      // Kinds transformed by a dedicated pool
+	LabelApplications    bool              `env:"LABEL_APPLICATIONS"`     // Group resources by app.kubernetes.io labels
+	MetadataKeysAllow    []string          `env:"METADATA_KEYS_ALLOW"`    // Label and annotation keys kept, all when empty
+	MetadataKeysDeny     []string          `env:"METADATA_KEYS_DENY"`     // Label and annotation keys left out
+	NamespaceCascade     bool              `env:"NAMESPACE_CASCADE"`      // Delete the resources with their namespace
+	NodeImagesMax        int               `env:"NODE_IMAGES_MAX"`        // Max number of image names for each node
+	NormalizeReady       bool              `env:"NORMALIZE_READY"`        // Adds _ready to resources without a transform
+	NumericAnnotations   map[string]string `env:"NUMERIC_ANNOTATIONS"`    // Annotations extracted as numeric properties
+	PendingEdgesMax      int               `env:"PENDING_EDGES_MAX"`      // Max number of edges held back
+	PendingEdgeTTLMS     int               `env:"PENDING_EDGE_TTL_MS"`    // Time(ms) to hold back an edge
+	PriorityKinds        []string          `env:"PRIORITY_KINDS"`         // Kinds transformed ahead of the others
+	RedactedPaths        []string          `env:"REDACTED_PATHS"`         // Fields never added as flattened properties
+	RemoteEdgesCluster   string            `env:"REMOTE_EDGES_CLUSTER"`   // Cluster of the resources referenced remotely
+	ResyncMarkers        bool              `env:"RESYNC_MARKERS"`         // Marks the resyncs signaled by vendoring code
+	SchemaVersion        int               `env:"SCHEMA_VERSION"`         // Pinned version of the property names
+	SensitiveNamespaces  []string          `env:"SENSITIVE_NAMESPACES"`   // Namespaces with anonymized resources
+	SummaryNodes         bool              `env:"SUMMARY_NODES"`          // Adds a summary node for each resource
+	SyncManifest         bool              `env:"SYNC_MANIFEST"`          // Emits a manifest node after the initial sync
+	TombstoneTTLMS       int               `env:"TOMBSTONE_TTL_MS"`       // Time(ms) to keep the delete markers
+	ValidateNodes        bool              `env:"VALIDATE_NODES"`         // Drop nodes not matching their kind schema
+	WorkloadDrift        bool              `env:"WORKLOAD_DRIFT"`         // Adds who last modified workloads and drift
 }
 
 var Cfg = Config{}
@@ -99,11 +186,80 @@ func InitConfig() {
 		setDefault(&Cfg.AggregatorURL, "AGGREGATOR_URL", DEFAULT_AGGREGATOR_URL)
 	}
 
+	setDefaultBool(&Cfg.CompressPayloads, "COMPRESS_PAYLOADS")
 	setDefaultInt(&Cfg.HeartbeatMS, "HEARTBEAT_MS", DEFAULT_HEARTBEAT_MS)
 	setDefaultInt(&Cfg.MaxBackoffMS, "MAX_BACKOFF_MS", DEFAULT_MAX_BACKOFF_MS)
+	setDefaultInt(&Cfg.MetricsPort, "METRICS_PORT", 0)
+	setDefaultInt(&Cfg.PayloadVersion, "PAYLOAD_VERSION", DEFAULT_PAYLOAD_VERSION)
+	setDefaultBool(&Cfg.RBACProbe, "RBAC_PROBE")
 	setDefaultInt(&Cfg.RediscoverRateMS, "REDISCOVER_RATE_MS", DEFAULT_REDISCOVER_RATE_MS)
 	setDefaultInt(&Cfg.ReportRateMS, "REPORT_RATE_MS", DEFAULT_REPORT_RATE_MS)
 
+	setDefault(&Cfg.LastSentStateFile, "LAST_SENT_STATE_FILE", "")
+	setDefault(&Cfg.SenderBackend, "SENDER_BACKEND", "aggregator")
+	setDefault(&Cfg.WebhookURL, "WEBHOOK_URL", "")
+	setDefaultMap(&Cfg.WebhookHeaders, "WEBHOOK_HEADERS")
+	setDefault(&Cfg.KafkaRestURL, "KAFKA_REST_URL", "")
+	setDefault(&Cfg.KafkaTopic, "KAFKA_TOPIC", DEFAULT_KAFKA_TOPIC)
+	setDefaultBool(&Cfg.KafkaTopicPerOperation, "KAFKA_TOPIC_PER_OPERATION")
+
+	setDefaultBool(&Cfg.LeaderElection, "LEADER_ELECTION")
+	setDefaultInt(&Cfg.LeaderElectionFailoverMS, "LEADER_ELECTION_FAILOVER_MS", DEFAULT_LEADER_FAILOVER_MS)
+	setDefault(&Cfg.LeaderElectionLease, "LEADER_ELECTION_LEASE", DEFAULT_LEADER_LEASE)
+
+	setDefaultInt(&Cfg.TransformRetries, "TRANSFORM_RETRIES", 0)
+	setDefaultInt(&Cfg.TransformRetryBackoffMS, "TRANSFORM_RETRY_BACKOFF_MS", DEFAULT_RETRY_BACKOFF_MS)
+
+	setDefaultBool(&Cfg.CoalesceEvents, "COALESCE_EVENTS")
+	setDefaultBool(&Cfg.CollectAnnotations, "COLLECT_ANNOTATIONS")
+	setDefaultBool(&Cfg.CollectAPIPath, "COLLECT_API_PATH")
+	setDefaultBool(&Cfg.CollectCategory, "COLLECT_CATEGORY")
+	setDefaultBool(&Cfg.CollectFinalizers, "COLLECT_FINALIZERS")
+	setDefaultInt(&Cfg.CompressPropertySize, "COMPRESS_PROPERTY_SIZE", 0)
+	setDefaultBool(&Cfg.ContainerCommands, "CONTAINER_COMMANDS")
+	setDefaultBool(&Cfg.ContainerNodes, "CONTAINER_NODES")
+	setDefaultBool(&Cfg.DaemonSetCoverage, "DAEMONSET_COVERAGE")
+	setDefaultBool(&Cfg.DataKeyNames, "DATA_KEY_NAMES")
+	setDefaultBool(&Cfg.DedupSymmetricEdges, "DEDUP_SYMMETRIC_EDGES")
+	setDefaultBool(&Cfg.DeferDanglingEdges, "DEFER_DANGLING_EDGES")
+	setDefaultBool(&Cfg.EdgeDirection, "EDGE_DIRECTION")
+	setDefaultBool(&Cfg.EligibleNodeEdges, "ELIGIBLE_NODE_EDGES")
+	setDefaultInt(&Cfg.EventQueueSize, "EVENT_QUEUE_SIZE", 0)
+	setDefaultBool(&Cfg.EventSummary, "EVENT_SUMMARY")
+	setDefaultList(&Cfg.ExcludedNamespaces, "EXCLUDED_NAMESPACES")
+	setDefaultInt(&Cfg.FlattenDepth, "FLATTEN_DEPTH", 0)
+	setDefaultInt(&Cfg.FlattenMaxKeys, "FLATTEN_MAX_KEYS", DEFAULT_FLATTEN_MAX_KEYS)
+	setDefaultInt(&Cfg.HeartbeatNodeMS, "HEARTBEAT_NODE_MS", 0)
+	setDefaultBool(&Cfg.HelmReleases, "HELM_RELEASES")
+	setDefaultBool(&Cfg.InternProperties, "INTERN_PROPERTIES")
+	setDefaultMap(&Cfg.KindCategories, "KIND_CATEGORIES")
+	setDefaultBool(&Cfg.KindQualifiedUIDs, "KIND_QUALIFIED_UIDS")
+	setDefaultMap(&Cfg.KindRateLimits, "KIND_RATE_LIMITS")
+	setDefaultMap(&Cfg.KindWorkerPools, "KIND_WORKER_POOLS")
+	setDefaultBool(&Cfg.LabelApplications, "LABEL_APPLICATIONS")
+	setDefaultList(&Cfg.MetadataKeysAllow, "METADATA_KEYS_ALLOW")
+	setDefaultList(&Cfg.MetadataKeysDeny, "METADATA_KEYS_DENY")
+	if Cfg.MetadataKeysDeny == nil {
+		Cfg.MetadataKeysDeny = DEFAULT_METADATA_KEYS_DENY
+	}
+	setDefaultBool(&Cfg.NamespaceCascade, "NAMESPACE_CASCADE")
+	setDefaultInt(&Cfg.NodeImagesMax, "NODE_IMAGES_MAX", DEFAULT_NODE_IMAGES_MAX)
+	setDefaultBool(&Cfg.NormalizeReady, "NORMALIZE_READY")
+	setDefaultMap(&Cfg.NumericAnnotations, "NUMERIC_ANNOTATIONS")
+	setDefaultInt(&Cfg.PendingEdgesMax, "PENDING_EDGES_MAX", DEFAULT_PENDING_EDGES_MAX)
+	setDefaultInt(&Cfg.PendingEdgeTTLMS, "PENDING_EDGE_TTL_MS", DEFAULT_PENDING_EDGE_TTL)
+	setDefaultList(&Cfg.PriorityKinds, "PRIORITY_KINDS")
+	setDefaultList(&Cfg.RedactedPaths, "REDACTED_PATHS")
+	setDefault(&Cfg.RemoteEdgesCluster, "REMOTE_EDGES_CLUSTER", "")
+	setDefaultBool(&Cfg.ResyncMarkers, "RESYNC_MARKERS")
+	setDefaultInt(&Cfg.SchemaVersion, "SCHEMA_VERSION", 0)
+	setDefaultList(&Cfg.SensitiveNamespaces, "SENSITIVE_NAMESPACES")
+	setDefaultBool(&Cfg.SummaryNodes, "SUMMARY_NODES")
+	setDefaultBool(&Cfg.SyncManifest, "SYNC_MANIFEST")
+	setDefaultInt(&Cfg.TombstoneTTLMS, "TOMBSTONE_TTL_MS", 0)
+	setDefaultBool(&Cfg.ValidateNodes, "VALIDATE_NODES")
+	setDefaultBool(&Cfg.WorkloadDrift, "WORKLOAD_DRIFT")
+
 	defaultKubePath := filepath.Join(os.Getenv("HOME"), ".kube", "config")
 	if _, err := os.Stat(defaultKubePath); os.IsNotExist(err) {
 		// set default to empty string if path does not reslove
@@ -158,6 +314,50 @@ func setDefault(field *string, env, defaultVal string) {
 	}
 }
 
+// Sets a bool config field from the env if present. There's no default because bool fields are false unless set.
+func setDefaultBool(field *bool, env string) {
+	if val := os.Getenv(env); val != "" {
+		glog.Infof("Using %s from environment: %s", env, val)
+		parsed, err := strconv.ParseBool(val)
+		if err != nil {
+			glog.Error("Error parsing env [", env, "].  Expected a bool.  Original error: ", err)
+			return
+		}
+		*field = parsed
+	}
+}
+
+// Sets a list config field from the env if present. The env value is a comma separated list.
+func setDefaultList(field *[]string, env string) {
+	if val := os.Getenv(env); val != "" {
+		glog.Infof("Using %s from environment: %s", env, val)
+		parsed := []string{}
+		for _, item := range strings.Split(val, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				parsed = append(parsed, item)
+			}
+		}
+		*field = parsed
+	}
+}
+
+// Sets a map config field from the env if present. The env value is a comma separated list of key=value pairs.
+func setDefaultMap(field *map[string]string, env string) {
+	if val := os.Getenv(env); val != "" {
+		glog.Infof("Using %s from environment: %s", env, val)
+		parsed := make(map[string]string)
+		for _, pair := range strings.Split(val, ",") {
+			key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if !found || key == "" || value == "" {
+				glog.Error("Error parsing env [", env, "].  Expected key=value pairs separated by commas, found: ", pair)
+				return
+			}
+			parsed[key] = value
+		}
+		*field = parsed
+	}
+}
+
 func setDefaultInt(field *int, env string, defaultVal int) {
 	if val := os.Getenv(env); val != "" {
 		glog.Infof("Using %s from environment: %s", env, val)
@@ -5,6 +5,7 @@ package config
 
 import (
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -52,3 +53,46 @@ func Test_SetDefaultInt_02(t *testing.T) {
 		t.Errorf("Failed testing setDefault() Expected: %d  Got: %d", 9999, property)
 	}
 }
+
+// Should use value from environment variable if it exists.
+func Test_SetDefaultBool(t *testing.T) {
+
+	os.Setenv("TEST_ENV_BOOL", "true")
+	var property bool
+	setDefaultBool(&property, "TEST_ENV_BOOL")
+
+	if !property {
+		t.Errorf("Failed testing setDefaultBool() Expected: %t  Got: %t", true, property)
+	}
+}
+
+func Test_SetDefaultMap(t *testing.T) {
+
+	os.Setenv("TEST_ENV_MAP", "example.com/cost-per-hour=costPerHour, example.com/cpu-usage=cpuUsage")
+	var property map[string]string
+	setDefaultMap(&property, "TEST_ENV_MAP")
+
+	expected := map[string]string{"example.com/cost-per-hour": "costPerHour", "example.com/cpu-usage": "cpuUsage"}
+	if !reflect.DeepEqual(property, expected) {
+		t.Errorf("Failed testing setDefaultMap() Expected: %v  Got: %v", expected, property)
+	}
+
+	// Leaves the field unchanged if the env can't be parsed.
+	os.Setenv("TEST_ENV_MAP", "example.com/cost-per-hour")
+	setDefaultMap(&property, "TEST_ENV_MAP")
+	if !reflect.DeepEqual(property, expected) {
+		t.Errorf("Failed testing setDefaultMap() Expected: %v  Got: %v", expected, property)
+	}
+}
+
+func Test_SetDefaultList(t *testing.T) {
+
+	os.Setenv("TEST_ENV_LIST", "payments, hr,")
+	var property []string
+	setDefaultList(&property, "TEST_ENV_LIST")
+
+	expected := []string{"payments", "hr"}
+	if !reflect.DeepEqual(property, expected) {
+		t.Errorf("Failed testing setDefaultList() Expected: %v  Got: %v", expected, property)
+	}
+}
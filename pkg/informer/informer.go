@@ -28,6 +28,7 @@ type GenericInformer struct {
 	initialized   bool
 	resourceIndex map[string]string // Index of curr resources [key=UUID value=resourceVersion]
 	retries       int64             // Counts times we have tried without establishing a watch.
+	kind          string            // Kind of the resources, used to delete the resources left in the index.
 }
 
 // InformerForResource initialize a Generic Informer for a resource (GVR).
@@ -52,7 +53,7 @@ func (inform *GenericInformer) Run(stopper chan struct{}) {
 			glog.Info("Informer stopped. ", inform.gvr.String())
 			for key := range inform.resourceIndex {
 				glog.V(5).Infof("Stopping informer %s and removing resource with UID: %s", inform.gvr.Resource, key)
-				obj := newUnstructured(inform.gvr.Resource, key)
+				obj := newUnstructured(inform.kind, key)
 				inform.DeleteFunc(obj)
 			}
 			glog.V(5).Info("Informer stopped. ", inform.gvr.String())
@@ -120,6 +121,7 @@ func (inform *GenericInformer) listAndResync() error {
 			glog.V(5).Infof("KIND: %s UUID: %s, ResourceVersion: %s",
 				inform.gvr.Resource, resources.Items[i].GetUID(), resources.Items[i].GetResourceVersion())
 			inform.AddFunc(&resources.Items[i])
+			inform.kind = resources.Items[i].GetKind()
 			newResourceIndex[string(resources.Items[i].GetUID())] = resources.Items[i].GetResourceVersion()
 		}
 		glog.V(3).Infof("Listed\t[Group: %s \tKind: %s]  ===>  resourceTotal: %d  resourceVersion: %s",
@@ -139,7 +141,7 @@ func (inform *GenericInformer) listAndResync() error {
 	for key := range inform.resourceIndex {
 		if _, exist := newResourceIndex[key]; !exist {
 			glog.V(3).Infof("Resource does not exist. Deleting resource: %s with UID: %s", inform.gvr.Resource, key)
-			obj := newUnstructured(inform.gvr.Resource, key)
+			obj := newUnstructured(inform.kind, key)
 			inform.DeleteFunc(obj)
 			delete(inform.resourceIndex, key) // Thread safe?
 		}
@@ -181,6 +183,7 @@ func (inform *GenericInformer) watch(stopper chan struct{}) {
 				}
 				obj := &unstructured.Unstructured{Object: o}
 				inform.AddFunc(obj)
+				inform.kind = obj.GetKind()
 				inform.resourceIndex[string(obj.GetUID())] = obj.GetResourceVersion()
 
 			case "MODIFIED":
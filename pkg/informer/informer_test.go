@@ -128,6 +128,27 @@ func Test_listAndResync_syncWithPrevState(t *testing.T) {
 	}
 }
 
+// Verify that the resources deleted while we weren't watching have the kind of the listed resources.
+func Test_listAndResync_deletedResourceKind(t *testing.T) {
+	// Create informer instance to test.
+	informer, _, _, _ := initInformer()
+	deletedKind := ""
+	informer.DeleteFunc = func(obj interface{}) { deletedKind = obj.(*unstructured.Unstructured).GetKind() }
+
+	// Add existing state to the informer
+	informer.resourceIndex["fake-uid"] = "fake-resource-version" // This resource should get deleted.
+
+	// Execute function
+	err := informer.listAndResync()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if deletedKind != "TheKind" {
+		t.Errorf("Expected the deleted resource to be kind TheKind, but got %s.", deletedKind)
+	}
+}
+
 func Test_StoppedInformer_ValidateDeleteFunc(t *testing.T) {
 	//create informer for mock resource
 	informer, _, _, _ := initInformer()
@@ -0,0 +1,151 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package informer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	authv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The resources the collector isn't allowed to list and watch, skipped until it is. Set by each discovery.
+// The resources it was allowed to list and watch are kept with the time of their review.
+var forbiddenResources = struct {
+	sync.Mutex
+	gvrs    map[schema.GroupVersionResource]struct{}
+	allowed map[schema.GroupVersionResource]time.Time
+}{gvrs: map[schema.GroupVersionResource]struct{}{}, allowed: map[schema.GroupVersionResource]time.Time{}}
+
+// Time before the access to an allowed resource is reviewed again. The new and the forbidden resources are
+// reviewed at every discovery.
+const rbacAllowedRecheck = 10 * time.Minute
+
+// Max number of resources reviewed at the same time.
+const rbacProbeConcurrency = 10
+
+// Removes from the list the resources the collector isn't allowed to list and watch in every namespace, so their
+// informers don't fail forever. The forbidden resources are probed again with each discovery, a resource is watched
+// as soon as the permission is granted. The allowed resources are only probed again after rbacAllowedRecheck.
+func filterForbiddenResources(client kubernetes.Interface, gvrList map[schema.GroupVersionResource]struct{}) {
+	now := time.Now()
+	forbiddenResources.Lock()
+	var probed []schema.GroupVersionResource
+	for gvr := range gvrList {
+		if reviewed, ok := forbiddenResources.allowed[gvr]; !ok || now.Sub(reviewed) >= rbacAllowedRecheck {
+			probed = append(probed, gvr)
+		}
+	}
+	forbiddenResources.Unlock()
+
+	var mutex sync.Mutex
+	forbidden := map[schema.GroupVersionResource]struct{}{}
+	allowed := map[schema.GroupVersionResource]struct{}{}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, rbacProbeConcurrency)
+	for _, gvr := range probed {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(gvr schema.GroupVersionResource) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			canAccess, reviewed := canListAndWatch(client, gvr)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if !canAccess {
+				forbidden[gvr] = struct{}{}
+			} else if reviewed {
+				allowed[gvr] = struct{}{}
+			}
+		}(gvr)
+	}
+	wg.Wait()
+	for gvr := range forbidden {
+		delete(gvrList, gvr)
+	}
+
+	forbiddenResources.Lock()
+	defer forbiddenResources.Unlock()
+	for gvr := range forbidden {
+		if _, ok := forbiddenResources.gvrs[gvr]; !ok {
+			glog.Warningf("Not allowed to list and watch %s, skipping it until the permission is granted", gvr.String())
+		}
+		delete(forbiddenResources.allowed, gvr)
+	}
+	for gvr := range forbiddenResources.gvrs {
+		if _, ok := forbidden[gvr]; !ok {
+			glog.Infof("Allowed to list and watch %s", gvr.String())
+		}
+	}
+	for gvr := range allowed {
+		forbiddenResources.allowed[gvr] = now
+	}
+	for gvr := range forbiddenResources.allowed {
+		if _, ok := gvrList[gvr]; !ok { // No longer discovered
+			delete(forbiddenResources.allowed, gvr)
+		}
+	}
+	forbiddenResources.gvrs = forbidden
+}
+
+// Returns whether the collector is allowed to list and watch the resource in every namespace, and whether the
+// access was reviewed. Assumes it is when the access can't be reviewed, the informer reports the error like it did
+// before the probe.
+func canListAndWatch(client kubernetes.Interface, gvr schema.GroupVersionResource) (allowed bool, reviewed bool) {
+	for _, verb := range []string{"list", "watch"} {
+		review := &authv1.SelfSubjectAccessReview{
+			Spec: authv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authv1.ResourceAttributes{
+					Verb:     verb,
+					Group:    gvr.Group,
+					Version:  gvr.Version,
+					Resource: gvr.Resource,
+				},
+			},
+		}
+		result, err := client.AuthorizationV1().SelfSubjectAccessReviews().
+			Create(context.TODO(), review, metav1.CreateOptions{})
+		if err != nil {
+			glog.Warningf("Error reviewing the access to %s: %s", gvr.String(), err)
+			return true, false
+		}
+		if !result.Status.Allowed {
+			return false, true
+		}
+	}
+	return true, true
+}
+
+// ForbiddenResources returns the resources skipped because the collector isn't allowed to list and watch them,
+// like apps/v1, Resource=deployments.
+func ForbiddenResources() []string {
+	forbiddenResources.Lock()
+	defer forbiddenResources.Unlock()
+	resources := make([]string, 0, len(forbiddenResources.gvrs))
+	for gvr := range forbiddenResources.gvrs {
+		resources = append(resources, gvr.String())
+	}
+	sort.Strings(resources)
+	return resources
+}
+
+// ServeStatus writes the resources skipped because of the RBAC permissions, as JSON.
+func ServeStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	status := struct {
+		ForbiddenResources []string `json:"forbiddenResources"`
+	}{ForbiddenResources: ForbiddenResources()}
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		glog.Error("Error writing the status: ", err)
+	}
+}
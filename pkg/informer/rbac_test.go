@@ -0,0 +1,120 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package informer
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	authv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// Returns a client allowed to list and watch the resources, and nothing else.
+func accessReviewClient(allowed map[string]bool, reviewErr error) *fake.Clientset {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "selfsubjectaccessreviews",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authv1.SelfSubjectAccessReview)
+			review.Status.Allowed = allowed[review.Spec.ResourceAttributes.Resource]
+			return true, review, reviewErr
+		})
+	return client
+}
+
+// Forgets the resources reviewed by a test.
+func resetForbiddenResources() {
+	forbiddenResources.gvrs = map[schema.GroupVersionResource]struct{}{}
+	forbiddenResources.allowed = map[schema.GroupVersionResource]time.Time{}
+}
+
+func Test_filterForbiddenResources(t *testing.T) {
+	defer resetForbiddenResources()
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	secrets := schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+	gvrList := map[schema.GroupVersionResource]struct{}{pods: {}, secrets: {}}
+	filterForbiddenResources(accessReviewClient(map[string]bool{"pods": true}, nil), gvrList)
+	if _, ok := gvrList[secrets]; ok || len(gvrList) != 1 {
+		t.Errorf("Expected the secrets to be skipped, got %v", gvrList)
+	}
+	if forbidden := ForbiddenResources(); !reflect.DeepEqual(forbidden, []string{secrets.String()}) {
+		t.Errorf("Expected the secrets to be forbidden, got %v", forbidden)
+	}
+
+	// Once the permission is granted, the secrets are watched with the next discovery.
+	gvrList = map[schema.GroupVersionResource]struct{}{pods: {}, secrets: {}}
+	filterForbiddenResources(accessReviewClient(map[string]bool{"pods": true, "secrets": true}, nil), gvrList)
+	if len(gvrList) != 2 || len(ForbiddenResources()) != 0 {
+		t.Errorf("Expected the secrets to be watched, got %v", gvrList)
+	}
+}
+
+func Test_filterForbiddenResourcesRecheck(t *testing.T) {
+	defer resetForbiddenResources()
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	secrets := schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+	client := accessReviewClient(map[string]bool{"pods": true}, nil)
+	reviews := func() map[string]int {
+		counts := map[string]int{}
+		for _, action := range client.Actions() {
+			review := action.(k8stesting.CreateAction).GetObject().(*authv1.SelfSubjectAccessReview)
+			counts[review.Spec.ResourceAttributes.Resource]++
+		}
+		client.ClearActions()
+		return counts
+	}
+	assertReviews := func(expected map[string]int) {
+		t.Helper()
+		if actual := reviews(); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected the reviews %v, got %v", expected, actual)
+		}
+	}
+
+	filterForbiddenResources(client, map[schema.GroupVersionResource]struct{}{pods: {}, secrets: {}})
+	assertReviews(map[string]int{"pods": 2, "secrets": 1})
+
+	// The allowed pods aren't reviewed again until the recheck, the forbidden secrets are.
+	filterForbiddenResources(client, map[schema.GroupVersionResource]struct{}{pods: {}, secrets: {}})
+	assertReviews(map[string]int{"secrets": 1})
+	forbiddenResources.allowed[pods] = time.Now().Add(-rbacAllowedRecheck)
+	gvrList := map[schema.GroupVersionResource]struct{}{pods: {}, secrets: {}}
+	filterForbiddenResources(client, gvrList)
+	assertReviews(map[string]int{"pods": 2, "secrets": 1})
+	if len(gvrList) != 1 {
+		t.Errorf("Expected the pods only, got %v", gvrList)
+	}
+}
+
+func Test_canListAndWatchReviewError(t *testing.T) {
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	if allowed, reviewed := canListAndWatch(accessReviewClient(nil, errors.New("unavailable")), pods); !allowed ||
+		reviewed {
+		t.Error("Expected the resource to be watched when the access can't be reviewed")
+	}
+}
+
+func Test_ServeStatus(t *testing.T) {
+	defer resetForbiddenResources()
+	secrets := schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+	forbiddenResources.gvrs = map[schema.GroupVersionResource]struct{}{secrets: {}}
+
+	recorder := httptest.NewRecorder()
+	ServeStatus(recorder, httptest.NewRequest("GET", "/status", nil))
+	status := struct {
+		ForbiddenResources []string `json:"forbiddenResources"`
+	}{}
+	if err := json.NewDecoder(recorder.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(status.ForbiddenResources, []string{secrets.String()}) {
+		t.Errorf("Expected the forbidden secrets in the status, got %v", status.ForbiddenResources)
+	}
+}
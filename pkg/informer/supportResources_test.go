@@ -6,6 +6,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/stolostron/search-collector/pkg/config"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -173,3 +174,18 @@ func Test_supportedResources(t *testing.T) {
 	}
 
 }
+
+func Test_isResourceAllowedCoalesceEvents(t *testing.T) {
+	if isResourceAllowed("", "events", nil, nil) {
+		t.Error("Expected events to be denied.")
+	}
+
+	config.Cfg.CoalesceEvents = true
+	defer func() { config.Cfg.CoalesceEvents = false }()
+	if !isResourceAllowed("", "events", nil, nil) {
+		t.Error("Expected events to be allowed when they're coalesced.")
+	}
+	if isResourceAllowed("events.k8s.io", "events", nil, nil) {
+		t.Error("Expected the events.k8s.io events to be denied, they're the same as the core events.")
+	}
+}
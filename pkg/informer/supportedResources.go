@@ -46,7 +46,12 @@ func isResourceAllowed(group, kind string, allowedList []Resource, deniedList []
 	// Ignore oauthaccesstoken resources because those cause too much noise on OpenShift clusters.
 	// Ignore projects as namespaces are overwritten to be projects on Openshift clusters - they tend to share
 	// the same uid.
-	list := []string{"events", "projects", "clusters", "clusterstatuses", "oauthaccesstokens"}
+	// Ignore events unless they're coalesced or summarized, there's one for each occurrence. The events.k8s.io
+	// Events are the same objects as the core ones, so only the core group is collected.
+	list := []string{"projects", "clusters", "clusterstatuses", "oauthaccesstokens"}
+	if (!config.Cfg.CoalesceEvents && !config.Cfg.EventSummary) || group != "" {
+		list = append(list, "events")
+	}
 	// Deny all apiResources with kind in list
 	for _, name := range list {
 		if kind == name {
@@ -166,6 +171,9 @@ func SupportedResources(discoveryClient *discovery.DiscoveryClient) (map[schema.
 
 	// Use handy converter function to convert into GroupVersionResource objects, which we need in order to make informers
 	gvrList, err := discovery.GroupVersionResources(supportedResources)
+	if config.Cfg.RBACProbe && gvrList != nil {
+		filterForbiddenResources(kubeClient, gvrList)
+	}
 
 	return gvrList, err
 }
@@ -0,0 +1,130 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package lease
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/stolostron/search-collector/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// LeaderElector runs the collector in the replica holding the Lease, when several replicas are deployed for HA.
+// The other replicas wait on standby, without watching or sending anything, until the Lease expires.
+type LeaderElector struct {
+	KubeClient kubernetes.Interface
+	LeaseName  string
+	Namespace  string
+	Identity   string        // Name of this replica in the Lease, the pod name
+	Failover   time.Duration // How long the Lease is held without a renewal before a standby takes over
+}
+
+// Shortest LEADER_ELECTION_FAILOVER_MS. The leader renews the Lease every fifth of it, shorter intervals would
+// flood the API server, and the leader election can't run with a zero interval.
+const minLeaderFailover = time.Second
+
+// NewLeaderElector returns the elector configured by LEADER_ELECTION_LEASE and LEADER_ELECTION_FAILOVER_MS, in the
+// namespace of the pod.
+func NewLeaderElector(client kubernetes.Interface) *LeaderElector {
+	identity, err := os.Hostname() // The pod name, unique among the replicas
+	if err != nil {
+		glog.Fatal("Unable to get the hostname for the leader election: ", err)
+	}
+	failover := time.Duration(config.Cfg.LeaderElectionFailoverMS) * time.Millisecond
+	if failover < minLeaderFailover {
+		glog.Warningf("LEADER_ELECTION_FAILOVER_MS %d is shorter than %v, using the default %d instead",
+			config.Cfg.LeaderElectionFailoverMS, minLeaderFailover, config.DEFAULT_LEADER_FAILOVER_MS)
+		failover = time.Duration(config.DEFAULT_LEADER_FAILOVER_MS) * time.Millisecond
+	}
+	return &LeaderElector{
+		KubeClient: client,
+		LeaseName:  config.Cfg.LeaderElectionLease,
+		Namespace:  getPodNamespace(),
+		Identity:   identity,
+		Failover:   failover,
+	}
+}
+
+// Run blocks until this replica is elected, then calls lead. Lead's context is done when the leadership is lost or
+// the context of Run is canceled. Lead must then stop sending and return. The Lease is only released once lead
+// returns, so a standby can't take over while this replica still sends. When the leadership is lost, or the context
+// is canceled, onLost is called so the replica stops collecting. Exiting is the simplest way, the replica restarts
+// on standby. The new leader starts its informers and sends the complete state, which resyncs the aggregator with
+// what the former leader last sent.
+func (e *LeaderElector) Run(ctx context.Context, lead func(ctx context.Context), onLost func()) {
+	// The leader election releases the Lease when its context is canceled. Client-go requires the holder to stop
+	// all activity first, so it's only canceled once lead returned.
+	electionCtx, release := context.WithCancel(context.Background())
+	defer release()
+	var mutex sync.Mutex
+	leading := false
+	led := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-electionCtx.Done():
+			return
+		}
+		mutex.Lock()
+		wasLeading := leading
+		mutex.Unlock()
+		if wasLeading {
+			<-led
+		}
+		release()
+	}()
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Name: e.LeaseName, Namespace: e.Namespace},
+		Client:     e.KubeClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: e.Identity},
+	}
+	glog.Infof("Waiting to be elected leader with lease %s/%s as %s", e.Namespace, e.LeaseName, e.Identity)
+	leaderelection.RunOrDie(electionCtx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   e.Failover,
+		RenewDeadline:   e.Failover * 2 / 3,
+		RetryPeriod:     e.Failover / 5,
+		ReleaseOnCancel: true, // The standby takes over right away when the leader shuts down
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(electedCtx context.Context) {
+				mutex.Lock()
+				if ctx.Err() != nil { // Shutting down, the Lease is released without leading
+					mutex.Unlock()
+					return
+				}
+				leading = true
+				mutex.Unlock()
+				defer close(led)
+
+				glog.Infof("Elected leader with lease %s/%s", e.Namespace, e.LeaseName)
+				leadCtx, stopLeading := context.WithCancel(electedCtx)
+				defer stopLeading()
+				go func() {
+					select {
+					case <-ctx.Done():
+						stopLeading()
+					case <-leadCtx.Done():
+					}
+				}()
+				lead(leadCtx)
+			},
+			OnStoppedLeading: func() {
+				glog.Warningf("Lost the leadership of lease %s/%s", e.Namespace, e.LeaseName)
+				onLost()
+			},
+			OnNewLeader: func(identity string) {
+				if identity != e.Identity {
+					glog.Infof("Replica %s is the leader, waiting on standby", identity)
+				}
+			},
+		},
+	})
+}
@@ -0,0 +1,125 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package lease
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLeaderElectorRun(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	elector := LeaderElector{
+		KubeClient: client,
+		LeaseName:  "search-collector-leader",
+		Namespace:  namespace,
+		Identity:   "collector-0",
+		Failover:   time.Second,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	led := make(chan struct{})
+	lost := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		elector.Run(ctx, func(ctx context.Context) {
+			close(led)
+			<-ctx.Done()
+		}, func() { close(lost) })
+		close(done)
+	}()
+
+	select {
+	case <-led:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the only replica to be elected")
+	}
+	lease, err := client.CoordinationV1().Leases(namespace).Get(contextVar, "search-collector-leader", metav1.GetOptions{})
+	assert.Nil(t, err, "Expected no error: Got %v", err)
+	assert.Equal(t, "collector-0", *lease.Spec.HolderIdentity, "Expected the replica to hold the lease")
+
+	// Stopping releases the lease, so a standby doesn't wait for it to expire.
+	cancel()
+	select {
+	case <-lost:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the leadership to be lost once stopped")
+	}
+	<-done
+	lease, err = client.CoordinationV1().Leases(namespace).Get(contextVar, "search-collector-leader", metav1.GetOptions{})
+	assert.Nil(t, err, "Expected no error: Got %v", err)
+	assert.Equal(t, "", *lease.Spec.HolderIdentity, "Expected the lease to be released")
+}
+
+func TestNewLeaderElectorFailover(t *testing.T) {
+	defer func(failover int) { config.Cfg.LeaderElectionFailoverMS = failover }(config.Cfg.LeaderElectionFailoverMS)
+
+	config.Cfg.LeaderElectionFailoverMS = 0 // The leader election would panic
+	elector := NewLeaderElector(fake.NewSimpleClientset())
+	assert.Equal(t, time.Duration(config.DEFAULT_LEADER_FAILOVER_MS)*time.Millisecond, elector.Failover,
+		"Expected the default failover")
+
+	config.Cfg.LeaderElectionFailoverMS = 5000
+	elector = NewLeaderElector(fake.NewSimpleClientset())
+	assert.Equal(t, 5*time.Second, elector.Failover, "Expected the configured failover")
+}
+
+func TestLeaderElectorRunReleasesAfterLead(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	elector := LeaderElector{
+		KubeClient: client,
+		LeaseName:  "search-collector-leader",
+		Namespace:  namespace,
+		Identity:   "collector-0",
+		Failover:   time.Second,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	led := make(chan struct{})
+	stopping := make(chan struct{})
+	stopped := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		elector.Run(ctx, func(ctx context.Context) {
+			close(led)
+			<-ctx.Done()
+			close(stopping)
+			<-stopped // Still sending
+		}, func() {})
+		close(done)
+	}()
+
+	select {
+	case <-led:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the only replica to be elected")
+	}
+
+	// The lease is held until lead stopped, so a standby can't send at the same time.
+	cancel()
+	select {
+	case <-stopping:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected lead to be stopped once canceled")
+	}
+	time.Sleep(100 * time.Millisecond)
+	lease, err := client.CoordinationV1().Leases(namespace).Get(contextVar, "search-collector-leader", metav1.GetOptions{})
+	assert.Nil(t, err, "Expected no error: Got %v", err)
+	assert.Equal(t, "collector-0", *lease.Spec.HolderIdentity, "Expected the lease to be held until lead returns")
+
+	close(stopped)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Run to return once lead stopped")
+	}
+	lease, err = client.CoordinationV1().Leases(namespace).Get(contextVar, "search-collector-leader", metav1.GetOptions{})
+	assert.Nil(t, err, "Expected no error: Got %v", err)
+	assert.Equal(t, "", *lease.Spec.HolderIdentity, "Expected the lease to be released")
+}
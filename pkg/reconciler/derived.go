@@ -0,0 +1,73 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package reconciler
+
+import (
+	"reflect"
+
+	tr "github.com/stolostron/search-collector/pkg/transforms"
+)
+
+// Sets the properties computed from the other nodes, like the owner chain of the pods, on the current nodes. The
+// nodes whose derived properties changed are added to the diff, so they're sent like any other update.
+// Called before the nodes are diffed, with the store of the current nodes. The store is updated with the nodes
+// that changed, so it can be used to build the edges. Lock must be held.
+func (r *Reconciler) deriveProperties(ns tr.NodeStore) {
+	ds := tr.NewDeriveStore(ns)
+	for _, node := range r.currentNodes {
+		derived := tr.DeriveProperties(node, ds)
+		if derived == nil {
+			continue
+		}
+		kind, _ := node.Properties["kind"].(string)
+		names := tr.DerivedPropertyNames(kind)
+		changed := false
+		for _, name := range names {
+			current, inNode := node.Properties[name]
+			value, inDerived := derived[name]
+			if inNode != inDerived || !reflect.DeepEqual(current, value) {
+				changed = true
+				break
+			}
+		}
+		if !changed {
+			continue
+		}
+		// The properties can be shared with the previous node, so they're copied instead of modified.
+		properties := make(map[string]interface{}, len(node.Properties)+len(derived))
+		for name, value := range node.Properties {
+			properties[name] = value
+		}
+		for _, name := range names {
+			delete(properties, name) // A property no longer derived, like a percent without the allocatable
+		}
+		for name, value := range derived {
+			properties[name] = value
+		}
+		node.Properties = properties
+		r.updateCurrentNode(node)
+		setTripleMapNode(ns.ByKindNamespaceName, node)
+	}
+}
+
+// Returns the node with the derived properties of the current node of the same UID, so an update of the resource
+// isn't sent only because they aren't computed yet. They're recomputed before the next diff. Lock must be held.
+func (r *Reconciler) withDerivedProperties(node tr.Node) tr.Node {
+	kind, _ := node.Properties["kind"].(string)
+	names := tr.DerivedPropertyNames(kind)
+	current, ok := r.currentNodes[node.UID]
+	if len(names) == 0 || !ok {
+		return node
+	}
+	properties := make(map[string]interface{}, len(node.Properties)+len(names))
+	for name, value := range node.Properties {
+		properties[name] = value
+	}
+	for _, name := range names {
+		if value, ok := current.Properties[name]; ok {
+			properties[name] = value
+		}
+	}
+	node.Properties = properties
+	return node
+}
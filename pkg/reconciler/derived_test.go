@@ -0,0 +1,109 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package reconciler
+
+import (
+	"testing"
+	"time"
+
+	tr "github.com/stolostron/search-collector/pkg/transforms"
+)
+
+func TestReconcilerDerivedProperties(t *testing.T) {
+	testReconciler := initTestReconciler()
+	now := time.Now().Unix()
+	reconcile := func(ne tr.NodeEvent) {
+		go func() { testReconciler.Input <- ne }()
+		testReconciler.reconcileNode()
+	}
+	noEdges := func(ns tr.NodeStore) []tr.Edge { return []tr.Edge{} }
+	replicaSet := tr.NodeEvent{Time: now, Operation: tr.Create, ComputeEdges: noEdges, Node: tr.Node{
+		UID:        "local-cluster/replicaset-uid",
+		Properties: map[string]interface{}{"kind": "ReplicaSet", "namespace": "default", "name": "web"},
+		Metadata:   map[string]string{}}}
+	pod := tr.NodeEvent{Time: now, Operation: tr.Create, ComputeEdges: noEdges, Node: tr.Node{
+		UID:        "local-cluster/pod-uid",
+		Properties: map[string]interface{}{"kind": "Pod", "namespace": "default", "name": "web-1"},
+		Metadata:   map[string]string{"OwnerUID": replicaSet.UID, "ControllerUID": replicaSet.UID}}}
+	reconcile(replicaSet)
+	reconcile(pod)
+
+	diff := testReconciler.Diff()
+	for _, node := range diff.AddNodes {
+		if node.UID == pod.UID && (node.Properties["_ownerDepth"] != int64(1) ||
+			node.Properties["_orphanedController"] != false) {
+			t.Fatalf("Expected the pod to be sent with its owner chain, got %v", node.Properties)
+		}
+	}
+
+	// An update of the pod keeps the derived properties, and is skipped when nothing else changed.
+	pod.Time = now + 1
+	reconcile(pod)
+	if diff := testReconciler.Diff(); len(diff.UpdateNodes) != 0 {
+		t.Fatalf("Expected no update of the pod, got %v", diff.UpdateNodes)
+	}
+
+	// The pod is sent again once its controller is deleted, not only when the pod changes.
+	reconcile(tr.NodeEvent{Time: now + 2, Operation: tr.Delete, Node: tr.Node{UID: replicaSet.UID}})
+	diff = testReconciler.Diff()
+	if len(diff.UpdateNodes) != 1 || diff.UpdateNodes[0].Properties["_orphanedController"] != true {
+		t.Fatalf("Expected the pod to be updated as orphaned, got %v", diff.UpdateNodes)
+	}
+	if pod.Node.Properties["_orphanedController"] != nil {
+		t.Fatal("Expected the node of the event to be left unchanged")
+	}
+}
+
+func TestReconcilerDerivedPropertiesStore(t *testing.T) {
+	testReconciler := initTestReconciler()
+	go func() {
+		testReconciler.Input <- tr.NodeEvent{Time: time.Now().Unix(), Operation: tr.Create,
+			ComputeEdges: func(ns tr.NodeStore) []tr.Edge { return []tr.Edge{} }, Node: tr.Node{
+				UID:        "local-cluster/pod-uid",
+				Properties: map[string]interface{}{"kind": "Pod", "namespace": "default", "name": "web-1"},
+				Metadata:   map[string]string{}}}
+	}()
+	testReconciler.reconcileNode()
+
+	// The edges are built from the same store, so it has the nodes with their derived properties.
+	ns := testReconciler.nodeStore()
+	testReconciler.deriveProperties(ns)
+	if depth := ns.ByKindNamespaceName["Pod"]["default"]["web-1"].Properties["_ownerDepth"]; depth != int64(0) {
+		t.Fatalf("Expected the store to have the derived properties, got %v", depth)
+	}
+}
+
+func TestReconcilerDerivedRollup(t *testing.T) {
+	testReconciler := initTestReconciler()
+	now := time.Now().Unix()
+	reconcile := func(ne tr.NodeEvent) {
+		go func() { testReconciler.Input <- ne }()
+		testReconciler.reconcileNode()
+	}
+	noEdges := func(ns tr.NodeStore) []tr.Edge { return []tr.Edge{} }
+	reconcile(tr.NodeEvent{Time: now, Operation: tr.Create, ComputeEdges: noEdges, Node: tr.Node{
+		UID:        "local-cluster/node-uid",
+		Properties: map[string]interface{}{"kind": "Node", "name": "worker-1"}}})
+	pod := tr.NodeEvent{Time: now, Operation: tr.Create, ComputeEdges: noEdges, Node: tr.Node{
+		UID: "local-cluster/pod-uid",
+		Properties: map[string]interface{}{"kind": "Pod", "namespace": "default", "name": "web-1",
+			"_nodeName": "worker-1", "_oomKilledContainers": int64(0)}}}
+	reconcile(pod)
+	testReconciler.Diff()
+
+	// The node is sent again when a pod running on it is OOM killed.
+	pod.Time = now + 1
+	pod.Node.Properties = map[string]interface{}{"kind": "Pod", "namespace": "default", "name": "web-1",
+		"_nodeName": "worker-1", "_oomKilledContainers": int64(1)}
+	reconcile(pod)
+	diff := testReconciler.Diff()
+	for _, node := range diff.UpdateNodes {
+		if node.UID == "local-cluster/node-uid" {
+			if node.Properties["_oomKills"] != int64(1) {
+				t.Fatalf("Expected the node to be updated with the OOM kill, got %v", node.Properties)
+			}
+			return
+		}
+	}
+	t.Fatalf("Expected the node to be updated, got %v", diff.UpdateNodes)
+}
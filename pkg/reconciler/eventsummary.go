@@ -0,0 +1,154 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package reconciler
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/golang/glog"
+	tr "github.com/stolostron/search-collector/pkg/transforms"
+)
+
+// Properties the event summary adds to the node of the involved object.
+var eventSummaryProperties = []string{"eventCount", "eventReasons", "lastEventTimestamp", "lastWarningMessage"}
+
+// Max number of events kept for the summaries. When it's reached, the events of the objects that aren't collected,
+// like the objects of denied kinds, are dropped.
+const summarizedEventsMax = 100000
+
+// Keeps the Event node to summarize it onto the node of its involved object, instead of sending it.
+// Updates the involved object's node when it's already collected. Lock must be held.
+func (r *Reconciler) summarizeEvent(ne tr.NodeEvent) {
+	involvedUID, _ := ne.Node.Properties["_involvedObjectUID"].(string)
+	if involvedUID == "" {
+		return
+	}
+	// Don't keep the events of an object deleted after them, nor the events deleted already.
+	for _, uid := range []string{involvedUID, ne.UID} {
+		if purged, ok := r.purgedNodes.Get(uid); ok && purged.(tr.NodeEvent).Time >= ne.Time {
+			return
+		}
+	}
+	if _, collected := r.currentNodes[involvedUID]; !collected && len(r.summarizedEvents) >= summarizedEventsMax {
+		r.pruneOrphanEvents()
+		if len(r.summarizedEvents) >= summarizedEventsMax {
+			glog.V(3).Infof("Dropping event %s, too many events of objects that aren't collected", ne.UID)
+			return
+		}
+	}
+	events, ok := r.eventSummaries[involvedUID]
+	if !ok {
+		events = map[string]tr.NodeEvent{}
+		r.eventSummaries[involvedUID] = events
+	}
+	if summarized, ok := events[ne.UID]; ok && summarized.Time > ne.Time {
+		return
+	}
+	events[ne.UID] = ne
+	r.summarizedEvents[ne.UID] = involvedUID
+	r.updateEventSummary(involvedUID)
+}
+
+// Removes the deleted event from the summary of its involved object. Returns false if the event isn't summarized.
+// Lock must be held.
+func (r *Reconciler) forgetEvent(ne tr.NodeEvent) bool {
+	involvedUID, ok := r.summarizedEvents[ne.UID]
+	if !ok {
+		return false
+	}
+	r.purgedNodes.Add(ne.UID, ne)
+	delete(r.summarizedEvents, ne.UID)
+	delete(r.eventSummaries[involvedUID], ne.UID)
+	if len(r.eventSummaries[involvedUID]) == 0 {
+		delete(r.eventSummaries, involvedUID)
+	}
+	r.updateEventSummary(involvedUID)
+	return true
+}
+
+// Drops the events of a deleted object. Lock must be held.
+func (r *Reconciler) forgetObjectEvents(involvedUID string) {
+	for uid := range r.eventSummaries[involvedUID] {
+		delete(r.summarizedEvents, uid)
+	}
+	delete(r.eventSummaries, involvedUID)
+}
+
+// Drops the events of the objects that aren't collected. Lock must be held.
+func (r *Reconciler) pruneOrphanEvents() {
+	for involvedUID := range r.eventSummaries {
+		if _, collected := r.currentNodes[involvedUID]; !collected {
+			r.forgetObjectEvents(involvedUID)
+		}
+	}
+}
+
+// Applies the summary of the events to the node of the object, when it's collected, and adds the node to the diff
+// if the summary changed. Lock must be held.
+func (r *Reconciler) updateEventSummary(involvedUID string) {
+	node, ok := r.currentNodes[involvedUID]
+	if !ok {
+		return // The summary is added when the involved object is collected.
+	}
+	node = r.withEventSummary(node)
+	if reflect.DeepEqual(node.Properties, r.currentNodes[involvedUID].Properties) {
+		return
+	}
+	r.updateCurrentNode(node)
+}
+
+// Returns a copy of the node with the summary of the events of the object: the total count, the count of each
+// reason, and the time and message of the latest events. Lock must be held.
+func (r *Reconciler) withEventSummary(node tr.Node) tr.Node {
+	properties := make(map[string]interface{}, len(node.Properties)+len(eventSummaryProperties))
+	for key, value := range node.Properties {
+		properties[key] = value
+	}
+	for _, key := range eventSummaryProperties {
+		delete(properties, key)
+	}
+	node.Properties = properties
+
+	events := r.eventSummaries[node.UID]
+	if len(events) == 0 {
+		return node
+	}
+	var total int64
+	var lastTimestamp, lastWarningTimestamp, lastWarningMessage string
+	counts := map[string]int64{}
+	for _, ne := range events {
+		reason, _ := ne.Node.Properties["reason"].(string)
+		count, _ := ne.Node.Properties["count"].(int64)
+		counts[reason] += count
+		total += count
+		// The timestamps are RFC3339 in UTC, so they sort as strings.
+		timestamp, _ := ne.Node.Properties["lastTimestamp"].(string)
+		if timestamp > lastTimestamp {
+			lastTimestamp = timestamp
+		}
+		message, _ := ne.Node.Properties["message"].(string)
+		// Ties are broken by the message, so the summary doesn't change between builds.
+		if ne.Node.Properties["type"] == "Warning" && (timestamp > lastWarningTimestamp ||
+			timestamp == lastWarningTimestamp && message > lastWarningMessage) {
+			lastWarningTimestamp = timestamp
+			lastWarningMessage = message
+		}
+	}
+	reasons := make([]string, 0, len(counts))
+	for reason, count := range counts {
+		reasons = append(reasons, reason+"="+strconv.FormatInt(count, 10))
+	}
+	sort.Strings(reasons)
+
+	properties["eventCount"] = total
+	properties["eventReasons"] = reasons
+	if lastTimestamp != "" {
+		properties["lastEventTimestamp"] = lastTimestamp
+	}
+	if lastWarningMessage != "" {
+		properties["lastWarningMessage"] = lastWarningMessage
+	}
+	return node
+}
@@ -0,0 +1,119 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package reconciler
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	tr "github.com/stolostron/search-collector/pkg/transforms"
+)
+
+func eventNodeEvent(uid, reason, eventType, message, timestamp string, count int64, at int64) tr.NodeEvent {
+	return tr.NodeEvent{
+		Time:      at,
+		Operation: tr.Create,
+		Node: tr.Node{UID: uid, Properties: map[string]interface{}{
+			"kind": "Event", "reason": reason, "type": eventType, "message": message, "lastTimestamp": timestamp,
+			"count": count, "_involvedObjectUID": "local-cluster/pod-uid"}},
+		ComputeEdges: func(ns tr.NodeStore) []tr.Edge { return []tr.Edge{} },
+	}
+}
+
+func TestReconcilerEventSummary(t *testing.T) {
+	config.Cfg.EventSummary = true
+	defer func() { config.Cfg.EventSummary = false }()
+	testReconciler := initTestReconciler()
+	now := time.Now().Unix()
+
+	reconcile := func(ne tr.NodeEvent) {
+		go func() { testReconciler.Input <- ne }()
+		testReconciler.reconcileNode()
+	}
+
+	// An event received before its involved object is summarized once the object is collected.
+	reconcile(eventNodeEvent("local-cluster/Event/pod-uid/BackOff", "BackOff", "Warning", "Back-off restarting",
+		"2022-06-01T10:00:00Z", 3, now))
+	pod := tr.NodeEvent{
+		Time:         now + 1,
+		Operation:    tr.Create,
+		Node:         tr.Node{UID: "local-cluster/pod-uid", Properties: map[string]interface{}{"kind": "Pod", "name": "p"}},
+		ComputeEdges: func(ns tr.NodeStore) []tr.Edge { return []tr.Edge{} },
+	}
+	reconcile(pod)
+	if _, ok := testReconciler.currentNodes["local-cluster/Event/pod-uid/BackOff"]; ok {
+		t.Fatal("Expected the summarized event not to be a node")
+	}
+	diff := testReconciler.Diff()
+	if len(diff.AddNodes) != 1 || diff.AddNodes[0].Properties["eventCount"] != int64(3) {
+		t.Fatalf("Expected the pod with the event summary, got %v", diff.AddNodes)
+	}
+
+	// A later event updates the pod.
+	reconcile(eventNodeEvent("local-cluster/Event/pod-uid/Pulled", "Pulled", "Normal", "Image pulled",
+		"2022-06-01T10:05:00Z", 2, now+2))
+	diff = testReconciler.Diff()
+	if len(diff.UpdateNodes) != 1 {
+		t.Fatalf("Expected the pod to be updated, got %v", diff)
+	}
+	properties := diff.UpdateNodes[0].Properties
+	if properties["eventCount"] != int64(5) ||
+		!reflect.DeepEqual(properties["eventReasons"], []string{"BackOff=3", "Pulled=2"}) ||
+		properties["lastEventTimestamp"] != "2022-06-01T10:05:00Z" ||
+		properties["lastWarningMessage"] != "Back-off restarting" {
+		t.Fatalf("Unexpected event summary %v", properties)
+	}
+
+	// An update of the pod keeps the summary, and is skipped when nothing else changed.
+	pod.Time = now + 3
+	reconcile(pod)
+	if properties := testReconciler.currentNodes[pod.UID].Properties; properties["eventCount"] != int64(5) {
+		t.Fatalf("Expected the pod to keep the event summary, got %v", properties)
+	}
+	if diff := testReconciler.Diff(); len(diff.UpdateNodes) != 0 {
+		t.Fatalf("Expected no update of the pod, got %v", diff.UpdateNodes)
+	}
+
+	// A deleted event no longer counts.
+	reconcile(tr.NodeEvent{Time: now + 4, Operation: tr.Delete, Node: tr.Node{UID: "local-cluster/Event/pod-uid/Pulled"}})
+	diff = testReconciler.Diff()
+	if len(diff.UpdateNodes) != 1 || diff.UpdateNodes[0].Properties["eventCount"] != int64(3) ||
+		!reflect.DeepEqual(diff.UpdateNodes[0].Properties["eventReasons"], []string{"BackOff=3"}) {
+		t.Fatalf("Expected the pod to be updated without the deleted event, got %v", diff.UpdateNodes)
+	}
+	if len(diff.DeleteNodes) != 0 {
+		t.Fatalf("Expected no deleted node for the summarized event, got %v", diff.DeleteNodes)
+	}
+
+	// Deleting the pod drops its events.
+	reconcile(tr.NodeEvent{Time: now + 5, Operation: tr.Delete, Node: tr.Node{UID: pod.UID}})
+	if len(testReconciler.eventSummaries) != 0 || len(testReconciler.summarizedEvents) != 0 {
+		t.Fatalf("Expected the events of the pod to be dropped, got %v", testReconciler.eventSummaries)
+	}
+}
+
+func TestReconcilerEventSummaryOrphans(t *testing.T) {
+	config.Cfg.EventSummary = true
+	defer func() { config.Cfg.EventSummary = false }()
+	testReconciler := initTestReconciler()
+
+	// The events of objects that aren't collected are dropped once there are too many.
+	orphans := map[string]tr.NodeEvent{}
+	for i := 0; i < summarizedEventsMax; i++ {
+		uid := fmt.Sprintf("local-cluster/event-%d", i)
+		orphans[uid] = tr.NodeEvent{}
+		testReconciler.summarizedEvents[uid] = "local-cluster/denied-uid"
+	}
+	testReconciler.eventSummaries["local-cluster/denied-uid"] = orphans
+	go func() {
+		testReconciler.Input <- eventNodeEvent("local-cluster/Event/pod-uid/BackOff", "BackOff", "Warning", "Back-off",
+			"2022-06-01T10:00:00Z", 1, time.Now().Unix())
+	}()
+	testReconciler.reconcileNode()
+	if len(testReconciler.summarizedEvents) != 1 || len(testReconciler.eventSummaries) != 1 {
+		t.Fatalf("Expected the orphan events to be pruned, got %d events", len(testReconciler.summarizedEvents))
+	}
+}
@@ -14,9 +14,11 @@ package reconciler
 import (
 	"reflect"
 	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	lru "github.com/golang/groupcache/lru"
+	"github.com/stolostron/search-collector/pkg/config"
 	tr "github.com/stolostron/search-collector/pkg/transforms"
 )
 
@@ -30,6 +32,7 @@ type CompleteState struct {
 	Nodes                  []tr.Node // All the nodes
 	Edges                  []tr.Edge // All the edges
 	TotalNodes, TotalEdges int
+	StoreHash              string // Hash of the nodes, see storeHashString
 }
 
 // Public type for the diff state of the system since the previous.
@@ -40,6 +43,7 @@ type Diff struct {
 	DeleteNodes            []tr.Deletion // UIDs of nodes to be deleted
 	AddEdges, DeleteEdges  []tr.Edge     // Edges to be added or deleted
 	TotalNodes, TotalEdges int
+	StoreHash              string // Hash of the nodes once the diff is applied, see storeHashString
 }
 
 // Create mapping with kind, namespace, and name as keys, and the Node itself as the value.
@@ -47,28 +51,39 @@ func nodeTripleMap(allNodes map[string]tr.Node) map[string]map[string]map[string
 
 	nodeMap := map[string]map[string]map[string]tr.Node{}
 	for _, n := range allNodes {
-		kind := n.Properties["kind"].(string) // blindly assert to string - it's always string
-		namespace := ""
-		if _, ok := n.Properties["namespace"]; !ok {
-			namespace = "_NONE"
-		} else {
-			namespace = n.Properties["namespace"].(string)
-		}
-		// Initialize nodeMap for 'kind' if it doesn't exist already for that kind
-		if _, ok := nodeMap[kind]; !ok {
-			nodeMap[kind] = map[string]map[string]tr.Node{}
-		}
-		if _, ok := nodeMap[kind][namespace]; !ok {
-			nodeMap[kind][namespace] = map[string]tr.Node{}
-		}
-		// Insert the name and uid mapping into nodeMap
-		if name, ok := n.Properties["name"].(string); ok {
-			nodeMap[kind][namespace][name] = n
-		}
+		setTripleMapNode(nodeMap, n)
 	}
 	return nodeMap
 }
 
+// Inserts the node into the mapping built by nodeTripleMap, replacing the node of the same kind, namespace and name.
+func setTripleMapNode(nodeMap map[string]map[string]map[string]tr.Node, n tr.Node) {
+	kind := n.Properties["kind"].(string) // blindly assert to string - it's always string
+	namespace := ""
+	if _, ok := n.Properties["namespace"]; !ok {
+		namespace = "_NONE"
+	} else {
+		namespace = n.Properties["namespace"].(string)
+	}
+	// Initialize nodeMap for 'kind' if it doesn't exist already for that kind
+	if _, ok := nodeMap[kind]; !ok {
+		nodeMap[kind] = map[string]map[string]tr.Node{}
+	}
+	if _, ok := nodeMap[kind][namespace]; !ok {
+		nodeMap[kind][namespace] = map[string]tr.Node{}
+	}
+	// Insert the name and uid mapping into nodeMap
+	if name, ok := n.Properties["name"].(string); ok {
+		nodeMap[kind][namespace][name] = n
+	}
+}
+
+// Returns the store of the current nodes. Build it once for each diff, the mapping by kind, namespace and name
+// loops over every node. Lock must be held.
+func (r *Reconciler) nodeStore() tr.NodeStore {
+	return tr.NodeStore{ByUID: r.currentNodes, ByKindNamespaceName: nodeTripleMap(r.currentNodes)}
+}
+
 // This object tracks and stores resources, and can regurgitate diffs based on the last time it was asked.
 type Reconciler struct {
 	currentNodes       map[string]tr.Node                         // Keyed by UID
@@ -76,10 +91,17 @@ type Reconciler struct {
 	diffNodes          map[string]tr.NodeEvent                    // Keyed by UID
 	k8sEventNodes      map[string]tr.NodeEvent                    // Keyed by UID
 	previousEventEdges map[string]tr.Edge                         // Keyed by UID
+	eventSummaries     map[string]map[string]tr.NodeEvent         // Keyed by involved object UID, then event UID
+	summarizedEvents   map[string]string                          // Involved object UID, keyed by event UID
+	dependents         map[string]map[string]struct{}             // Dependent node UIDs, keyed by the UID they depend on
 	edgeFuncs          map[string]func(ns tr.NodeStore) []tr.Edge // Edge building functions, keyed by UID
 
 	previousEdges map[string]map[string]tr.Edge // Keyed by source then dest so we can quickly compare the new list
 	totalEdges    int                           // Save the total count as we build to avoid looping when needed
+	pendingEdges  map[string]time.Time          // When each edge deferred for a missing endpoint was first seen
+
+	storeHashes map[string]uint64 // Hash of each node as it was last diffed, keyed by UID
+	storeHash   uint64            // Sum of storeHashes, modulo 2^64
 
 	Input       chan tr.NodeEvent
 	mutex       sync.Mutex // Used to protect currentState and diffState as they are accessed by multiple goroutines
@@ -94,7 +116,12 @@ func NewReconciler() *Reconciler {
 		diffNodes:          make(map[string]tr.NodeEvent),
 		k8sEventNodes:      make(map[string]tr.NodeEvent),
 		previousEventEdges: make(map[string]tr.Edge),
+		eventSummaries:     make(map[string]map[string]tr.NodeEvent),
+		summarizedEvents:   make(map[string]string),
+		dependents:         make(map[string]map[string]struct{}),
 		edgeFuncs:          make(map[string]func(ns tr.NodeStore) []tr.Edge),
+		pendingEdges:       make(map[string]time.Time),
+		storeHashes:        make(map[string]uint64),
 
 		mutex:       sync.Mutex{},
 		purgedNodes: lru.New(CACHE_SIZE),
@@ -111,21 +138,28 @@ func (r *Reconciler) Diff() Diff {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
+	ns := r.nodeStore()
+	r.deriveProperties(ns)
 	ret := Diff{}
 
 	// Fill out nodes
 	for _, ne := range r.diffNodes {
 		if ne.Operation == tr.Create {
-			ret.AddNodes = append(ret.AddNodes, ne.Node)
+			output := tr.OutputNode(ne.Node)
+			r.hashStoreNode(output)
+			ret.AddNodes = append(ret.AddNodes, output)
 		} else if ne.Operation == tr.Update {
-			ret.UpdateNodes = append(ret.UpdateNodes, ne.Node)
+			output := tr.OutputNode(ne.Node)
+			r.hashStoreNode(output)
+			ret.UpdateNodes = append(ret.UpdateNodes, output)
 		} else if ne.Operation == tr.Delete {
-			ret.DeleteNodes = append(ret.DeleteNodes, tr.Deletion{UID: ne.UID})
+			r.unhashStoreNode(ne.UID)
+			ret.DeleteNodes = append(ret.DeleteNodes, tr.NewDeletion(ne.UID))
 		}
 	}
 
 	// Fill out edges
-	newEdges := r.allEdges()
+	newEdges := r.allEdges(ns)
 
 	// TODO combine the following 2 loops?
 
@@ -182,6 +216,7 @@ func (r *Reconciler) Diff() Diff {
 
 	ret.TotalNodes = len(r.currentNodes)
 	ret.TotalEdges = r.totalEdges
+	ret.StoreHash = r.storeHashString()
 	return ret
 }
 
@@ -190,16 +225,19 @@ func (r *Reconciler) Complete() CompleteState {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
+	ns := r.nodeStore()
+	r.deriveProperties(ns)
 	allNodes := make([]tr.Node, 0, len(r.currentNodes)) // We know the size ahead of time
 	for _, n := range r.currentNodes {
-		allNodes = append(allNodes, n)
+		allNodes = append(allNodes, tr.OutputNode(n))
 	}
 
 	ret := CompleteState{
 		Nodes: allNodes,
 	}
+	r.rehashStore(allNodes)
 
-	newEdges := r.allEdges()
+	newEdges := r.allEdges(ns)
 
 	// Coerce to array
 	for _, destMap := range newEdges {
@@ -216,20 +254,16 @@ func (r *Reconciler) Complete() CompleteState {
 
 	ret.TotalNodes = len(r.currentNodes)
 	ret.TotalEdges = r.totalEdges
+	ret.StoreHash = r.storeHashString()
 	return ret
 }
 
 // Builds all edges for all the nodes.
 // Keyed by srcUID then destUID for fast comparison with previous.
 // This function reads from the state, locking left up to caller (complete and diff methods)
-func (r *Reconciler) allEdges() map[string]map[string]tr.Edge {
+func (r *Reconciler) allEdges(ns tr.NodeStore) map[string]map[string]tr.Edge {
 	ret := make(map[string]map[string]tr.Edge)
 
-	ns := tr.NodeStore{
-		ByUID:               r.currentNodes,
-		ByKindNamespaceName: nodeTripleMap(r.currentNodes),
-	}
-
 	// After building the nodestore, get all the application UIDs in appUIDs and others in otherUIDs.
 	// Process the application nodes first while building edges so that _hostingApplication metadata
 	// gets populated for subscription nodes
@@ -253,12 +287,20 @@ func (r *Reconciler) allEdges() map[string]map[string]tr.Edge {
 	otherUIDs := tr.SliceDiff(allUIDs, appUIDs)
 
 	// Loop across all the nodes and build their edges.
+	seenPending := make(map[string]struct{})
 	for _, uid := range append(appUIDs, otherUIDs...) {
 		glog.V(5).Infof("Calculating edges UID: %s", uid)
 		edges := r.edgeFuncs[uid](ns) // Get edges from this specific node
 
 		edges = append(edges, tr.CommonEdges(uid, ns)...) // Get common edges for this node
 		for _, edge := range edges {
+			// The destination of a remote edge is never collected here, it's in another cluster.
+			if config.Cfg.DeferDanglingEdges && !tr.IsRemoteEdge(edge) && r.deferEdge(edge, seenPending) {
+				continue
+			}
+			if config.Cfg.EdgeDirection {
+				tr.SetEdgeDirection(&edge)
+			}
 			if _, ok := ret[edge.SourceUID]; !ok { // Init if it's not there
 				ret[edge.SourceUID] = make(map[string]tr.Edge)
 			}
@@ -266,6 +308,17 @@ func (r *Reconciler) allEdges() map[string]map[string]tr.Edge {
 		}
 	}
 
+	if config.Cfg.DedupSymmetricEdges {
+		dedupSymmetricEdges(ret)
+	}
+
+	// Edges that weren't built this time don't need to wait anymore.
+	for key := range r.pendingEdges {
+		if _, ok := seenPending[key]; !ok {
+			delete(r.pendingEdges, key)
+		}
+	}
+
 	totalEdges := 0
 	// loop over double map to get the total number we added
 	for _, destUID := range ret {
@@ -276,6 +329,135 @@ func (r *Reconciler) allEdges() map[string]map[string]tr.Edge {
 	return ret
 }
 
+// Removes the second direction of the symmetric edges built from both of their nodes, keeping the edge whose
+// source has the lower UID. Picking by UID keeps the same edge on every diff, so it isn't deleted and added back.
+func dedupSymmetricEdges(edges map[string]map[string]tr.Edge) {
+	for srcUID, destMap := range edges {
+		for destUID, edge := range destMap {
+			if srcUID <= destUID || !tr.IsSymmetricEdge(edge) {
+				continue
+			}
+			if reverse, ok := edges[destUID][srcUID]; ok && reverse.EdgeType == edge.EdgeType &&
+				tr.IsSymmetricEdge(reverse) {
+				delete(destMap, destUID)
+			}
+		}
+		if len(destMap) == 0 {
+			delete(edges, srcUID)
+		}
+	}
+}
+
+// Returns true if the edge must be held back because one of its endpoints isn't in the current nodes yet.
+// Edges are rebuilt from the current nodes on every diff, so a held back edge is retried when its endpoint arrives.
+// The edge is emitted anyway, dangling, once it has waited longer than PendingEdgeTTLMS or if PendingEdgesMax
+// edges are already waiting, because its endpoint may be a kind that is never collected.
+func (r *Reconciler) deferEdge(edge tr.Edge, seenPending map[string]struct{}) bool {
+	_, srcFound := r.currentNodes[edge.SourceUID]
+	_, destFound := r.currentNodes[edge.DestUID]
+	if srcFound && destFound {
+		return false
+	}
+	if r.pendingEdges == nil {
+		r.pendingEdges = make(map[string]time.Time)
+	}
+
+	key := edge.SourceUID + "/" + string(edge.EdgeType) + "/" + edge.DestUID
+	since, ok := r.pendingEdges[key]
+	if !ok {
+		if len(r.pendingEdges) >= config.Cfg.PendingEdgesMax {
+			glog.V(3).Infof("Too many pending edges, not deferring edge %s", key)
+			return false
+		}
+		since = time.Now()
+		r.pendingEdges[key] = since
+	}
+	seenPending[key] = struct{}{}
+
+	if time.Since(since) > time.Duration(config.Cfg.PendingEdgeTTLMS)*time.Millisecond {
+		glog.V(3).Infof("Pending edge %s expired, sending it without its endpoint", key)
+		return false
+	}
+	return true
+}
+
+// Replaces the current node with a copy the reconciler changed, and adds it to the diff. Lock must be held.
+func (r *Reconciler) updateCurrentNode(node tr.Node) {
+	r.setCurrentNode(node)
+
+	// Keep the time of the pending diff, so the next update of the node isn't taken as out of order.
+	diff, inDiff := r.diffNodes[node.UID]
+	if !inDiff {
+		diff.Operation = tr.Create
+		if _, inPrevious := r.previousNodes[node.UID]; inPrevious {
+			diff.Operation = tr.Update
+		}
+	}
+	diff.Node = node
+	diff.ComputeEdges = r.edgeFuncs[node.UID]
+	r.diffNodes[node.UID] = diff
+}
+
+// Sets the node in the current state, and indexes it by the nodes it depends on. Lock must be held.
+func (r *Reconciler) setCurrentNode(node tr.Node) {
+	r.unindexDependent(node.UID)
+	r.currentNodes[node.UID] = node
+	for _, parent := range tr.DependentNodeParents(node) {
+		if _, ok := r.dependents[parent]; !ok {
+			r.dependents[parent] = map[string]struct{}{}
+		}
+		r.dependents[parent][node.UID] = struct{}{}
+	}
+}
+
+// Removes the current node of the UID from the index of the nodes it depends on. Lock must be held.
+func (r *Reconciler) unindexDependent(uid string) {
+	current, ok := r.currentNodes[uid]
+	if !ok {
+		return
+	}
+	for _, parent := range tr.DependentNodeParents(current) {
+		delete(r.dependents[parent], uid)
+		if len(r.dependents[parent]) == 0 {
+			delete(r.dependents, parent)
+		}
+	}
+}
+
+// Removes the node from the current state, and adds a deletion diff if it was sent before. Lock must be held.
+func (r *Reconciler) deleteNode(ne tr.NodeEvent, inPrevious bool) {
+	r.unindexDependent(ne.UID)
+	delete(r.currentNodes, ne.UID) // Get rid of it from our currentState, if it was ever there.
+	delete(r.edgeFuncs, ne.UID)
+	r.purgedNodes.Add(ne.UID, ne) // Add this to the list of node purged resources
+
+	if inPrevious {
+		r.diffNodes[ne.UID] = ne // Since it was in the previous, we need to have a deletion diff.
+	} else {
+		delete(r.diffNodes, ne.UID) // Otherwise no need to send a payload, just remove from local memory
+	}
+}
+
+// Deletes the node of a resource, along with the nodes that depend on it.
+func (r *Reconciler) deleteResource(ne tr.NodeEvent, inPrevious bool) {
+	deletedApplication, _ := r.currentNodes[ne.UID].Properties["_labelApplication"].(string)
+	r.deleteNode(ne, inPrevious)
+	r.forgetObjectEvents(ne.UID)
+	if config.Cfg.LabelApplications && deletedApplication != "" {
+		r.pruneLabelApplication(deletedApplication, ne.Time)
+	}
+	if config.Cfg.CoalesceEvents || config.Cfg.ContainerNodes || config.Cfg.SummaryNodes ||
+		config.Cfg.HelmReleases {
+		// The coalesced event, container, summary and Helm release nodes don't have informers, they are deleted
+		// with their resource.
+		for uid := range r.dependents[ne.UID] {
+			_, dependentInPrevious := r.previousNodes[uid]
+			r.deleteNode(tr.NodeEvent{Node: tr.Node{UID: uid}, Time: ne.Time, Operation: tr.Delete},
+				dependentInPrevious)
+		}
+	}
+}
+
 // This method takes a channel and constantly receives from it, reconciling the input with whatever is currently stored
 func (r *Reconciler) receive() {
 	glog.Info("Reconciler Routine Started")
@@ -311,19 +493,38 @@ func (r *Reconciler) reconcileNode() {
 		}
 	}
 
+	// Summarized events are added to the node of their involved object instead. The deletes only have the UID.
+	if config.Cfg.EventSummary {
+		if ne.Operation == tr.Delete && r.forgetEvent(ne) {
+			return
+		}
+		if ne.Operation != tr.Delete && ne.Node.Properties["kind"] == "Event" {
+			r.summarizeEvent(ne)
+			return
+		}
+	}
+
 	previousNode, inPrevious := r.previousNodes[ne.Node.UID]
 
 	if ne.Operation == tr.Delete {
-		delete(r.currentNodes, ne.UID) // Get rid of it from our currentState, if it was ever there.
-		delete(r.edgeFuncs, ne.UID)
-		r.purgedNodes.Add(ne.UID, ne) // Add this to the list of node purged resources
-
-		if inPrevious {
-			r.diffNodes[ne.UID] = ne // Since it was in the previous, we need to have a deletion diff.
-		} else {
-			delete(r.diffNodes, ne.UID) // Otherwise no need to send a payload, just remove from local memory
+		// Delete events of the resources in a namespace can be missed during the cascade, they're deleted with it.
+		var namespaceDeletes []tr.NodeEvent
+		if config.Cfg.NamespaceCascade && r.currentNodes[ne.UID].Properties["kind"] == "Namespace" {
+			namespaceDeletes = tr.NamespaceDeleteEvents(r.nodeStore(), ne.UID, ne.Time)
+		}
+		r.deleteResource(ne, inPrevious)
+		for _, namespaced := range namespaceDeletes {
+			_, namespacedInPrevious := r.previousNodes[namespaced.UID]
+			r.deleteResource(namespaced, namespacedInPrevious)
 		}
 	} else { // This is either an update or create, which look very similar. TODO actually combine the two.
+		if config.Cfg.EventSummary {
+			ne.Node = r.withEventSummary(ne.Node)
+		}
+		ne.Node = r.withDerivedProperties(ne.Node)
+		if ne.Node.Properties["kind"] == tr.SyncManifestKind {
+			ne.Node = r.recountSyncManifest(ne.Node)
+		}
 		ne.Operation = tr.Create
 		if inPrevious { // If this was in the previous, our operation for diffs is update, not create
 			ne.Operation = tr.Update
@@ -334,8 +535,9 @@ func (r *Reconciler) reconcileNode() {
 			// the Metadata is only used to compute the edges and not sent with the node data.
 			// If the node is an application or subscription, it might have changes to its metadata we
 			// need to account for so don't skip updates on those
+			// Synthetic applications don't have metadata, so they are skipped too.
 			if reflect.DeepEqual(ne.Node.Properties, previousNode.Properties) &&
-				ne.Node.Properties["kind"] != "Application" &&
+				(ne.Node.Properties["kind"] != "Application" || ne.Node.Properties["_synthetic"] == true) &&
 				ne.Node.Properties["kind"] != "Subscription" {
 				return
 			}
@@ -363,9 +565,47 @@ func (r *Reconciler) reconcileNode() {
 			}
 		}
 
-		r.currentNodes[ne.UID] = ne.Node
+		previousApplication, _ := r.currentNodes[ne.UID].Properties["_labelApplication"].(string)
+		r.setCurrentNode(ne.Node)
 		r.edgeFuncs[ne.UID] = ne.ComputeEdges
 		r.diffNodes[ne.UID] = ne
+		if config.Cfg.LabelApplications && previousApplication != "" &&
+			previousApplication != ne.Node.Properties["_labelApplication"] {
+			r.pruneLabelApplication(previousApplication, ne.Time)
+		}
+	}
+}
+
+// The synthetic nodes of the collector itself, the sync manifest doesn't count them.
+var collectorKinds = map[interface{}]struct{}{
+	tr.SyncManifestKind: {}, tr.HeartbeatKind: {}, tr.ResyncMarkerKind: {},
+}
+
+// Returns the sync manifest counting the current nodes instead of the nodes the transformer emitted, so the nodes
+// the reconciler dropped, like the deleted nodes or the summarized events, aren't counted. The nodes not sent yet
+// are sent with the manifest. Lock must be held.
+func (r *Reconciler) recountSyncManifest(manifest tr.Node) tr.Node {
+	uids := make([]string, 0, len(r.currentNodes))
+	for uid, node := range r.currentNodes {
+		if _, ok := collectorKinds[node.Properties["kind"]]; !ok {
+			uids = append(uids, uid)
+		}
+	}
+	return tr.RecountSyncManifest(manifest, uids)
+}
+
+// Deletes the synthetic Application of the application label if none of the current nodes has the label anymore.
+// Lock must be held.
+func (r *Reconciler) pruneLabelApplication(name string, time int64) {
+	for _, node := range r.currentNodes {
+		if node.Properties["_labelApplication"] == name {
+			return
+		}
+	}
+	uid := tr.LabelApplicationUID(name)
+	if _, ok := r.currentNodes[uid]; ok {
+		_, inPrevious := r.previousNodes[uid]
+		r.deleteNode(tr.NodeEvent{Node: tr.Node{UID: uid}, Time: time, Operation: tr.Delete}, inPrevious)
 	}
 }
 
@@ -11,6 +11,8 @@ Copyright (c) 2020 Red Hat, Inc.
 package reconciler
 
 import (
+	"fmt"
+	"hash/fnv"
 	"io/ioutil"
 	"log"
 	"reflect"
@@ -20,6 +22,7 @@ import (
 
 	"github.com/golang/glog"
 	lru "github.com/golang/groupcache/lru"
+	"github.com/stolostron/search-collector/pkg/config"
 	tr "github.com/stolostron/search-collector/pkg/transforms"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -38,7 +41,12 @@ func initTestReconciler() *Reconciler {
 		diffNodes:          make(map[string]tr.NodeEvent),
 		k8sEventNodes:      make(map[string]tr.NodeEvent),
 		previousEventEdges: make(map[string]tr.Edge),
+		eventSummaries:     make(map[string]map[string]tr.NodeEvent),
+		summarizedEvents:   make(map[string]string),
+		dependents:         make(map[string]map[string]struct{}),
+		storeHashes:        make(map[string]uint64),
 		edgeFuncs:          make(map[string]func(ns tr.NodeStore) []tr.Edge),
+		pendingEdges:       make(map[string]time.Time),
 
 		Input:       make(chan tr.NodeEvent),
 		purgedNodes: lru.New(CACHE_SIZE),
@@ -251,7 +259,7 @@ func TestReconcilerAddEdges(t *testing.T) {
 		testReconciler.reconcileNode()
 	}
 	//Build edges
-	edgeMap1 := testReconciler.allEdges()
+	edgeMap1 := testReconciler.allEdges(testReconciler.nodeStore())
 
 	//Expected edge
 	edgeMap2 := make(map[string]map[string]tr.Edge, 1)
@@ -267,6 +275,26 @@ func TestReconcilerAddEdges(t *testing.T) {
 	}
 }
 
+func TestReconcilerEdgeDirection(t *testing.T) {
+	config.Cfg.EdgeDirection = true
+	defer func() { config.Cfg.EdgeDirection = false }()
+	testReconciler := initTestReconciler()
+	events := createNodeEvents()
+	go func() {
+		for _, ne := range events {
+			testReconciler.Input <- ne
+		}
+	}()
+	for range events {
+		testReconciler.reconcileNode()
+	}
+
+	edge := testReconciler.allEdges(testReconciler.nodeStore())["local-cluster/5678"]["local-cluster/1234"]
+	if edge.Direction != tr.Directed {
+		t.Fatalf("Expected the ownedBy edge to be directed, got %q", edge.Direction)
+	}
+}
+
 func TestReconcilerDiff(t *testing.T) {
 	testReconciler := initTestReconciler()
 	//Add a node to reconciler previous nodes
@@ -378,8 +406,8 @@ func TestReconcilerComplete(t *testing.T) {
 	// Checks the count of nodes and edges based on the JSON files in pkg/test-data
 	// Update counts when the test data is changed
 	// We don't create Nodes for kind = Event
-	const Nodes = 34
-	const Edges = 51
+	const Nodes = 42
+	const Edges = 55
 	if len(com.Edges) != Edges || com.TotalEdges != Edges || len(com.Nodes) != Nodes || com.TotalNodes != Nodes {
 		ns := tr.NodeStore{
 			ByUID:               testReconciler.currentNodes,
@@ -397,3 +425,306 @@ func TestReconcilerComplete(t *testing.T) {
 		t.Log("Reconciler Complete() working as expected")
 	}
 }
+
+// Returns node events for a pod, with an edge to a node that may arrive later, and for that node.
+func createDanglingEdgeEvents() (tr.NodeEvent, tr.NodeEvent) {
+	pod := tr.NodeEvent{
+		Time:      time.Now().Unix(),
+		Operation: tr.Create,
+		Node:      tr.Node{UID: "local-cluster/pod-uid", Properties: map[string]interface{}{"kind": "Pod", "name": "p"}},
+		ComputeEdges: func(ns tr.NodeStore) []tr.Edge {
+			return []tr.Edge{{EdgeType: "runsOn", SourceUID: "local-cluster/pod-uid", DestUID: "local-cluster/node-uid",
+				SourceKind: "Pod", DestKind: "Node"}}
+		},
+	}
+	node := tr.NodeEvent{
+		Time:         time.Now().Unix(),
+		Operation:    tr.Create,
+		Node:         tr.Node{UID: "local-cluster/node-uid", Properties: map[string]interface{}{"kind": "Node", "name": "n"}},
+		ComputeEdges: func(ns tr.NodeStore) []tr.Edge { return []tr.Edge{} },
+	}
+	return pod, node
+}
+
+func TestReconcilerDeferDanglingEdges(t *testing.T) {
+	config.Cfg.DeferDanglingEdges = true
+	defer func() { config.Cfg.DeferDanglingEdges = false }()
+	testReconciler := initTestReconciler()
+
+	// The pod runs on a node that hasn't arrived yet.
+	pod, node := createDanglingEdgeEvents()
+	go func() { testReconciler.Input <- pod }()
+	testReconciler.reconcileNode()
+	diff := testReconciler.Diff()
+	if len(diff.AddEdges) != 0 {
+		t.Fatalf("Expected the runsOn edge to be deferred, got %v", diff.AddEdges)
+	}
+	if len(testReconciler.pendingEdges) != 1 {
+		t.Fatalf("Expected 1 pending edge, got %d", len(testReconciler.pendingEdges))
+	}
+
+	// The edge is sent once the node arrives.
+	go func() { testReconciler.Input <- node }()
+	testReconciler.reconcileNode()
+	diff = testReconciler.Diff()
+	if len(diff.AddEdges) != 1 || diff.AddEdges[0].DestUID != node.UID {
+		t.Fatalf("Expected the runsOn edge to be added, got %v", diff.AddEdges)
+	}
+	if len(testReconciler.pendingEdges) != 0 {
+		t.Fatalf("Expected no pending edges, got %d", len(testReconciler.pendingEdges))
+	}
+}
+
+func TestReconcilerDeferDanglingEdgesExpire(t *testing.T) {
+	config.Cfg.DeferDanglingEdges = true
+	defer func() { config.Cfg.DeferDanglingEdges = false }()
+	testReconciler := initTestReconciler()
+
+	pod, _ := createDanglingEdgeEvents()
+	go func() { testReconciler.Input <- pod }()
+	testReconciler.reconcileNode()
+	testReconciler.Diff()
+
+	// Expired edges are sent without their endpoint.
+	expired := time.Now().Add(-time.Duration(config.Cfg.PendingEdgeTTLMS+1) * time.Millisecond)
+	for key := range testReconciler.pendingEdges {
+		testReconciler.pendingEdges[key] = expired
+	}
+	diff := testReconciler.Diff()
+	if len(diff.AddEdges) != 1 {
+		t.Fatalf("Expected the expired edge to be added, got %v", diff.AddEdges)
+	}
+}
+
+func TestReconcilerDeleteContainerNodes(t *testing.T) {
+	config.Cfg.ContainerNodes = true
+	defer func() { config.Cfg.ContainerNodes = false }()
+	testReconciler := initTestReconciler()
+
+	pod := tr.NodeEvent{
+		Time:         time.Now().Unix(),
+		Operation:    tr.Create,
+		Node:         tr.Node{UID: "local-cluster/pod-uid", Properties: map[string]interface{}{"kind": "Pod", "name": "p"}},
+		ComputeEdges: func(ns tr.NodeStore) []tr.Edge { return []tr.Edge{} },
+	}
+	container := tr.NodeEvent{
+		Time:      pod.Time,
+		Operation: tr.Create,
+		Node: tr.Node{UID: "local-cluster/pod-uid/main",
+			Properties: map[string]interface{}{"kind": "Container", "name": "main", "_podUID": "local-cluster/pod-uid"}},
+		ComputeEdges: func(ns tr.NodeStore) []tr.Edge { return []tr.Edge{} },
+	}
+	for _, ne := range []tr.NodeEvent{pod, container} {
+		go func(ne tr.NodeEvent) { testReconciler.Input <- ne }(ne)
+		testReconciler.reconcileNode()
+	}
+	testReconciler.Diff()
+	if _, ok := testReconciler.dependents[pod.UID][container.UID]; !ok {
+		t.Fatalf("Expected the container to be indexed by its pod, got %v", testReconciler.dependents)
+	}
+
+	// Deleting the pod deletes its container.
+	go func() {
+		testReconciler.Input <- tr.NodeEvent{Time: pod.Time + 1, Operation: tr.Delete, Node: tr.Node{UID: pod.UID}}
+	}()
+	testReconciler.reconcileNode()
+	if len(testReconciler.currentNodes) != 0 {
+		t.Fatalf("Expected the pod and its container to be deleted, got %v", testReconciler.currentNodes)
+	}
+	if len(testReconciler.dependents) != 0 {
+		t.Fatalf("Expected the index of the dependent nodes to be empty, got %v", testReconciler.dependents)
+	}
+	diff := testReconciler.Diff()
+	if len(diff.DeleteNodes) != 2 {
+		t.Fatalf("Expected 2 deleted nodes, got %v", diff.DeleteNodes)
+	}
+}
+
+func TestReconcilerDeleteTombstoneTTL(t *testing.T) {
+	testReconciler := initTestReconciler()
+	send := func(ne tr.NodeEvent) {
+		go func() { testReconciler.Input <- ne }()
+		testReconciler.reconcileNode()
+	}
+	pod := tr.NodeEvent{
+		Time:         time.Now().Unix(),
+		Operation:    tr.Create,
+		Node:         tr.Node{UID: "local-cluster/pod-uid", Properties: map[string]interface{}{"kind": "Pod", "name": "p"}},
+		ComputeEdges: func(ns tr.NodeStore) []tr.Edge { return []tr.Edge{} },
+	}
+	send(pod)
+	testReconciler.Diff()
+
+	send(tr.NodeEvent{Time: pod.Time + 1, Operation: tr.Delete, Node: tr.Node{UID: pod.UID}})
+	if diff := testReconciler.Diff(); len(diff.DeleteNodes) != 1 || diff.DeleteNodes[0].TombstoneTTL != 0 {
+		t.Fatalf("Expected 1 deleted node without a TTL, got %v", diff.DeleteNodes)
+	}
+
+	config.Cfg.TombstoneTTLMS = 60000
+	defer func() { config.Cfg.TombstoneTTLMS = 0 }()
+	pod.Time += 2
+	send(pod)
+	testReconciler.Diff()
+	send(tr.NodeEvent{Time: pod.Time + 1, Operation: tr.Delete, Node: tr.Node{UID: pod.UID}})
+	expected := []tr.Deletion{{UID: pod.UID, TombstoneTTL: 60000}}
+	if diff := testReconciler.Diff(); !reflect.DeepEqual(diff.DeleteNodes, expected) {
+		t.Fatalf("Expected %v, got %v", expected, diff.DeleteNodes)
+	}
+}
+
+func TestReconcilerPruneLabelApplication(t *testing.T) {
+	config.Cfg.LabelApplications = true
+	defer func() { config.Cfg.LabelApplications = false }()
+	testReconciler := initTestReconciler()
+	send := func(ne tr.NodeEvent) {
+		go func() { testReconciler.Input <- ne }()
+		testReconciler.reconcileNode()
+	}
+	member := func(uid, application string) tr.NodeEvent {
+		return tr.NodeEvent{
+			Time:      time.Now().Unix(),
+			Operation: tr.Create,
+			Node: tr.Node{UID: uid, Properties: map[string]interface{}{
+				"kind": "Deployment", "name": uid, "_labelApplication": application}},
+			ComputeEdges: func(ns tr.NodeStore) []tr.Edge { return []tr.Edge{} },
+		}
+	}
+	app := tr.NodeEvent{
+		Time:         time.Now().Unix(),
+		Operation:    tr.Update,
+		Node:         tr.Node{UID: tr.LabelApplicationUID("shop"), Properties: map[string]interface{}{"kind": "Application"}},
+		ComputeEdges: func(ns tr.NodeStore) []tr.Edge { return []tr.Edge{} },
+	}
+	send(member("a", "shop"))
+	send(member("b", "shop"))
+	send(app)
+
+	// The application stays while it has members.
+	send(tr.NodeEvent{Time: time.Now().Unix() + 1, Operation: tr.Delete, Node: tr.Node{UID: "a"}})
+	if _, ok := testReconciler.currentNodes[app.UID]; !ok {
+		t.Fatal("Expected the application to stay while it has members")
+	}
+
+	// Relabeling the last member deletes the application.
+	send(member("b", "other"))
+	if _, ok := testReconciler.currentNodes[app.UID]; ok {
+		t.Fatal("Expected the application to be deleted with its last member")
+	}
+}
+
+func TestReconcilerNamespaceCascade(t *testing.T) {
+	config.Cfg.NamespaceCascade = true
+	defer func() { config.Cfg.NamespaceCascade = false }()
+	testReconciler := initTestReconciler()
+	send := func(ne tr.NodeEvent) {
+		go func() { testReconciler.Input <- ne }()
+		testReconciler.reconcileNode()
+	}
+	node := func(uid, kind, namespace string) tr.NodeEvent {
+		properties := map[string]interface{}{"kind": kind, "name": uid}
+		if namespace != "" {
+			properties["namespace"] = namespace
+		}
+		return tr.NodeEvent{
+			Time:         time.Now().Unix(),
+			Operation:    tr.Create,
+			Node:         tr.Node{UID: uid, Properties: properties},
+			ComputeEdges: func(ns tr.NodeStore) []tr.Edge { return []tr.Edge{} },
+		}
+	}
+	for _, ne := range []tr.NodeEvent{
+		node("foo", "Namespace", ""),
+		node("pod-foo", "Pod", "foo"),
+		node("configmap-foo", "ConfigMap", "foo"),
+		node("pod-bar", "Pod", "bar"),
+		node("node-1", "Node", ""),
+	} {
+		send(ne)
+	}
+	testReconciler.Diff()
+
+	// The delete events of the pod and configmap were missed, they're deleted with their namespace.
+	send(tr.NodeEvent{Time: time.Now().Unix() + 1, Operation: tr.Delete, Node: tr.Node{UID: "foo"}})
+	for _, uid := range []string{"foo", "pod-foo", "configmap-foo"} {
+		if _, ok := testReconciler.currentNodes[uid]; ok {
+			t.Errorf("Expected %s to be deleted with its namespace", uid)
+		}
+	}
+	if len(testReconciler.currentNodes) != 2 {
+		t.Fatalf("Expected the nodes of other namespaces to be kept, got %v", testReconciler.currentNodes)
+	}
+	if diff := testReconciler.Diff(); len(diff.DeleteNodes) != 3 {
+		t.Fatalf("Expected 3 deleted nodes, got %v", diff.DeleteNodes)
+	}
+}
+
+func TestReconcilerSyncManifest(t *testing.T) {
+	testReconciler := initTestReconciler()
+	send := func(ne tr.NodeEvent) {
+		go func() { testReconciler.Input <- ne }()
+		testReconciler.reconcileNode()
+	}
+	node := func(uid, kind string) tr.NodeEvent {
+		return tr.NodeEvent{
+			Time:         time.Now().Unix(),
+			Operation:    tr.Create,
+			Node:         tr.Node{UID: uid, Properties: map[string]interface{}{"kind": kind, "name": uid}},
+			ComputeEdges: func(ns tr.NodeStore) []tr.Edge { return []tr.Edge{} },
+		}
+	}
+	send(node("pod-1", "Pod"))
+	send(node("pod-2", "Pod"))
+	send(node("heartbeat", tr.HeartbeatKind))
+	send(tr.NodeEvent{Time: time.Now().Unix() + 1, Operation: tr.Delete, Node: tr.Node{UID: "pod-2"}})
+
+	// The transformer counted both pods, the deleted one isn't sent so it isn't counted.
+	manifest := node("manifest", tr.SyncManifestKind)
+	manifest.Properties["nodeCount"] = int64(2)
+	send(manifest)
+	properties := testReconciler.currentNodes["manifest"].Properties
+	h := fnv.New64a()
+	h.Write([]byte("pod-1"))
+	if properties["nodeCount"] != int64(1) || properties["checksum"] != fmt.Sprintf("%016x", h.Sum64()) {
+		t.Fatalf("Expected the manifest to count the current pod, got %v", properties)
+	}
+	if manifest.Properties["nodeCount"] != int64(2) {
+		t.Fatal("Expected the node of the event to be left unchanged")
+	}
+}
+
+func TestDedupSymmetricEdges(t *testing.T) {
+	pvToClaim := tr.Edge{EdgeType: "boundTo", SourceUID: "local-cluster/pv", DestUID: "local-cluster/claim",
+		SourceKind: "PersistentVolume", DestKind: "PersistentVolumeClaim"}
+	claimToPV := tr.Edge{EdgeType: "boundTo", SourceUID: "local-cluster/claim", DestUID: "local-cluster/pv",
+		SourceKind: "PersistentVolumeClaim", DestKind: "PersistentVolume"}
+	podToClaim := tr.Edge{EdgeType: "attachedTo", SourceUID: "local-cluster/pod", DestUID: "local-cluster/claim",
+		SourceKind: "Pod", DestKind: "PersistentVolumeClaim"}
+	claimToPod := tr.Edge{EdgeType: "attachedTo", SourceUID: "local-cluster/claim", DestUID: "local-cluster/pod",
+		SourceKind: "PersistentVolumeClaim", DestKind: "Pod"}
+	edges := map[string]map[string]tr.Edge{
+		"local-cluster/pv":    {"local-cluster/claim": pvToClaim},
+		"local-cluster/claim": {"local-cluster/pv": claimToPV, "local-cluster/pod": claimToPod},
+		"local-cluster/pod":   {"local-cluster/claim": podToClaim},
+	}
+	dedupSymmetricEdges(edges)
+
+	// Only the boundTo edge from the lower UID is kept, both directions of the directed edges are kept.
+	expected := map[string]map[string]tr.Edge{
+		"local-cluster/claim": {"local-cluster/pv": claimToPV, "local-cluster/pod": claimToPod},
+		"local-cluster/pod":   {"local-cluster/claim": podToClaim},
+	}
+	if !reflect.DeepEqual(edges, expected) {
+		t.Fatalf("Expected edges %v, got %v", expected, edges)
+	}
+
+	// An edge its builder set as directed isn't deduplicated.
+	pvToClaim.Direction = tr.Directed
+	edges = map[string]map[string]tr.Edge{
+		"local-cluster/pv":    {"local-cluster/claim": pvToClaim},
+		"local-cluster/claim": {"local-cluster/pv": claimToPV},
+	}
+	dedupSymmetricEdges(edges)
+	if len(edges) != 2 {
+		t.Fatalf("Expected the directed edge to be kept, got %v", edges)
+	}
+}
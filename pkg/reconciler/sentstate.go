@@ -0,0 +1,135 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package reconciler
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	tr "github.com/stolostron/search-collector/pkg/transforms"
+)
+
+// SentState is what the aggregator has: a hash of each node it was sent, and the edges.
+// It's kept by the sender so it can send only the delta after the collector restarts.
+type SentState struct {
+	Nodes map[string]string                 `json:"nodes"` // Hash of each node as it was sent, keyed by UID
+	Edges map[string]map[string]tr.EdgeType `json:"edges"` // Type of each edge, keyed by source then dest
+}
+
+// NewSentState returns an empty state.
+func NewSentState() SentState {
+	return SentState{Nodes: make(map[string]string), Edges: make(map[string]map[string]tr.EdgeType)}
+}
+
+// NodeHash returns the hash of the properties of a node as it's sent. The metadata isn't sent, so it isn't hashed.
+func NodeHash(node tr.Node) string {
+	encoded, err := json.Marshal(node.Properties) // Map keys are sorted, so the same properties have the same hash
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(encoded))[:32]
+}
+
+// Returns the hash of the node as it's sent in the store hash, from its UID and NodeHash.
+func storeNodeHash(output tr.Node) uint64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(output.UID))
+	_, _ = hash.Write([]byte{0})
+	_, _ = hash.Write([]byte(NodeHash(output)))
+	return hash.Sum64()
+}
+
+// Sets the node as it's sent in the store hash. Lock must be held.
+func (r *Reconciler) hashStoreNode(output tr.Node) {
+	r.unhashStoreNode(output.UID)
+	hash := storeNodeHash(output)
+	r.storeHashes[output.UID] = hash
+	r.storeHash += hash
+}
+
+// Removes the node of the UID from the store hash. Lock must be held.
+func (r *Reconciler) unhashStoreNode(uid string) {
+	if hash, ok := r.storeHashes[uid]; ok {
+		r.storeHash -= hash
+		delete(r.storeHashes, uid)
+	}
+}
+
+// Hashes the nodes sent in the complete state, replacing the store hash. Lock must be held.
+func (r *Reconciler) rehashStore(outputs []tr.Node) {
+	r.storeHashes = make(map[string]uint64, len(outputs))
+	r.storeHash = 0
+	for _, output := range outputs {
+		r.hashStoreNode(output)
+	}
+}
+
+// Returns the store hash in hex: the sum, modulo 2^64, of the FNV-1a 64-bit hash of the UID and NodeHash of each
+// node sent. The aggregator can compute it over the nodes it has to find out it diverged. Lock must be held.
+func (r *Reconciler) storeHashString() string {
+	return fmt.Sprintf("%016x", r.storeHash)
+}
+
+// DiffFrom returns the diff between the current state and the state that was sent, and resets the diff like Diff.
+// Unlike Diff, it doesn't need the events since the state was sent, so the deletes missed while the collector
+// wasn't running are found too: they're the nodes that were sent but aren't current. The deleted edges only have
+// their type and UIDs, the sent state doesn't keep the rest.
+func (r *Reconciler) DiffFrom(sent SentState) Diff {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ns := r.nodeStore()
+	r.deriveProperties(ns) // The sent hashes include the derived properties
+	ret := Diff{}
+	r.rehashStore(nil)
+	for uid, node := range r.currentNodes {
+		output := tr.OutputNode(node)
+		r.hashStoreNode(output)
+		hash, wasSent := sent.Nodes[uid]
+		if !wasSent {
+			ret.AddNodes = append(ret.AddNodes, output)
+		} else if hash != NodeHash(output) {
+			ret.UpdateNodes = append(ret.UpdateNodes, output)
+		}
+	}
+	deleted := make(map[string]struct{})
+	for uid := range sent.Nodes {
+		if _, ok := r.currentNodes[uid]; !ok {
+			ret.DeleteNodes = append(ret.DeleteNodes, tr.NewDeletion(uid))
+			deleted[uid] = struct{}{}
+		}
+	}
+
+	newEdges := r.allEdges(ns)
+	for srcUID, destMap := range newEdges {
+		for destUID, edge := range destMap {
+			if _, ok := sent.Edges[srcUID][destUID]; !ok {
+				ret.AddEdges = append(ret.AddEdges, edge)
+			}
+		}
+	}
+	// The edges of the deleted nodes are deleted with them.
+	for srcUID, destMap := range sent.Edges {
+		if _, ok := deleted[srcUID]; ok {
+			continue
+		}
+		for destUID, edgeType := range destMap {
+			if _, ok := deleted[destUID]; ok {
+				continue
+			}
+			if _, ok := newEdges[srcUID][destUID]; !ok {
+				ret.DeleteEdges = append(ret.DeleteEdges, tr.Edge{EdgeType: edgeType, SourceUID: srcUID, DestUID: destUID})
+			}
+		}
+	}
+
+	r.previousEdges = newEdges
+	r.resetDiffs()
+
+	ret.TotalNodes = len(r.currentNodes)
+	ret.TotalEdges = r.totalEdges
+	ret.StoreHash = r.storeHashString()
+	return ret
+}
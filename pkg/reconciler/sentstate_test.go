@@ -0,0 +1,135 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package reconciler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	tr "github.com/stolostron/search-collector/pkg/transforms"
+)
+
+func TestReconcilerDiffFrom(t *testing.T) {
+	testReconciler := initTestReconciler()
+	events := createNodeEvents()
+	go func() {
+		for _, ne := range events {
+			testReconciler.Input <- ne
+		}
+	}()
+	for range events {
+		testReconciler.reconcileNode()
+	}
+
+	// The owner was sent as it is, the pod was sent with other properties, and a node deleted while the
+	// collector wasn't running was sent along with its edge.
+	sent := NewSentState()
+	sent.Nodes["local-cluster/1234"] = NodeHash(tr.OutputNode(testReconciler.currentNodes["local-cluster/1234"]))
+	sent.Nodes["local-cluster/5678"] = NodeHash(tr.Node{Properties: map[string]interface{}{"name": "old"}})
+	sent.Nodes["local-cluster/gone"] = "hash"
+	sent.Edges["local-cluster/gone"] = map[string]tr.EdgeType{"local-cluster/1234": "ownedBy"}
+	sent.Edges["local-cluster/1234"] = map[string]tr.EdgeType{"local-cluster/other": "uses"}
+
+	diff := testReconciler.DiffFrom(sent)
+	if len(diff.AddNodes) != 0 || len(diff.UpdateNodes) != 1 || diff.UpdateNodes[0].UID != "local-cluster/5678" {
+		t.Errorf("Expected only the pod to be updated, got adds %v updates %v", diff.AddNodes, diff.UpdateNodes)
+	}
+	if len(diff.DeleteNodes) != 1 || diff.DeleteNodes[0].UID != "local-cluster/gone" {
+		t.Errorf("Expected the node missing from the current state to be deleted, got %v", diff.DeleteNodes)
+	}
+	if len(diff.AddEdges) != 1 || diff.AddEdges[0].SourceUID != "local-cluster/5678" {
+		t.Errorf("Expected the ownedBy edge of the pod to be added, got %v", diff.AddEdges)
+	}
+	// The edge of the deleted node is deleted with it.
+	if len(diff.DeleteEdges) != 1 || !reflect.DeepEqual(diff.DeleteEdges[0], tr.Edge{EdgeType: "uses",
+		SourceUID: "local-cluster/1234", DestUID: "local-cluster/other"}) {
+		t.Errorf("Expected the edge that isn't current to be deleted, got %v", diff.DeleteEdges)
+	}
+	if diff.TotalNodes != 2 || diff.TotalEdges != 1 {
+		t.Errorf("Expected 2 nodes and 1 edge in total, got %d and %d", diff.TotalNodes, diff.TotalEdges)
+	}
+
+	// Like Diff, the next diff is from the state just computed.
+	if next := testReconciler.Diff(); len(next.AddNodes) != 0 || len(next.AddEdges) != 0 {
+		t.Errorf("Expected an empty diff after DiffFrom, got %v", next)
+	}
+}
+
+func TestReconcilerDiffFromDerivedProperties(t *testing.T) {
+	pod := tr.NodeEvent{Time: time.Now().Unix(), Operation: tr.Create,
+		ComputeEdges: func(ns tr.NodeStore) []tr.Edge { return []tr.Edge{} }, Node: tr.Node{
+			UID:        "local-cluster/pod-uid",
+			Properties: map[string]interface{}{"kind": "Pod", "namespace": "default", "name": "web-1"},
+			Metadata:   map[string]string{}}}
+	reconcile := func(r *Reconciler) {
+		go func() { r.Input <- pod }()
+		r.reconcileNode()
+	}
+
+	// The pod was sent with its derived properties before the restart.
+	before := initTestReconciler()
+	reconcile(before)
+	sent := NewSentState()
+	for _, node := range before.Diff().AddNodes {
+		sent.Nodes[node.UID] = NodeHash(node)
+	}
+
+	restarted := initTestReconciler()
+	reconcile(restarted)
+	if diff := restarted.DiffFrom(sent); len(diff.AddNodes) != 0 || len(diff.UpdateNodes) != 0 {
+		t.Fatalf("Expected the pod not to be sent again, got adds %v updates %v", diff.AddNodes, diff.UpdateNodes)
+	}
+	if diff := restarted.Diff(); len(diff.UpdateNodes) != 0 {
+		t.Fatalf("Expected no update of the pod on the next diff, got %v", diff.UpdateNodes)
+	}
+}
+
+func TestReconcilerStoreHash(t *testing.T) {
+	reconcileAll := func(r *Reconciler, events []tr.NodeEvent) {
+		go func() {
+			for _, ne := range events {
+				r.Input <- ne
+			}
+		}()
+		for range events {
+			r.reconcileNode()
+		}
+	}
+	events := createNodeEvents()
+	diffed := initTestReconciler()
+	reconcileAll(diffed, events)
+	diff := diffed.Diff()
+	if diff.StoreHash == "0000000000000000" {
+		t.Fatal("Expected the hash of the nodes")
+	}
+
+	// The complete state and the delta from an empty sent state have the same hash as the diffs.
+	completed := initTestReconciler()
+	reconcileAll(completed, events)
+	if complete := completed.Complete(); complete.StoreHash != diff.StoreHash {
+		t.Errorf("Expected the complete state hash %s, got %s", diff.StoreHash, complete.StoreHash)
+	}
+	restored := initTestReconciler()
+	reconcileAll(restored, events)
+	if restoredDiff := restored.DiffFrom(NewSentState()); restoredDiff.StoreHash != diff.StoreHash {
+		t.Errorf("Expected the restored hash %s, got %s", diff.StoreHash, restoredDiff.StoreHash)
+	}
+
+	// An update changes the hash, and a delete removes the node from it.
+	updated := events[1]
+	updated.Time++
+	updated.Node.Properties = map[string]interface{}{"kind": "Pod", "namespace": "default", "name": "updated"}
+	reconcileAll(diffed, []tr.NodeEvent{updated})
+	updatedHash := diffed.Diff().StoreHash
+	if updatedHash == diff.StoreHash {
+		t.Error("Expected the update to change the hash")
+	}
+	reconcileAll(diffed, []tr.NodeEvent{{Time: updated.Time + 1, Operation: tr.Delete, Node: tr.Node{UID: updated.UID}}})
+	deletedHash := diffed.Diff().StoreHash
+	remaining := initTestReconciler()
+	reconcileAll(remaining, events[:1])
+	if complete := remaining.Complete(); complete.StoreHash != deletedHash {
+		t.Errorf("Expected the hash of the remaining node %s, got %s", complete.StoreHash, deletedHash)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package send
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/golang/glog"
+	tr "github.com/stolostron/search-collector/pkg/transforms"
+)
+
+// Content type of the JSON records produced through the Kafka REST proxy.
+const kafkaRecordsContentType = "application/vnd.kafka.json.v2+json"
+
+// Max number of records produced in each request to the REST proxy.
+const kafkaBatchSize = 1000
+
+// Produces a record for each node, deletion and edge of the payloads to Kafka, through a Kafka REST proxy, like the
+// Confluent REST proxy. The records of a resource have the same key, so they land on the same partition in order.
+// Either all the records go to one topic, with the operation in the op field, or each operation goes to its own
+// topic, named after the topic and the operation, like search-collector.add.
+type kafkaBackend struct {
+	restURL           string
+	topic             string
+	topicPerOperation bool
+	clusterName       string
+	httpClient        http.Client
+}
+
+// The value of each record.
+type kafkaRecordValue struct {
+	Op        string       `json:"op"` // add, update, delete, addEdge or deleteEdge
+	Cluster   string       `json:"cluster"`
+	RequestId int          `json:"requestId,omitempty"`
+	ClearAll  bool         `json:"clearAll,omitempty"` // The record is part of the complete state
+	Node      *tr.Node     `json:"node,omitempty"`
+	Deletion  *tr.Deletion `json:"deletion,omitempty"`
+	Edge      *tr.Edge     `json:"edge,omitempty"`
+}
+
+type kafkaRecord struct {
+	Key   string           `json:"key"`
+	Value kafkaRecordValue `json:"value"`
+}
+
+func newKafkaBackend(restURL, topic string, topicPerOperation bool, clusterName string) *kafkaBackend {
+	if restURL == "" {
+		glog.Error("SENDER_BACKEND is kafka, but KAFKA_REST_URL isn't set")
+	}
+	return &kafkaBackend{restURL: strings.TrimSuffix(restURL, "/"), topic: topic,
+		topicPerOperation: topicPerOperation, clusterName: clusterName,
+		httpClient: http.Client{Timeout: backendTimeout}}
+}
+
+// Send produces the records of the payload, grouped by topic. The Kafka topics don't report the totals.
+func (k *kafkaBackend) Send(payload Payload, expectedTotalResources int, expectedTotalEdges int) error {
+	recordsByTopic := map[string][]kafkaRecord{}
+	add := func(key string, value kafkaRecordValue) {
+		value.Cluster = k.clusterName
+		value.RequestId = payload.RequestId
+		value.ClearAll = payload.ClearAll
+		topic := k.topic
+		if k.topicPerOperation {
+			topic = k.topic + "." + value.Op
+		}
+		recordsByTopic[topic] = append(recordsByTopic[topic], kafkaRecord{Key: key, Value: value})
+	}
+	for i := range payload.AddResources {
+		add(payload.AddResources[i].UID, kafkaRecordValue{Op: "add", Node: &payload.AddResources[i]})
+	}
+	for i := range payload.UpdatedResources {
+		add(payload.UpdatedResources[i].UID, kafkaRecordValue{Op: "update", Node: &payload.UpdatedResources[i]})
+	}
+	for i := range payload.DeletedResources {
+		add(payload.DeletedResources[i].UID, kafkaRecordValue{Op: "delete", Deletion: &payload.DeletedResources[i]})
+	}
+	for i := range payload.AddEdges {
+		add(kafkaEdgeKey(payload.AddEdges[i]), kafkaRecordValue{Op: "addEdge", Edge: &payload.AddEdges[i]})
+	}
+	for i := range payload.DeleteEdges {
+		add(kafkaEdgeKey(payload.DeleteEdges[i]), kafkaRecordValue{Op: "deleteEdge", Edge: &payload.DeleteEdges[i]})
+	}
+
+	for topic, records := range recordsByTopic {
+		for start := 0; start < len(records); start += kafkaBatchSize {
+			end := start + kafkaBatchSize
+			if end > len(records) {
+				end = len(records)
+			}
+			if err := k.produce(topic, records[start:end], payloadLabel(payload)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// The key of the records of an edge, so the add and delete of the same edge are in order.
+func kafkaEdgeKey(edge tr.Edge) string {
+	return edge.SourceUID + "/" + string(edge.EdgeType) + "/" + edge.DestUID
+}
+
+// Produces the records to the topic with a single request to the REST proxy.
+func (k *kafkaBackend) produce(topic string, records []kafkaRecord, label string) error {
+	body, err := json.Marshal(map[string][]kafkaRecord{"records": records})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, k.restURL+"/topics/"+url.PathEscape(topic), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", kafkaRecordsContentType)
+	payloadSizes.WithLabelValues(label).Observe(float64(req.ContentLength))
+	return doBackendRequest(k.httpClient, req, label)
+}
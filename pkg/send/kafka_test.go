@@ -0,0 +1,91 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package send
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stolostron/search-collector/pkg/transforms"
+)
+
+// Records the records produced to each topic of the fake REST proxy.
+func newFakeKafkaRESTProxy(t *testing.T) (*httptest.Server, map[string][]kafkaRecord) {
+	produced := map[string][]kafkaRecord{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType := r.Header.Get("Content-Type"); contentType != kafkaRecordsContentType {
+			t.Errorf("Expected the Kafka JSON content type, got %q", contentType)
+		}
+		body := map[string][]kafkaRecord{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		topic := strings.TrimPrefix(r.URL.Path, "/topics/")
+		produced[topic] = append(produced[topic], body["records"]...)
+		w.WriteHeader(http.StatusOK)
+	}))
+	return ts, produced
+}
+
+func newKafkaTestPayload() Payload {
+	return Payload{
+		RequestId:        42,
+		AddResources:     []transforms.Node{{UID: "Node0"}, {UID: "Node1"}},
+		UpdatedResources: []transforms.Node{{UID: "Node2"}},
+		DeletedResources: []transforms.Deletion{{UID: "Node3"}},
+		AddEdges:         []transforms.Edge{{EdgeType: "ownedBy", SourceUID: "Node0", DestUID: "Node1"}},
+	}
+}
+
+func TestKafkaBackendSingleTopic(t *testing.T) {
+	ts, produced := newFakeKafkaRESTProxy(t)
+	defer ts.Close()
+
+	backend := newKafkaBackend(ts.URL+"/", "search", false, "cluster1")
+	if err := backend.Send(newKafkaTestPayload(), 0, 0); err != nil {
+		t.Fatal("Expected the records to be produced, got ", err)
+	}
+
+	records := produced["search"]
+	if len(produced) != 1 || len(records) != 5 {
+		t.Fatalf("Expected 5 records in the search topic, got %v", produced)
+	}
+	ops := []string{}
+	for _, record := range records {
+		ops = append(ops, record.Value.Op)
+		if record.Value.Cluster != "cluster1" || record.Value.RequestId != 42 {
+			t.Errorf("Expected the cluster and request ID in each record, got %+v", record.Value)
+		}
+	}
+	if strings.Join(ops, ",") != "add,add,update,delete,addEdge" {
+		t.Errorf("Expected the records in the order of the payload, got %v", ops)
+	}
+	if records[0].Key != "Node0" || records[0].Value.Node.UID != "Node0" {
+		t.Errorf("Expected the node's record to be keyed by its UID, got %+v", records[0])
+	}
+	if records[3].Value.Deletion.UID != "Node3" || records[4].Key != "Node0/ownedBy/Node1" {
+		t.Errorf("Expected the deletion and edge records, got %+v and %+v", records[3], records[4])
+	}
+}
+
+func TestKafkaBackendTopicPerOperation(t *testing.T) {
+	ts, produced := newFakeKafkaRESTProxy(t)
+	defer ts.Close()
+
+	backend := newKafkaBackend(ts.URL, "search", true, "cluster1")
+	if err := backend.Send(newKafkaTestPayload(), 0, 0); err != nil {
+		t.Fatal("Expected the records to be produced, got ", err)
+	}
+	for topic, count := range map[string]int{"search.add": 2, "search.update": 1, "search.delete": 1,
+		"search.addEdge": 1} {
+		if len(produced[topic]) != count {
+			t.Errorf("Expected %d records in topic %s, got %d", count, topic, len(produced[topic]))
+		}
+	}
+	if len(produced) != 4 {
+		t.Errorf("Expected 4 topics, got %v", produced)
+	}
+}
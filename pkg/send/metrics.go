@@ -0,0 +1,44 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package send
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	sendDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "search_collector",
+		Subsystem: "sender",
+		Name:      "send_duration_seconds",
+		Help:      "Time to send a payload to the aggregator and read its response, by payload and result.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12), // 10ms to 20s
+	}, []string{"payload", "result"})
+	payloadSizes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "search_collector",
+		Subsystem: "sender",
+		Name:      "payload_bytes",
+		Help:      "Size of the payloads sent to the aggregator, after compression.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 10), // 1KiB to 256MiB
+	}, []string{"payload"})
+	resyncs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "search_collector",
+		Subsystem: "sender",
+		Name:      "resyncs_total",
+		Help: "Number of times the complete state was sent instead of a diff, by reason: startup (first send or " +
+			"after a failed cycle), required (asked by the aggregator) or diff_error (the diff failed).",
+	}, []string{"reason"})
+)
+
+// Metrics returns the Prometheus collectors of the sender metrics, for the binary to register.
+func Metrics() []prometheus.Collector {
+	return []prometheus.Collector{sendDuration, payloadSizes, resyncs}
+}
+
+// Returns the payload label of the metrics, complete or diff.
+func payloadLabel(payload Payload) string {
+	if payload.ClearAll {
+		return "complete"
+	}
+	return "diff"
+}
@@ -0,0 +1,151 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package send
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/stolostron/search-collector/pkg/config"
+	tr "github.com/stolostron/search-collector/pkg/transforms"
+)
+
+// The payload versions this collector can send, oldest first.
+// Version 1 is the Payload, version 2 is the PayloadV2.
+var supportedPayloadVersions = []int{1, 2}
+
+// Header listing the payload versions the collector supports when negotiating, and the version of the payload
+// when sending a version other than 1.
+const payloadVersionHeader = "Search-Payload-Version"
+
+// Returned when the aggregator doesn't accept the payload version, the payload is sent again with version 1.
+var errPayloadVersion = errors.New("Aggregator doesn't support the payload version")
+
+// PayloadV2 is the version 2 of the payload. The deleted nodes are only their UIDs, and the information about the
+// payload itself is grouped in its metadata.
+type PayloadV2 struct {
+	Metadata        PayloadMetadata `json:"metadata"`
+	AddResources    []tr.Node       `json:"addResources,omitempty"`    // Nodes which must be added
+	UpdateResources []tr.Node       `json:"updateResources,omitempty"` // Nodes that exist and must be updated
+	DeleteResources []string        `json:"deleteResources,omitempty"` // UIDs of the nodes which must be deleted
+	AddEdges        []tr.Edge       `json:"addEdges,omitempty"`        // Edges which must be added
+	DeleteEdges     []tr.Edge       `json:"deleteEdges,omitempty"`     // Edges which must be deleted
+}
+
+// PayloadMetadata describes a version 2 payload.
+type PayloadMetadata struct {
+	PayloadVersion   int    `json:"payloadVersion"`         // Version of the payload format
+	Cluster          string `json:"cluster"`                // Name of the cluster the resources are from
+	CollectorVersion string `json:"collectorVersion"`       // Version of this collector
+	RequestId        int    `json:"requestId,omitempty"`    // Unique ID to track each request for debug
+	ClearAll         bool   `json:"clearAll,omitempty"`     // Tells the aggregator to clear existing data first
+	TombstoneTTL     int64  `json:"tombstoneTTL,omitempty"` // Time(ms) the consumer should keep the delete markers
+	TotalResources   int    `json:"totalResources"`         // Number of nodes once the payload is applied
+	TotalEdges       int    `json:"totalEdges"`             // Number of edges once the payload is applied
+	StoreHash        string `json:"storeHash,omitempty"`    // Hash of the nodes once the payload is applied
+}
+
+// The answer of the aggregator to the negotiation, with the payload versions it accepts.
+type payloadVersionResponse struct {
+	PayloadVersions []int `json:"payloadVersions"`
+}
+
+// Returns the version 2 of the payload.
+func payloadV2(payload Payload, expectedTotalResources int, expectedTotalEdges int) PayloadV2 {
+	deleted := make([]string, 0, len(payload.DeletedResources))
+	for _, deletion := range payload.DeletedResources {
+		deleted = append(deleted, deletion.UID)
+	}
+	if len(deleted) == 0 {
+		deleted = nil
+	}
+	return PayloadV2{
+		Metadata: PayloadMetadata{
+			PayloadVersion:   2,
+			Cluster:          config.Cfg.ClusterName,
+			CollectorVersion: config.COLLECTOR_API_VERSION,
+			RequestId:        payload.RequestId,
+			ClearAll:         payload.ClearAll,
+			TombstoneTTL:     int64(config.Cfg.TombstoneTTLMS),
+			TotalResources:   expectedTotalResources,
+			TotalEdges:       expectedTotalEdges,
+			StoreHash:        payload.StoreHash,
+		},
+		AddResources:    payload.AddResources,
+		UpdateResources: payload.UpdatedResources,
+		DeleteResources: deleted,
+		AddEdges:        payload.AddEdges,
+		DeleteEdges:     payload.DeleteEdges,
+	}
+}
+
+// Returns the JSON of the payload in the given version.
+func marshalPayload(payload Payload, version int, expectedTotalResources int, expectedTotalEdges int) ([]byte, error) {
+	if version == 2 {
+		return json.Marshal(payloadV2(payload, expectedTotalResources, expectedTotalEdges))
+	}
+	return json.Marshal(payload)
+}
+
+// Returns the payload version to send, negotiating it with the aggregator the first time.
+func (s *Sender) negotiatedPayloadVersion() int {
+	if s.payloadVersion == 0 {
+		s.payloadVersion = s.negotiatePayloadVersion()
+	}
+	return s.payloadVersion
+}
+
+// Asks the aggregator for the payload versions it accepts, and returns the latest one supported by both, up to
+// PAYLOAD_VERSION. Falls back to version 1 when the aggregator doesn't answer with its versions, like the
+// aggregators that predate the negotiation.
+func (s *Sender) negotiatePayloadVersion() int {
+	latest := config.Cfg.PayloadVersion
+	if latest <= 1 {
+		return 1
+	}
+	url := s.aggregatorURL + s.aggregatorSyncPath
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		glog.Warningf("Error negotiating the payload version, using version 1: %s", err)
+		return 1
+	}
+	versions := make([]string, 0, len(supportedPayloadVersions))
+	for _, version := range supportedPayloadVersions {
+		versions = append(versions, strconv.Itoa(version))
+	}
+	req.Header.Set(payloadVersionHeader, strings.Join(versions, ","))
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		glog.Warningf("Error negotiating the payload version, using version 1: %s", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	accepted := payloadVersionResponse{}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&accepted) != nil {
+		glog.Infof("Aggregator at %s didn't negotiate the payload version (%s), using version 1", url, resp.Status)
+		return 1
+	}
+	negotiated := 1
+	for _, version := range accepted.PayloadVersions {
+		if version > negotiated && version <= latest && isSupportedPayloadVersion(version) {
+			negotiated = version
+		}
+	}
+	glog.Infof("Negotiated payload version %d with the aggregator", negotiated)
+	return negotiated
+}
+
+// Returns whether the collector can send the payload version.
+func isSupportedPayloadVersion(version int) bool {
+	for _, supported := range supportedPayloadVersions {
+		if version == supported {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package send
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	"github.com/stolostron/search-collector/pkg/transforms"
+)
+
+// Starts an aggregator accepting the given payload versions, nil for an aggregator that predates the negotiation.
+// The bodies of the sync requests are passed to received.
+func payloadVersionServer(t *testing.T, versions []int,
+	received func(r *http.Request, body map[string]interface{})) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			if versions == nil {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(payloadVersionResponse{PayloadVersions: versions})
+			return
+		}
+		body := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if r.Header.Get(payloadVersionHeader) == "2" && versions == nil {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		received(r, body)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(SyncResponse{TotalResources: 1})
+	}))
+}
+
+func TestNegotiatePayloadVersion(t *testing.T) {
+	defer func() { config.Cfg.PayloadVersion = config.DEFAULT_PAYLOAD_VERSION }()
+	for _, test := range []struct {
+		name     string
+		latest   int
+		accepted []int
+		expected int
+	}{
+		{"version 1 configured", 1, []int{1, 2}, 1},
+		{"aggregator without negotiation", 2, nil, 1},
+		{"both support version 2", 2, []int{1, 2}, 2},
+		{"aggregator only supports version 1", 2, []int{1}, 1},
+		{"aggregator supports a newer version", 2, []int{1, 2, 3}, 2},
+	} {
+		config.Cfg.PayloadVersion = test.latest
+		ts := payloadVersionServer(t, test.accepted, func(*http.Request, map[string]interface{}) {})
+		s := Sender{httpClient: *ts.Client(), aggregatorURL: ts.URL}
+		if actual := s.negotiatedPayloadVersion(); actual != test.expected {
+			t.Errorf("%s: expected payload version %d, got %d", test.name, test.expected, actual)
+		}
+		ts.Close()
+	}
+}
+
+func TestSenderPayloadV2(t *testing.T) {
+	defer func() { config.Cfg.PayloadVersion = config.DEFAULT_PAYLOAD_VERSION }()
+	config.Cfg.PayloadVersion = 2
+
+	var body map[string]interface{}
+	ts := payloadVersionServer(t, []int{1, 2}, func(r *http.Request, received map[string]interface{}) {
+		if version := r.Header.Get(payloadVersionHeader); version != "2" {
+			t.Errorf("Expected the payload version header to be 2, got %q", version)
+		}
+		body = received
+	})
+	defer ts.Close()
+
+	s := Sender{httpClient: *ts.Client(), aggregatorURL: ts.URL}
+	payload := Payload{
+		RequestId:        7,
+		StoreHash:        "00000000000000ff",
+		AddResources:     []transforms.Node{{UID: "Node0"}},
+		DeletedResources: []transforms.Deletion{{UID: "Node1"}},
+	}
+	if err := s.send(payload, 1, 0); err != nil {
+		t.Fatal("send function reports error:", err)
+	}
+
+	metadata, _ := body["metadata"].(map[string]interface{})
+	if metadata["payloadVersion"] != float64(2) || metadata["requestId"] != float64(7) ||
+		metadata["totalResources"] != float64(1) || metadata["collectorVersion"] != config.COLLECTOR_API_VERSION ||
+		metadata["storeHash"] != "00000000000000ff" {
+		t.Errorf("Unexpected metadata %v", metadata)
+	}
+	if deleted, _ := body["deleteResources"].([]interface{}); len(deleted) != 1 || deleted[0] != "Node1" {
+		t.Errorf("Expected the UIDs of the deleted nodes, got %v", body["deleteResources"])
+	}
+}
+
+func TestSenderPayloadVersionFallback(t *testing.T) {
+	defer func() { config.Cfg.PayloadVersion = config.DEFAULT_PAYLOAD_VERSION }()
+	config.Cfg.PayloadVersion = 2
+
+	var bodies []map[string]interface{}
+	ts := payloadVersionServer(t, nil, func(r *http.Request, received map[string]interface{}) {
+		bodies = append(bodies, received)
+	})
+	defer ts.Close()
+
+	// The version was negotiated with an aggregator that has since been downgraded.
+	s := Sender{httpClient: *ts.Client(), aggregatorURL: ts.URL, payloadVersion: 2}
+	if err := s.sendWithRetry(Payload{AddResources: []transforms.Node{{UID: "Node0"}}}, 1, 0); err != nil {
+		t.Fatal("sendWithRetry reports error:", err)
+	}
+	if len(bodies) != 1 || bodies[0]["metadata"] != nil || s.payloadVersion != 1 {
+		t.Errorf("Expected the payload to be resent with version 1, got %v", bodies)
+	}
+}
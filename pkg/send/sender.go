@@ -12,6 +12,8 @@ package send
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"crypto/rand"
 	"encoding/json"
 	"errors"
@@ -19,6 +21,7 @@ import (
 	"math"
 	"math/big"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -45,6 +48,9 @@ type Payload struct {
 	ClearAll    bool      `json:"clearAll,omitempty"`    // Tells the aggregator to clear existing data first.
 	RequestId   int       `json:"requestId,omitempty"`   // Unique ID to track each request for debug.
 	Version     string    `json:"version,omitempty"`     // Version of this collector
+	// Hash of the collector's nodes once the payload is applied, for the aggregator to detect it diverged. It's the
+	// sum, modulo 2^64 and in hex, of the FNV-1a 64-bit hash of the UID and reconciler.NodeHash of each node.
+	StoreHash string `json:"storeHash,omitempty"`
 }
 
 func (p Payload) empty() bool {
@@ -66,9 +72,23 @@ type SyncResponse struct {
 	DeleteErrors      []SyncError
 	AddEdgeErrors     []SyncError
 	DeleteEdgeErrors  []SyncError
+	ResyncRequired    bool // The aggregator's data diverged, it needs the complete state before the next diffs
 	Version           string
 }
 
+// Returned when the aggregator asks for the complete state, with a 409 Conflict or ResyncRequired in its response.
+var errResyncRequired = errors.New("Aggregator requires a resync")
+
+// Returned when the backend answers with 429 Too Many Requests, the payload is sent again after a backoff.
+var errBusy = errors.New("Aggregator busy")
+
+// Backend delivers the payloads built by the Sender somewhere other than the aggregator.
+// Send returns an error if the payload wasn't delivered. The expected totals are the number of nodes and edges
+// after the payload is applied, for the backends that keep the state and can check it.
+type Backend interface {
+	Send(payload Payload, expectedTotalResources int, expectedTotalEdges int) error
+}
+
 // SyncError is used to respond with errors.
 type SyncError struct {
 	ResourceUID string
@@ -82,6 +102,9 @@ type Sender struct {
 	httpClient         http.Client
 	lastSentTime       int64 // Time we last successfully sent data to the hub. Gets reset to -1 if a send cycle fails.
 	rec                *reconciler.Reconciler
+	backend            Backend         // Where the payloads are sent instead of the aggregator, nil for the aggregator
+	sentState          *sentStateStore // The state last sent, kept in LAST_SENT_STATE_FILE, nil when it's not set
+	payloadVersion     int             // Payload version negotiated with the aggregator, 0 until it's negotiated
 }
 
 func (s *Sender) reloadSender() {
@@ -91,6 +114,24 @@ func (s *Sender) reloadSender() {
 		s.aggregatorSyncPath = strings.Join([]string{"/", config.Cfg.ClusterName, "/aggregator/sync"}, "")
 	}
 	s.httpClient = getHTTPSClient()
+	s.backend = newConfiguredBackend()
+	s.payloadVersion = 0 // The aggregator may have changed, the version is negotiated again.
+}
+
+// Returns the backend selected with SENDER_BACKEND, or nil for the aggregator.
+func newConfiguredBackend() Backend {
+	switch config.Cfg.SenderBackend {
+	case "webhook":
+		return newWebhookBackend(config.Cfg.WebhookURL, config.Cfg.WebhookHeaders)
+	case "kafka":
+		return newKafkaBackend(config.Cfg.KafkaRestURL, config.Cfg.KafkaTopic, config.Cfg.KafkaTopicPerOperation,
+			config.Cfg.ClusterName)
+	case "", "aggregator":
+		return nil
+	default:
+		glog.Errorf("Unknown SENDER_BACKEND %s, sending to the aggregator", config.Cfg.SenderBackend)
+		return nil
+	}
 }
 
 // Constructs a new Sender using the provided channels.
@@ -104,6 +145,8 @@ func NewSender(rec *reconciler.Reconciler, aggregatorURL, clusterName string) *S
 		httpClient:         getHTTPSClient(),
 		lastSentTime:       -1,
 		rec:                rec,
+		backend:            newConfiguredBackend(),
+		sentState:          newSentStateStore(config.Cfg.LastSentStateFile, clusterName),
 	}
 
 	if !config.Cfg.DeployedInHub {
@@ -140,11 +183,30 @@ func (s *Sender) diffPayload() (Payload, int, int) {
 
 		AddEdges:    diff.AddEdges,
 		DeleteEdges: diff.DeleteEdges,
+		StoreHash:   diff.StoreHash,
 	}
 
 	return payload, diff.TotalNodes, diff.TotalEdges
 }
 
+// Returns a payload with the delta from the state sent before the restart, and the expected totals.
+func (s *Sender) restoredPayload(sent reconciler.SentState) (Payload, int, int) {
+	diff := s.rec.DiffFrom(sent)
+	payload := Payload{
+		RequestId: generateRequestId(),
+		Version:   config.COLLECTOR_API_VERSION,
+
+		AddResources:     diff.AddNodes,
+		UpdatedResources: diff.UpdateNodes,
+		DeletedResources: diff.DeleteNodes,
+
+		AddEdges:    diff.AddEdges,
+		DeleteEdges: diff.DeleteEdges,
+		StoreHash:   diff.StoreHash,
+	}
+	return payload, diff.TotalNodes, diff.TotalEdges
+}
+
 // Fetches complete state from the reconciler and transforms into payload struct
 func (s *Sender) completePayload() (Payload, int, int) {
 
@@ -156,7 +218,8 @@ func (s *Sender) completePayload() (Payload, int, int) {
 		RequestId:    generateRequestId(),
 		AddResources: complete.Nodes,
 
-		AddEdges: complete.Edges,
+		AddEdges:  complete.Edges,
+		StoreHash: complete.StoreHash,
 	}
 	return payload, complete.TotalNodes, complete.TotalEdges
 }
@@ -166,15 +229,29 @@ func (s *Sender) completePayload() (Payload, int, int) {
 func (s *Sender) sendWithRetry(payload Payload, expectedTotalResources int, expectedTotalEdges int) error {
 	retry := 0
 	for {
-		sendError := s.send(payload, expectedTotalResources, expectedTotalEdges)
+		var sendError error
+		if s.backend != nil {
+			sendError = s.backend.Send(payload, expectedTotalResources, expectedTotalEdges)
+		} else {
+			sendError = s.send(payload, expectedTotalResources, expectedTotalEdges)
+		}
 		retry++
 		waitMS := int(math.Min(float64(retry*15*1000), float64(config.Cfg.MaxBackoffMS)))
 
-		if sendError != nil && sendError.Error() == "Aggregator busy" {
+		if sendError == nil {
+			s.sentState.record(payload)
+			return nil
+		} else if errors.Is(sendError, errResyncRequired) {
+			// Not an error of the aggregator, the complete state is sent right away.
+			return sendError
+		} else if errors.Is(sendError, errPayloadVersion) {
+			glog.Warning("Aggregator rejected the payload version, resending with version 1.")
+			continue
+		} else if errors.Is(sendError, errBusy) {
 			glog.Warningf("Received busy response from Aggregator. Resending in %d ms.", waitMS)
 			time.Sleep(time.Duration(waitMS) * time.Millisecond)
 			continue
-		} else if sendError != nil {
+		} else {
 			glog.Warningf("Received error response [%s] from Aggregator. Resending in %d ms after resetting config.",
 				sendError.Error(), waitMS)
 			time.Sleep(time.Duration(waitMS) * time.Millisecond)
@@ -182,24 +259,39 @@ func (s *Sender) sendWithRetry(payload Payload, expectedTotalResources int, expe
 			s.reloadSender()    // reload sender variables - Aggregator URL, path and client
 			return sendError
 		}
-		return sendError
 	}
 }
 
 // Sends data to the aggregator and returns an error if it didn't work.
 // Pointer receiver because Sender contains a mutex - that freaked the linter out even though it
 // doesn't use the mutex. Changed it so that if we do need to use the mutex we wont have any problems.
-func (s *Sender) send(payload Payload, expectedTotalResources int, expectedTotalEdges int) error {
+func (s *Sender) send(payload Payload, expectedTotalResources int, expectedTotalEdges int) (err error) {
 	glog.Infof("Sending Resources { request: %d, add: %d, update: %d, delete: %d edge add: %d edge delete: %d }",
 		payload.RequestId, len(payload.AddResources), len(payload.UpdatedResources), len(payload.DeletedResources),
 		len(payload.AddEdges), len(payload.DeleteEdges))
 
-	payloadBytes, err := json.Marshal(payload)
+	version := s.negotiatedPayloadVersion()
+	payloadBytes, err := marshalPayload(payload, version, expectedTotalResources, expectedTotalEdges)
+	if err != nil {
+		return err
+	}
+	req, err := newPayloadRequest(s.aggregatorURL+s.aggregatorSyncPath, payloadBytes)
 	if err != nil {
 		return err
 	}
-	payloadBuffer := bytes.NewBuffer(payloadBytes)
-	resp, err := s.httpClient.Post(s.aggregatorURL+s.aggregatorSyncPath, "application/json", payloadBuffer)
+	if version > 1 {
+		req.Header.Set(payloadVersionHeader, strconv.Itoa(version))
+	}
+	payloadSizes.WithLabelValues(payloadLabel(payload)).Observe(float64(req.ContentLength))
+	start := time.Now()
+	defer func() {
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+		sendDuration.WithLabelValues(payloadLabel(payload), result).Observe(time.Since(start).Seconds())
+	}()
+	resp, err := s.httpClient.Do(req)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
@@ -208,7 +300,12 @@ func (s *Sender) send(payload Payload, expectedTotalResources int, expectedTotal
 		return err
 	}
 	if resp.StatusCode == http.StatusTooManyRequests {
-		return errors.New("Aggregator busy")
+		return errBusy
+	} else if resp.StatusCode == http.StatusConflict {
+		return errResyncRequired
+	} else if resp.StatusCode == http.StatusUnsupportedMediaType && version > 1 {
+		s.payloadVersion = 1
+		return errPayloadVersion
 	} else if resp.StatusCode != http.StatusOK {
 		msg := fmt.Sprintf("POST to: %s responded with error. StatusCode: %d  Message: %s",
 			s.aggregatorURL+s.aggregatorSyncPath, resp.StatusCode, resp.Status)
@@ -224,6 +321,9 @@ func (s *Sender) send(payload Payload, expectedTotalResources int, expectedTotal
 		glog.Error("Error decoding JSON response.")
 		return err
 	}
+	if r.ResyncRequired {
+		return errResyncRequired
+	}
 
 	// Compare size that comes back in r to size that we track, accounting for the errors reported by the aggregator.
 	if r.TotalResources != (expectedTotalResources + len(r.DeleteErrors) - len(r.AddErrors)) {
@@ -242,11 +342,47 @@ func (s *Sender) send(payload Payload, expectedTotalResources int, expectedTotal
 	return nil
 }
 
+// Builds the POST request of the payload, with the body compressed with gzip when COMPRESS_PAYLOADS is enabled.
+func newPayloadRequest(url string, payloadBytes []byte) (*http.Request, error) {
+	body := bytes.NewBuffer(payloadBytes)
+	if config.Cfg.CompressPayloads {
+		body = &bytes.Buffer{}
+		w := gzip.NewWriter(body)
+		if _, err := w.Write(payloadBytes); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		glog.V(3).Infof("Compressed payload from %d to %d bytes", len(payloadBytes), body.Len())
+	}
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if config.Cfg.CompressPayloads {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	return req, nil
+}
+
 // Sends data to the aggregator.
 // Attempts to send a diff, then just sends the complete if the aggregator appears to need that.
 func (s *Sender) Sync() error {
+	// After a restart, the delta from the state sent before the restart is sent instead of the complete state.
+	if sent, ok := s.sentState.takeRestored(); ok && s.lastSentTime == -1 {
+		glog.Info("Sending the delta from the state sent before the restart")
+		payload, expectedTotalResources, expectedTotalEdges := s.restoredPayload(sent)
+		if err := s.sendWithRetry(payload, expectedTotalResources, expectedTotalEdges); err == nil {
+			s.lastSentTime = time.Now().Unix()
+			return nil
+		}
+		glog.Warning("Error sending the delta from the state sent before the restart, sending complete payload")
+	}
 	if s.lastSentTime == -1 { // If we have never sent before, we just send the complete.
 		glog.Info("First time sending or last Sync cycle failed, sending complete payload")
+		resyncs.WithLabelValues("startup").Inc()
 		payload, expectedTotalResources, expectedTotalEdges := s.completePayload()
 		err := s.sendWithRetry(payload, expectedTotalResources, expectedTotalEdges)
 		if err != nil {
@@ -272,7 +408,14 @@ func (s *Sender) Sync() error {
 	if err != nil {
 		// If something went wrong here, form a new complete payload (only necessary because
 		// currentState may have changed since we got it, and we have to keep our diffs synced)
-		glog.Warning("Error on diff payload sending: ", err)
+		// The aggregator can also ask for it when its data diverged from ours.
+		if errors.Is(err, errResyncRequired) {
+			glog.Warning("Aggregator requires a resync")
+			resyncs.WithLabelValues("required").Inc()
+		} else {
+			glog.Warning("Error on diff payload sending: ", err)
+			resyncs.WithLabelValues("diff_error").Inc()
+		}
 		payload, expectedTotalResources, expectedTotalEdges := s.completePayload()
 		glog.Warning("Retrying with complete payload")
 		err := s.sendWithRetry(payload, expectedTotalResources, expectedTotalEdges)
@@ -292,8 +435,8 @@ func (s *Sender) Sync() error {
 }
 
 // Starts the send loop to send data on an interval.
-// In case of error it backoffs and retries.
-func (s *Sender) StartSendLoop() {
+// In case of error it backoffs and retries. Returns once ctx is done, after the send in progress.
+func (s *Sender) StartSendLoop(ctx context.Context) {
 
 	// Used for exponential backoff, increased each interval. Has to be a float64 since I use it with math.Exp2()
 	backoffFactor := float64(0)
@@ -319,7 +462,12 @@ func (s *Sender) StartSendLoop() {
 			glog.Warning("Backing off send interval because of error response from aggregator. Sleeping for ", timeToSleep)
 		}
 		// Sleep either for the current backed off interval, or the maximum time defined in the config
-		time.Sleep(timeToSleep)
+		select {
+		case <-ctx.Done():
+			glog.Info("Stopped the send loop")
+			return
+		case <-time.After(timeToSleep):
+		}
 	}
 }
 
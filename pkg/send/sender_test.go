@@ -11,13 +11,18 @@ irrespective of what has been deposited with the U.S. Copyright Office.
 package send
 
 import (
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stolostron/search-collector/pkg/config"
+	"github.com/stolostron/search-collector/pkg/reconciler"
 	"github.com/stolostron/search-collector/pkg/transforms"
 )
 
@@ -117,3 +122,141 @@ func TestSenderSuccessful(t *testing.T) {
 		t.Fatal("send function reports error:", err)
 	}
 }
+
+func TestSenderCompressedPayload(t *testing.T) {
+	defer func(compress bool) { config.Cfg.CompressPayloads = compress }(config.Cfg.CompressPayloads)
+	config.Cfg.CompressPayloads = true
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if encoding := r.Header.Get("Content-Encoding"); encoding != "gzip" {
+			t.Errorf("Expected the gzip Content-Encoding, got %q", encoding)
+		}
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		received := Payload{}
+		if err := json.NewDecoder(reader).Decode(&received); err != nil {
+			t.Fatal("Expected the compressed body to be the JSON payload:", err)
+		}
+		response := SyncResponse{TotalResources: len(received.AddResources), TotalAdded: len(received.AddResources)}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer ts.Close()
+
+	s := Sender{
+		httpClient:    *ts.Client(),
+		aggregatorURL: ts.URL,
+	}
+	payload := Payload{AddResources: []transforms.Node{{UID: "Node0"}, {UID: "Node1"}}}
+
+	if err := s.send(payload, 2, 0); err != nil {
+		t.Fatal("send function reports error:", err)
+	}
+}
+
+func TestSenderResyncRequired(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		response func(w http.ResponseWriter)
+	}{
+		{"conflict", func(w http.ResponseWriter) { w.WriteHeader(http.StatusConflict) }},
+		{"resync required", func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(200)
+			_ = json.NewEncoder(w).Encode(SyncResponse{ResyncRequired: true})
+		}},
+	} {
+		var clearAll []bool
+		ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received := Payload{}
+			if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+				t.Fatal(err)
+			}
+			clearAll = append(clearAll, received.ClearAll)
+			if !received.ClearAll {
+				test.response(w)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(200)
+			_ = json.NewEncoder(w).Encode(SyncResponse{})
+		}))
+
+		s := NewSender(reconciler.NewReconciler(), ts.URL, "local-cluster")
+		s.httpClient = *ts.Client()
+		s.lastSentTime = time.Now().Unix() - int64(config.Cfg.HeartbeatMS/1000) // Sends the heartbeat diff
+
+		// The diff is followed by the complete state, without waiting for a retry.
+		if err := s.Sync(); err != nil {
+			t.Errorf("%s: expected the complete payload to be sent, got %v", test.name, err)
+		}
+		ts.Close()
+		if len(clearAll) != 2 || clearAll[0] || !clearAll[1] {
+			t.Errorf("%s: expected a diff then a complete payload, got clearAll %v", test.name, clearAll)
+		}
+	}
+}
+
+func TestSenderStoreHash(t *testing.T) {
+	var received []map[string]interface{}
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		_ = json.NewEncoder(w).Encode(SyncResponse{})
+	}))
+	defer ts.Close()
+
+	s := NewSender(reconciler.NewReconciler(), ts.URL, "local-cluster")
+	s.httpClient = *ts.Client()
+	if err := s.Sync(); err != nil {
+		t.Fatal("Sync reports error:", err)
+	}
+	if len(received) != 1 || received[0]["storeHash"] != "0000000000000000" {
+		t.Errorf("Expected the payload to have the hash of the empty store, got %v", received)
+	}
+
+	// Older aggregators don't get the field when there's no hash.
+	encoded, err := json.Marshal(Payload{RequestId: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(encoded), "storeHash") {
+		t.Errorf("Expected the store hash to be omitted, got %s", encoded)
+	}
+}
+
+func TestSenderMetrics(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		_ = json.NewEncoder(w).Encode(SyncResponse{})
+	}))
+	defer ts.Close()
+
+	s := NewSender(reconciler.NewReconciler(), ts.URL, "local-cluster")
+	s.httpClient = *ts.Client()
+	startups := testutil.ToFloat64(resyncs.WithLabelValues("startup"))
+
+	if err := s.Sync(); err != nil {
+		t.Fatal("Sync reports error:", err)
+	}
+	if actual := testutil.ToFloat64(resyncs.WithLabelValues("startup")) - startups; actual != 1 {
+		t.Errorf("Expected the first complete payload to be counted, got %v", actual)
+	}
+	if actual := testutil.CollectAndCount(sendDuration, "search_collector_sender_send_duration_seconds"); actual < 1 {
+		t.Error("Expected the send duration to be observed")
+	}
+	if actual := testutil.CollectAndCount(payloadSizes, "search_collector_sender_payload_bytes"); actual < 1 {
+		t.Error("Expected the payload size to be observed")
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package send
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/glog"
+	"github.com/stolostron/search-collector/pkg/config"
+	"github.com/stolostron/search-collector/pkg/reconciler"
+	tr "github.com/stolostron/search-collector/pkg/transforms"
+)
+
+// Keeps the state last acknowledged by the aggregator in a file, so that after a restart the sender can send the
+// delta from that state instead of the complete state.
+// The file has a snapshot of the state, and each payload acknowledged since is appended to a log next to it, so a
+// send only writes its changes. The snapshot is rewritten, and the log emptied, once the log is bigger than it.
+type sentStateStore struct {
+	path         string
+	state        reconciler.SentState
+	restored     bool  // The state was read from the file and wasn't used yet
+	snapshotSize int64 // Size of the snapshot file, the log is compacted once it's bigger
+	logSize      int64 // Size of the log file
+}
+
+// The content of the file. The state is only used by a collector of the same cluster and version.
+type sentStateFile struct {
+	Cluster string               `json:"cluster"`
+	Version string               `json:"version"`
+	State   reconciler.SentState `json:"state"`
+}
+
+// The changes of an acknowledged payload, a line of the log.
+type sentStateChange struct {
+	Nodes        map[string]string `json:"nodes,omitempty"`        // Hash of the added and updated nodes, by UID
+	DeletedNodes []string          `json:"deletedNodes,omitempty"` // The aggregator deletes their edges with them
+	Edges        []sentEdge        `json:"edges,omitempty"`
+	DeletedEdges []sentEdge        `json:"deletedEdges,omitempty"`
+}
+
+// The key of an edge in the log.
+type sentEdge struct {
+	Source string      `json:"source"`
+	Dest   string      `json:"dest"`
+	Type   tr.EdgeType `json:"type,omitempty"`
+}
+
+// Returns the path of the log of the state file.
+func sentStateLogPath(path string) string {
+	return path + ".log"
+}
+
+// Returns the store of the file, with the state read from it if there's one. Returns nil if the path is empty.
+func newSentStateStore(path, clusterName string) *sentStateStore {
+	if path == "" {
+		return nil
+	}
+	store := &sentStateStore{path: path, state: reconciler.NewSentState()}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		glog.Info("No state was sent before, the complete state will be sent")
+		return store
+	} else if err != nil {
+		glog.Errorf("Failed to read the sent state from %s, the complete state will be sent: %v", path, err)
+		return store
+	}
+	file := sentStateFile{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		glog.Errorf("Failed to decode the sent state from %s, the complete state will be sent: %v", path, err)
+		return store
+	}
+	if file.Cluster != clusterName || file.Version != config.COLLECTOR_API_VERSION || file.State.Nodes == nil {
+		glog.Infof("The sent state is from cluster %s version %s, the complete state will be sent",
+			file.Cluster, file.Version)
+		return store
+	}
+	if file.State.Edges == nil {
+		file.State.Edges = reconciler.NewSentState().Edges
+	}
+	store.state = file.State
+	store.snapshotSize = int64(len(data))
+	store.replayLog()
+	glog.Infof("Restored the sent state of %d nodes from %s", len(store.state.Nodes), path)
+	store.restored = true
+	return store
+}
+
+// Applies the changes of the log to the state. A line that can't be decoded, like a line cut short by a crash,
+// ends the log: the changes after it weren't written. The changes are applied in order, so replaying the log over
+// a snapshot that already has them, when the collector stopped while compacting, gives the same state.
+func (s *sentStateStore) replayLog() {
+	log, err := os.Open(sentStateLogPath(s.path))
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		glog.Errorf("Failed to read the log of the sent state, using the snapshot: %v", err)
+		return
+	}
+	defer log.Close()
+	reader := bufio.NewReader(log)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return // A line without its newline wasn't written completely
+		} else if err != nil {
+			glog.Errorf("Failed to read the log of the sent state: %v", err)
+			return
+		}
+		change := sentStateChange{}
+		if err := json.Unmarshal(line, &change); err != nil {
+			glog.Warningf("Failed to decode the log of the sent state, ignoring the rest: %v", err)
+			return
+		}
+		s.logSize += int64(len(line))
+		s.apply(change)
+	}
+}
+
+// Applies the payload the aggregator acknowledged to the state, and writes its changes to the log, or writes the
+// snapshot if the state was cleared or the log is bigger than the snapshot.
+// Empty payloads don't change the state, so nothing is written.
+func (s *sentStateStore) record(payload Payload) {
+	if s == nil || (payload.empty() && !payload.ClearAll) {
+		return
+	}
+	change := sentStateChange{Nodes: make(map[string]string, len(payload.AddResources)+len(payload.UpdatedResources))}
+	for _, node := range payload.AddResources {
+		change.Nodes[node.UID] = reconciler.NodeHash(node)
+	}
+	for _, node := range payload.UpdatedResources {
+		change.Nodes[node.UID] = reconciler.NodeHash(node)
+	}
+	for _, deletion := range payload.DeletedResources {
+		change.DeletedNodes = append(change.DeletedNodes, deletion.UID)
+	}
+	for _, edge := range payload.AddEdges {
+		change.Edges = append(change.Edges, sentEdge{Source: edge.SourceUID, Dest: edge.DestUID, Type: edge.EdgeType})
+	}
+	for _, edge := range payload.DeleteEdges {
+		change.DeletedEdges = append(change.DeletedEdges, sentEdge{Source: edge.SourceUID, Dest: edge.DestUID})
+	}
+	if payload.ClearAll {
+		s.state = reconciler.NewSentState()
+	}
+	s.apply(change)
+	if payload.ClearAll || !s.appendLog(change) || s.logSize > s.snapshotSize {
+		s.save()
+	}
+}
+
+// Applies the changes to the state.
+func (s *sentStateStore) apply(change sentStateChange) {
+	for uid, hash := range change.Nodes {
+		s.state.Nodes[uid] = hash
+	}
+	deleted := make(map[string]struct{}, len(change.DeletedNodes))
+	for _, uid := range change.DeletedNodes {
+		delete(s.state.Nodes, uid)
+		deleted[uid] = struct{}{}
+	}
+	for _, edge := range change.Edges {
+		if _, ok := s.state.Edges[edge.Source]; !ok {
+			s.state.Edges[edge.Source] = make(map[string]tr.EdgeType)
+		}
+		s.state.Edges[edge.Source][edge.Dest] = edge.Type
+	}
+	for _, edge := range change.DeletedEdges {
+		delete(s.state.Edges[edge.Source], edge.Dest)
+		if len(s.state.Edges[edge.Source]) == 0 {
+			delete(s.state.Edges, edge.Source)
+		}
+	}
+	// The aggregator deletes the edges of the deleted nodes with them.
+	if len(deleted) > 0 {
+		for srcUID, destMap := range s.state.Edges {
+			if _, ok := deleted[srcUID]; ok {
+				delete(s.state.Edges, srcUID)
+				continue
+			}
+			for destUID := range destMap {
+				if _, ok := deleted[destUID]; ok {
+					delete(destMap, destUID)
+				}
+			}
+		}
+	}
+}
+
+// Appends the changes to the log. Returns false if they couldn't be written, the snapshot is written instead.
+func (s *sentStateStore) appendLog(change sentStateChange) bool {
+	line, err := json.Marshal(change)
+	if err != nil {
+		glog.Error("Failed to encode the sent state changes: ", err)
+		return false
+	}
+	log, err := os.OpenFile(sentStateLogPath(s.path), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		glog.Error("Failed to write the log of the sent state: ", err)
+		return false
+	}
+	n, err := log.Write(append(line, '\n'))
+	s.logSize += int64(n)
+	if closeErr := log.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		glog.Error("Failed to write the log of the sent state: ", err)
+		return false
+	}
+	return true
+}
+
+// Writes the state to a temporary file, then renames it, so a crash never leaves a partial state. Then empties
+// the log, the snapshot has its changes.
+func (s *sentStateStore) save() {
+	data, err := json.Marshal(sentStateFile{Cluster: config.Cfg.ClusterName, Version: config.COLLECTOR_API_VERSION,
+		State: s.state})
+	if err != nil {
+		glog.Error("Failed to encode the sent state: ", err)
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		glog.Error("Failed to write the sent state: ", err)
+		return
+	}
+	defer os.Remove(tmp.Name()) // Fails once it's renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		glog.Error("Failed to write the sent state: ", err)
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		glog.Error("Failed to write the sent state: ", err)
+		return
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		glog.Error("Failed to write the sent state: ", err)
+		return
+	}
+	s.snapshotSize = int64(len(data))
+	if err := os.Remove(sentStateLogPath(s.path)); err != nil && !os.IsNotExist(err) {
+		glog.Error("Failed to empty the log of the sent state: ", err)
+		return
+	}
+	s.logSize = 0
+}
+
+// Returns the state restored from the file the first time it's called after the collector started, and false
+// afterwards or if there was no state to restore.
+func (s *sentStateStore) takeRestored() (reconciler.SentState, bool) {
+	if s == nil || !s.restored {
+		return reconciler.SentState{}, false
+	}
+	s.restored = false
+	return s.state, true
+}
@@ -0,0 +1,126 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package send
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	"github.com/stolostron/search-collector/pkg/reconciler"
+	"github.com/stolostron/search-collector/pkg/transforms"
+)
+
+func TestSentStateStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sent-state.json")
+	store := newSentStateStore(path, config.Cfg.ClusterName)
+	if _, restored := store.takeRestored(); restored {
+		t.Fatal("Expected nothing to restore without a file")
+	}
+
+	node := transforms.Node{UID: "Node0", Properties: map[string]interface{}{"kind": "Pod"}}
+	store.record(Payload{ClearAll: true,
+		AddResources: []transforms.Node{node, {UID: "Node1"}},
+		AddEdges: []transforms.Edge{{EdgeType: "ownedBy", SourceUID: "Node0", DestUID: "Node1"},
+			{EdgeType: "ownedBy", SourceUID: "Node0", DestUID: "Node2"}},
+	})
+	store.record(Payload{DeletedResources: []transforms.Deletion{{UID: "Node1"}}})
+
+	restoredStore := newSentStateStore(path, config.Cfg.ClusterName)
+	state, restored := restoredStore.takeRestored()
+	if !restored {
+		t.Fatal("Expected the state to be restored from the file")
+	}
+	if len(state.Nodes) != 1 || state.Nodes["Node0"] != reconciler.NodeHash(node) {
+		t.Errorf("Expected the hash of Node0 only, got %v", state.Nodes)
+	}
+	// The edge to the deleted node is deleted with it.
+	if len(state.Edges["Node0"]) != 1 || state.Edges["Node0"]["Node2"] != "ownedBy" {
+		t.Errorf("Expected the edge to Node2 only, got %v", state.Edges)
+	}
+	if _, restored := restoredStore.takeRestored(); restored {
+		t.Error("Expected the state to be restored only once")
+	}
+
+	// The state of another cluster isn't restored.
+	if _, restored := newSentStateStore(path, "other-cluster").takeRestored(); restored {
+		t.Error("Expected the state of another cluster to be ignored")
+	}
+}
+
+func TestSentStateStoreLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sent-state.json")
+	store := newSentStateStore(path, config.Cfg.ClusterName)
+	store.record(Payload{ClearAll: true, AddResources: []transforms.Node{{UID: "Node0"}, {UID: "Node1"}}})
+	snapshot, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The next sends are appended to the log, the snapshot isn't rewritten.
+	store.record(Payload{AddResources: []transforms.Node{{UID: "Node2"}}})
+	store.record(Payload{DeletedResources: []transforms.Deletion{{UID: "Node0"}}})
+	if current, _ := os.ReadFile(path); !bytes.Equal(current, snapshot) {
+		t.Error("Expected the snapshot to be left as it is")
+	}
+	// A line cut short by a crash is ignored.
+	log, err := os.OpenFile(sentStateLogPath(path), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal("Expected the changes in the log: ", err)
+	}
+	_, _ = log.WriteString(`{"deletedNodes":["Node1"`)
+	log.Close()
+	state, _ := newSentStateStore(path, config.Cfg.ClusterName).takeRestored()
+	if len(state.Nodes) != 2 || state.Nodes["Node1"] == "" || state.Nodes["Node2"] == "" {
+		t.Errorf("Expected the snapshot with the changes of the log, got %v", state.Nodes)
+	}
+
+	// The log is compacted into the snapshot once it's bigger.
+	for i := 0; i < 10; i++ {
+		store.record(Payload{UpdatedResources: []transforms.Node{{UID: "Node2",
+			Properties: map[string]interface{}{"restarts": i}}}})
+	}
+	if store.logSize >= store.snapshotSize {
+		t.Errorf("Expected the log to be compacted, it has %d bytes", store.logSize)
+	}
+	state, _ = newSentStateStore(path, config.Cfg.ClusterName).takeRestored()
+	if state.Nodes["Node2"] != store.state.Nodes["Node2"] {
+		t.Errorf("Expected the latest hash of Node2, got %v", state.Nodes)
+	}
+}
+
+func TestSenderSyncRestoredState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sent-state.json")
+	defer func(file string) { config.Cfg.LastSentStateFile = file }(config.Cfg.LastSentStateFile)
+	config.Cfg.LastSentStateFile = path
+	newSentStateStore(path, config.Cfg.ClusterName).record(Payload{ClearAll: true,
+		AddResources: []transforms.Node{{UID: "deleted-while-down"}}})
+
+	var received []Payload
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := Payload{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, payload)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		_ = json.NewEncoder(w).Encode(SyncResponse{})
+	}))
+	defer ts.Close()
+
+	s := NewSender(reconciler.NewReconciler(), ts.URL, config.Cfg.ClusterName)
+	s.httpClient = *ts.Client()
+	if err := s.Sync(); err != nil {
+		t.Fatal("Sync reports error:", err)
+	}
+	if len(received) != 1 || received[0].ClearAll || len(received[0].DeletedResources) != 1 ||
+		received[0].DeletedResources[0].UID != "deleted-while-down" {
+		t.Errorf("Expected the delta from the restored state, got %+v", received)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package send
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Time to wait for the webhook and the Kafka REST proxy to answer.
+const backendTimeout = 60 * time.Second
+
+// Sends each payload as JSON in the body of a POST to a URL, with the configured headers, like an Authorization
+// header. The body is the aggregator's payload, so it's compressed with COMPRESS_PAYLOADS too.
+type webhookBackend struct {
+	url        string
+	headers    map[string]string
+	httpClient http.Client
+}
+
+func newWebhookBackend(url string, headers map[string]string) *webhookBackend {
+	if url == "" {
+		glog.Error("SENDER_BACKEND is webhook, but WEBHOOK_URL isn't set")
+	}
+	return &webhookBackend{url: url, headers: headers, httpClient: http.Client{Timeout: backendTimeout}}
+}
+
+// Send posts the payload. Any 2xx status is a success, the webhook doesn't report the totals.
+func (w *webhookBackend) Send(payload Payload, expectedTotalResources int, expectedTotalEdges int) error {
+	if payload.empty() && !payload.ClearAll {
+		glog.V(3).Info("Nothing to send to the webhook, skipping the heartbeat.")
+		return nil
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := newPayloadRequest(w.url, payloadBytes)
+	if err != nil {
+		return err
+	}
+	for name, value := range w.headers {
+		req.Header.Set(name, value)
+	}
+	payloadSizes.WithLabelValues(payloadLabel(payload)).Observe(float64(req.ContentLength))
+	return doBackendRequest(w.httpClient, req, payloadLabel(payload))
+}
+
+// Sends the request, and returns an error unless the response has a 2xx status. 429 Too Many Requests is
+// returned as errBusy, so the request is sent again after a backoff.
+func doBackendRequest(client http.Client, req *http.Request, label string) (err error) {
+	start := time.Now()
+	defer func() {
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+		sendDuration.WithLabelValues(label, result).Observe(time.Since(start).Seconds())
+	}()
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return errBusy
+	} else if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("POST to: %s responded with error. StatusCode: %d  Message: %s", req.URL.Redacted(),
+			resp.StatusCode, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package send
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stolostron/search-collector/pkg/transforms"
+)
+
+func TestWebhookBackend(t *testing.T) {
+	var received []Payload
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer abc=" {
+			t.Errorf("Expected the configured Authorization header, got %q", auth)
+		}
+		payload := Payload{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, payload)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	backend := newWebhookBackend(ts.URL, map[string]string{"Authorization": "Bearer abc="})
+	payload := Payload{ClearAll: true, AddResources: []transforms.Node{{UID: "Node0"}}}
+	if err := backend.Send(payload, 1, 0); err != nil {
+		t.Fatal("Expected the payload to be sent, got ", err)
+	}
+	// The heartbeat diffs aren't sent.
+	if err := backend.Send(Payload{}, 1, 0); err != nil {
+		t.Fatal("Expected the empty payload to be skipped, got ", err)
+	}
+	if len(received) != 1 || !received[0].ClearAll || received[0].AddResources[0].UID != "Node0" {
+		t.Errorf("Expected the complete payload to be received once, got %v", received)
+	}
+}
+
+func TestWebhookBackendErrors(t *testing.T) {
+	status := http.StatusTooManyRequests
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	backend := newWebhookBackend(ts.URL, nil)
+	payload := Payload{AddResources: []transforms.Node{{UID: "Node0"}}}
+	if err := backend.Send(payload, 1, 0); !errors.Is(err, errBusy) {
+		t.Errorf("Expected a busy error for 429, got %v", err)
+	}
+	status = http.StatusInternalServerError
+	if err := backend.Send(payload, 1, 0); err == nil || errors.Is(err, errBusy) {
+		t.Errorf("Expected an error for 500, got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/stolostron/search-collector/pkg/config"
+)
+
+// Properties kept as they are in the nodes of sensitive namespaces. They describe the type and location of the
+// resource, not the resource itself.
+var anonymizedNodeProperties = map[string]struct{}{
+	"apigroup":    {},
+	"apiversion":  {},
+	"kind":        {},
+	"kind_plural": {},
+	"namespace":   {},
+}
+
+// Returns true if the namespace is configured as sensitive.
+func isSensitiveNamespace(namespace string) bool {
+	for _, sensitive := range config.Cfg.SensitiveNamespaces {
+		if namespace == sensitive {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a stable hash of the value, so the same name always gets the same anonymized name.
+func anonymize(value string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(value)))[:16]
+}
+
+// AnonymizeNode returns a copy of the node with its name and labels hashed and the other properties stripped,
+// if the node is in a sensitive namespace. Otherwise the node is returned as it is.
+// The UID is kept, so the edges of the node still connect. The edges are built from the real names, so nodes must
+// be anonymized when they leave the collector instead of when they are transformed.
+func AnonymizeNode(node Node) Node {
+	namespace, _ := node.Properties["namespace"].(string)
+	if len(config.Cfg.SensitiveNamespaces) == 0 || !isSensitiveNamespace(namespace) {
+		return node
+	}
+
+	properties := make(map[string]interface{}, len(anonymizedNodeProperties)+3)
+	for name := range anonymizedNodeProperties {
+		if value, ok := node.Properties[name]; ok {
+			properties[name] = value
+		}
+	}
+	if name, ok := node.Properties["name"].(string); ok {
+		properties["name"] = anonymize(name)
+	}
+	if labels, ok := node.Properties["label"].(map[string]string); ok {
+		anonymizedLabels := make(map[string]string, len(labels))
+		for key, value := range labels {
+			anonymizedLabels[anonymize(key)] = anonymize(value)
+		}
+		properties["label"] = anonymizedLabels
+	}
+	properties["_anonymized"] = true
+
+	return Node{
+		UID:            node.UID,
+		ResourceString: node.ResourceString,
+		Properties:     properties,
+		Metadata:       map[string]string{},
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestAnonymizeNode(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	p.Labels = map[string]string{"team": "payments"}
+	node := PodResourceBuilder(&p).BuildNode()
+
+	// Nodes aren't anonymized unless their namespace is sensitive.
+	AssertDeepEqual("node", AnonymizeNode(node), node, t)
+
+	config.Cfg.SensitiveNamespaces = []string{"default"}
+	defer func() { config.Cfg.SensitiveNamespaces = nil }()
+
+	anonymized := AnonymizeNode(node)
+	AssertEqual("UID", anonymized.UID, node.UID, t)
+	AssertEqual("kind", anonymized.Properties["kind"], "Pod", t)
+	AssertEqual("namespace", anonymized.Properties["namespace"], "default", t)
+	AssertEqual("name", anonymized.Properties["name"], anonymize("fake-pod-dqqkm"), t)
+	AssertEqual("_anonymized", anonymized.Properties["_anonymized"], true, t)
+	AssertEqual("hostIP", anonymized.Properties["hostIP"], nil, t)
+	AssertEqual("image", anonymized.Properties["image"], nil, t)
+	AssertDeepEqual("label", anonymized.Properties["label"], map[string]string{anonymize("team"): anonymize("payments")}, t)
+
+	// The original node isn't modified.
+	AssertEqual("name", node.Properties["name"], "fake-pod-dqqkm", t)
+
+	// The hash is stable.
+	AssertEqual("name", AnonymizeNode(node).Properties["name"], anonymized.Properties["name"], t)
+}
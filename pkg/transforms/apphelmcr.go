@@ -73,20 +73,8 @@ func (a AppHelmCRResource) BuildEdges(ns NodeStore) []Edge {
 		ret = append(ret, edgesByDestinationName(releaseMap, "Release", nodeInfo, ns, []string{})...)
 	}
 
-	if a.Repo.SecretRef != nil {
-		secretMap := make(map[string]struct{})
-		if a.Repo.SecretRef.Name != "" {
-			secretMap[a.Repo.SecretRef.Name] = struct{}{}
-			ret = append(ret, edgesByDestinationName(secretMap, "Secret", nodeInfo, ns, []string{})...)
-		}
-	}
-
-	if a.Repo.ConfigMapRef != nil {
-		configmapMap := make(map[string]struct{})
-		if a.Repo.ConfigMapRef.Name != "" {
-			configmapMap[a.Repo.ConfigMapRef.Name] = struct{}{}
-			ret = append(ret, edgesByDestinationName(configmapMap, "ConfigMap", nodeInfo, ns, []string{})...)
-		}
-	}
+	// The secret and config map of the repo can be in another namespace
+	ret = append(ret, objectReferenceEdges(a.Repo.SecretRef, "Secret", nodeInfo, ns)...)
+	ret = append(ret, objectReferenceEdges(a.Repo.ConfigMapRef, "ConfigMap", nodeInfo, ns)...)
 	return ret
 }
@@ -13,6 +13,7 @@ package transforms
 import (
 	"testing"
 
+	corev1 "k8s.io/api/core/v1"
 	app "open-cluster-management.io/multicloud-operators-subscription/pkg/apis/apps/helmrelease/v1"
 )
 
@@ -28,3 +29,19 @@ func TestTransformAppHelmCR(t *testing.T) {
 	AssertEqual("name", node.Properties["name"], "testAppHelmCR", t)
 	AssertEqual("kind", node.Properties["kind"], "HelmRelease", t)
 }
+
+func TestAppHelmCRBuildEdgesCrossNamespace(t *testing.T) {
+	nodes := []Node{{
+		UID:        "local-cluster/uuid-configmap",
+		Properties: map[string]interface{}{"kind": "ConfigMap", "namespace": "helm-repos", "name": "repo-config"},
+	}}
+	nodeStore := BuildFakeNodeStore(nodes)
+
+	var a app.HelmRelease
+	UnmarshalFile("apphelmcr.json", &a, t)
+	a.Repo.ConfigMapRef = &corev1.ObjectReference{Name: "repo-config", Namespace: "helm-repos"}
+	edges := AppHelmCRResourceBuilder(&a).BuildEdges(nodeStore)
+
+	AssertEqual("HelmRelease edges", len(edges), 1, t)
+	AssertEqual("HelmRelease attachedTo", edges[0].DestUID, "local-cluster/uuid-configmap", t)
+}
@@ -0,0 +1,79 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"sync"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// The category of the kinds, by api group and kind. Used to set _category when COLLECT_CATEGORY is enabled.
+// Kinds that don't have a category don't get the property.
+var (
+	kindCategories = map[schema.GroupKind]string{
+		{Group: "", Kind: "Pod"}:                                         "workloads",
+		{Group: "", Kind: "ReplicationController"}:                       "workloads",
+		{Group: "apps", Kind: "ControllerRevision"}:                      "workloads",
+		{Group: "apps", Kind: "DaemonSet"}:                               "workloads",
+		{Group: "apps", Kind: "Deployment"}:                              "workloads",
+		{Group: "apps", Kind: "ReplicaSet"}:                              "workloads",
+		{Group: "apps", Kind: "StatefulSet"}:                             "workloads",
+		{Group: "apps.openshift.io", Kind: "DeploymentConfig"}:           "workloads",
+		{Group: "batch", Kind: "CronJob"}:                                "workloads",
+		{Group: "batch", Kind: "Job"}:                                    "workloads",
+		{Group: "", Kind: "Endpoints"}:                                   "networking",
+		{Group: "", Kind: "Service"}:                                     "networking",
+		{Group: "discovery.k8s.io", Kind: "EndpointSlice"}:               "networking",
+		{Group: "networking.k8s.io", Kind: "Ingress"}:                    "networking",
+		{Group: "networking.k8s.io", Kind: "IngressClass"}:               "networking",
+		{Group: "networking.k8s.io", Kind: "NetworkPolicy"}:              "networking",
+		{Group: "route.openshift.io", Kind: "Route"}:                     "networking",
+		{Group: "", Kind: "PersistentVolume"}:                            "storage",
+		{Group: "", Kind: "PersistentVolumeClaim"}:                       "storage",
+		{Group: "snapshot.storage.k8s.io", Kind: "VolumeSnapshot"}:       "storage",
+		{Group: "storage.k8s.io", Kind: "CSIDriver"}:                     "storage",
+		{Group: "storage.k8s.io", Kind: "CSINode"}:                       "storage",
+		{Group: "storage.k8s.io", Kind: "StorageClass"}:                  "storage",
+		{Group: "storage.k8s.io", Kind: "VolumeAttachment"}:              "storage",
+		{Group: "", Kind: "ConfigMap"}:                                   "config",
+		{Group: "", Kind: "Secret"}:                                      "config",
+		{Group: "", Kind: "ServiceAccount"}:                              "rbac",
+		{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"}:        "rbac",
+		{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}: "rbac",
+		{Group: "rbac.authorization.k8s.io", Kind: "Role"}:               "rbac",
+		{Group: "rbac.authorization.k8s.io", Kind: "RoleBinding"}:        "rbac",
+		{Group: "", Kind: "LimitRange"}:                                  "policy",
+		{Group: "", Kind: "ResourceQuota"}:                               "policy",
+		{Group: "policy", Kind: "PodDisruptionBudget"}:                   "policy",
+		{Group: "scheduling.k8s.io", Kind: "PriorityClass"}:              "policy",
+		{Group: "", Kind: "Namespace"}:                                   "cluster",
+		{Group: "", Kind: "Node"}:                                        "cluster",
+	}
+	kindCategoriesMutex = sync.RWMutex{}
+)
+
+// RegisterKindCategory sets the category of the resources of the given kind, for the kinds that don't have one or
+// to replace the built-in one. KIND_CATEGORIES takes precedence over the registered categories.
+func RegisterKindCategory(gk schema.GroupKind, category string) {
+	kindCategoriesMutex.Lock()
+	defer kindCategoriesMutex.Unlock()
+	kindCategories[gk] = category
+}
+
+// Returns the category of the kind, from KIND_CATEGORIES or the registered categories.
+// Returns false if the kind doesn't have a category.
+func kindCategory(gk schema.GroupKind) (string, bool) {
+	key := gk.Kind
+	if gk.Group != "" {
+		key += "." + gk.Group
+	}
+	if category, ok := config.Cfg.KindCategories[key]; ok {
+		return category, true
+	}
+	kindCategoriesMutex.RLock()
+	defer kindCategoriesMutex.RUnlock()
+	category, ok := kindCategories[gk]
+	return category, ok
+}
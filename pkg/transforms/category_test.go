@@ -0,0 +1,62 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestNodeEventCategory(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	var d apps.Deployment
+	UnmarshalFile("deployment.json", &d, t)
+	event := &Event{Time: time.Now().Unix(), Operation: Create}
+
+	ne := NewNodeEvent(event, PodResourceBuilder(&p), "pods")
+	AssertEqual("disabled _category", ne.Properties["_category"], nil, t)
+
+	config.Cfg.CollectCategory = true
+	defer func() { config.Cfg.CollectCategory = false }()
+	ne = NewNodeEvent(event, PodResourceBuilder(&p), "pods")
+	AssertEqual("pod _category", ne.Properties["_category"], "workloads", t)
+	ne = NewNodeEvent(event, DeploymentResourceBuilder(&d), "deployments")
+	AssertEqual("deployment _category", ne.Properties["_category"], "workloads", t)
+
+	// The kind alone doesn't match a resource from another group.
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1", "kind": "Deployment", "metadata": map[string]interface{}{"name": "other"}}}
+	ne = NewNodeEvent(event, GenericResourceBuilder(u), "deployments")
+	AssertEqual("other group _category", ne.Properties["_category"], nil, t)
+}
+
+func TestKindCategory(t *testing.T) {
+	certificate := schema.GroupKind{Group: "cert-manager.io", Kind: "Certificate"}
+	_, ok := kindCategory(certificate)
+	AssertEqual("no category", ok, false, t)
+
+	RegisterKindCategory(certificate, "security")
+	defer func() {
+		kindCategoriesMutex.Lock()
+		delete(kindCategories, certificate)
+		kindCategoriesMutex.Unlock()
+	}()
+	category, _ := kindCategory(certificate)
+	AssertEqual("registered category", category, "security", t)
+
+	defer func() { config.Cfg.KindCategories = nil }()
+	config.Cfg.KindCategories = map[string]string{"Certificate.cert-manager.io": "tls", "Event": "events"}
+	category, _ = kindCategory(certificate)
+	AssertEqual("configured category", category, "tls", t)
+	category, _ = kindCategory(schema.GroupKind{Kind: "Event"})
+	AssertEqual("configured core category", category, "events", t)
+	category, _ = kindCategory(schema.GroupKind{Kind: "Secret"})
+	AssertEqual("default category", category, "config", t)
+}
@@ -50,19 +50,9 @@ func (c ChannelResource) BuildEdges(ns NodeStore) []Edge {
 		Kind:      c.node.Properties["kind"].(string),
 		Name:      c.node.Properties["name"].(string)}
 
-	// Build uses edges to connect channel to configmaps and secrets
-	secretMap := make(map[string]struct{})
-	configmapMap := make(map[string]struct{})
-
-	if c.Spec.ConfigMapRef != nil {
-		configmapMap[c.Spec.ConfigMapRef.Name] = struct{}{}
-	}
-	if c.Spec.SecretRef != nil {
-		secretMap[c.Spec.SecretRef.Name] = struct{}{}
-	}
-
-	ret = append(ret, edgesByDestinationName(secretMap, "Secret", nodeInfo, ns, []string{})...)
-	ret = append(ret, edgesByDestinationName(configmapMap, "ConfigMap", nodeInfo, ns, []string{})...)
+	// Build uses edges to connect channel to configmaps and secrets, which can be in another namespace
+	ret = append(ret, objectReferenceEdges(c.Spec.SecretRef, "Secret", nodeInfo, ns)...)
+	ret = append(ret, objectReferenceEdges(c.Spec.ConfigMapRef, "ConfigMap", nodeInfo, ns)...)
 
 	// deploys edges
 	// HelmRepo channel to deployables edges
@@ -24,3 +24,21 @@ func TestTransformChannel(t *testing.T) {
 	// Test only the fields that exist in channel - the common test will test the other bits
 	AssertEqual("kind", node.Properties["kind"], "Channel", t)
 }
+
+func TestChannelBuildEdgesCrossNamespace(t *testing.T) {
+	nodes := []Node{{
+		UID:        "local-cluster/uuid-secret",
+		Properties: map[string]interface{}{"kind": "Secret", "namespace": "credentials", "name": "secname"},
+	}}
+	nodeStore := BuildFakeNodeStore(nodes)
+
+	var c app.Channel
+	UnmarshalFile("channel.json", &c, t)
+	AssertEqual("same namespace edges", len(ChannelResourceBuilder(&c).BuildEdges(nodeStore)), 0, t)
+
+	// The secret is looked up in the namespace of the reference.
+	c.Spec.SecretRef.Namespace = "credentials"
+	edges := ChannelResourceBuilder(&c).BuildEdges(nodeStore)
+	AssertEqual("cross namespace edges", len(edges), 1, t)
+	AssertEqual("Channel uses", edges[0].DestUID, "local-cluster/uuid-secret", t)
+}
@@ -11,12 +11,22 @@ Copyright (c) 2020 Red Hat, Inc.
 package transforms
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/stolostron/search-collector/pkg/config"
+	core "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	apiTypes "k8s.io/apimachinery/pkg/types"
 )
 
@@ -39,7 +49,18 @@ func commonProperties(resource v1.Object) map[string]interface{} {
 	}
 
 	if resource.GetLabels() != nil {
-		ret["label"] = resource.GetLabels()
+		ret["label"] = resource.GetLabels() // Filtered when the node is sent, the edges are built from all the labels.
+	}
+	if config.Cfg.CollectAnnotations && len(resource.GetAnnotations()) > 0 {
+		ret["annotation"] = filterMetadataKeys(resource.GetAnnotations())
+	}
+	// Resources being deleted stay until their finalizers are removed.
+	ret["terminating"] = resource.GetDeletionTimestamp() != nil
+	if resource.GetDeletionTimestamp() != nil {
+		ret["deletionTimestamp"] = resource.GetDeletionTimestamp().UTC().Format(time.RFC3339)
+	}
+	if config.Cfg.CollectFinalizers && len(resource.GetFinalizers()) > 0 {
+		ret["finalizers"] = resource.GetFinalizers()
 	}
 	if resource.GetNamespace() != "" {
 		ret["namespace"] = resource.GetNamespace()
@@ -51,17 +72,40 @@ func commonProperties(resource v1.Object) map[string]interface{} {
 	if resource.GetAnnotations()["apps.open-cluster-management.io/hosting-deployable"] != "" {
 		ret["_hostingDeployable"] = resource.GetAnnotations()["apps.open-cluster-management.io/hosting-deployable"]
 	}
+	numericAnnotationProperties(resource.GetAnnotations(), ret)
 	return ret
 }
 
+// Extracts the annotations configured in NUMERIC_ANNOTATIONS into numeric properties.
+// Values that aren't numbers are skipped, so a typo in an annotation doesn't change the type of the property.
+func numericAnnotationProperties(annotations map[string]string, properties map[string]interface{}) {
+	for key, property := range config.Cfg.NumericAnnotations {
+		value, ok := annotations[key]
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if intValue, err := strconv.ParseInt(value, 10, 64); err == nil {
+			properties[property] = intValue
+		} else if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			properties[property] = floatValue
+		} else {
+			glog.V(3).Infof("Skipping annotation %s with non numeric value: %s", key, value)
+		}
+	}
+}
+
 // Transforms a resource of unknown type by simply pulling out the common properties.
 func transformCommon(resource v1.Object) Node {
 	n := Node{
-		UID:        prefixedUID(resource.GetUID()),
+		UID:        PrefixedUID(resourceKind(resource), resource.GetUID()),
 		Properties: commonProperties(resource),
 		Metadata:   make(map[string]string),
 	}
 	n.Metadata["OwnerUID"] = ownerRefUID(resource.GetOwnerReferences())
+	if owners := otherOwnerUIDs(resource.GetOwnerReferences()); len(owners) > 0 {
+		n.Metadata["OtherOwnerUIDs"] = strings.Join(owners, ",")
+	}
 	// Adding OwnerReleaseName and Namespace to resources that doesn't have ownerRef but are deployed by a release.
 	if n.Metadata["OwnerUID"] == "" && resource.GetAnnotations()["meta.helm.sh/release-name"] != "" &&
 		resource.GetAnnotations()["meta.helm.sh/release-namespace"] != "" {
@@ -113,6 +157,7 @@ func CommonEdges(uid string, ns NodeStore) []Edge {
 	if currNode.GetMetadata("OwnerUID") != "" {
 		ret = append(ret, edgesByOwner(currNode.GetMetadata("OwnerUID"), ns, nodeInfo, []string{})...)
 	}
+	ret = append(ret, ownerRefEdges(currNode, ns, nodeInfo)...)
 
 	// deployer subscriber edges
 	ret = append(ret, edgesByDeployerSubscriber(nodeInfo, ns)...)
@@ -120,22 +165,72 @@ func CommonEdges(uid string, ns NodeStore) []Edge {
 }
 
 // Prefixes the given UID with the cluster name from config and a /
-func prefixedUID(uid apiTypes.UID) string {
+// When KIND_QUALIFIED_UIDS is enabled, the kind goes between the cluster name and the UID, like cluster/Pod/uid.
+func PrefixedUID(kind string, uid apiTypes.UID) string {
+	if config.Cfg.KindQualifiedUIDs && kind != "" {
+		return strings.Join([]string{config.Cfg.ClusterName, kind, string(uid)}, "/")
+	}
 	return strings.Join([]string{config.Cfg.ClusterName, string(uid)}, "/")
 }
 
+// Returns the kind of a typed resource, or "" if its TypeMeta isn't set.
+func resourceKind(resource v1.Object) string {
+	if obj, ok := resource.(runtime.Object); ok {
+		return obj.GetObjectKind().GroupVersionKind().Kind
+	}
+	return ""
+}
+
 // Prefixes the given UID with the cluster name from config and a /
 func ownerRefUID(ownerReferences []v1.OwnerReference) string {
 	ownerUID := ""
 	for _, ref := range ownerReferences {
 		if ref.Controller != nil && *ref.Controller {
-			ownerUID = prefixedUID(ref.UID)
+			ownerUID = PrefixedUID(ref.Kind, ref.UID)
 			continue
 		}
 	}
 	return ownerUID
 }
 
+// Returns the UIDs of the owners that aren't the controller. ownerRefUID has the controller's UID.
+func otherOwnerUIDs(ownerReferences []v1.OwnerReference) []string {
+	uids := make([]string, 0)
+	for _, ref := range ownerReferences {
+		if ref.Controller == nil || !*ref.Controller {
+			uids = append(uids, PrefixedUID(ref.Kind, ref.UID))
+		}
+	}
+	return uids
+}
+
+// Returns ownedBy edges from the node to each owner in its OtherOwnerUIDs. Owners that aren't in the store are
+// skipped. Unlike the controller in OwnerUID, we don't follow the owners of these owners.
+func ownerRefEdges(node Node, ns NodeStore, nodeInfo NodeInfo) []Edge {
+	ret := []Edge{}
+	if node.GetMetadata("OtherOwnerUIDs") == "" {
+		return ret
+	}
+	for _, ownerUID := range strings.Split(node.GetMetadata("OtherOwnerUIDs"), ",") {
+		owner, ok := ns.ByUID[ownerUID]
+		if !ok {
+			glog.V(4).Infof("For %s, %s, ownedBy edge not created: owner %s not found",
+				nodeInfo.Kind, nodeInfo.NameSpace+"/"+nodeInfo.Name, ownerUID)
+			continue
+		}
+		if ownerUID != nodeInfo.UID { // avoid connecting node to itself
+			ret = append(ret, Edge{
+				SourceUID:  nodeInfo.UID,
+				DestUID:    ownerUID,
+				EdgeType:   "ownedBy",
+				SourceKind: nodeInfo.Kind,
+				DestKind:   owner.Properties["kind"].(string),
+			})
+		}
+	}
+	return ret
+}
+
 type NodeInfo struct {
 	EdgeType
 	Name, NameSpace, UID, Kind string
@@ -190,6 +285,18 @@ func edgesByOwner(destUID string, ns NodeStore, nodeInfo NodeInfo, seenDests []s
 	return ret
 }
 
+// Returns the edge to the resource of an object reference. The resource is in the namespace of the reference,
+// or the namespace of the source when the reference doesn't have one.
+func objectReferenceEdges(ref *core.ObjectReference, destKind string, nodeInfo NodeInfo, ns NodeStore) []Edge {
+	if ref == nil || ref.Name == "" {
+		return []Edge{}
+	}
+	if ref.Namespace != "" {
+		nodeInfo.NameSpace = ref.Namespace
+	}
+	return edgesByDestinationName(map[string]struct{}{ref.Name: {}}, destKind, nodeInfo, ns, []string{})
+}
+
 // Function used to get all edges for a specific destKind - the propSet are maps of resource names,
 // nodeInfo has additional info about the node and nodestore has all the current nodes
 func edgesByDestinationName(
@@ -435,6 +542,130 @@ func apiGroupVersion(typeMeta v1.TypeMeta, node *Node) {
 	}
 }
 
+// Template annotations set by tooling that don't change what the pods run, like `kubectl rollout restart`.
+var volatileTemplateAnnotations = []string{"kubectl.kubernetes.io/restartedAt"}
+
+// Returns a sha256 hash of the pod template, for comparing templates across resources and over time.
+// The hash ignores fields set by controllers and tooling, so it only changes when the template is edited.
+// Maps are encoded with sorted keys, so the hash is deterministic.
+func podTemplateHash(template core.PodTemplateSpec) string {
+	template = *template.DeepCopy()
+	template.ObjectMeta.CreationTimestamp = v1.Time{}
+	delete(template.ObjectMeta.Labels, "pod-template-hash")
+	for _, annotation := range volatileTemplateAnnotations {
+		delete(template.ObjectMeta.Annotations, annotation)
+	}
+	data, err := json.Marshal(template)
+	if err != nil {
+		glog.Warning("Error encoding pod template to compute its hash: ", err)
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// Sets _lastRestartedAt from the annotation `kubectl rollout restart` adds to the pod template. The value is
+// normalized to RFC3339 in UTC. It isn't set if the workload was never restarted or the annotation isn't a time.
+func addLastRestartedAt(template core.PodTemplateSpec, node *Node) {
+	restartedAt, ok := template.Annotations["kubectl.kubernetes.io/restartedAt"]
+	if !ok {
+		return
+	}
+	parsed, err := time.Parse(time.RFC3339, restartedAt)
+	if err != nil {
+		glog.V(3).Infof("Ignoring invalid restartedAt annotation %q of %s: %v", restartedAt, node.UID, err)
+		return
+	}
+	node.Properties["_lastRestartedAt"] = parsed.UTC().Format(time.RFC3339)
+}
+
+// Returns the names of the secrets used to pull the images of a pod spec.
+func imagePullSecretNames(podSpec core.PodSpec) []string {
+	names := make([]string, 0, len(podSpec.ImagePullSecrets))
+	for _, secret := range podSpec.ImagePullSecrets {
+		if secret.Name != "" {
+			names = append(names, secret.Name)
+		}
+	}
+	return names
+}
+
+// Builds the uses edges from a workload to the secrets used to pull the images of its pod template.
+// Pods may not exist yet when pulling their images fails, so we also link the workload itself.
+func imagePullSecretEdges(podSpec core.PodSpec, node Node, ns NodeStore) []Edge {
+	secretMap := make(map[string]struct{})
+	for _, name := range imagePullSecretNames(podSpec) {
+		secretMap[name] = struct{}{}
+	}
+	if len(secretMap) == 0 {
+		return []Edge{}
+	}
+	nodeInfo := NodeInfo{
+		Name:      node.Properties["name"].(string),
+		NameSpace: node.Properties["namespace"].(string),
+		UID:       node.UID,
+		EdgeType:  "uses",
+		Kind:      node.Properties["kind"].(string),
+	}
+	return edgesByDestinationName(secretMap, "Secret", nodeInfo, ns, []string{})
+}
+
+// Builds the path of the resource on the kubernetes API server, e.g. /api/v1/namespaces/foo/pods/bar
+// selfLink was removed from kubernetes, so we construct it from the group, version, namespace and name.
+// Returns an empty string if the node doesn't have enough information to build the path.
+func resourceAPIPath(properties map[string]interface{}, resourceString string) string {
+	apiVersion, _ := properties["apiversion"].(string)
+	name, _ := properties["name"].(string)
+	if apiVersion == "" || name == "" || resourceString == "" {
+		return ""
+	}
+
+	// Resources in the core group are served under /api, everything else is under /apis/<group>
+	path := []string{"/api", apiVersion}
+	if apiGroup, ok := properties["apigroup"].(string); ok && apiGroup != "" {
+		path = []string{"/apis", apiGroup, apiVersion}
+	}
+	// Cluster-scoped resources don't have a namespace segment.
+	if namespace, ok := properties["namespace"].(string); ok && namespace != "" {
+		path = append(path, "namespaces", namespace)
+	}
+	path = append(path, resourceString, name)
+	return strings.Join(path, "/")
+}
+
+// Properties used to identify and connect nodes. These are never compressed.
+var identityProperties = map[string]struct{}{
+	"kind": {}, "kind_plural": {}, "name": {}, "namespace": {}, "apigroup": {}, "apiversion": {},
+}
+
+// Compresses the string properties larger than maxSize bytes. Each value is replaced with its gzip compressed
+// bytes encoded as standard base64, and the compressed property names are listed in the _compressed property.
+// Consumers are responsible for decoding the values if they need them.
+func compressLargeProperties(properties map[string]interface{}, maxSize int) {
+	compressed := []string{}
+	for key, value := range properties {
+		str, ok := value.(string)
+		if _, identity := identityProperties[key]; !ok || identity || len(str) <= maxSize {
+			continue
+		}
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write([]byte(str)); err != nil {
+			glog.Warningf("Unable to compress property %s, leaving it uncompressed. %v", key, err)
+			continue
+		}
+		if err := zw.Close(); err != nil {
+			glog.Warningf("Unable to compress property %s, leaving it uncompressed. %v", key, err)
+			continue
+		}
+		properties[key] = base64.StdEncoding.EncodeToString(buf.Bytes())
+		compressed = append(compressed, key)
+	}
+	if len(compressed) > 0 {
+		sort.Strings(compressed) // keep the order stable, so updates aren't sent when nothing changed
+		properties["_compressed"] = compressed
+	}
+}
+
 // Copy hosting Subscription/Deployable properties from the sourceNode to the destination
 func copyhostingSubProperties(srcUID string, destUID string, ns NodeStore) {
 	srcNode, srcFound := ns.ByUID[srcUID]
@@ -11,11 +11,19 @@ irrespective of what has been deposited with the U.S. Copyright Office.
 package transforms
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io/ioutil"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/stolostron/search-collector/pkg/config"
+	apps "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	machineryV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 var labels = map[string]string{"app": "test", "fake": "true", "component": "testapp"}
@@ -61,3 +69,224 @@ func TestCommonProperties(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestResourceAPIPath(t *testing.T) {
+	var tests = []struct {
+		name           string
+		properties     map[string]interface{}
+		resourceString string
+		expected       string
+	}{
+		{
+			"Namespaced core resource",
+			map[string]interface{}{"apiversion": "v1", "namespace": "foo", "name": "bar"},
+			"pods",
+			"/api/v1/namespaces/foo/pods/bar",
+		},
+		{
+			"Cluster-scoped core resource",
+			map[string]interface{}{"apiversion": "v1", "name": "worker-1"},
+			"nodes",
+			"/api/v1/nodes/worker-1",
+		},
+		{
+			"Namespaced resource in a group",
+			map[string]interface{}{"apigroup": "apps", "apiversion": "v1", "namespace": "foo", "name": "bar"},
+			"deployments",
+			"/apis/apps/v1/namespaces/foo/deployments/bar",
+		},
+		{
+			"Cluster-scoped resource in a group",
+			map[string]interface{}{"apigroup": "storage.k8s.io", "apiversion": "v1", "name": "standard"},
+			"storageclasses",
+			"/apis/storage.k8s.io/v1/storageclasses/standard",
+		},
+		{
+			"Missing version",
+			map[string]interface{}{"kind": "Release", "name": "my-release"},
+			"releases",
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		AssertEqual(test.name, resourceAPIPath(test.properties, test.resourceString), test.expected, t)
+	}
+}
+
+func TestCompressLargeProperties(t *testing.T) {
+	manifest := strings.Repeat("apiVersion: v1\nkind: ConfigMap\n", 100)
+	longName := strings.Repeat("n", 100)
+	properties := map[string]interface{}{
+		"name":     longName,
+		"manifest": manifest,
+		"status":   "Running",
+		"replicas": int64(3),
+	}
+
+	compressLargeProperties(properties, 64)
+
+	AssertEqual("name", properties["name"], longName, t)
+	AssertEqual("status", properties["status"], "Running", t)
+	AssertEqual("replicas", properties["replicas"], int64(3), t)
+	AssertDeepEqual("_compressed", properties["_compressed"], []string{"manifest"}, t)
+
+	// Decoding the value must give back the original manifest.
+	raw, err := base64.StdEncoding.DecodeString(properties["manifest"].(string))
+	if err != nil {
+		t.Fatal("Unable to decode compressed property ", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal("Unable to read compressed property ", err)
+	}
+	decoded, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal("Unable to decompress property ", err)
+	}
+	AssertEqual("manifest", string(decoded), manifest, t)
+}
+
+func TestCompressLargePropertiesNothingToCompress(t *testing.T) {
+	properties := map[string]interface{}{"name": "foo", "status": "Running"}
+
+	compressLargeProperties(properties, 64)
+
+	if _, ok := properties["_compressed"]; ok {
+		t.Error("Expected no _compressed property when nothing is larger than the threshold")
+	}
+}
+
+func TestNumericAnnotationProperties(t *testing.T) {
+	config.Cfg.NumericAnnotations = map[string]string{
+		"example.com/cost-per-hour": "costPerHour",
+		"example.com/cpu-usage":     "cpuUsage",
+		"example.com/memory-usage":  "memoryUsage",
+		"example.com/not-set":       "notSet",
+	}
+	defer func() { config.Cfg.NumericAnnotations = nil }()
+
+	p := CreateGenericResource()
+	p.SetAnnotations(map[string]string{
+		"example.com/cost-per-hour": "0.25",
+		"example.com/cpu-usage":     "250",
+		"example.com/memory-usage":  "high",
+	})
+
+	cp := commonProperties(p)
+	AssertEqual("costPerHour", cp["costPerHour"], 0.25, t)
+	AssertEqual("cpuUsage", cp["cpuUsage"], int64(250), t)
+	AssertEqual("memoryUsage", cp["memoryUsage"], nil, t)
+	AssertEqual("notSet", cp["notSet"], nil, t)
+
+	// The generic transform extracts the same properties.
+	u := unstructured.Unstructured{}
+	u.SetAnnotations(p.GetAnnotations())
+	up := unstructuredProperties(&u)
+	AssertEqual("costPerHour", up["costPerHour"], 0.25, t)
+	AssertEqual("cpuUsage", up["cpuUsage"], int64(250), t)
+}
+
+func TestFinalizerProperties(t *testing.T) {
+	defer func(collect bool) { config.Cfg.CollectFinalizers = collect }(config.Cfg.CollectFinalizers)
+	finalizers := []string{"kubernetes.io/pvc-protection", "example.com/cleanup"}
+
+	p := CreateGenericResource()
+	p.SetFinalizers(finalizers)
+	AssertEqual("not collected", commonProperties(p)["finalizers"], nil, t)
+
+	config.Cfg.CollectFinalizers = true
+	AssertDeepEqual("finalizers", commonProperties(p)["finalizers"], finalizers, t)
+	AssertEqual("no finalizers", commonProperties(CreateGenericResource())["finalizers"], nil, t)
+
+	// The generic transform and the typed transforms collect the same property.
+	u := unstructured.Unstructured{}
+	u.SetFinalizers(finalizers)
+	AssertDeepEqual("generic finalizers", unstructuredProperties(&u)["finalizers"], finalizers, t)
+	var d apps.Deployment
+	UnmarshalFile("deployment.json", &d, t)
+	d.SetFinalizers(finalizers)
+	AssertDeepEqual("deployment finalizers", DeploymentResourceBuilder(&d).BuildNode().Properties["finalizers"],
+		finalizers, t)
+}
+
+func TestKindQualifiedUIDs(t *testing.T) {
+	config.Cfg.KindQualifiedUIDs = true
+	defer func() { config.Cfg.KindQualifiedUIDs = false }()
+
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	node := PodResourceBuilder(&p).BuildNode()
+	AssertEqual("UID", node.UID, "local-cluster/Pod/uuid-fake-pod-aaaaa", t)
+	ownerUID := "local-cluster/ReplicaSet/eb762405-361f-11e9-85ca-00163e019656"
+	AssertEqual("_ownerUID", node.Properties["_ownerUID"], ownerUID, t)
+	AssertEqual("OwnerUID", node.GetMetadata("OwnerUID"), ownerUID, t)
+
+	u := unstructured.Unstructured{}
+	u.SetKind("foobar")
+	u.SetUID("1234")
+	AssertEqual("generic UID", GenericResourceBuilder(&u).BuildNode().UID, "local-cluster/foobar/1234", t)
+
+	config.Cfg.KindQualifiedUIDs = false
+	AssertEqual("UID", PodResourceBuilder(&p).BuildNode().UID, "local-cluster/uuid-fake-pod-aaaaa", t)
+}
+
+func TestAddLastRestartedAt(t *testing.T) {
+	var d apps.Deployment
+	UnmarshalFile("deployment.json", &d, t)
+	node := DeploymentResourceBuilder(&d).BuildNode()
+	AssertEqual("_lastRestartedAt", node.Properties["_lastRestartedAt"], nil, t)
+
+	d.Spec.Template.Annotations = map[string]string{"kubectl.kubernetes.io/restartedAt": "2023-05-04T10:11:12+02:00"}
+	node = DeploymentResourceBuilder(&d).BuildNode()
+	AssertEqual("_lastRestartedAt", node.Properties["_lastRestartedAt"], "2023-05-04T08:11:12Z", t)
+
+	var s apps.StatefulSet
+	UnmarshalFile("statefulset.json", &s, t)
+	s.Spec.Template.Annotations = map[string]string{"kubectl.kubernetes.io/restartedAt": "yesterday"}
+	node = StatefulSetResourceBuilder(&s).BuildNode()
+	AssertEqual("_lastRestartedAt", node.Properties["_lastRestartedAt"], nil, t)
+
+	var ds apps.DaemonSet
+	UnmarshalFile("daemonset.json", &ds, t)
+	ds.Spec.Template.Annotations = map[string]string{"kubectl.kubernetes.io/restartedAt": "2023-05-04T08:11:12Z"}
+	node = DaemonSetResourceBuilder(&ds).BuildNode()
+	AssertEqual("_lastRestartedAt", node.Properties["_lastRestartedAt"], "2023-05-04T08:11:12Z", t)
+}
+
+func TestCommonEdgesOwnerReferences(t *testing.T) {
+	var d apps.Deployment
+	UnmarshalFile("deployment.json", &d, t)
+	var r apps.ReplicaSet
+	UnmarshalFile("replicaset.json", &r, t)
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	deployment := DeploymentResourceBuilder(&d).BuildNode()
+	replicaSet := ReplicaSetResourceBuilder(&r).BuildNode()
+
+	// The pod is owned by the ReplicaSet, which is owned by the Deployment.
+	pod := PodResourceBuilder(&p).BuildNode()
+	nodeStore := BuildFakeNodeStore([]Node{deployment, replicaSet, pod})
+	edges := CommonEdges(pod.UID, nodeStore)
+	AssertEqual("Pod edge total:", len(edges), 2, t)
+	for i, owner := range []Node{replicaSet, deployment} {
+		AssertEqual("ownedBy", string(edges[i].EdgeType), "ownedBy", t)
+		AssertEqual("ownedBy source", edges[i].SourceUID, pod.UID, t)
+		AssertEqual("ownedBy dest", edges[i].DestUID, owner.UID, t)
+	}
+
+	// Owners that aren't the controller get an edge too, if they're in the store.
+	p.OwnerReferences = append(p.OwnerReferences,
+		machineryV1.OwnerReference{Kind: "ConfigMap", Name: "lock", UID: "uuid-lock"},
+		machineryV1.OwnerReference{Kind: "ConfigMap", Name: "missing", UID: "uuid-missing"})
+	pod = PodResourceBuilder(&p).BuildNode()
+	lock := Node{
+		UID:        PrefixedUID("ConfigMap", "uuid-lock"),
+		Properties: map[string]interface{}{"kind": "ConfigMap", "namespace": "default", "name": "lock"},
+	}
+	nodeStore = BuildFakeNodeStore([]Node{deployment, replicaSet, pod, lock})
+	edges = CommonEdges(pod.UID, nodeStore)
+	AssertEqual("Pod edge total:", len(edges), 3, t)
+	AssertEqual("ownedBy dest", edges[2].DestUID, lock.UID, t)
+	AssertEqual("ownedBy dest kind", edges[2].DestKind, "ConfigMap", t)
+}
@@ -0,0 +1,43 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// ConfigMapResource ...
+type ConfigMapResource struct {
+	node    Node
+	release *helmStorage // The Helm release stored in the config map, nil for other config maps
+}
+
+// ConfigMapResourceBuilder ...
+// The values of the config map are never collected, only the number of keys in data and binaryData, and their
+// names when DATA_KEY_NAMES is enabled.
+func ConfigMapResourceBuilder(c *v1.ConfigMap) *ConfigMapResource {
+	node := transformCommon(c)         // Start off with the common properties
+	apiGroupVersion(c.TypeMeta, &node) // add kind, apigroup and version
+	// Extract the properties specific to this type
+	keys := make([]string, 0, len(c.Data)+len(c.BinaryData))
+	for key := range c.Data {
+		keys = append(keys, key)
+	}
+	for key := range c.BinaryData {
+		keys = append(keys, key)
+	}
+	dataKeyProperties(keys, node.Properties)
+
+	return &ConfigMapResource{node: node, release: newHelmStorage(c, node.UID, c.Data["release"])}
+}
+
+// BuildNode construct the node for the ConfigMap Resources
+func (c ConfigMapResource) BuildNode() Node {
+	return c.node
+}
+
+// BuildEdges construct the edges for the ConfigMap Resources
+// Config maps storing a Helm release link the resources of the release to its Release node.
+func (c ConfigMapResource) BuildEdges(ns NodeStore) []Edge {
+	return append(CommonEdges(c.node.UID, ns), c.release.edges(ns)...)
+}
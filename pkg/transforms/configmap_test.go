@@ -0,0 +1,35 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTransformConfigMap(t *testing.T) {
+	defer func(keyNames bool) { config.Cfg.DataKeyNames = keyNames }(config.Cfg.DataKeyNames)
+
+	values := []string{"api-token-8f2b1c", "replicas: 3\nlogLevel: debug"}
+	c := v1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "app-config", Namespace: "default", UID: "configmap-uid"},
+		Data:       map[string]string{"token": values[0], "config.yaml": values[1]},
+		BinaryData: map[string][]byte{"cert.der": []byte(values[0])},
+	}
+
+	config.Cfg.DataKeyNames = false
+	node := ConfigMapResourceBuilder(&c).BuildNode()
+	AssertEqual("kind", node.Properties["kind"], "ConfigMap", t)
+	AssertEqual("dataCount", node.Properties["dataCount"], int64(3), t)
+	AssertEqual("dataKeys", node.Properties["dataKeys"], nil, t)
+	assertNoDataValues(node.Properties, values, t)
+
+	config.Cfg.DataKeyNames = true
+	node = ConfigMapResourceBuilder(&c).BuildNode()
+	AssertDeepEqual("dataKeys", node.Properties["dataKeys"], []string{"cert.der", "config.yaml", "token"}, t)
+	assertNoDataValues(node.Properties, values, t)
+}
@@ -0,0 +1,102 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"github.com/stolostron/search-collector/pkg/config"
+	v1 "k8s.io/api/core/v1"
+)
+
+// ContainerKind is the kind of the synthetic nodes emitted for the containers of each pod.
+// The nodes also have the _synthetic property, because they don't exist as resources on the kube API server.
+const ContainerKind = "Container"
+
+// Builds a node for each container and init container of the pod. The UID is the pod's UID with the container
+// name, and the node is owned by the pod so it gets the ownedBy edge from the common edges.
+// The _podUID property is used to delete the container nodes with their pod.
+func containerNodes(p *v1.Pod, podNode Node) []Node {
+	statuses := make(map[string]v1.ContainerStatus, len(p.Status.ContainerStatuses)+len(p.Status.InitContainerStatuses))
+	for _, status := range append(p.Status.InitContainerStatuses, p.Status.ContainerStatuses...) {
+		statuses[status.Name] = status
+	}
+
+	nodes := make([]Node, 0, len(p.Spec.InitContainers)+len(p.Spec.Containers))
+	for _, container := range p.Spec.InitContainers {
+		nodes = append(nodes, containerNode(container, statuses, true, podNode))
+	}
+	for _, container := range p.Spec.Containers {
+		nodes = append(nodes, containerNode(container, statuses, false, podNode))
+	}
+	return nodes
+}
+
+func containerNode(container v1.Container, statuses map[string]v1.ContainerStatus, init bool, podNode Node) Node {
+	node := Node{
+		UID:            podNode.UID + "/" + container.Name,
+		ResourceString: "containers",
+		Properties: map[string]interface{}{
+			"kind":              ContainerKind,
+			"kind_plural":       "containers",
+			"name":              container.Name,
+			"image":             container.Image,
+			"initContainer":     init,
+			"_clusterNamespace": config.Cfg.ClusterNamespace,
+			"_podUID":           podNode.UID,
+			"_synthetic":        true,
+		},
+		Metadata: map[string]string{"OwnerUID": podNode.UID},
+	}
+	if config.Cfg.DeployedInHub {
+		node.Properties["_hubClusterResource"] = true
+	}
+	for _, property := range []string{"namespace", "created"} {
+		if value, ok := podNode.Properties[property]; ok {
+			node.Properties[property] = value
+		}
+	}
+	if container.TerminationMessagePolicy != "" {
+		node.Properties["terminationMessagePolicy"] = string(container.TerminationMessagePolicy)
+	}
+	if container.TerminationMessagePath != "" {
+		node.Properties["terminationMessagePath"] = container.TerminationMessagePath
+	}
+	// The startup probe delays the liveness and readiness probes until it succeeds.
+	for probeType, probe := range containerProbes(container) {
+		if probe != nil {
+			node.Properties[probeType+"InitialDelaySeconds"] = int64(probe.InitialDelaySeconds)
+			node.Properties[probeType+"PeriodSeconds"] = int64(probe.PeriodSeconds)
+			node.Properties[probeType+"FailureThreshold"] = int64(probe.FailureThreshold)
+			if handler := probeHandlerType(probe); handler != "" {
+				node.Properties[probeType+"Handler"] = handler
+			}
+		}
+	}
+	if len(container.Resources.Requests) > 0 {
+		node.Properties["requests"] = resourceListStrings(container.Resources.Requests)
+	}
+	if len(container.Resources.Limits) > 0 {
+		node.Properties["limits"] = resourceListStrings(container.Resources.Limits)
+	}
+
+	if status, ok := statuses[container.Name]; ok {
+		node.Properties["ready"] = status.Ready
+		node.Properties["restarts"] = int64(status.RestartCount)
+		if status.ImageID != "" {
+			node.Properties["imageID"] = status.ImageID
+		}
+		if terminated := status.LastTerminationState.Terminated; terminated != nil && terminated.Reason != "" {
+			node.Properties["lastTerminationReason"] = terminated.Reason
+		}
+		switch {
+		case status.State.Running != nil:
+			node.Properties["state"] = "Running"
+		case status.State.Waiting != nil:
+			node.Properties["state"] = "Waiting"
+			node.Properties["reason"] = status.State.Waiting.Reason
+		case status.State.Terminated != nil:
+			node.Properties["state"] = "Terminated"
+			node.Properties["reason"] = status.State.Terminated.Reason
+		}
+	}
+	return node
+}
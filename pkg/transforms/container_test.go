@@ -0,0 +1,91 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestContainerNodes(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	p.Spec.InitContainers = []v1.Container{{Name: "init", Image: "busybox"}}
+	p.Spec.Containers[0].Resources.Limits = v1.ResourceList{v1.ResourceMemory: resource.MustParse("64Mi")}
+	p.Spec.Containers[0].StartupProbe = &v1.Probe{InitialDelaySeconds: 5, PeriodSeconds: 10, FailureThreshold: 30,
+		ProbeHandler: v1.ProbeHandler{Exec: &v1.ExecAction{Command: []string{"true"}}}}
+	podNode := PodResourceBuilder(&p).BuildNode()
+
+	nodes := containerNodes(&p, podNode)
+	AssertEqual("container nodes", len(nodes), 2, t)
+
+	initNode := nodes[0]
+	AssertEqual("UID", initNode.UID, "local-cluster/uuid-fake-pod-aaaaa/init", t)
+	AssertEqual("initContainer", initNode.Properties["initContainer"], true, t)
+	AssertEqual("state", initNode.Properties["state"], nil, t)
+
+	node := nodes[1]
+	AssertEqual("UID", node.UID, "local-cluster/uuid-fake-pod-aaaaa/fake-pod", t)
+	AssertEqual("kind", node.Properties["kind"], ContainerKind, t)
+	AssertEqual("name", node.Properties["name"], "fake-pod", t)
+	AssertEqual("namespace", node.Properties["namespace"], "default", t)
+	AssertEqual("image", node.Properties["image"], "fake-image:latest", t)
+	AssertEqual("initContainer", node.Properties["initContainer"], false, t)
+	AssertEqual("state", node.Properties["state"], "Running", t)
+	AssertEqual("ready", node.Properties["ready"], true, t)
+	AssertEqual("restarts", node.Properties["restarts"], int64(0), t)
+	AssertEqual("imageID", node.Properties["imageID"],
+		"docker-pullable://fake-image@sha256:396c3d5a7ee6174f6f9ca0f626474673a003b0be87afec31a4e91e61ebd9ab70", t)
+	AssertEqual("lastTerminationReason", node.Properties["lastTerminationReason"], nil, t)
+	AssertDeepEqual("limits", node.Properties["limits"], map[string]string{"memory": "64Mi"}, t)
+	AssertEqual("requests", node.Properties["requests"], nil, t)
+	AssertEqual("terminationMessagePolicy", node.Properties["terminationMessagePolicy"], "File", t)
+	AssertEqual("startupProbeInitialDelaySeconds", node.Properties["startupProbeInitialDelaySeconds"], int64(5), t)
+	AssertEqual("startupProbePeriodSeconds", node.Properties["startupProbePeriodSeconds"], int64(10), t)
+	AssertEqual("startupProbeFailureThreshold", node.Properties["startupProbeFailureThreshold"], int64(30), t)
+	AssertEqual("livenessProbePeriodSeconds", node.Properties["livenessProbePeriodSeconds"], nil, t)
+	AssertEqual("startupProbeHandler", node.Properties["startupProbeHandler"], "exec", t)
+	AssertEqual("livenessProbeHandler", node.Properties["livenessProbeHandler"], nil, t)
+	AssertEqual("terminationMessagePath", node.Properties["terminationMessagePath"], "/dev/termination-log", t)
+	AssertEqual("_synthetic", node.Properties["_synthetic"], true, t)
+	AssertEqual("_podUID", node.Properties["_podUID"], podNode.UID, t)
+	AssertEqual("OwnerUID", node.GetMetadata("OwnerUID"), podNode.UID, t)
+}
+
+func TestContainerNodesEdges(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	podNode := PodResourceBuilder(&p).BuildNode()
+	containerNode := containerNodes(&p, podNode)[0]
+	nodeStore := BuildFakeNodeStore([]Node{podNode, containerNode})
+
+	edges := CommonEdges(containerNode.UID, nodeStore)
+	AssertEqual("Container edge total:", len(edges), 1, t)
+	AssertEqual("Container ownedBy", edges[0].EdgeType, EdgeType("ownedBy"), t)
+	AssertEqual("Container ownedBy", edges[0].DestUID, podNode.UID, t)
+}
+
+func TestTransformRoutineContainerNodes(t *testing.T) {
+	config.Cfg.ContainerNodes = true
+	defer func() { config.Cfg.ContainerNodes = false }()
+
+	input := make(chan *Event)
+	output := make(chan NodeEvent)
+	go TransformRoutine(input, output)
+
+	var u unstructured.Unstructured
+	UnmarshalFile("pod.json", &u, t)
+	input <- &Event{Time: time.Now().Unix(), Operation: Create, Resource: &u, ResourceString: "pods"}
+
+	pod := <-output
+	AssertEqual("kind", pod.Properties["kind"], "Pod", t)
+	container := <-output
+	AssertEqual("kind", container.Properties["kind"], ContainerKind, t)
+	AssertEqual("Operation", container.Operation, Create, t)
+	AssertEqual("Time", container.Time, pod.Time, t)
+}
@@ -11,12 +11,18 @@ Copyright (c) 2020 Red Hat, Inc.
 package transforms
 
 import (
+	"sort"
+	"strings"
+
+	"github.com/stolostron/search-collector/pkg/config"
 	v1 "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
 )
 
 // DaemonSetResource ...
 type DaemonSetResource struct {
 	node Node
+	Spec v1.DaemonSetSpec
 }
 
 // DaemonSetResourceBuilder ...
@@ -30,7 +36,91 @@ func DaemonSetResourceBuilder(d *v1.DaemonSet) *DaemonSetResource {
 	node.Properties["ready"] = int64(d.Status.NumberReady)
 	node.Properties["updated"] = int64(d.Status.UpdatedNumberScheduled)
 
-	return &DaemonSetResource{node: node}
+	if pullSecrets := imagePullSecretNames(d.Spec.Template.Spec); len(pullSecrets) > 0 {
+		node.Properties["imagePullSecret"] = pullSecrets
+	}
+	addLastRestartedAt(d.Spec.Template, &node)
+	if tolerations := d.Spec.Template.Spec.Tolerations; len(tolerations) > 0 {
+		values := make([]string, 0, len(tolerations))
+		for _, toleration := range tolerations {
+			values = append(values, tolerationString(toleration))
+		}
+		node.Properties["toleration"] = values
+	}
+
+	return &DaemonSetResource{node: node, Spec: d.Spec}
+}
+
+// Formats a toleration like the taints it matches, '<key>=<value>:<effect>' for the Equal operator and
+// '<key>:<effect>' for Exists. The effect is left out when it tolerates every effect, and the key is * when
+// it tolerates every key.
+func tolerationString(t core.Toleration) string {
+	value := t.Key
+	if value == "" {
+		value = "*"
+	}
+	if t.Operator != core.TolerationOpExists {
+		value += "=" + t.Value
+	}
+	if t.Effect != "" {
+		value += ":" + string(t.Effect)
+	}
+	return value
+}
+
+// The tolerations the DaemonSet controller adds to the pods of every DaemonSet.
+var daemonSetDefaultTolerations = []core.Toleration{
+	{Key: "node.kubernetes.io/not-ready", Operator: core.TolerationOpExists, Effect: core.TaintEffectNoExecute},
+	{Key: "node.kubernetes.io/unreachable", Operator: core.TolerationOpExists, Effect: core.TaintEffectNoExecute},
+	{Key: "node.kubernetes.io/disk-pressure", Operator: core.TolerationOpExists, Effect: core.TaintEffectNoSchedule},
+	{Key: "node.kubernetes.io/memory-pressure", Operator: core.TolerationOpExists, Effect: core.TaintEffectNoSchedule},
+	{Key: "node.kubernetes.io/pid-pressure", Operator: core.TolerationOpExists, Effect: core.TaintEffectNoSchedule},
+	{Key: "node.kubernetes.io/unschedulable", Operator: core.TolerationOpExists, Effect: core.TaintEffectNoSchedule},
+}
+
+// Host network pods also tolerate the nodes without a network.
+var daemonSetHostNetworkToleration = core.Toleration{
+	Key: "node.kubernetes.io/network-unavailable", Operator: core.TolerationOpExists, Effect: core.TaintEffectNoSchedule,
+}
+
+// Finds the tainted nodes selected by the DaemonSet. Adds canRunOn edges to the nodes whose taints it tolerates,
+// and sets untoleratedNodes to the nodes it can't run on because of their taints, the gaps in its coverage.
+// Nodes without taints, or not matching the node selector and required node affinity, are left out.
+func (d DaemonSetResource) taintedNodeCoverage(ns NodeStore) []Edge {
+	spec := d.Spec.Template.Spec
+	tolerations := append(append([]core.Toleration{}, spec.Tolerations...), daemonSetDefaultTolerations...)
+	if spec.HostNetwork {
+		tolerations = append(tolerations, daemonSetHostNetworkToleration)
+	}
+
+	nodeNames := make([]string, 0, len(ns.ByKindNamespaceName["Node"]["_NONE"]))
+	for name := range ns.ByKindNamespaceName["Node"]["_NONE"] {
+		nodeNames = append(nodeNames, name)
+	}
+	sort.Strings(nodeNames) // keep the order of the edges and nodes stable
+
+	ret := make([]Edge, 0)
+	untolerated := make([]string, 0)
+	for _, name := range nodeNames {
+		dest := ns.ByKindNamespaceName["Node"]["_NONE"][name]
+		if taints, _ := dest.Properties["taint"].([]string); len(taints) == 0 || !podMatchesNode(spec, dest) {
+			continue
+		}
+		if blocking := untoleratedTaints(tolerations, dest); len(blocking) > 0 {
+			untolerated = append(untolerated, name+" ("+strings.Join(blocking, ", ")+")")
+			continue
+		}
+		ret = append(ret, Edge{
+			SourceUID:  d.node.UID,
+			DestUID:    dest.UID,
+			EdgeType:   "canRunOn",
+			SourceKind: d.node.Properties["kind"].(string),
+			DestKind:   dest.Properties["kind"].(string),
+		})
+	}
+	d.node.Properties["untoleratedNodes"] = untolerated
+	d.node.Properties["coverageGap"] = len(untolerated) > 0
+	return ret
 }
 
 // BuildNode construct the node for the Daemonset Resources
@@ -40,6 +130,9 @@ func (d DaemonSetResource) BuildNode() Node {
 
 // BuildEdges construct the edges for the Daemonset Resources
 func (d DaemonSetResource) BuildEdges(ns NodeStore) []Edge {
-	//no op for now to implement interface
-	return []Edge{}
+	ret := imagePullSecretEdges(d.Spec.Template.Spec, d.node, ns)
+	if config.Cfg.DaemonSetCoverage {
+		ret = append(ret, d.taintedNodeCoverage(ns)...)
+	}
+	return ret
 }
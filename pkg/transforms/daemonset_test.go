@@ -13,7 +13,9 @@ package transforms
 import (
 	"testing"
 
+	"github.com/stolostron/search-collector/pkg/config"
 	v1 "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
 )
 
 func TestTransformDaemonSet(t *testing.T) {
@@ -27,11 +29,26 @@ func TestTransformDaemonSet(t *testing.T) {
 	AssertEqual("desired", node.Properties["desired"], int64(1), t)
 	AssertEqual("ready", node.Properties["ready"], int64(1), t)
 	AssertEqual("updated", node.Properties["updated"], int64(1), t)
+	AssertDeepEqual("imagePullSecret", node.Properties["imagePullSecret"], []string{"registry-secret"}, t)
+	AssertDeepEqual("toleration", node.Properties["toleration"], []string{"dedicated:NoSchedule", "CriticalAddonsOnly"}, t)
+}
+
+func TestTolerationString(t *testing.T) {
+	AssertEqual("equal", tolerationString(core.Toleration{
+		Key: "dedicated", Operator: core.TolerationOpEqual, Value: "infra", Effect: core.TaintEffectNoSchedule}),
+		"dedicated=infra:NoSchedule", t)
+	AssertEqual("default operator", tolerationString(core.Toleration{Key: "dedicated", Value: "infra"}),
+		"dedicated=infra", t)
+	AssertEqual("exists", tolerationString(core.Toleration{Key: "gpu", Operator: core.TolerationOpExists}), "gpu", t)
+	AssertEqual("everything", tolerationString(core.Toleration{Operator: core.TolerationOpExists}), "*", t)
 }
 
 func TestDaemonSetBuildEdges(t *testing.T) {
 	// Build a fake NodeStore with nodes needed to generate edges.
-	nodes := make([]Node, 0)
+	nodes := []Node{{
+		UID:        "uuid-123-secret",
+		Properties: map[string]interface{}{"kind": "Secret", "namespace": "default", "name": "registry-secret"},
+	}}
 	nodeStore := BuildFakeNodeStore(nodes)
 
 	// Build edges from mock resource daemonset.json
@@ -40,5 +57,42 @@ func TestDaemonSetBuildEdges(t *testing.T) {
 	edges := DaemonSetResourceBuilder(&ds).BuildEdges(nodeStore)
 
 	// Validate results
-	AssertEqual("DaemonSet has no edges:", len(edges), 0, t)
+	AssertEqual("DaemonSet edge total:", len(edges), 1, t)
+	AssertEqual("DaemonSet uses", edges[0].DestKind, "Secret", t)
+}
+
+func TestDaemonSetBuildEdgesCoverage(t *testing.T) {
+	config.Cfg.DaemonSetCoverage = true
+	defer func() { config.Cfg.DaemonSetCoverage = false }()
+
+	var ds v1.DaemonSet
+	UnmarshalFile("daemonset.json", &ds, t)
+	daemonSet := DaemonSetResourceBuilder(&ds)
+
+	nodes := []Node{daemonSet.BuildNode()}
+	for _, n := range []struct{ name, taint string }{
+		{"node-1", "dedicated=infra:NoSchedule"},                  // tolerated
+		{"node-2", "dedicated=gpu:NoExecute"},                     // not tolerated, the toleration is for NoSchedule
+		{"node-3", ""},                                            // no taints
+		{"node-4", "node.kubernetes.io/unschedulable:NoSchedule"}, // tolerated by default
+		{"node-5", "spot=true:PreferNoSchedule"},                  // doesn't keep pods out
+	} {
+		node := Node{UID: "uuid-node-" + n.name, Properties: map[string]interface{}{
+			"kind": "Node", "namespace": "_NONE", "name": n.name}}
+		if n.taint != "" {
+			node.Properties["taint"] = []string{n.taint}
+		}
+		nodes = append(nodes, node)
+	}
+	edges := daemonSet.BuildEdges(BuildFakeNodeStore(nodes))
+
+	// There's no Secret in the store, all the edges are to the tainted nodes it tolerates.
+	AssertEqual("DaemonSet edge total:", len(edges), 3, t)
+	AssertEqual("DaemonSet canRunOn", string(edges[0].EdgeType), "canRunOn", t)
+	AssertEqual("DaemonSet canRunOn", edges[0].DestUID, "uuid-node-node-1", t)
+	AssertEqual("DaemonSet canRunOn", edges[1].DestUID, "uuid-node-node-4", t)
+	AssertEqual("DaemonSet canRunOn", edges[2].DestUID, "uuid-node-node-5", t)
+	AssertDeepEqual("untoleratedNodes", daemonSet.BuildNode().Properties["untoleratedNodes"],
+		[]string{"node-2 (dedicated=gpu:NoExecute)"}, t)
+	AssertEqual("coverageGap", daemonSet.BuildNode().Properties["coverageGap"], true, t)
 }
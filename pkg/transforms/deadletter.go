@@ -0,0 +1,184 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/stolostron/search-collector/pkg/config"
+	apiTypes "k8s.io/apimachinery/pkg/types"
+)
+
+// TransformError is a resource the transformer gave up on, passed into the Errors channel and to the subscribers of
+// SubscribeErrors. The resource was retried TRANSFORM_RETRIES times before giving up.
+type TransformError struct {
+	Event   *Event // The event of the resource, as it was passed into Input
+	Err     error  // The error of the last try
+	Retries int    // Number of retries before giving up
+}
+
+func (e *TransformError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TransformError) Unwrap() error {
+	return e.Err
+}
+
+// A resource that failed to transform, waiting for its next retry.
+type failedEvent struct {
+	event   *Event
+	retries int // Number of retries so far, including the one this is waiting for
+}
+
+// The event waiting for a retry of each resource, by UID. A newer event of the resource takes its place, so the
+// retry is dropped instead of rolling the node back to the failed event.
+type pendingRetries struct {
+	mutex  sync.Mutex
+	events map[apiTypes.UID]*Event
+}
+
+func newPendingRetries() *pendingRetries {
+	return &pendingRetries{events: make(map[apiTypes.UID]*Event)}
+}
+
+// Records the failed event as the one to retry for its resource.
+func (p *pendingRetries) add(event *Event) {
+	if p == nil || event.Resource == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.events[event.Resource.GetUID()] = event
+}
+
+// Forgets the retry of the resource when a newer event of it is received, or the retry is done.
+func (p *pendingRetries) remove(event *Event) {
+	if p == nil || event.Resource == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.events, event.Resource.GetUID())
+}
+
+// Returns the number of resources waiting for a retry. A nil pendingRetries has none.
+func (p *pendingRetries) len() int {
+	if p == nil {
+		return 0
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return len(p.events)
+}
+
+// Returns true if the event is still the one to retry for its resource, no newer event was received since it failed.
+func (p *pendingRetries) current(event *Event) bool {
+	if p == nil || event.Resource == nil {
+		return true
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.events[event.Resource.GetUID()] == event
+}
+
+// The channels of the consumers subscribed to the transform errors.
+type errorSubscribers struct {
+	mutex sync.Mutex
+	subs  []chan *TransformError
+}
+
+// SubscribeErrors returns a channel receiving each resource the transformer gave up on, for alerting. The errors
+// are dropped while the channel's buffer is full, they don't hold back the transformer. The channel is closed once
+// the transformer is stopped. Unlike Errors, each subscriber gets every error.
+func (t Transformer) SubscribeErrors(buffer int) <-chan *TransformError {
+	sub := make(chan *TransformError, buffer)
+	t.subscribers.mutex.Lock()
+	defer t.subscribers.mutex.Unlock()
+	if isStopped(t.stopper) {
+		close(sub)
+		return sub
+	}
+	t.subscribers.subs = append(t.subscribers.subs, sub)
+	return sub
+}
+
+// Closes the subscribers' channels. The routines reporting errors must have returned.
+func (s *errorSubscribers) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, sub := range s.subs {
+		close(sub)
+	}
+	s.subs = nil
+}
+
+// Handles a resource that failed to transform after the given number of retries. It's retried later, after a
+// backoff, until TRANSFORM_RETRIES retries failed. Then it's reported on the Errors channel and to the subscribers.
+// Nothing is retried or reported without a transformer.
+func (t *Transformer) failed(event *Event, err error, retries int) {
+	if t == nil {
+		return
+	}
+	if retries < config.Cfg.TransformRetries {
+		t.pending.add(event)
+		backoff := transformRetryBackoff(retries + 1)
+		glog.V(2).Infof("Retrying %s in %v", describeResource(event.Resource), backoff)
+		retry := failedEvent{event: event, retries: retries + 1}
+		time.AfterFunc(backoff, func() {
+			select {
+			case t.retries <- retry:
+			case <-t.stopper: // Dropped, the transformer is stopping
+			}
+		})
+		return
+	}
+	t.pending.remove(event)
+	if retries > 0 {
+		glog.Errorf("Giving up on %s after %d retries", describeResource(event.Resource), retries)
+	}
+	t.reportError(&TransformError{Event: event, Err: err, Retries: retries})
+}
+
+// Returns the backoff before the given retry. It starts at TRANSFORM_RETRY_BACKOFF_MS and doubles with each retry,
+// up to MAX_BACKOFF_MS.
+func transformRetryBackoff(retry int) time.Duration {
+	backoff := time.Duration(config.Cfg.TransformRetryBackoffMS) * time.Millisecond
+	max := time.Duration(config.Cfg.MaxBackoffMS) * time.Millisecond
+	for i := 1; i < retry && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		return max
+	}
+	return backoff
+}
+
+// Transforms the resources due for a retry, until the stopper is closed. The retried resources keep the time of
+// their event, so the reconciler doesn't prefer them over a more recent event of the same resource in its diff.
+// The retry is dropped when a newer event of the resource was received since it failed.
+func retryRoutine(t *Transformer, output chan NodeEvent) {
+	for {
+		select {
+		case <-t.stopper:
+			return
+		case retry := <-t.retries:
+			if !t.pending.current(retry.event) {
+				glog.V(2).Infof("Dropping the retry of %s, a newer event was received",
+					describeResource(retry.event.Resource))
+				continue
+			}
+			if err := t.resync.transform(retry.event, output, t.manifest, t.throttle); err != nil {
+				glog.Error(err)
+				countTransformError(retry.event)
+				t.failed(retry.event, err, retry.retries)
+			} else {
+				t.pending.remove(retry.event)
+				glog.V(2).Infof("Transformed %s after %d retries", describeResource(retry.event.Resource),
+					retry.retries)
+			}
+		}
+	}
+}
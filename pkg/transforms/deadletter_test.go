@@ -0,0 +1,143 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestTransformRetryBackoff(t *testing.T) {
+	config.Cfg.TransformRetryBackoffMS = 1000
+	defer func() { config.Cfg.TransformRetryBackoffMS = config.DEFAULT_RETRY_BACKOFF_MS }()
+	AssertEqual("first", transformRetryBackoff(1), time.Second, t)
+	AssertEqual("second", transformRetryBackoff(2), 2*time.Second, t)
+	AssertEqual("third", transformRetryBackoff(3), 4*time.Second, t)
+	AssertEqual("max", transformRetryBackoff(30), time.Duration(config.Cfg.MaxBackoffMS)*time.Millisecond, t)
+}
+
+// Returns a resource whose transform fails, until the number of failures is reached.
+func failingWidget(failures int32) (*unstructured.Unstructured, func()) {
+	tries := int32(0)
+	RegisterTransform(schema.GroupVersionKind{Group: "example.com", Kind: "Widget"},
+		func(r *unstructured.Unstructured) Transform {
+			if atomic.AddInt32(&tries, 1) <= failures {
+				panic("widget not ready")
+			}
+			return widgetTransform{node: transformCommon(r)}
+		})
+	widget := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"metadata":   map[string]interface{}{"name": "foo", "namespace": "default", "uid": "widget-uid"},
+	}}
+	return widget, func() { registeredTransforms = map[schema.GroupVersionKind]TransformFunc{} }
+}
+
+func TestTransformerRetriesThenGivesUp(t *testing.T) {
+	config.Cfg.TransformRetries = 2
+	config.Cfg.TransformRetryBackoffMS = 1
+	defer func() {
+		config.Cfg.TransformRetries = 0
+		config.Cfg.TransformRetryBackoffMS = config.DEFAULT_RETRY_BACKOFF_MS
+	}()
+	widget, unregister := failingWidget(3)
+	defer unregister()
+
+	input := make(chan *Event)
+	output := make(chan NodeEvent)
+	transformer := NewTransformer(input, output, 1)
+	subscriber := transformer.SubscribeErrors(1)
+	event := &Event{Operation: Create, Resource: widget, ResourceString: "widgets"}
+	input <- event
+
+	select {
+	case failed := <-subscriber:
+		AssertEqual("event", failed.Event, event, t)
+		AssertEqual("retries", failed.Retries, 2, t)
+		AssertEqual("error", failed.Error(), failed.Err.Error(), t)
+	case <-output:
+		t.Fatal("Expected the widget to fail on every try")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the transformer to give up on the widget")
+	}
+	var transformErr *TransformError
+	if err := <-transformer.Errors; !errors.As(err, &transformErr) || transformErr.Event != event {
+		t.Errorf("Expected the Errors channel to get the TransformError, got %v", err)
+	}
+
+	transformer.Stop()
+	if _, open := <-subscriber; open {
+		t.Error("Expected the subscriber's channel to be closed once the transformer stopped")
+	}
+	if _, open := <-transformer.SubscribeErrors(1); open {
+		t.Error("Expected subscribing to a stopped transformer to return a closed channel")
+	}
+}
+
+func TestTransformerRetrySucceeds(t *testing.T) {
+	config.Cfg.TransformRetries = 3
+	config.Cfg.TransformRetryBackoffMS = 1
+	defer func() {
+		config.Cfg.TransformRetries = 0
+		config.Cfg.TransformRetryBackoffMS = config.DEFAULT_RETRY_BACKOFF_MS
+	}()
+	widget, unregister := failingWidget(2)
+	defer unregister()
+
+	input := make(chan *Event)
+	output := make(chan NodeEvent)
+	transformer := NewTransformer(input, output, 1)
+	defer transformer.Stop()
+	subscriber := transformer.SubscribeErrors(1)
+	input <- &Event{Operation: Create, Resource: widget, ResourceString: "widgets"}
+
+	select {
+	case ne := <-output:
+		AssertEqual("retried", ne.UID, PrefixedUID("Widget", "widget-uid"), t)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the widget to be transformed on its second retry")
+	}
+	select {
+	case failed := <-subscriber:
+		t.Errorf("Expected no error once the retry succeeded, got %v", failed)
+	default:
+	}
+}
+
+func TestTransformerDropsStaleRetry(t *testing.T) {
+	config.Cfg.TransformRetries = 3
+	config.Cfg.TransformRetryBackoffMS = 50
+	defer func() {
+		config.Cfg.TransformRetries = 0
+		config.Cfg.TransformRetryBackoffMS = config.DEFAULT_RETRY_BACKOFF_MS
+	}()
+	widget, unregister := failingWidget(1)
+	defer unregister()
+
+	input := make(chan *Event)
+	output := make(chan NodeEvent)
+	transformer := NewTransformer(input, output, 1)
+	defer transformer.Stop()
+	input <- &Event{Time: 1, Operation: Create, Resource: widget, ResourceString: "widgets"}
+	input <- &Event{Time: 2, Operation: Update, Resource: widget, ResourceString: "widgets"}
+
+	select {
+	case ne := <-output:
+		AssertEqual("newer event", ne.Time, int64(2), t)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the newer event of the widget to be transformed")
+	}
+	// The retry of the failed event would roll the node back.
+	select {
+	case ne := <-output:
+		t.Errorf("Expected the stale retry to be dropped, got the node of the event at %d", ne.Time)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -17,6 +17,7 @@ import (
 // DeploymentResource ...
 type DeploymentResource struct {
 	node Node
+	Spec v1.DeploymentSpec
 }
 
 // DeploymentResourceBuilder ...
@@ -32,7 +33,25 @@ func DeploymentResourceBuilder(d *v1.Deployment) *DeploymentResource {
 		node.Properties["desired"] = int64(*d.Spec.Replicas)
 	}
 
-	return &DeploymentResource{node: node}
+	if pullSecrets := imagePullSecretNames(d.Spec.Template.Spec); len(pullSecrets) > 0 {
+		node.Properties["imagePullSecret"] = pullSecrets
+	}
+	if d.Spec.Strategy.Type != "" {
+		node.Properties["strategy"] = string(d.Spec.Strategy.Type)
+	}
+	// Kept as strings to tell a percent like 25% from an absolute number like 1.
+	if rollingUpdate := d.Spec.Strategy.RollingUpdate; rollingUpdate != nil {
+		if rollingUpdate.MaxSurge != nil {
+			node.Properties["maxSurge"] = rollingUpdate.MaxSurge.String()
+		}
+		if rollingUpdate.MaxUnavailable != nil {
+			node.Properties["maxUnavailable"] = rollingUpdate.MaxUnavailable.String()
+		}
+	}
+	addLastRestartedAt(d.Spec.Template, &node)
+	node.Properties["_templateHash"] = podTemplateHash(d.Spec.Template)
+
+	return &DeploymentResource{node: node, Spec: d.Spec}
 }
 
 // BuildNode construct the node for the Deployment Resources
@@ -42,6 +61,5 @@ func (d DeploymentResource) BuildNode() Node {
 
 // BuildEdges construct the edges for the Deployment Resources
 func (d DeploymentResource) BuildEdges(ns NodeStore) []Edge {
-	//no op for now to implement interface
-	return []Edge{}
+	return imagePullSecretEdges(d.Spec.Template.Spec, d.node, ns)
 }
@@ -14,6 +14,7 @@ import (
 	"testing"
 
 	v1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 func TestTransformDeployment(t *testing.T) {
@@ -26,11 +27,57 @@ func TestTransformDeployment(t *testing.T) {
 	AssertEqual("current", node.Properties["current"], int64(1), t)
 	AssertEqual("desired", node.Properties["desired"], int64(1), t)
 	AssertEqual("ready", node.Properties["ready"], int64(1), t)
+	AssertDeepEqual("imagePullSecret", node.Properties["imagePullSecret"], []string{"registry-secret"}, t)
+	AssertEqual("_templateHash", len(node.Properties["_templateHash"].(string)), 64, t)
+	AssertEqual("strategy", node.Properties["strategy"], "RollingUpdate", t)
+	AssertEqual("maxSurge", node.Properties["maxSurge"], "25%", t)
+	AssertEqual("maxUnavailable", node.Properties["maxUnavailable"], "25%", t)
+}
+
+func TestDeploymentRolloutParameters(t *testing.T) {
+	var d v1.Deployment
+	UnmarshalFile("deployment.json", &d, t)
+
+	// Absolute numbers stay distinguishable from percents.
+	surge, unavailable := intstr.FromInt(1), intstr.FromInt(0)
+	d.Spec.Strategy.RollingUpdate = &v1.RollingUpdateDeployment{MaxSurge: &surge, MaxUnavailable: &unavailable}
+	node := DeploymentResourceBuilder(&d).BuildNode()
+	AssertEqual("maxSurge", node.Properties["maxSurge"], "1", t)
+	AssertEqual("maxUnavailable", node.Properties["maxUnavailable"], "0", t)
+
+	d.Spec.Strategy = v1.DeploymentStrategy{Type: v1.RecreateDeploymentStrategyType}
+	node = DeploymentResourceBuilder(&d).BuildNode()
+	AssertEqual("strategy", node.Properties["strategy"], "Recreate", t)
+	AssertEqual("maxSurge", node.Properties["maxSurge"], nil, t)
+	AssertEqual("maxUnavailable", node.Properties["maxUnavailable"], nil, t)
+}
+
+func TestDeploymentTemplateHash(t *testing.T) {
+	var d v1.Deployment
+	UnmarshalFile("deployment.json", &d, t)
+	hash := DeploymentResourceBuilder(&d).BuildNode().Properties["_templateHash"]
+	AssertEqual("deterministic", DeploymentResourceBuilder(&d).BuildNode().Properties["_templateHash"], hash, t)
+
+	// Restarting the deployment and the labels added by the controller don't change the hash.
+	restarted := d.DeepCopy()
+	restarted.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"] = "2022-05-05T10:00:00Z"
+	restarted.Spec.Template.Labels["pod-template-hash"] = "5d59d67564"
+	AssertEqual("restarted", DeploymentResourceBuilder(restarted).BuildNode().Properties["_templateHash"], hash, t)
+
+	// Editing the template changes the hash.
+	edited := d.DeepCopy()
+	edited.Spec.Template.Spec.Containers[0].Image = "fake-image:v2"
+	if DeploymentResourceBuilder(edited).BuildNode().Properties["_templateHash"] == hash {
+		t.Error("Expected the hash to change when the template is edited")
+	}
 }
 
 func TestDeploymentBuildEdges(t *testing.T) {
 	// Build a fake NodeStore with nodes needed to generate edges.
-	nodes := make([]Node, 0)
+	nodes := []Node{{
+		UID:        "uuid-123-secret",
+		Properties: map[string]interface{}{"kind": "Secret", "namespace": "default", "name": "registry-secret"},
+	}}
 	nodeStore := BuildFakeNodeStore(nodes)
 
 	// Build edges from mock resource deployment.json
@@ -39,5 +86,6 @@ func TestDeploymentBuildEdges(t *testing.T) {
 	edges := DeploymentResourceBuilder(&d).BuildEdges(nodeStore)
 
 	// Validate results
-	AssertEqual("Deployment has no edges:", len(edges), 0, t)
+	AssertEqual("Deployment edge total:", len(edges), 1, t)
+	AssertEqual("Deployment uses", edges[0].DestKind, "Secret", t)
 }
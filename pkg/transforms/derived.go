@@ -0,0 +1,56 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+// Computes the properties of a node from the other nodes in the store.
+type deriveFunc func(node Node, ds DeriveStore) map[string]interface{}
+
+// DeriveStore is the node store the derived properties are computed from, along with the indexes the derive
+// functions share. Build it once for each pass over the nodes, so each node doesn't scan the store.
+type DeriveStore struct {
+	NodeStore
+	podsByNode map[string][]Node // The pods, keyed by the name of the node they run on
+}
+
+// NewDeriveStore indexes the nodes of the store for the derive functions.
+func NewDeriveStore(ns NodeStore) DeriveStore {
+	ds := DeriveStore{NodeStore: ns, podsByNode: map[string][]Node{}}
+	for _, pods := range ns.ByKindNamespaceName["Pod"] {
+		for _, pod := range pods {
+			if nodeName, ok := pod.Properties["_nodeName"].(string); ok && nodeName != "" {
+				ds.podsByNode[nodeName] = append(ds.podsByNode[nodeName], pod)
+			}
+		}
+	}
+	return ds
+}
+
+// The properties computed from the other nodes in the store, by kind, with the names of the properties each function
+// returns. They can't be set when the node is built, and the edge functions must not set them on the nodes in the
+// store, the nodes are already diffed when the edges are built. The reconciler derives them before the diff instead.
+var derivedProperties = map[string]struct {
+	names  []string
+	derive deriveFunc
+}{
+	"Node": {names: []string{"_oomKills", "_oomKilledPods", "_requestedCpu", "_requestedMemory",
+		"_requestedCpuPercent", "_requestedMemoryPercent"}, derive: rollupPods},
+	"Pod": {names: []string{"_ownerDepth", "_orphanedController", "evictionNodePressure"},
+		derive: podDerivedProperties},
+}
+
+// DeriveProperties returns the properties of the node computed from the other nodes in the store, nil if the nodes
+// of its kind don't have any. The node isn't modified.
+func DeriveProperties(node Node, ds DeriveStore) map[string]interface{} {
+	kind, _ := node.Properties["kind"].(string)
+	derived, ok := derivedProperties[kind]
+	if !ok {
+		return nil
+	}
+	return derived.derive(node, ds)
+}
+
+// DerivedPropertyNames returns the names of the properties computed from the other nodes for the kind, nil if it
+// doesn't have any.
+func DerivedPropertyNames(kind string) []string {
+	return derivedProperties[kind].names
+}
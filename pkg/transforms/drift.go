@@ -0,0 +1,167 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/stolostron/search-collector/pkg/config"
+	"k8s.io/apimachinery/pkg/api/resource"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Max number of drifted fields listed, the drift is usually one or two fields.
+const driftedFieldsMax = 20
+
+// Adds the properties to find the workloads modified outside of GitOps, when WORKLOAD_DRIFT is enabled:
+// lastModifiedBy and lastModifiedAt from the latest managed fields entry that modified the workload, and
+// lastAppliedDrift with the driftedFields when the spec differs from the last-applied-configuration annotation.
+func addWorkloadDrift(r *unstructured.Unstructured, node *Node) {
+	if !config.Cfg.WorkloadDrift {
+		return
+	}
+	if manager, modified, ok := lastModification(r.GetManagedFields()); ok {
+		node.Properties["lastModifiedBy"] = manager
+		node.Properties["lastModifiedAt"] = modified.UTC().Format(time.RFC3339)
+	}
+
+	applied, ok := r.GetAnnotations()[lastAppliedAnnotation]
+	if !ok {
+		return
+	}
+	appliedObject := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(applied), &appliedObject); err != nil {
+		glog.V(3).Infof("Ignoring invalid %s annotation of %s: %v", lastAppliedAnnotation, node.UID, err)
+		return
+	}
+	drifted := driftedFields("spec", appliedObject["spec"], r.Object["spec"], nil)
+	sort.Strings(drifted)
+	if len(drifted) > driftedFieldsMax {
+		drifted = drifted[:driftedFieldsMax]
+	}
+	node.Properties["lastAppliedDrift"] = len(drifted) > 0
+	if len(drifted) > 0 {
+		node.Properties["driftedFields"] = drifted
+	}
+}
+
+// Annotations the controllers update on the workloads, like the revision of a Deployment at each rollout.
+var controllerAnnotationPrefixes = []string{"deployment.kubernetes.io/"}
+
+// Returns the manager and time of the latest managed fields entry that modified the workload: its spec, labels or
+// the annotations that aren't updated by the controllers.
+func lastModification(entries []v1.ManagedFieldsEntry) (string, time.Time, bool) {
+	var manager string
+	var latest time.Time
+	for _, entry := range entries {
+		if entry.Time == nil || entry.Subresource != "" || !modifiesWorkload(entry.FieldsV1) {
+			continue
+		}
+		if manager == "" || entry.Time.After(latest) {
+			manager = entry.Manager
+			latest = entry.Time.Time
+		}
+	}
+	return manager, latest, manager != ""
+}
+
+// Returns true if the managed fields include the spec, the labels or an annotation that isn't updated by the
+// controllers. The controllers update the status, and kube-controller-manager the revision annotation of the
+// Deployments with a plain Update entry, so those entries aren't modifications of the workload.
+func modifiesWorkload(fields *v1.FieldsV1) bool {
+	if fields == nil {
+		return false
+	}
+	set := map[string]json.RawMessage{}
+	if err := json.Unmarshal(fields.Raw, &set); err != nil {
+		return false
+	}
+	if _, ok := set["f:spec"]; ok {
+		return true
+	}
+	metadata := map[string]json.RawMessage{}
+	if err := json.Unmarshal(set["f:metadata"], &metadata); err != nil {
+		return false
+	}
+	if _, ok := metadata["f:labels"]; ok {
+		return true
+	}
+	annotations := map[string]json.RawMessage{}
+	if err := json.Unmarshal(metadata["f:annotations"], &annotations); err != nil {
+		return false
+	}
+	for key := range annotations {
+		if key != "." && !isControllerAnnotation(strings.TrimPrefix(key, "f:")) {
+			return true
+		}
+	}
+	return false
+}
+
+func isControllerAnnotation(key string) bool {
+	for _, prefix := range controllerAnnotationPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Appends the paths of the fields of the applied value that differ in the live value. Fields the applied value
+// doesn't set are ignored, they're defaulted or set by controllers.
+func driftedFields(path string, applied, live interface{}, drifted []string) []string {
+	switch appliedValue := applied.(type) {
+	case map[string]interface{}:
+		liveMap, ok := live.(map[string]interface{})
+		if !ok {
+			return append(drifted, path)
+		}
+		for key, value := range appliedValue {
+			drifted = driftedFields(joinPath(path, key), value, liveMap[key], drifted)
+		}
+	case []interface{}:
+		liveList, ok := live.([]interface{})
+		if !ok || len(liveList) != len(appliedValue) {
+			return append(drifted, path)
+		}
+		for i, value := range appliedValue {
+			drifted = driftedFields(joinPath(path, strconv.Itoa(i)), value, liveList[i], drifted)
+		}
+	case nil:
+		// A null field in the applied manifest isn't set.
+	default:
+		if !sameScalar(appliedValue, live) {
+			return append(drifted, path)
+		}
+	}
+	return drifted
+}
+
+// Returns true if the scalars are the same. The numbers of the annotation are float64 and the live ones int64,
+// and quantities are compared by value, so 0.5 is the same as 500m.
+func sameScalar(applied, live interface{}) bool {
+	if reflect.DeepEqual(applied, live) {
+		return true
+	}
+	if live == nil {
+		return false
+	}
+	appliedString, liveString := fmt.Sprint(applied), fmt.Sprint(live)
+	if appliedString == liveString {
+		return true
+	}
+	appliedQuantity, err := resource.ParseQuantity(appliedString)
+	if err != nil {
+		return false
+	}
+	liveQuantity, err := resource.ParseQuantity(liveString)
+	return err == nil && appliedQuantity.Cmp(liveQuantity) == 0
+}
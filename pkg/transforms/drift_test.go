@@ -0,0 +1,108 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Returns a Deployment scaled to 3 replicas after it was applied with 2, and edited after the controllers updated
+// its status.
+func driftedDeployment(lastApplied string) *unstructured.Unstructured {
+	annotations := map[string]interface{}{}
+	if lastApplied != "" {
+		annotations[lastAppliedAnnotation] = lastApplied
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name": "web", "namespace": "default", "uid": "deployment-uid", "annotations": annotations,
+			"managedFields": []interface{}{
+				map[string]interface{}{"manager": "kubectl-client-side-apply", "operation": "Update",
+					"time": "2022-06-01T10:00:00Z", "fieldsType": "FieldsV1",
+					"fieldsV1": map[string]interface{}{"f:spec": map[string]interface{}{}}},
+				map[string]interface{}{"manager": "kubectl-edit", "operation": "Update",
+					"time": "2022-06-01T11:00:00Z", "fieldsType": "FieldsV1",
+					"fieldsV1": map[string]interface{}{"f:spec": map[string]interface{}{}}},
+				map[string]interface{}{"manager": "kube-controller-manager", "operation": "Update",
+					"time": "2022-06-01T12:00:00Z", "subresource": "status", "fieldsType": "FieldsV1",
+					"fieldsV1": map[string]interface{}{"f:status": map[string]interface{}{}}},
+				map[string]interface{}{"manager": "old-controller", "operation": "Update",
+					"time": "2022-06-01T13:00:00Z", "fieldsType": "FieldsV1",
+					"fieldsV1": map[string]interface{}{"f:status": map[string]interface{}{}}},
+				// kube-controller-manager updates the revision annotation at each rollout, as it does on a cluster.
+				map[string]interface{}{"manager": "kube-controller-manager", "operation": "Update",
+					"apiVersion": "apps/v1", "time": "2022-06-01T14:00:00Z", "fieldsType": "FieldsV1",
+					"fieldsV1": map[string]interface{}{"f:metadata": map[string]interface{}{
+						"f:annotations": map[string]interface{}{
+							".": map[string]interface{}{}, "f:deployment.kubernetes.io/revision": map[string]interface{}{},
+						}}}},
+				map[string]interface{}{"manager": "kube-controller-manager", "operation": "Update",
+					"apiVersion": "apps/v1", "time": "2022-06-01T14:00:01Z", "subresource": "status",
+					"fieldsType": "FieldsV1", "fieldsV1": map[string]interface{}{"f:status": map[string]interface{}{
+						"f:availableReplicas": map[string]interface{}{}, "f:observedGeneration": map[string]interface{}{},
+					}}},
+			},
+		},
+		"spec": map[string]interface{}{
+			"replicas":             int64(3),
+			"revisionHistoryLimit": int64(10),
+			"template": map[string]interface{}{"spec": map[string]interface{}{
+				"containers": []interface{}{map[string]interface{}{
+					"name": "web", "image": "nginx:1.21", "terminationMessagePath": "/dev/termination-log",
+					"resources": map[string]interface{}{"requests": map[string]interface{}{"cpu": "500m"}},
+				}},
+			}},
+		},
+	}}
+}
+
+func transformDrift(r *unstructured.Unstructured) Node {
+	trans, _ := transformBuilders[[2]string{"Deployment", "apps"}](r)
+	return trans.BuildNode()
+}
+
+func TestWorkloadDrift(t *testing.T) {
+	config.Cfg.WorkloadDrift = true
+	defer func() { config.Cfg.WorkloadDrift = false }()
+
+	// The defaulted fields and the same quantity written differently aren't drift.
+	node := transformDrift(driftedDeployment(`{"apiVersion":"apps/v1","kind":"Deployment","spec":{"replicas":2,` +
+		`"template":{"spec":{"containers":[{"name":"web","image":"nginx:1.21","resources":{"requests":{"cpu":"0.5"}}}]}}}}`))
+	AssertEqual("lastModifiedBy", node.Properties["lastModifiedBy"], "kubectl-edit", t)
+	AssertEqual("lastModifiedAt", node.Properties["lastModifiedAt"], "2022-06-01T11:00:00Z", t)
+	AssertEqual("lastAppliedDrift", node.Properties["lastAppliedDrift"], true, t)
+	AssertDeepEqual("driftedFields", node.Properties["driftedFields"], []string{"spec.replicas"}, t)
+
+	node = transformDrift(driftedDeployment(`{"spec":{"replicas":3}}`))
+	AssertEqual("no drift", node.Properties["lastAppliedDrift"], false, t)
+	AssertEqual("no drifted fields", node.Properties["driftedFields"], nil, t)
+
+	node = transformDrift(driftedDeployment(`{"spec":{"template":{"spec":{"containers":[]}}}}`))
+	AssertDeepEqual("list length", node.Properties["driftedFields"], []string{"spec.template.spec.containers"}, t)
+
+	// Without the annotation, only the last modification is known.
+	node = transformDrift(driftedDeployment(""))
+	AssertEqual("not applied", node.Properties["lastAppliedDrift"], nil, t)
+	AssertEqual("not applied lastModifiedBy", node.Properties["lastModifiedBy"], "kubectl-edit", t)
+
+	// A label is a modification of the workload.
+	r := driftedDeployment("")
+	managedFields := r.Object["metadata"].(map[string]interface{})["managedFields"].([]interface{})
+	r.Object["metadata"].(map[string]interface{})["managedFields"] = append(managedFields, map[string]interface{}{
+		"manager": "kubectl-label", "operation": "Update", "time": "2022-06-01T15:00:00Z", "fieldsType": "FieldsV1",
+		"fieldsV1": map[string]interface{}{"f:metadata": map[string]interface{}{
+			"f:labels": map[string]interface{}{"f:team": map[string]interface{}{}}}}})
+	node = transformDrift(r)
+	AssertEqual("label lastModifiedBy", node.Properties["lastModifiedBy"], "kubectl-label", t)
+}
+
+func TestWorkloadDriftDisabled(t *testing.T) {
+	node := transformDrift(driftedDeployment(`{"spec":{"replicas":2}}`))
+	AssertEqual("lastModifiedBy", node.Properties["lastModifiedBy"], nil, t)
+	AssertEqual("lastAppliedDrift", node.Properties["lastAppliedDrift"], nil, t)
+}
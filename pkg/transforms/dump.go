@@ -0,0 +1,72 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// Max number of node events waiting to be written to the dump. The events that don't fit are left out of the
+// dump, so a slow writer doesn't hold back the output.
+const dumpBufferSize = 1000
+
+// A node event written to the dump. The edges aren't included, they're built from the other nodes downstream.
+type dumpedNodeEvent struct {
+	Operation string `json:"operation"`
+	Time      int64  `json:"time"`
+	Node
+}
+
+// NewDumpTransformer creates a transformer that passes the node events into the output, like NewTransformer,
+// and also writes each of them to the dump as a line of JSON (NDJSON). Use it to capture the nodes to a file.
+// Errors writing to the dump are logged and don't stop the transformer. Stop waits for the nodes to be written.
+func NewDumpTransformer(inputChan chan *Event, outputChan chan NodeEvent, numRoutines int, dump io.Writer) Transformer {
+	t := Transformer{Output: outputChan, forward: &sync.WaitGroup{}}
+	output := make(chan NodeEvent)
+	dumped := make(chan NodeEvent, dumpBufferSize)
+	t.forward.Add(2)
+	go func() {
+		defer t.forward.Done()
+		teeNodeEvents(output, outputChan, dumped)
+	}()
+	go func() {
+		defer t.forward.Done()
+		dumpNodeEvents(dumped, dump)
+	}()
+	t.start(inputChan, output, numRoutines)
+	return t
+}
+
+// Passes each node event into the output and the dump, until the input is closed. Then closes the dump.
+// The events that don't fit in the dump are dropped from it.
+func teeNodeEvents(input, output, dump chan NodeEvent) {
+	defer close(dump)
+	for ne := range input {
+		output <- ne
+		select {
+		case dump <- ne:
+		default:
+			glog.V(2).Infof("Leaving node %s out of the dump, the writer can't keep up", ne.UID)
+		}
+	}
+}
+
+// Writes each node event to the writer as a line of JSON, until the dump is closed. The nodes are written as they
+// leave the collector, see OutputNode.
+func dumpNodeEvents(dump chan NodeEvent, w io.Writer) {
+	for ne := range dump {
+		dumped := dumpedNodeEvent{Operation: operationNames[ne.Operation], Time: ne.Time, Node: OutputNode(ne.Node)}
+		line, err := json.Marshal(dumped)
+		if err != nil {
+			glog.Warningf("Error encoding node %s for the dump: %v", ne.UID, err)
+			continue
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			glog.Warningf("Error writing node %s to the dump: %v", ne.UID, err)
+		}
+	}
+}
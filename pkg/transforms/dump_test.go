@@ -0,0 +1,118 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDumpTransformer(t *testing.T) {
+	input := make(chan *Event)
+	output := make(chan NodeEvent)
+	var dump bytes.Buffer
+	transformer := NewDumpTransformer(input, output, 1, &dump)
+
+	var p unstructured.Unstructured
+	UnmarshalFile("pod.json", &p, t)
+	for _, operation := range []Operation{Create, Update} {
+		input <- &Event{Resource: &p, ResourceString: "pods", Operation: operation, Time: 42}
+		select {
+		case ne := <-output:
+			AssertEqual("output operation", ne.Operation, operation, t)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the node event on the output")
+		}
+	}
+	transformer.Stop() // Waits for the dump to be written
+
+	var dumped []map[string]interface{}
+	scanner := bufio.NewScanner(&dump)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Expected each line of the dump to be JSON: %v", err)
+		}
+		dumped = append(dumped, line)
+	}
+	AssertEqual("dumped lines", len(dumped), 2, t)
+	AssertEqual("first operation", dumped[0]["operation"], "create", t)
+	AssertEqual("second operation", dumped[1]["operation"], "update", t)
+	AssertEqual("time", dumped[0]["time"], float64(42), t)
+	AssertEqual("uid", dumped[0]["uid"], "local-cluster/"+string(p.GetUID()), t)
+	AssertEqual("kind", dumped[0]["properties"].(map[string]interface{})["kind"], "Pod", t)
+}
+
+func TestDumpNodeEventsOutputNodes(t *testing.T) {
+	config.Cfg.SensitiveNamespaces = []string{"secret-ns"}
+	config.Cfg.MetadataKeysDeny = []string{"internal/*"}
+	defer func() {
+		config.Cfg.SensitiveNamespaces = nil
+		config.Cfg.MetadataKeysDeny = nil
+	}()
+	dump := make(chan NodeEvent, 2)
+	dump <- NodeEvent{Node: Node{UID: "uid-1", Properties: map[string]interface{}{
+		"kind": "Pod", "name": "db", "namespace": "secret-ns"}}}
+	dump <- NodeEvent{Node: Node{UID: "uid-2", Properties: map[string]interface{}{
+		"kind": "Pod", "name": "web", "namespace": "default",
+		"label": map[string]string{"app": "web", "internal/owner": "team"}}}}
+	close(dump)
+	var w bytes.Buffer
+	dumpNodeEvents(dump, &w)
+
+	// The nodes are dumped as they're sent: anonymized, with the labels filtered and the schema version.
+	var anonymized, filtered dumpedNodeEvent
+	lines := bytes.Split(w.Bytes(), []byte("\n"))
+	if err := json.Unmarshal(lines[0], &anonymized); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(lines[1], &filtered); err != nil {
+		t.Fatal(err)
+	}
+	AssertEqual("anonymized name", anonymized.Properties["name"], anonymize("db"), t)
+	AssertDeepEqual("filtered labels", filtered.Properties["label"], map[string]interface{}{"app": "web"}, t)
+	AssertEqual("schema version", filtered.Properties["_schemaVersion"], float64(CurrentSchemaVersion), t)
+}
+
+type failingWriter struct{ writes int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return 0, errors.New("disk full")
+}
+
+func TestDumpNodeEventsWriteErrors(t *testing.T) {
+	dump := make(chan NodeEvent, 2)
+	dump <- NodeEvent{Node: Node{UID: "uid-1"}}
+	dump <- NodeEvent{Node: Node{UID: "uid-2"}}
+	close(dump)
+	var w failingWriter
+	dumpNodeEvents(dump, &w)
+
+	// A failed write doesn't stop the next ones.
+	AssertEqual("writes", w.writes, 2, t)
+}
+
+func TestTeeNodeEventsDoesntWaitForTheDump(t *testing.T) {
+	input := make(chan NodeEvent, 2)
+	output := make(chan NodeEvent, 2)
+	dump := make(chan NodeEvent, 1) // Nothing reads it
+	input <- NodeEvent{Node: Node{UID: "uid-1"}}
+	input <- NodeEvent{Node: Node{UID: "uid-2"}}
+	close(input)
+	teeNodeEvents(input, output, dump)
+
+	AssertEqual("first output", (<-output).UID, "uid-1", t)
+	AssertEqual("second output", (<-output).UID, "uid-2", t)
+	AssertEqual("dumped", (<-dump).UID, "uid-1", t)
+	if _, ok := <-dump; ok {
+		t.Error("Expected the dump to be closed without the event that didn't fit")
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/groupcache/lru"
+	"github.com/stolostron/search-collector/pkg/config"
+	v1 "k8s.io/api/core/v1"
+	apiTypes "k8s.io/apimachinery/pkg/types"
+)
+
+// EventResource ...
+type EventResource struct {
+	node Node
+}
+
+// Max number of coalesced nodes whose events are tracked. The least recently updated are forgotten first,
+// their count starts over from the next event.
+const coalescedEventsMax = 10000
+
+// An event merged into a coalesced node.
+type coalescedOccurrence struct {
+	count     int32
+	timestamp time.Time
+	message   string
+	eventType string
+}
+
+// The events merged into a coalesced node, and the node of the last of them without the merged properties.
+type coalescedEvent struct {
+	events map[apiTypes.UID]coalescedOccurrence
+	node   Node
+	time   int64 // When the last event was merged
+}
+
+// The coalesced events by the UID of their node, and the UID of the node of each event, so the delete of an event
+// can be applied to its node. Shared by the transformer routines and the delete handler.
+type coalescedEventStore struct {
+	sync.Mutex
+	cache   *lru.Cache
+	byEvent map[apiTypes.UID]string
+}
+
+func newCoalescedEventStore(max int) *coalescedEventStore {
+	s := &coalescedEventStore{cache: lru.New(max), byEvent: map[apiTypes.UID]string{}}
+	s.cache.OnEvicted = func(key lru.Key, value interface{}) {
+		for eventUID := range value.(*coalescedEvent).events {
+			delete(s.byEvent, eventUID)
+		}
+	}
+	return s
+}
+
+var coalescedEvents = newCoalescedEventStore(coalescedEventsMax)
+
+// EventResourceBuilder coalesces the events for the same involved object and reason into a single node.
+// The node's UID derives from the involved object's UID and the reason, so every event lands on the same node.
+// It keeps the latest message and the sum of the counts of the events. The deletes of the events are applied with
+// CoalescedEventDelete, the node is deleted with its last event.
+// With EVENT_SUMMARY, each event keeps its own node instead, the reconciler summarizes them and forgets the events
+// deleted.
+func EventResourceBuilder(e *v1.Event) *EventResource {
+	node := transformCommon(e)         // Start off with the common properties
+	apiGroupVersion(e.TypeMeta, &node) // add kind, apigroup and version
+
+	involved := e.InvolvedObject
+	if config.Cfg.EventSummary {
+		return &EventResource{node: summarizedEventNode(node, e)}
+	}
+	key := string(involved.UID)
+	if key == "" {
+		key = strings.Join([]string{involved.Kind, involved.Namespace, involved.Name}, "/")
+	}
+	node.UID = PrefixedUID("Event", apiTypes.UID(key+"/"+e.Reason))
+	// The involved object is the owner of the node, it's deleted with it.
+	involvedUID := PrefixedUID(involved.Kind, involved.UID)
+	if involved.UID != "" {
+		node.Metadata["OwnerUID"] = involvedUID
+	}
+
+	node.Properties["name"] = involved.Name + "." + e.Reason
+	node.Properties["reason"] = e.Reason
+	node.Properties["involvedObjectKind"] = involved.Kind
+	node.Properties["involvedObjectName"] = involved.Name
+	if involved.Namespace != "" {
+		node.Properties["involvedObjectNamespace"] = involved.Namespace
+	}
+	node.Properties["_involvedObjectUID"] = involvedUID
+
+	return &EventResource{node: coalescedEvents.add(node, e)}
+}
+
+// Returns the node of a single event, for the summary of its involved object.
+func summarizedEventNode(node Node, e *v1.Event) Node {
+	involved := e.InvolvedObject
+	node.Properties["reason"] = e.Reason
+	node.Properties["message"] = e.Message
+	node.Properties["type"] = e.Type
+	node.Properties["lastTimestamp"] = eventTimestamp(e).UTC().Format(time.RFC3339)
+	node.Properties["count"] = int64(eventCount(e))
+	if involved.UID != "" {
+		node.Properties["_involvedObjectUID"] = PrefixedUID(involved.Kind, involved.UID)
+	}
+	return node
+}
+
+// CoalescedEventDelete returns the node event for the delete of the Event with the given UID when the events are
+// coalesced: the update of its coalesced node without the event, or the delete of the node if it was the last
+// event. Returns false if the event isn't merged into a coalesced node.
+// The update has the time the last event was merged, so it doesn't bring back a node deleted with its involved
+// object since.
+func CoalescedEventDelete(eventUID apiTypes.UID, time int64) (NodeEvent, bool) {
+	return coalescedEvents.remove(eventUID, time)
+}
+
+// Returns a copy of the node with the message, type and time of the latest event, and the sum of the counts of the
+// events. Ties are broken by the message, so the node doesn't depend on the order the events were merged.
+func (c *coalescedEvent) merged() Node {
+	node := c.node
+	node.Properties = make(map[string]interface{}, len(c.node.Properties)+5)
+	for key, value := range c.node.Properties {
+		node.Properties[key] = value
+	}
+	var latest coalescedOccurrence
+	var count int64
+	for _, occurrence := range c.events {
+		count += int64(occurrence.count)
+		if occurrence.timestamp.After(latest.timestamp) || occurrence.timestamp.Equal(latest.timestamp) &&
+			occurrence.message > latest.message {
+			latest = occurrence
+		}
+	}
+	node.Properties["message"] = latest.message
+	node.Properties["type"] = latest.eventType
+	node.Properties["lastTimestamp"] = latest.timestamp.UTC().Format(time.RFC3339)
+	node.Properties["count"] = count
+	node.Properties["_coalescedEvents"] = int64(len(c.events))
+	return node
+}
+
+// Merges the event into the events of the coalesced node, and returns the node with the merged properties.
+func (s *coalescedEventStore) add(node Node, e *v1.Event) Node {
+	s.Lock()
+	defer s.Unlock()
+
+	var coalesced *coalescedEvent
+	if cached, ok := s.cache.Get(node.UID); ok {
+		coalesced = cached.(*coalescedEvent)
+	} else {
+		coalesced = &coalescedEvent{events: map[apiTypes.UID]coalescedOccurrence{}}
+		s.cache.Add(node.UID, coalesced)
+	}
+	coalesced.events[e.UID] = coalescedOccurrence{
+		count: eventCount(e), timestamp: eventTimestamp(e), message: e.Message, eventType: e.Type,
+	}
+	coalesced.node = node
+	coalesced.time = time.Now().Unix()
+	s.byEvent[e.UID] = node.UID
+	return coalesced.merged()
+}
+
+// Removes the event from its coalesced node. See CoalescedEventDelete.
+func (s *coalescedEventStore) remove(eventUID apiTypes.UID, time int64) (NodeEvent, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	uid, ok := s.byEvent[eventUID]
+	if !ok {
+		return NodeEvent{}, false
+	}
+	delete(s.byEvent, eventUID)
+	cached, ok := s.cache.Get(uid)
+	if !ok {
+		return NodeEvent{}, false
+	}
+	coalesced := cached.(*coalescedEvent)
+	delete(coalesced.events, eventUID)
+	if len(coalesced.events) == 0 {
+		s.cache.Remove(uid)
+		return NodeEvent{Node: Node{UID: uid}, Time: time, Operation: Delete}, true
+	}
+	node := coalesced.merged()
+	return NodeEvent{
+		Node:         node,
+		ComputeEdges: EventResource{node: node}.BuildEdges,
+		Time:         coalesced.time,
+		Operation:    Update,
+	}, true
+}
+
+// Returns the number of occurrences of the event. Events reported as a series keep their count in the series.
+func eventCount(e *v1.Event) int32 {
+	count := e.Count
+	if e.Series != nil && e.Series.Count > count {
+		count = e.Series.Count
+	}
+	if count < 1 {
+		count = 1
+	}
+	return count
+}
+
+// Returns the time the event last occurred.
+func eventTimestamp(e *v1.Event) time.Time {
+	switch {
+	case e.Series != nil && !e.Series.LastObservedTime.IsZero():
+		return e.Series.LastObservedTime.Time
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	}
+	return e.CreationTimestamp.Time
+}
+
+// BuildNode construct the node for the Event Resources
+func (e EventResource) BuildNode() Node {
+	return e.node
+}
+
+// BuildEdges construct the edges for the Event Resources
+func (e EventResource) BuildEdges(ns NodeStore) []Edge {
+	return CommonEdges(e.node.UID, ns)
+}
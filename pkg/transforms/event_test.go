@@ -0,0 +1,128 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apiTypes "k8s.io/apimachinery/pkg/types"
+)
+
+func fakeEvent(uid, reason, message string, count int32, last time.Time) *v1.Event {
+	return &v1.Event{
+		TypeMeta:   metav1.TypeMeta{Kind: "Event", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "fake-pod." + uid, Namespace: "default", UID: apiTypes.UID(uid)},
+		InvolvedObject: v1.ObjectReference{
+			Kind: "Pod", Name: "fake-pod", Namespace: "default", UID: "event-test-pod",
+		},
+		Reason:        reason,
+		Message:       message,
+		Type:          "Warning",
+		Count:         count,
+		LastTimestamp: metav1.NewTime(last),
+	}
+}
+
+func TestTransformEventCoalesces(t *testing.T) {
+	now := time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC)
+	first := EventResourceBuilder(fakeEvent("event-1", "BackOff", "Back-off restarting", 3, now)).BuildNode()
+	// An older occurrence doesn't replace the latest message.
+	second := EventResourceBuilder(fakeEvent("event-2", "BackOff", "Older message", 2, now.Add(-time.Hour))).BuildNode()
+	// Updates of an event replace its count instead of adding to it.
+	third := EventResourceBuilder(fakeEvent("event-1", "BackOff", "Back-off again", 5, now.Add(time.Minute))).BuildNode()
+	other := EventResourceBuilder(fakeEvent("event-3", "Unhealthy", "Probe failed", 1, now)).BuildNode()
+
+	AssertEqual("uid", first.UID, PrefixedUID("Event", "event-test-pod/BackOff"), t)
+	AssertEqual("same uid", second.UID, first.UID, t)
+	AssertEqual("name", first.Properties["name"], "fake-pod.BackOff", t)
+	AssertEqual("first count", first.Properties["count"], int64(3), t)
+	AssertEqual("second count", second.Properties["count"], int64(5), t)
+	AssertEqual("second message", second.Properties["message"], "Back-off restarting", t)
+	AssertEqual("third count", third.Properties["count"], int64(7), t)
+	AssertEqual("third message", third.Properties["message"], "Back-off again", t)
+	AssertEqual("lastTimestamp", third.Properties["lastTimestamp"], "2022-08-01T12:01:00Z", t)
+	AssertEqual("coalesced events", third.Properties["_coalescedEvents"], int64(2), t)
+	AssertEqual("involvedObjectKind", third.Properties["involvedObjectKind"], "Pod", t)
+	AssertEqual("involvedObjectName", third.Properties["involvedObjectName"], "fake-pod", t)
+	AssertEqual("involvedObjectNamespace", third.Properties["involvedObjectNamespace"], "default", t)
+	AssertEqual("OwnerUID", third.GetMetadata("OwnerUID"), PrefixedUID("Pod", "event-test-pod"), t)
+	AssertEqual("dependent", IsDependentNode(third, PrefixedUID("Pod", "event-test-pod")), true, t)
+
+	AssertEqual("other reason uid", other.UID, PrefixedUID("Event", "event-test-pod/Unhealthy"), t)
+	AssertEqual("other reason count", other.Properties["count"], int64(1), t)
+}
+
+func TestCoalescedEventDelete(t *testing.T) {
+	now := time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC)
+	// The involved object has no UID, its node is never deleted with it.
+	event := func(uid, message string, count int32, last time.Time) *v1.Event {
+		e := fakeEvent(uid, "FailedCreate", message, count, last)
+		e.InvolvedObject = v1.ObjectReference{Kind: "ReplicaSet", Name: "gone", Namespace: "default"}
+		return e
+	}
+	EventResourceBuilder(event("delete-1", "Quota exceeded", 3, now))
+	node := EventResourceBuilder(event("delete-2", "Older message", 2, now.Add(-time.Minute))).BuildNode()
+	AssertEqual("count", node.Properties["count"], int64(5), t)
+
+	// The delete of an event drops its count.
+	ne, ok := CoalescedEventDelete("delete-1", now.Unix())
+	AssertEqual("coalesced", ok, true, t)
+	AssertEqual("operation", ne.Operation, Update, t)
+	AssertEqual("uid", ne.UID, node.UID, t)
+	AssertEqual("count after delete", ne.Properties["count"], int64(2), t)
+	AssertEqual("message after delete", ne.Properties["message"], "Older message", t)
+	AssertEqual("coalesced events", ne.Properties["_coalescedEvents"], int64(1), t)
+	if ne.ComputeEdges == nil {
+		t.Error("Expected the update to have its edge function")
+	}
+
+	// The node is deleted with its last event, and the events are forgotten.
+	ne, ok = CoalescedEventDelete("delete-2", now.Unix())
+	AssertEqual("coalesced", ok, true, t)
+	AssertEqual("operation", ne.Operation, Delete, t)
+	AssertEqual("uid", ne.UID, node.UID, t)
+	_, ok = CoalescedEventDelete("delete-2", now.Unix())
+	AssertEqual("forgotten", ok, false, t)
+	_, ok = coalescedEvents.cache.Get(node.UID)
+	AssertEqual("cached", ok, false, t)
+}
+
+func TestCoalescedEventStoreEviction(t *testing.T) {
+	store := newCoalescedEventStore(1)
+	now := time.Now()
+	first := fakeEvent("evicted-1", "BackOff", "Back-off", 1, now)
+	store.add(Node{UID: "local-cluster/first", Properties: map[string]interface{}{}}, first)
+	store.add(Node{UID: "local-cluster/second", Properties: map[string]interface{}{}},
+		fakeEvent("evicted-2", "BackOff", "Back-off", 1, now))
+
+	// The events of the evicted node are forgotten with it.
+	_, ok := store.remove("evicted-1", now.Unix())
+	AssertEqual("evicted", ok, false, t)
+	AssertEqual("events", len(store.byEvent), 1, t)
+}
+
+func TestTransformEventSummary(t *testing.T) {
+	config.Cfg.EventSummary = true
+	defer func() { config.Cfg.EventSummary = false }()
+	now := time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC)
+	node := EventResourceBuilder(fakeEvent("event-summary", "BackOff", "Back-off restarting", 3, now)).BuildNode()
+
+	// Each event keeps its own UID, so its delete removes it from the summary.
+	AssertEqual("uid", node.UID, PrefixedUID("Event", "event-summary"), t)
+	AssertEqual("count", node.Properties["count"], int64(3), t)
+	AssertEqual("lastTimestamp", node.Properties["lastTimestamp"], "2022-08-01T12:00:00Z", t)
+	AssertEqual("involved object", node.Properties["_involvedObjectUID"], PrefixedUID("Pod", "event-test-pod"), t)
+	AssertEqual("not coalesced", node.Properties["_coalescedEvents"], nil, t)
+}
+
+func TestEventCount(t *testing.T) {
+	e := fakeEvent("event-count", "Scheduled", "", 0, time.Time{})
+	AssertEqual("no count", eventCount(e), int32(1), t)
+
+	e.Series = &v1.EventSeries{Count: 4}
+	AssertEqual("series count", eventCount(e), int32(4), t)
+}
@@ -4,6 +4,8 @@
 package transforms
 
 import (
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,7 +22,7 @@ type GenericResource struct {
 // Builds a GenericResource node. Extract the useful properties from unstructured resource.
 func GenericResourceBuilder(r *unstructured.Unstructured) *GenericResource {
 	n := Node{
-		UID:        prefixedUID(r.GetUID()),
+		UID:        PrefixedUID(r.GetKind(), r.GetUID()),
 		Properties: unstructuredProperties(r),
 		Metadata:   make(map[string]string),
 	}
@@ -31,6 +33,15 @@ func GenericResourceBuilder(r *unstructured.Unstructured) *GenericResource {
 		n.Metadata["OwnerReleaseName"] = r.GetAnnotations()["meta.helm.sh/release-name"]
 		n.Metadata["OwnerReleaseNamespace"] = r.GetAnnotations()["meta.helm.sh/release-namespace"]
 	}
+	if config.Cfg.NormalizeReady {
+		if ready := normalizedReady(r.Object); ready != "" {
+			n.Properties["_ready"] = ready
+		}
+	}
+	if config.Cfg.FlattenDepth > 0 {
+		redacted := flattenProperties(r.Object, config.Cfg.FlattenDepth, config.Cfg.FlattenMaxKeys, n.Properties)
+		auditRedactedFields(n, redacted)
+	}
 	return &GenericResource{node: n}
 }
 
@@ -45,6 +56,123 @@ func (r GenericResource) BuildEdges(ns NodeStore) []Edge {
 	return []Edge{}
 }
 
+// Values of status.phase normalized to _ready, keyed in lower case. Other phases are unknown.
+var readyPhases = map[string]string{
+	"active":      "true",
+	"available":   "true",
+	"bound":       "true",
+	"complete":    "true",
+	"completed":   "true",
+	"healthy":     "true",
+	"ready":       "true",
+	"running":     "true",
+	"succeeded":   "true",
+	"degraded":    "false",
+	"error":       "false",
+	"failed":      "false",
+	"notready":    "false",
+	"pending":     "false",
+	"terminating": "false",
+	"unhealthy":   "false",
+}
+
+// Returns the readiness of the resource as true, false or unknown. A Ready condition in status.conditions takes
+// precedence over status.phase. Returns an empty string if the resource has neither.
+func normalizedReady(object map[string]interface{}) string {
+	conditions, _, _ := unstructured.NestedSlice(object, "status", "conditions")
+	for _, condition := range conditions {
+		conditionMap, ok := condition.(map[string]interface{})
+		if !ok || conditionMap["type"] != "Ready" {
+			continue
+		}
+		switch conditionMap["status"] {
+		case "True":
+			return "true"
+		case "False":
+			return "false"
+		}
+		return "unknown"
+	}
+	if phase, found, _ := unstructured.NestedString(object, "status", "phase"); found && phase != "" {
+		if ready, ok := readyPhases[strings.ToLower(phase)]; ok {
+			return ready
+		}
+		return "unknown"
+	}
+	return ""
+}
+
+// Fields of the resource that aren't flattened. The metadata is already in the common properties.
+var flattenSkipFields = map[string]struct{}{"apiVersion": {}, "kind": {}, "metadata": {}}
+
+// Adds the scalar leaves of the object as properties keyed by their dot separated path, like spec.replicas or
+// status.conditions.0.type. Leaves deeper than maxDepth path segments are skipped, and we stop after maxKeys
+// properties (0 for no limit). Keys are visited in sorted order so the same keys are kept when truncating.
+// Properties that already exist are never overwritten. Fields matching REDACTED_PATHS are skipped with everything
+// under them, their paths are returned for the audit log.
+func flattenProperties(object map[string]interface{}, maxDepth, maxKeys int,
+	properties map[string]interface{}) []string {
+	added := 0
+	redacted := []string{}
+	var flatten func(path string, value interface{}, depth int) bool
+	flatten = func(path string, value interface{}, depth int) bool {
+		if depth > maxDepth {
+			return true
+		}
+		switch typed := value.(type) {
+		case map[string]interface{}:
+			keys := make([]string, 0, len(typed))
+			for key := range typed {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				if depth == 0 {
+					if _, skip := flattenSkipFields[key]; skip {
+						continue
+					}
+				}
+				if len(config.Cfg.RedactedPaths) > 0 && isRedactedPath(joinPath(path, key)) {
+					redacted = append(redacted, joinPath(path, key))
+					continue
+				}
+				if !flatten(joinPath(path, key), typed[key], depth+1) {
+					return false
+				}
+			}
+		case []interface{}:
+			for i, item := range typed {
+				if len(config.Cfg.RedactedPaths) > 0 && isRedactedPath(joinPath(path, strconv.Itoa(i))) {
+					redacted = append(redacted, joinPath(path, strconv.Itoa(i)))
+					continue
+				}
+				if !flatten(joinPath(path, strconv.Itoa(i)), item, depth+1) {
+					return false
+				}
+			}
+		case string, bool, int64, float64:
+			if _, exists := properties[path]; exists {
+				return true
+			}
+			if maxKeys > 0 && added >= maxKeys {
+				return false
+			}
+			properties[path] = typed
+			added++
+		}
+		return true
+	}
+	flatten("", object, 0)
+	return redacted
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
 // TODO: Consolidate with commonProperties() in common.go
 // Extracts the common properties from any k8s resource and returns them in a map ready to be put in an Node
 func unstructuredProperties(r *unstructured.Unstructured) map[string]interface{} {
@@ -69,7 +197,18 @@ func unstructuredProperties(r *unstructured.Unstructured) map[string]interface{}
 	}
 
 	if r.GetLabels() != nil {
-		ret["label"] = r.GetLabels()
+		ret["label"] = r.GetLabels() // Filtered when the node is sent, the edges are built from all the labels.
+	}
+	if config.Cfg.CollectAnnotations && len(r.GetAnnotations()) > 0 {
+		ret["annotation"] = filterMetadataKeys(r.GetAnnotations())
+	}
+	// Resources being deleted stay until their finalizers are removed.
+	ret["terminating"] = r.GetDeletionTimestamp() != nil
+	if r.GetDeletionTimestamp() != nil {
+		ret["deletionTimestamp"] = r.GetDeletionTimestamp().UTC().Format(time.RFC3339)
+	}
+	if config.Cfg.CollectFinalizers && len(r.GetFinalizers()) > 0 {
+		ret["finalizers"] = r.GetFinalizers()
 	}
 	if r.GetNamespace() != "" {
 		ret["namespace"] = r.GetNamespace()
@@ -80,6 +219,7 @@ func unstructuredProperties(r *unstructured.Unstructured) map[string]interface{}
 	if r.GetAnnotations()["apps.open-cluster-management.io/hosting-deployable"] != "" {
 		ret["_hostingDeployable"] = r.GetAnnotations()["apps.open-cluster-management.io/hosting-deployable"]
 	}
+	numericAnnotationProperties(r.GetAnnotations(), ret)
 	return ret
 
 }
@@ -0,0 +1,171 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newFlattenTestResource() *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"metadata":   map[string]interface{}{"name": "foo", "namespace": "default", "uid": "1234"},
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"paused":   false,
+			"name":     "not the resource name",
+			"template": map[string]interface{}{"image": map[string]interface{}{
+				"tag": "v1", "registry": map[string]interface{}{"host": "quay.io"}}},
+		},
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Ready", "status": "True"},
+			},
+			"ratio": 0.5,
+			"empty": nil,
+		},
+	}}
+}
+
+func TestGenericResourceBuilder(t *testing.T) {
+	node := GenericResourceBuilder(newFlattenTestResource()).BuildNode()
+
+	AssertEqual("kind", node.Properties["kind"], "Widget", t)
+	AssertEqual("name", node.Properties["name"], "foo", t)
+	AssertEqual("flattening is off by default", node.Properties["spec.replicas"], nil, t)
+	AssertEqual("_ready is off by default", node.Properties["_ready"], nil, t)
+}
+
+func TestGenericResourceTerminating(t *testing.T) {
+	r := newFlattenTestResource()
+	AssertEqual("terminating", GenericResourceBuilder(r).BuildNode().Properties["terminating"], false, t)
+
+	deletion := metav1.NewTime(time.Date(2022, 05, 05, 10, 0, 0, 0, time.UTC))
+	r.SetDeletionTimestamp(&deletion)
+	node := GenericResourceBuilder(r).BuildNode()
+	AssertEqual("terminating", node.Properties["terminating"], true, t)
+	AssertEqual("deletionTimestamp", node.Properties["deletionTimestamp"], "2022-05-05T10:00:00Z", t)
+}
+
+func TestGenericResourceNormalizeReady(t *testing.T) {
+	config.Cfg.NormalizeReady = true
+	defer func() { config.Cfg.NormalizeReady = false }()
+
+	node := GenericResourceBuilder(newFlattenTestResource()).BuildNode()
+	AssertEqual("_ready", node.Properties["_ready"], "true", t)
+}
+
+func TestNormalizedReady(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   map[string]interface{}
+		expected string
+	}{
+		{"ready condition", map[string]interface{}{"conditions": []interface{}{
+			map[string]interface{}{"type": "Synced", "status": "False"},
+			map[string]interface{}{"type": "Ready", "status": "False"}}}, "false"},
+		{"unknown condition", map[string]interface{}{"conditions": []interface{}{
+			map[string]interface{}{"type": "Ready", "status": "Unknown"}}}, "unknown"},
+		{"condition over phase", map[string]interface{}{"phase": "Failed", "conditions": []interface{}{
+			map[string]interface{}{"type": "Ready", "status": "True"}}}, "true"},
+		{"healthy phase", map[string]interface{}{"phase": "Running"}, "true"},
+		{"unhealthy phase", map[string]interface{}{"phase": "failed"}, "false"},
+		{"unknown phase", map[string]interface{}{"phase": "Reticulating"}, "unknown"},
+		{"neither", map[string]interface{}{"conditions": []interface{}{
+			map[string]interface{}{"type": "Synced", "status": "True"}}}, ""},
+	}
+	for _, test := range tests {
+		AssertEqual(test.name, normalizedReady(map[string]interface{}{"status": test.status}), test.expected, t)
+	}
+}
+
+func TestGenericResourceFlatten(t *testing.T) {
+	config.Cfg.FlattenDepth = 4
+	config.Cfg.FlattenMaxKeys = 0
+	defer func() {
+		config.Cfg.FlattenDepth = 0
+		config.Cfg.FlattenMaxKeys = config.DEFAULT_FLATTEN_MAX_KEYS
+	}()
+
+	node := GenericResourceBuilder(newFlattenTestResource()).BuildNode()
+	AssertEqual("spec.replicas", node.Properties["spec.replicas"], int64(2), t)
+	AssertEqual("spec.paused", node.Properties["spec.paused"], false, t)
+	AssertEqual("spec.name", node.Properties["spec.name"], "not the resource name", t)
+	AssertEqual("status.ratio", node.Properties["status.ratio"], 0.5, t)
+	AssertEqual("status.conditions.0.type", node.Properties["status.conditions.0.type"], "Ready", t)
+	AssertEqual("spec.template.image.tag", node.Properties["spec.template.image.tag"], "v1", t)
+	AssertEqual("too deep", node.Properties["spec.template.image.registry.host"], nil, t)
+	AssertEqual("null", node.Properties["status.empty"], nil, t)
+	AssertEqual("metadata", node.Properties["metadata.uid"], nil, t)
+	AssertEqual("name", node.Properties["name"], "foo", t)
+}
+
+func TestGenericResourceFlattenMaxKeys(t *testing.T) {
+	properties := map[string]interface{}{}
+	flattenProperties(newFlattenTestResource().Object, 5, 2, properties)
+
+	// Keys are visited in sorted order.
+	AssertDeepEqual("properties", properties, map[string]interface{}{"spec.name": "not the resource name",
+		"spec.paused": false}, t)
+}
+
+func TestGenericResourceFlattenRedactedPaths(t *testing.T) {
+	config.Cfg.FlattenDepth = 5
+	config.Cfg.FlattenMaxKeys = 0
+	config.Cfg.RedactedPaths = []string{"spec.template.image", "status.conditions.*.status"}
+	defer func() {
+		config.Cfg.FlattenDepth = 0
+		config.Cfg.FlattenMaxKeys = config.DEFAULT_FLATTEN_MAX_KEYS
+		config.Cfg.RedactedPaths = nil
+	}()
+
+	node := GenericResourceBuilder(newFlattenTestResource()).BuildNode()
+	AssertEqual("spec.replicas", node.Properties["spec.replicas"], int64(2), t)
+	AssertEqual("redacted subtree", node.Properties["spec.template.image.tag"], nil, t)
+	AssertEqual("redacted subtree", node.Properties["spec.template.image.registry.host"], nil, t)
+	AssertEqual("status.conditions.0.type", node.Properties["status.conditions.0.type"], "Ready", t)
+	AssertEqual("redacted wildcard", node.Properties["status.conditions.0.status"], nil, t)
+
+	redacted := flattenProperties(newFlattenTestResource().Object, 5, 0, map[string]interface{}{})
+	AssertDeepEqual("redacted paths", redacted, []string{"spec.template.image", "status.conditions.0.status"}, t)
+}
+
+func TestGenericResourceRedactedLastApplied(t *testing.T) {
+	config.Cfg.FlattenDepth = 5
+	config.Cfg.RedactedPaths = []string{"spec.credentials"}
+	defer func(annotations bool, deny []string) {
+		config.Cfg.FlattenDepth = 0
+		config.Cfg.RedactedPaths = nil
+		config.Cfg.CollectAnnotations = annotations
+		config.Cfg.MetadataKeysDeny = deny
+	}(config.Cfg.CollectAnnotations, config.Cfg.MetadataKeysDeny)
+	config.Cfg.CollectAnnotations = true
+	config.Cfg.MetadataKeysDeny = []string{"example.com/internal"} // Replaces the defaults
+
+	// The credentials of the spec are applied with kubectl, so they're in the annotation too.
+	r := newFlattenTestResource()
+	r.Object["spec"].(map[string]interface{})["credentials"] = map[string]interface{}{"password": "s3cr3t-passw0rd"}
+	r.SetAnnotations(map[string]string{
+		lastAppliedAnnotation: `{"kind":"Widget","spec":{"credentials":{"password":"s3cr3t-passw0rd"}}}`,
+		"owner":               "team-a",
+	})
+	node := GenericResourceBuilder(r).BuildNode()
+
+	assertNoDataValues(node.Properties, []string{"s3cr3t-passw0rd"}, t)
+	AssertDeepEqual("annotation", node.Properties["annotation"], map[string]string{"owner": "team-a"}, t)
+}
+
+func TestMatchesPathPattern(t *testing.T) {
+	AssertEqual("exact", matchesPathPattern("spec.password", "spec.password"), true, t)
+	AssertEqual("wildcard", matchesPathPattern("spec.*.password", "spec.users.password"), true, t)
+	AssertEqual("index", matchesPathPattern("spec.users.*.password", "spec.users.3.password"), true, t)
+	AssertEqual("parent", matchesPathPattern("spec.password", "spec"), false, t)
+	AssertEqual("child", matchesPathPattern("spec", "spec.password"), false, t)
+	AssertEqual("other", matchesPathPattern("spec.password", "spec.passwords"), false, t)
+}
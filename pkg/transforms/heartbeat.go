@@ -0,0 +1,56 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/stolostron/search-collector/pkg/config"
+)
+
+// HeartbeatKind is the kind of the synthetic node the transformer emits to show the collector is alive.
+// The node also has the _synthetic property, so consumers can filter it out of real queries.
+const HeartbeatKind = "CollectorHeartbeat"
+
+// Builds the heartbeat node. The _heartbeat time changes on each beat, so the reconciler always sends it.
+func heartbeatNode(now time.Time) Node {
+	return Node{
+		UID:            PrefixedUID(HeartbeatKind, "search-collector-heartbeat"),
+		ResourceString: "collectorheartbeats",
+		Properties: map[string]interface{}{
+			"kind":              HeartbeatKind,
+			"kind_plural":       "collectorheartbeats",
+			"name":              "search-collector-heartbeat",
+			"_clusterNamespace": config.Cfg.ClusterNamespace,
+			"_synthetic":        true,
+			"_heartbeat":        now.UTC().Format(time.RFC3339),
+		},
+		Metadata: map[string]string{},
+	}
+}
+
+// Emits a heartbeat node on the output channel at the given interval, until the stopper is closed.
+func sendHeartbeats(output chan NodeEvent, interval time.Duration, stopper chan struct{}) {
+	glog.Infof("Sending heartbeat nodes every %s", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var now time.Time
+		select {
+		case <-stopper:
+			return
+		case now = <-ticker.C:
+		}
+		select {
+		case output <- NodeEvent{
+			Node:         heartbeatNode(now),
+			ComputeEdges: func(ns NodeStore) []Edge { return []Edge{} },
+			Time:         now.Unix(),
+			Operation:    Update,
+		}:
+		case <-stopper:
+			return
+		}
+	}
+}
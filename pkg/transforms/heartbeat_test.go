@@ -0,0 +1,30 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeartbeatNode(t *testing.T) {
+	node := heartbeatNode(time.Date(2022, 05, 05, 10, 0, 0, 0, time.UTC))
+
+	AssertEqual("UID", node.UID, "local-cluster/search-collector-heartbeat", t)
+	AssertEqual("kind", node.Properties["kind"], HeartbeatKind, t)
+	AssertEqual("_synthetic", node.Properties["_synthetic"], true, t)
+	AssertEqual("_heartbeat", node.Properties["_heartbeat"], "2022-05-05T10:00:00Z", t)
+}
+
+func TestSendHeartbeats(t *testing.T) {
+	output := make(chan NodeEvent)
+	go sendHeartbeats(output, 10*time.Millisecond, nil)
+
+	select {
+	case ne := <-output:
+		AssertEqual("kind", ne.Node.Properties["kind"], HeartbeatKind, t)
+		AssertEqual("edges", len(ne.ComputeEdges(BuildFakeNodeStore([]Node{}))), 0, t)
+	case <-time.After(time.Second):
+		t.Fatal("Expected a heartbeat node")
+	}
+}
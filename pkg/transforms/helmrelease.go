@@ -71,18 +71,23 @@ func (h HelmReleaseResource) BuildNode() Node {
 type SummarizedManifestResource struct {
 	Kind     string
 	Metadata struct {
-		Name string
+		Name      string
+		Namespace string
 	}
 }
 
 func getSummarizedManifestResources(h HelmReleaseResource) []SummarizedManifestResource {
-
-	smr := []SummarizedManifestResource{}
-
 	if h.Release == nil {
 		glog.V(2).Infof("Cannot retrieve manifest from nil Helm Release %s", h.GetLabels()["NAME"])
-		return smr // Can't have any resources without the Release
+		return []SummarizedManifestResource{} // Can't have any resources without the Release
 	}
+	return parseManifestResources(h.Release.GetManifest(), h.GetLabels()["NAME"])
+}
+
+// Returns the kind and name of each resource in the manifest of a Helm release.
+func parseManifestResources(manifest, releaseName string) []SummarizedManifestResource {
+
+	smr := []SummarizedManifestResource{}
 
 	/*
 		A manifest is a YAML-encoded representation of the Kubernetes resources
@@ -91,23 +96,24 @@ func getSummarizedManifestResources(h HelmReleaseResource) []SummarizedManifestR
 		(2) https://helm.sh/docs/chart_template_guide/#a-first-template
 	*/
 
-	manifest := h.Release.GetManifest()
-
 	// Strings for parsing out important information from manifest resources
 
 	manifestParts := strings.Split(manifest, "---\n") // Split manifest yaml into multiple resource yamls.
 
 	for _, resource := range manifestParts { //	Per resource yaml ...
+		if strings.TrimSpace(resource) == "" { // Helm 3 manifests start with a separator
+			continue
+		}
 
 		tmpsmr := SummarizedManifestResource{}
 		// We unmarshal the struct
 		err := yaml.Unmarshal([]byte(resource), &tmpsmr)
 		if err != nil {
-			glog.Errorf("Unmarshalling Helm Release %s failed: %v", h.GetLabels()["NAME"], err)
+			glog.Errorf("Unmarshalling Helm Release %s failed: %v", releaseName, err)
 		} else if tmpsmr.Kind != "" && tmpsmr.Metadata.Name != "" { // ... and if both resource kind and name defined...
 			smr = append(smr, tmpsmr) // ... prep `KIND` and `NAME` for BuildEdges
 		} else { // this shouldn't happen
-			glog.Warningf("kind or name not found for resource in Helm Release %s", h.GetLabels()["NAME"])
+			glog.Warningf("kind or name not found for resource in Helm Release %s", releaseName)
 		}
 	}
 
@@ -0,0 +1,192 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/stolostron/search-collector/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Type of the Secrets where Helm 3 stores each revision of a release.
+const helmReleaseSecretType = "helm.sh/release.v1"
+
+// The fields we read from a release stored by Helm 3. The chart templates and files are left out.
+type helmStoredRelease struct {
+	Name      string                 `json:"name"`
+	Namespace string                 `json:"namespace"`
+	Version   int64                  `json:"version"`
+	Config    map[string]interface{} `json:"config"`
+	Manifest  string                 `json:"manifest"`
+	Info      struct {
+		Status       string      `json:"status"`
+		LastDeployed metav1.Time `json:"last_deployed"`
+	} `json:"info"`
+	Chart struct {
+		Metadata struct {
+			Name       string `json:"name"`
+			Version    string `json:"version"`
+			AppVersion string `json:"appVersion"`
+		} `json:"metadata"`
+	} `json:"chart"`
+}
+
+// The Helm 3 release stored in a Secret or ConfigMap, with its node and the resources of its manifest.
+type helmStorage struct {
+	releaseNode Node
+	resources   []SummarizedManifestResource
+}
+
+// HelmStorageReleaseUID returns the UID of the Release node of a release stored by Helm 3. The release names
+// are unique in their namespace, and the node is the same for every revision.
+func HelmStorageReleaseUID(namespace, name string) string {
+	return config.Cfg.ClusterName + "/Release/" + namespace + "/" + name
+}
+
+// Decodes a release the way Helm 3 stores it: the JSON of the release, gzipped and base64 encoded.
+func decodeHelmRelease(encoded string) (*helmStoredRelease, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	// Older Helm versions didn't gzip the release.
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b, 0x08}) {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		if data, err = io.ReadAll(reader); err != nil {
+			return nil, err
+		}
+	}
+	release := &helmStoredRelease{}
+	if err := json.Unmarshal(data, release); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// Returns the release stored by Helm 3 in the Secret or ConfigMap, or nil if there's none or HELM_RELEASES is
+// disabled. Superseded revisions are skipped, the Release node comes from the latest revision.
+func newHelmStorage(resource metav1.Object, storageUID, encoded string) *helmStorage {
+	if !config.Cfg.HelmReleases || resource.GetLabels()["owner"] != "helm" || encoded == "" ||
+		resource.GetLabels()["status"] == "superseded" {
+		return nil
+	}
+	release, err := decodeHelmRelease(encoded)
+	if err != nil {
+		glog.Warningf("Failed to decode the Helm release in %s/%s: %v", resource.GetNamespace(),
+			resource.GetName(), err)
+		return nil
+	}
+	if release.Info.Status == "superseded" {
+		return nil
+	}
+	namespace := release.Namespace
+	if namespace == "" {
+		namespace = resource.GetNamespace()
+	}
+
+	node := Node{
+		UID:            HelmStorageReleaseUID(namespace, release.Name),
+		ResourceString: "releases",
+		Properties:     make(map[string]interface{}),
+		Metadata:       make(map[string]string),
+	}
+	node.Properties["kind"] = "Release"
+	node.Properties["kind_plural"] = "releases"
+	node.Properties["name"] = release.Name
+	node.Properties["namespace"] = namespace
+	node.Properties["status"] = release.Info.Status
+	node.Properties["revision"] = release.Version
+	node.Properties["chartName"] = release.Chart.Metadata.Name
+	node.Properties["chartVersion"] = release.Chart.Metadata.Version
+	if release.Chart.Metadata.AppVersion != "" {
+		node.Properties["appVersion"] = release.Chart.Metadata.AppVersion
+	}
+	if !release.Info.LastDeployed.IsZero() {
+		node.Properties["updated"] = release.Info.LastDeployed.UTC().Format(time.RFC3339)
+	}
+	node.Properties["valuesHash"] = helmValuesHash(release.Config)
+	node.Properties["_releaseStorageUID"] = storageUID
+	if config.Cfg.DeployedInHub {
+		node.Properties["_hubClusterResource"] = true
+	} else {
+		node.Properties["_clusterNamespace"] = config.Cfg.ClusterNamespace
+	}
+
+	return &helmStorage{releaseNode: node, resources: parseManifestResources(release.Manifest, release.Name)}
+}
+
+// Returns a hash of the values the release was installed with, to find the releases of a chart with the same or
+// different values. The values may hold credentials, so only the hash is collected.
+func helmValuesHash(values map[string]interface{}) string {
+	if len(values) == 0 {
+		return ""
+	}
+	encoded, err := json.Marshal(values) // Map keys are sorted, so the same values have the same hash
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(encoded))[:16]
+}
+
+// Returns the Release node, to be emitted along with the node of the Secret or ConfigMap.
+func (h *helmStorage) nodes() []Node {
+	if h == nil {
+		return nil
+	}
+	return []Node{h.releaseNode}
+}
+
+// Builds the deployedBy edges from the resources in the manifest of the release to its Release node. Only the
+// revision behind the current Release node builds them, so the resources removed by an upgrade lose their edge.
+func (h *helmStorage) edges(ns NodeStore) []Edge {
+	if h == nil {
+		return []Edge{}
+	}
+	releaseUID := h.releaseNode.UID
+	releaseNode, ok := ns.ByUID[releaseUID]
+	if !ok || releaseNode.Properties["_releaseStorageUID"] != h.releaseNode.Properties["_releaseStorageUID"] {
+		return []Edge{}
+	}
+	releaseNamespace, _ := h.releaseNode.Properties["namespace"].(string)
+
+	edges := []Edge{}
+	for _, resource := range h.resources {
+		namespace := resource.Metadata.Namespace
+		if namespace == "" {
+			namespace = releaseNamespace
+		}
+		NonNSResMapMutex.RLock()
+		_, notNameSpaced := NonNSResourceMap[resource.Kind]
+		NonNSResMapMutex.RUnlock()
+		if notNameSpaced {
+			namespace = "_NONE"
+		}
+		resourceNode, ok := ns.ByKindNamespaceName[resource.Kind][namespace][resource.Metadata.Name]
+		if !ok {
+			glog.V(3).Infof("edge deployedBy Helm Release %s not created: Resource %s %s/%s not found",
+				releaseUID, resource.Kind, namespace, resource.Metadata.Name)
+			continue
+		}
+		edges = append(edges, Edge{
+			SourceUID:  resourceNode.UID,
+			DestUID:    releaseUID,
+			EdgeType:   "deployedBy",
+			SourceKind: resource.Kind,
+			DestKind:   "Release",
+		})
+	}
+	return edges
+}
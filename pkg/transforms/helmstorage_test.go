@@ -0,0 +1,135 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const helmTestManifest = `---
+# Source: nginx/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web-nginx
+---
+# Source: nginx/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web-nginx
+  namespace: default
+`
+
+// Encodes the release the way Helm 3 stores it: gzipped JSON, base64 encoded.
+func encodeHelmRelease(release map[string]interface{}, t *testing.T) string {
+	data, err := json.Marshal(release)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func newHelmReleaseSecret(status string, revision int64, t *testing.T) *unstructured.Unstructured {
+	encoded := encodeHelmRelease(map[string]interface{}{
+		"name":      "web",
+		"namespace": "default",
+		"version":   revision,
+		"config":    map[string]interface{}{"replicaCount": 2, "auth": map[string]interface{}{"password": "hunter2"}},
+		"manifest":  helmTestManifest,
+		"info":      map[string]interface{}{"status": status, "last_deployed": "2022-08-01T10:00:00Z"},
+		"chart": map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "nginx", "version": "13.1.0", "appVersion": "1.23.1"},
+		},
+	}, t)
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"type":       helmReleaseSecretType,
+		"metadata": map[string]interface{}{
+			"name": "sh.helm.release.v1.web.v1", "namespace": "default", "uid": "release-secret-uid",
+			"labels": map[string]interface{}{"owner": "helm", "name": "web", "status": status},
+		},
+		// The API server base64 encodes the data, on top of Helm's own encoding.
+		"data": map[string]interface{}{"release": base64.StdEncoding.EncodeToString([]byte(encoded))},
+	}}
+}
+
+func TestHelmReleaseSecret(t *testing.T) {
+	config.Cfg.HelmReleases = true
+	defer func() { config.Cfg.HelmReleases = false }()
+
+	events, err := transformNodeEvents(&Event{Resource: newHelmReleaseSecret("deployed", 3, t), Operation: Create})
+	if err != nil || len(events) != 2 {
+		t.Fatalf("Expected the secret and release nodes, got %d nodes and error %v", len(events), err)
+	}
+	release := events[1].Node
+	AssertEqual("uid", release.UID, HelmStorageReleaseUID("default", "web"), t)
+	AssertEqual("ResourceString", release.ResourceString, "releases", t)
+	AssertEqual("kind", release.Properties["kind"], "Release", t)
+	AssertEqual("name", release.Properties["name"], "web", t)
+	AssertEqual("namespace", release.Properties["namespace"], "default", t)
+	AssertEqual("status", release.Properties["status"], "deployed", t)
+	AssertEqual("revision", release.Properties["revision"], int64(3), t)
+	AssertEqual("chartName", release.Properties["chartName"], "nginx", t)
+	AssertEqual("chartVersion", release.Properties["chartVersion"], "13.1.0", t)
+	AssertEqual("appVersion", release.Properties["appVersion"], "1.23.1", t)
+	AssertEqual("updated", release.Properties["updated"], "2022-08-01T10:00:00Z", t)
+	AssertEqual("_releaseStorageUID", release.Properties["_releaseStorageUID"], events[0].UID, t)
+	AssertEqual("dependent", IsDependentNode(release, events[0].UID), true, t)
+	assertNoDataValues(release.Properties, []string{"hunter2"}, t)
+	assertNoDataValues(events[0].Properties, []string{"hunter2"}, t)
+
+	// The same values always have the same hash.
+	again, _ := transformNodeEvents(&Event{Resource: newHelmReleaseSecret("deployed", 4, t), Operation: Update})
+	AssertEqual("valuesHash", again[1].Properties["valuesHash"], release.Properties["valuesHash"], t)
+	AssertEqual("valuesHash length", len(release.Properties["valuesHash"].(string)), 16, t)
+}
+
+func TestHelmReleaseSecretSkipped(t *testing.T) {
+	events, _ := transformNodeEvents(&Event{Resource: newHelmReleaseSecret("deployed", 1, t), Operation: Create})
+	AssertEqual("disabled", len(events), 1, t)
+
+	config.Cfg.HelmReleases = true
+	defer func() { config.Cfg.HelmReleases = false }()
+	events, _ = transformNodeEvents(&Event{Resource: newHelmReleaseSecret("superseded", 1, t), Operation: Create})
+	AssertEqual("superseded", len(events), 1, t)
+}
+
+func TestHelmReleaseEdges(t *testing.T) {
+	config.Cfg.HelmReleases = true
+	defer func() { config.Cfg.HelmReleases = false }()
+
+	trans, extra := transformBuilders[[2]string{"Secret", ""}](newHelmReleaseSecret("deployed", 1, t))
+	nodes := []Node{trans.BuildNode(), extra[0],
+		{UID: "deployment-uid", Properties: map[string]interface{}{
+			"kind": "Deployment", "namespace": "default", "name": "web-nginx"}},
+		{UID: "service-uid", Properties: map[string]interface{}{
+			"kind": "Service", "namespace": "default", "name": "web-nginx"}},
+	}
+	edges := trans.BuildEdges(BuildFakeNodeStore(nodes))
+
+	AssertEqual("edges", len(edges), 2, t)
+	for _, edge := range edges {
+		AssertEqual("type", string(edge.EdgeType), "deployedBy", t)
+		AssertEqual("dest", edge.DestUID, HelmStorageReleaseUID("default", "web"), t)
+	}
+
+	// An older revision doesn't build the edges of the current release.
+	nodes[1].Properties = map[string]interface{}{"kind": "Release", "name": "web", "namespace": "default",
+		"_releaseStorageUID": "other-revision-uid"}
+	AssertEqual("older revision", len(trans.BuildEdges(BuildFakeNodeStore(nodes))), 0, t)
+}
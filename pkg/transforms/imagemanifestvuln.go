@@ -0,0 +1,135 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ImageManifestVuln is the vulnerability report of an image manifest, created by the Quay container security
+// operator in each namespace running the image.
+type ImageManifestVuln struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              ImageManifestVulnSpec   `json:"spec"`
+	Status            ImageManifestVulnStatus `json:"status"`
+}
+
+// ImageManifestVulnSpec has the image, its manifest digest and the vulnerable packages found in the image.
+type ImageManifestVulnSpec struct {
+	Image    string                     `json:"image"`
+	Manifest string                     `json:"manifest"`
+	Features []ImageManifestVulnFeature `json:"features"`
+}
+
+// ImageManifestVulnFeature is a package of the image with its vulnerabilities.
+type ImageManifestVulnFeature struct {
+	Name            string                   `json:"name"`
+	Version         string                   `json:"version"`
+	Vulnerabilities []ImageManifestVulnEntry `json:"vulnerabilities"`
+}
+
+// ImageManifestVulnEntry is a vulnerability of a package.
+type ImageManifestVulnEntry struct {
+	Name     string `json:"name"`
+	Severity string `json:"severity"`
+	FixedBy  string `json:"fixedby"`
+}
+
+// ImageManifestVulnStatus summarizes the vulnerabilities and lists the pods running the image.
+type ImageManifestVulnStatus struct {
+	HighestSeverity string              `json:"highestSeverity"`
+	FixableCount    int                 `json:"fixableCount"`
+	AffectedPods    map[string][]string `json:"affectedPods"`
+}
+
+// ImageManifestVulnResource ...
+type ImageManifestVulnResource struct {
+	node Node
+}
+
+// ImageManifestVulnResourceBuilder ...
+func ImageManifestVulnResourceBuilder(v *ImageManifestVuln) *ImageManifestVulnResource {
+	node := transformCommon(v)         // Start off with the common properties
+	apiGroupVersion(v.TypeMeta, &node) // add kind, apigroup and version
+
+	vulnerabilities := map[string]struct{}{}
+	for _, feature := range v.Spec.Features {
+		for _, vulnerability := range feature.Vulnerabilities {
+			vulnerabilities[vulnerability.Name] = struct{}{}
+		}
+	}
+	names := make([]string, 0, len(vulnerabilities))
+	for name := range vulnerabilities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	node.Properties["image"] = v.Spec.Image
+	node.Properties["manifest"] = v.Spec.Manifest
+	node.Properties["highestSeverity"] = v.Status.HighestSeverity
+	node.Properties["fixableCount"] = int64(v.Status.FixableCount)
+	node.Properties["vulnerabilityCount"] = int64(len(names))
+	node.Properties["vulnerability"] = names
+	node.Properties["affectedPodCount"] = int64(len(v.Status.AffectedPods))
+	return &ImageManifestVulnResource{node: node}
+}
+
+// BuildNode returns the node of the ImageManifestVuln.
+func (v ImageManifestVulnResource) BuildNode() Node {
+	return v.node
+}
+
+// BuildEdges returns no edges, the pods running the image build the scannedBy edges.
+func (v ImageManifestVulnResource) BuildEdges(ns NodeStore) []Edge {
+	return []Edge{}
+}
+
+// Returns the manifest digest of each container's image, like sha256:<hex>, from the imageID in the container
+// statuses, init containers included. The imageID is the image's repo digest, like
+// docker-pullable://quay.io/org/app@sha256:<hex>. Images without a repo digest, like the ones built on the node,
+// are skipped.
+func imageDigests(p *v1.Pod) []string {
+	seen := map[string]struct{}{}
+	digests := make([]string, 0, len(p.Status.ContainerStatuses))
+	for _, status := range append(p.Status.InitContainerStatuses, p.Status.ContainerStatuses...) {
+		i := strings.LastIndex(status.ImageID, "@")
+		if i < 0 {
+			continue
+		}
+		digest := status.ImageID[i+1:]
+		if _, ok := seen[digest]; !ok {
+			seen[digest] = struct{}{}
+			digests = append(digests, digest)
+		}
+	}
+	return digests
+}
+
+// Returns the scannedBy edges from the pod to the ImageManifestVulns, in the pod's namespace, of the manifests
+// its containers run.
+func vulnerabilityEdges(podNode Node, digests []string, ns NodeStore) []Edge {
+	ret := []Edge{}
+	if len(digests) == 0 {
+		return ret
+	}
+	namespace, _ := podNode.Properties["namespace"].(string)
+	for _, vuln := range ns.ByKindNamespaceName["ImageManifestVuln"][namespace] {
+		manifest, _ := vuln.Properties["manifest"].(string)
+		if manifest == "" || !containsString(digests, manifest) {
+			continue
+		}
+		ret = append(ret, Edge{
+			SourceUID:  podNode.UID,
+			DestUID:    vuln.UID,
+			EdgeType:   "scannedBy",
+			SourceKind: "Pod",
+			DestKind:   "ImageManifestVuln",
+		})
+	}
+	return ret
+}
@@ -0,0 +1,59 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestTransformImageManifestVuln(t *testing.T) {
+	var v ImageManifestVuln
+	UnmarshalFile("imagemanifestvuln.json", &v, t)
+	node := ImageManifestVulnResourceBuilder(&v).BuildNode()
+
+	AssertEqual("kind", node.Properties["kind"], "ImageManifestVuln", t)
+	AssertEqual("apigroup", node.Properties["apigroup"], "secscan.quay.redhat.com", t)
+	AssertEqual("image", node.Properties["image"], "quay.io/fake/fake-image", t)
+	AssertEqual("manifest", node.Properties["manifest"],
+		"sha256:396c3d5a7ee6174f6f9ca0f626474673a003b0be87afec31a4e91e61ebd9ab70", t)
+	AssertEqual("highestSeverity", node.Properties["highestSeverity"], "High", t)
+	AssertEqual("fixableCount", node.Properties["fixableCount"], int64(2), t)
+	AssertEqual("vulnerabilityCount", node.Properties["vulnerabilityCount"], int64(2), t)
+	AssertDeepEqual("vulnerability", node.Properties["vulnerability"], []string{"RHSA-2021:1024", "RHSA-2021:1199"}, t)
+	AssertEqual("affectedPodCount", node.Properties["affectedPodCount"], int64(1), t)
+}
+
+func TestImageDigests(t *testing.T) {
+	p := v1.Pod{Status: v1.PodStatus{
+		InitContainerStatuses: []v1.ContainerStatus{{Name: "init", ImageID: "quay.io/org/init@sha256:aaa"}},
+		ContainerStatuses: []v1.ContainerStatus{
+			{Name: "main", ImageID: "docker-pullable://quay.io/org/app@sha256:bbb"},
+			{Name: "sidecar", ImageID: "quay.io/org/app@sha256:bbb"},
+			{Name: "local", ImageID: "sha256:ccc"},
+			{Name: "pending"},
+		},
+	}}
+	AssertDeepEqual("digests", imageDigests(&p), []string{"sha256:aaa", "sha256:bbb"}, t)
+}
+
+func TestPodBuildEdgesImageManifestVuln(t *testing.T) {
+	var v ImageManifestVuln
+	UnmarshalFile("imagemanifestvuln.json", &v, t)
+	vulnNode := ImageManifestVulnResourceBuilder(&v).BuildNode()
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	pod := PodResourceBuilder(&p)
+
+	edges := vulnerabilityEdges(pod.node, pod.imageDigests, BuildFakeNodeStore([]Node{vulnNode, pod.node}))
+	AssertEqual("edges", len(edges), 1, t)
+	AssertEqual("type", string(edges[0].EdgeType), "scannedBy", t)
+	AssertEqual("source", edges[0].SourceUID, pod.node.UID, t)
+	AssertEqual("dest", edges[0].DestUID, vulnNode.UID, t)
+
+	// The report of another manifest doesn't match.
+	vulnNode.Properties["manifest"] = "sha256:other"
+	edges = vulnerabilityEdges(pod.node, pod.imageDigests, BuildFakeNodeStore([]Node{vulnNode, pod.node}))
+	AssertEqual("edges", len(edges), 0, t)
+}
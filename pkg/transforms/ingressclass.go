@@ -0,0 +1,67 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"github.com/golang/glog"
+	networking "k8s.io/api/networking/v1"
+)
+
+// IngressClassResource ...
+type IngressClassResource struct {
+	node Node
+	Spec networking.IngressClassSpec
+}
+
+// IngressClassResourceBuilder ...
+func IngressClassResourceBuilder(i *networking.IngressClass) *IngressClassResource {
+	node := transformCommon(i)         // Start off with the common properties
+	apiGroupVersion(i.TypeMeta, &node) // add kind, apigroup and version
+	// Extract the properties specific to this type
+	node.Properties["controller"] = i.Spec.Controller
+	node.Properties["default"] = i.Annotations[networking.AnnotationIsDefaultIngressClass] == "true"
+
+	return &IngressClassResource{node: node, Spec: i.Spec}
+}
+
+// BuildNode construct the node for the IngressClass Resources
+func (i IngressClassResource) BuildNode() Node {
+	return i.node
+}
+
+// BuildEdges construct the edges for the IngressClass Resources
+func (i IngressClassResource) BuildEdges(ns NodeStore) []Edge {
+	params := i.Spec.Parameters
+	if params == nil {
+		return []Edge{}
+	}
+
+	// Parameters are cluster scoped unless the scope is Namespace.
+	namespace := "_NONE"
+	if params.Scope != nil && *params.Scope == networking.IngressClassParametersReferenceScopeNamespace {
+		if params.Namespace == nil {
+			return []Edge{}
+		}
+		namespace = *params.Namespace
+	}
+	apiGroup := ""
+	if params.APIGroup != nil {
+		apiGroup = *params.APIGroup
+	}
+
+	dest, ok := ns.ByKindNamespaceName[params.Kind][namespace][params.Name]
+	// The kind alone could match a resource from another group.
+	if !ok || (dest.Properties["apigroup"] != nil && dest.Properties["apigroup"] != apiGroup) ||
+		(dest.Properties["apigroup"] == nil && apiGroup != "") {
+		glog.V(4).Infof("For IngressClass %s, uses edge not created as %s %s/%s not found",
+			i.node.Properties["name"], params.Kind, namespace, params.Name)
+		return []Edge{}
+	}
+	return []Edge{{
+		SourceUID:  i.node.UID,
+		DestUID:    dest.UID,
+		EdgeType:   "uses",
+		SourceKind: i.node.Properties["kind"].(string),
+		DestKind:   params.Kind,
+	}}
+}
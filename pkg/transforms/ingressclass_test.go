@@ -0,0 +1,52 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+
+	networking "k8s.io/api/networking/v1"
+)
+
+func TestTransformIngressClass(t *testing.T) {
+	var i networking.IngressClass
+	UnmarshalFile("ingressclass.json", &i, t)
+	node := IngressClassResourceBuilder(&i).BuildNode()
+
+	// Test only the fields that exist in ingress class - the common test will test the other bits
+	AssertEqual("kind", node.Properties["kind"], "IngressClass", t)
+	AssertEqual("apigroup", node.Properties["apigroup"], "networking.k8s.io", t)
+	AssertEqual("controller", node.Properties["controller"], "example.com/ingress-controller", t)
+	AssertEqual("default", node.Properties["default"], true, t)
+}
+
+func TestIngressClassBuildEdges(t *testing.T) {
+	nodes := []Node{{
+		UID: "uuid-ingress-params",
+		Properties: map[string]interface{}{"kind": "IngressParameters", "apigroup": "k8s.example.com",
+			"namespace": "ingress-system", "name": "external-lb-params"},
+	}}
+	nodeStore := BuildFakeNodeStore(nodes)
+
+	var i networking.IngressClass
+	UnmarshalFile("ingressclass.json", &i, t)
+	edges := IngressClassResourceBuilder(&i).BuildEdges(nodeStore)
+
+	AssertEqual("IngressClass edge total:", len(edges), 1, t)
+	AssertEqual("IngressClass uses", edges[0].DestUID, "uuid-ingress-params", t)
+	AssertEqual("IngressClass uses", string(edges[0].EdgeType), "uses", t)
+
+	// Cluster scoped parameters.
+	clusterScope := networking.IngressClassParametersReferenceScopeCluster
+	i.Spec.Parameters.Scope = &clusterScope
+	i.Spec.Parameters.Namespace = nil
+	AssertEqual("Cluster scoped not found", len(IngressClassResourceBuilder(&i).BuildEdges(nodeStore)), 0, t)
+	nodes[0].Properties["namespace"] = "_NONE"
+	nodeStore = BuildFakeNodeStore(nodes)
+	AssertEqual("Cluster scoped", len(IngressClassResourceBuilder(&i).BuildEdges(nodeStore)), 1, t)
+
+	// A resource with the same kind from another group isn't the parameters.
+	nodes[0].Properties["apigroup"] = "other.example.com"
+	nodeStore = BuildFakeNodeStore(nodes)
+	AssertEqual("Other group", len(IngressClassResourceBuilder(&i).BuildEdges(nodeStore)), 0, t)
+}
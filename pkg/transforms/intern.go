@@ -0,0 +1,127 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Max number of strings and of label maps interned. Once full, the table starts over, so the values no node uses
+// anymore don't keep the memory. Only the properties repeated across resources are interned, so it rarely fills.
+const internedMax = 100000
+
+// Properties with few distinct values across the cluster, shared by many resources. The values unique to each
+// resource, like the names, IPs and timestamps, would fill the table and keep it starting over, so they aren't
+// interned.
+var internedProperties = map[string]struct{}{
+	"kind": {}, "kind_plural": {}, "apigroup": {}, "apiversion": {}, "namespace": {}, "cluster": {},
+	"_clusterNamespace": {}, "label": {}, "image": {}, "container": {}, "status": {}, "qosClass": {},
+	"hostIP": {}, "_nodeName": {},
+}
+
+// Longer strings, like messages and compressed properties, are rarely repeated and aren't interned.
+const internedLenMax = 256
+
+// Bigger label maps, by the length of their keys and values, are rarely repeated either. They aren't interned, so
+// the table doesn't keep their copy.
+const internedMetadataLenMax = 4096
+
+// The strings and label maps shared by the nodes, keyed by their value. Shared by the transformer routines, the
+// values already interned are only read so the routines don't wait for each other.
+var interned = struct {
+	sync.RWMutex
+	strings  map[string]string
+	metadata map[string]map[string]string
+}{strings: map[string]string{}, metadata: map[string]map[string]string{}}
+
+// Replaces the string values of the internedProperties with a shared copy of the same value, so the nodes kept by the
+// reconciler don't each hold their own copy of the kinds, namespaces, label keys and values, and so on.
+// Resources with the same labels, like the pods of a ReplicaSet, share the same map.
+// The shared maps must not be modified, the transforms only read the properties once they're built.
+func internProperties(properties map[string]interface{}) {
+	for name, value := range properties {
+		if _, ok := internedProperties[name]; !ok {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			properties[name] = internString(v)
+		case []string:
+			for i, s := range v {
+				v[i] = internString(s)
+			}
+		case map[string]string:
+			properties[name] = internMetadata(v)
+		}
+	}
+}
+
+// Returns the shared copy of the string.
+func internString(s string) string {
+	if len(s) > internedLenMax {
+		return s
+	}
+	interned.RLock()
+	shared, ok := interned.strings[s]
+	interned.RUnlock()
+	if ok {
+		return shared
+	}
+
+	interned.Lock()
+	defer interned.Unlock()
+	if shared, ok := interned.strings[s]; ok { // Interned by another routine meanwhile
+		return shared
+	}
+	if len(interned.strings) >= internedMax {
+		interned.strings = map[string]string{}
+	}
+	interned.strings[s] = s
+	return s
+}
+
+// Returns the shared map with the same keys and values, its keys and values interned. Maps longer than
+// internedMetadataLenMax are returned as they are.
+func internMetadata(metadata map[string]string) map[string]string {
+	length := 0
+	keys := make([]string, 0, len(metadata))
+	for key, value := range metadata {
+		length += len(key) + len(value) + 2
+		keys = append(keys, key)
+	}
+	if length > internedMetadataLenMax {
+		return metadata
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.Grow(length)
+	for _, key := range keys {
+		b.WriteString(key)
+		b.WriteByte(0)
+		b.WriteString(metadata[key])
+		b.WriteByte(0)
+	}
+	interned.RLock()
+	shared, ok := interned.metadata[b.String()]
+	interned.RUnlock()
+	if ok {
+		return shared
+	}
+
+	shared = make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		shared[internString(key)] = internString(value)
+	}
+	interned.Lock()
+	defer interned.Unlock()
+	if existing, ok := interned.metadata[b.String()]; ok { // Interned by another routine meanwhile
+		return existing
+	}
+	if len(interned.metadata) >= internedMax {
+		interned.metadata = map[string]map[string]string{}
+	}
+	interned.metadata[b.String()] = shared
+	return shared
+}
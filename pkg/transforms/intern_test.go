@@ -0,0 +1,204 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"unsafe"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Returns the pods of a synthetic cluster, with the names, labels, namespaces and images spread the way they are on a
+// large cluster: every ReplicaSet has a few pods on different nodes, and the namespaces run the same images.
+func syntheticPods(nodes, pods int) []*unstructured.Unstructured {
+	const podsPerReplicaSet = 5
+	resources := make([]*unstructured.Unstructured, 0, pods)
+	for i := 0; i < pods; i++ {
+		replicaSet := i / podsPerReplicaSet
+		app := fmt.Sprintf("app-%d", replicaSet%200)
+		namespace := fmt.Sprintf("namespace-%d", replicaSet%100)
+		hash := fmt.Sprintf("%08x", replicaSet)
+		resources = append(resources, &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Pod",
+			"metadata": map[string]interface{}{
+				"name":              fmt.Sprintf("%s-%s-%05d", app, hash, i),
+				"namespace":         namespace,
+				"uid":               fmt.Sprintf("pod-uid-%d", i),
+				"creationTimestamp": "2022-06-01T10:00:00Z",
+				"labels": map[string]interface{}{
+					"app":                       app,
+					"app.kubernetes.io/part-of": "synthetic",
+					"pod-template-hash":         hash,
+				},
+				"ownerReferences": []interface{}{map[string]interface{}{
+					"apiVersion": "apps/v1", "kind": "ReplicaSet", "name": app + "-" + hash,
+					"uid": fmt.Sprintf("replicaset-uid-%d", replicaSet), "controller": true,
+				}},
+			},
+			"spec": map[string]interface{}{
+				"nodeName": fmt.Sprintf("node-%d", i%nodes),
+				"containers": []interface{}{map[string]interface{}{
+					"name": "main", "image": fmt.Sprintf("quay.io/synthetic/%s:1.0", app),
+				}},
+			},
+			"status": map[string]interface{}{
+				"phase":  "Running",
+				"hostIP": fmt.Sprintf("10.0.%d.%d", (i%nodes)/250, (i%nodes)%250),
+				"podIP":  fmt.Sprintf("10.128.%d.%d", i/250%250, i%250),
+				"containerStatuses": []interface{}{map[string]interface{}{
+					"name": "main", "ready": true, "restartCount": int64(0),
+					"image": fmt.Sprintf("quay.io/synthetic/%s:1.0", app),
+				}},
+			},
+		}})
+	}
+	return resources
+}
+
+// Returns the address of the bytes of the string, the same for shared copies.
+func stringData(s string) uintptr {
+	return (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+}
+
+func TestInternProperties(t *testing.T) {
+	labels := func() map[string]string { return map[string]string{"app": "web", "tier": "frontend"} }
+	first := map[string]interface{}{"kind": string([]byte("Pod")), "label": labels(), "image": []string{"nginx"}}
+	second := map[string]interface{}{"kind": string([]byte("Pod")), "label": labels(), "image": []string{"nginx"}}
+	internProperties(first)
+	internProperties(second)
+
+	firstKind, secondKind := first["kind"].(string), second["kind"].(string)
+	AssertEqual("shared string", stringData(firstKind), stringData(secondKind), t)
+	AssertEqual("shared slice element", stringData(first["image"].([]string)[0]),
+		stringData(second["image"].([]string)[0]), t)
+	firstLabels, secondLabels := first["label"].(map[string]string), second["label"].(map[string]string)
+	AssertEqual("same labels", secondLabels["tier"], "frontend", t)
+	AssertEqual("shared labels", fmt.Sprintf("%p", firstLabels), fmt.Sprintf("%p", secondLabels), t)
+
+	other := map[string]interface{}{"label": map[string]string{"app": "web"}}
+	internProperties(other)
+	AssertEqual("different labels", len(other["label"].(map[string]string)), 1, t)
+}
+
+func TestInternPropertiesTableFull(t *testing.T) {
+	defer func() { interned.strings = map[string]string{} }()
+	interned.strings = make(map[string]string, internedMax)
+	for i := 0; i < internedMax; i++ {
+		interned.strings[fmt.Sprint(i)] = fmt.Sprint(i)
+	}
+	properties := map[string]interface{}{"kind": "Pod"}
+	internProperties(properties)
+	AssertEqual("table started over", len(interned.strings), 1, t)
+	AssertEqual("value kept", properties["kind"], "Pod", t)
+}
+
+func TestInternPropertiesLargeMetadata(t *testing.T) {
+	labels := map[string]string{"large": strings.Repeat("x", internedMetadataLenMax)}
+	properties := map[string]interface{}{"label": labels}
+	internProperties(properties)
+
+	// The map isn't interned, the table doesn't keep it.
+	AssertEqual("same map", fmt.Sprintf("%p", properties["label"]), fmt.Sprintf("%p", labels), t)
+	interned.RLock()
+	defer interned.RUnlock()
+	for key := range interned.metadata {
+		if strings.HasPrefix(key, "large\x00") {
+			t.Fatal("Expected the large map not to be interned")
+		}
+	}
+}
+
+func TestInternPropertiesUniqueValues(t *testing.T) {
+	name, podIP := string([]byte("web-5d8f7-x2x7q")), string([]byte("10.128.3.7"))
+	annotations := map[string]string{"k8s.v1.cni.cncf.io/network-status": podIP}
+	properties := map[string]interface{}{"kind": "Pod", "name": name, "podIP": podIP, "annotation": annotations}
+	internProperties(properties)
+
+	// The values unique to each resource don't fill the table.
+	AssertEqual("same name", stringData(properties["name"].(string)), stringData(name), t)
+	AssertEqual("same map", fmt.Sprintf("%p", properties["annotation"]), fmt.Sprintf("%p", annotations), t)
+	interned.RLock()
+	defer interned.RUnlock()
+	for _, value := range []string{name, podIP} {
+		if _, ok := interned.strings[value]; ok {
+			t.Errorf("Expected %s not to be interned", value)
+		}
+	}
+	if _, ok := interned.strings["Pod"]; !ok {
+		t.Error("Expected the kind to be interned")
+	}
+}
+
+func TestInternPropertiesConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				internProperties(map[string]interface{}{"kind": "Pod", "name": fmt.Sprint(j),
+					"label": map[string]string{"app": fmt.Sprint(j % 10)}})
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Transforms the pods of a synthetic cluster and keeps their nodes like the reconciler does. Reports the heap kept
+// by the nodes, with and without INTERN_PROPERTIES, to catch memory and throughput regressions. The cluster has more
+// pods than internedMax, so a table filling up with unique values would show.
+func BenchmarkLargeClusterPods(b *testing.B) {
+	pods := syntheticPods(1000, internedMax*3/2)
+	for _, intern := range []bool{false, true} {
+		b.Run(fmt.Sprintf("intern=%t", intern), func(b *testing.B) {
+			config.Cfg.InternProperties = intern
+			defer func() { config.Cfg.InternProperties = false }()
+			b.ReportAllocs()
+			var heap float64
+			for i := 0; i < b.N; i++ {
+				var before, after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+				store := make(map[string]Node, len(pods))
+				for _, pod := range pods {
+					events, err := transformNodeEvents(&Event{Operation: Create, Resource: pod, ResourceString: "pods"})
+					if err != nil {
+						b.Fatal(err)
+					}
+					for _, ne := range events {
+						store[ne.UID] = ne.Node
+					}
+				}
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				heap += float64(after.HeapAlloc) - float64(before.HeapAlloc)
+				runtime.KeepAlive(store)
+			}
+			b.ReportMetric(heap/float64(b.N)/float64(len(pods)), "heap-bytes/pod")
+			interned.RLock()
+			b.ReportMetric(float64(len(interned.strings)), "interned-strings")
+			interned.RUnlock()
+		})
+	}
+}
+
+func BenchmarkInternProperties(b *testing.B) {
+	pods := syntheticPods(500, 1000)
+	nodes := make([]Node, 0, len(pods))
+	for _, pod := range pods {
+		nodes = append(nodes, transformCommon(pod))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		internProperties(nodes[i%len(nodes)].Properties)
+	}
+}
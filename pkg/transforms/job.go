@@ -11,7 +11,12 @@ Copyright (c) 2020 Red Hat, Inc.
 package transforms
 
 import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
 	v1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 // JobResource ...
@@ -37,6 +42,93 @@ func JobResourceBuilder(j *v1.Job) *JobResource {
 	return &JobResource{node: node}
 }
 
+// Adds the rules of spec.podFailurePolicy as podFailurePolicyAction, with the action of each rule, and
+// podFailurePolicyRule, with a description of what each rule matches, like "FailJob onExitCodes In 1,2" or
+// "Ignore onPodConditions DisruptionTarget=True". Both lists are in the order of the rules. The field is newer than
+// the k8s API version we build with, so it's read from the unstructured resource.
+func (j *JobResource) addPodFailurePolicy(object map[string]interface{}) {
+	rules, found, err := unstructured.NestedSlice(object, "spec", "podFailurePolicy", "rules")
+	if err != nil {
+		glog.V(3).Infof("Ignoring invalid spec.podFailurePolicy of Job %s: %v", j.node.Properties["name"], err)
+		return
+	}
+	if !found || len(rules) == 0 {
+		return
+	}
+	actions := make([]string, 0, len(rules))
+	descriptions := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		ruleMap, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		action, _, _ := unstructured.NestedString(ruleMap, "action")
+		actions = append(actions, action)
+		descriptions = append(descriptions, podFailurePolicyRule(action, ruleMap))
+	}
+	j.node.Properties["podFailurePolicyAction"] = actions
+	j.node.Properties["podFailurePolicyRule"] = descriptions
+}
+
+// Describes what a pod failure policy rule matches.
+func podFailurePolicyRule(action string, rule map[string]interface{}) string {
+	if onExitCodes, found, _ := unstructured.NestedMap(rule, "onExitCodes"); found {
+		operator, _, _ := unstructured.NestedString(onExitCodes, "operator")
+		values, _, _ := unstructured.NestedSlice(onExitCodes, "values")
+		codes := make([]string, 0, len(values))
+		for _, value := range values {
+			codes = append(codes, fmt.Sprint(value))
+		}
+		description := fmt.Sprintf("%s onExitCodes %s %s", action, operator, strings.Join(codes, ","))
+		if container, _, _ := unstructured.NestedString(onExitCodes, "containerName"); container != "" {
+			description += " container=" + container
+		}
+		return description
+	}
+	conditions, _, _ := unstructured.NestedSlice(rule, "onPodConditions")
+	patterns := make([]string, 0, len(conditions))
+	for _, condition := range conditions {
+		if conditionMap, ok := condition.(map[string]interface{}); ok {
+			patterns = append(patterns, fmt.Sprintf("%v=%v", conditionMap["type"], conditionMap["status"]))
+		}
+	}
+	return fmt.Sprintf("%s onPodConditions %s", action, strings.Join(patterns, ","))
+}
+
+// Adds the rules of spec.successPolicy as successPolicySucceededIndexes and successPolicySucceededCount, in the
+// order of the rules. A rule can set either field or both, the field it doesn't set is "" or 0 (a count is at
+// least 1). The field is newer than the k8s API version we build with, so it's read from the unstructured resource.
+func (j *JobResource) addSuccessPolicy(object map[string]interface{}) {
+	rules, found, err := unstructured.NestedSlice(object, "spec", "successPolicy", "rules")
+	if err != nil {
+		glog.V(3).Infof("Ignoring invalid spec.successPolicy of Job %s: %v", j.node.Properties["name"], err)
+		return
+	}
+	if !found || len(rules) == 0 {
+		return
+	}
+	indexes := make([]string, 0, len(rules))
+	counts := make([]int64, 0, len(rules))
+	for _, rule := range rules {
+		ruleMap, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		succeededIndexes, _, _ := unstructured.NestedString(ruleMap, "succeededIndexes")
+		indexes = append(indexes, succeededIndexes)
+		var count int64
+		switch value := ruleMap["succeededCount"].(type) { // float64 when decoded by encoding/json
+		case int64:
+			count = value
+		case float64:
+			count = int64(value)
+		}
+		counts = append(counts, count)
+	}
+	j.node.Properties["successPolicySucceededIndexes"] = indexes
+	j.node.Properties["successPolicySucceededCount"] = counts
+}
+
 // BuildNode construct node for Job resources
 func (j JobResource) BuildNode() Node {
 	return j.node
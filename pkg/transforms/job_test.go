@@ -14,6 +14,7 @@ import (
 	"testing"
 
 	v1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 func TestTransformJob(t *testing.T) {
@@ -25,6 +26,61 @@ func TestTransformJob(t *testing.T) {
 	AssertEqual("successful", node.Properties["successful"], int64(1), t)
 	AssertEqual("completions", node.Properties["completions"], int64(1), t)
 	AssertEqual("parallelism", node.Properties["parallelism"], int64(1), t)
+	AssertEqual("podFailurePolicyAction", node.Properties["podFailurePolicyAction"], nil, t)
+	AssertEqual("successPolicySucceededIndexes", node.Properties["successPolicySucceededIndexes"], nil, t)
+}
+
+func TestJobPodFailurePolicy(t *testing.T) {
+	var j v1.Job
+	var u unstructured.Unstructured
+	UnmarshalFile("job.json", &j, t)
+	UnmarshalFile("job.json", &u, t)
+	rules := []interface{}{
+		map[string]interface{}{
+			"action": "FailJob",
+			"onExitCodes": map[string]interface{}{
+				"containerName": "main", "operator": "In", "values": []interface{}{int64(1), int64(42)}},
+		},
+		map[string]interface{}{
+			"action":          "Ignore",
+			"onPodConditions": []interface{}{map[string]interface{}{"type": "DisruptionTarget", "status": "True"}},
+		},
+	}
+	if err := unstructured.SetNestedSlice(u.Object, rules, "spec", "podFailurePolicy", "rules"); err != nil {
+		t.Fatal(err)
+	}
+	job := JobResourceBuilder(&j)
+	job.addPodFailurePolicy(u.Object)
+	node := job.BuildNode()
+
+	AssertDeepEqual("podFailurePolicyAction", node.Properties["podFailurePolicyAction"], []string{"FailJob", "Ignore"}, t)
+	AssertDeepEqual("podFailurePolicyRule", node.Properties["podFailurePolicyRule"], []string{
+		"FailJob onExitCodes In 1,42 container=main",
+		"Ignore onPodConditions DisruptionTarget=True",
+	}, t)
+}
+
+func TestJobSuccessPolicy(t *testing.T) {
+	var j v1.Job
+	var u unstructured.Unstructured
+	UnmarshalFile("job.json", &j, t)
+	UnmarshalFile("job.json", &u, t)
+	rules := []interface{}{
+		map[string]interface{}{"succeededIndexes": "0-2,5", "succeededCount": int64(2)},
+		map[string]interface{}{"succeededCount": float64(10)},
+		map[string]interface{}{"succeededIndexes": "7"},
+	}
+	if err := unstructured.SetNestedSlice(u.Object, rules, "spec", "successPolicy", "rules"); err != nil {
+		t.Fatal(err)
+	}
+	job := JobResourceBuilder(&j)
+	job.addSuccessPolicy(u.Object)
+	node := job.BuildNode()
+
+	AssertDeepEqual("successPolicySucceededIndexes", node.Properties["successPolicySucceededIndexes"],
+		[]string{"0-2,5", "", "7"}, t)
+	AssertDeepEqual("successPolicySucceededCount", node.Properties["successPolicySucceededCount"],
+		[]int64{2, 10, 0}, t)
 }
 
 func TestJobBuildEdges(t *testing.T) {
@@ -0,0 +1,91 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"sort"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	apiTypes "k8s.io/apimachinery/pkg/types"
+)
+
+// Labels that name the logical application of a resource, in order of precedence.
+var applicationLabels = []string{"app.kubernetes.io/part-of", "app.kubernetes.io/name"}
+
+// Returns the logical application of the node from its labels, or an empty string if it doesn't have one.
+func labelApplication(node Node) string {
+	labels, _ := node.Properties["label"].(map[string]string)
+	for _, label := range applicationLabels {
+		if value := labels[label]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// LabelApplicationUID returns the UID of the synthetic Application node for the application label value.
+func LabelApplicationUID(name string) string {
+	return PrefixedUID("Application", apiTypes.UID("label-application-"+name))
+}
+
+// Builds the synthetic Application node grouping the resources with the same application label. The node is
+// cluster scoped, because the labels don't tell which namespace the application belongs to. It's the same for
+// every member, so sending it with each member is idempotent.
+func labelApplicationNode(name string) Node {
+	return Node{
+		UID:            LabelApplicationUID(name),
+		ResourceString: "applications",
+		Properties: map[string]interface{}{
+			"kind":              "Application",
+			"kind_plural":       "applications",
+			"name":              name,
+			"_clusterNamespace": config.Cfg.ClusterNamespace,
+			"_synthetic":        true,
+		},
+		Metadata: map[string]string{},
+	}
+}
+
+// Builds the partOf edges from the members of the synthetic Application to the Application.
+// Every node is checked, so this is O(nodes) for each synthetic Application.
+func labelApplicationEdges(node Node, ns NodeStore) []Edge {
+	name := node.Properties["name"]
+	uids := []string{}
+	for uid, member := range ns.ByUID {
+		if member.Properties["_labelApplication"] == name {
+			uids = append(uids, uid)
+		}
+	}
+	sort.Strings(uids) // keep the order of the edges stable
+
+	ret := []Edge{}
+	for _, uid := range uids {
+		member := ns.ByUID[uid]
+		kind, _ := member.Properties["kind"].(string)
+		ret = append(ret, Edge{
+			SourceUID:  uid,
+			DestUID:    node.UID,
+			EdgeType:   "partOf",
+			SourceKind: kind,
+			DestKind:   "Application",
+		})
+	}
+	return ret
+}
+
+// Adds the _labelApplication property to the node and returns the node event for its synthetic Application,
+// or false if the node doesn't have an application label.
+func labelApplicationEvent(ne *NodeEvent) (NodeEvent, bool) {
+	name := labelApplication(ne.Node)
+	if name == "" {
+		return NodeEvent{}, false
+	}
+	ne.Node.Properties["_labelApplication"] = name
+	app := labelApplicationNode(name)
+	return NodeEvent{
+		Node:         app,
+		ComputeEdges: func(ns NodeStore) []Edge { return labelApplicationEdges(app, ns) },
+		Time:         ne.Time,
+		Operation:    Update,
+	}, true
+}
@@ -0,0 +1,35 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+)
+
+func TestLabelApplicationEvent(t *testing.T) {
+	ne := NodeEvent{Node: Node{UID: "local-cluster/uuid-member", Properties: map[string]interface{}{
+		"kind": "Deployment", "name": "frontend",
+		"label": map[string]string{"app.kubernetes.io/name": "frontend", "app.kubernetes.io/part-of": "shop"}},
+	}}
+	appEvent, ok := labelApplicationEvent(&ne)
+	AssertEqual("has application", ok, true, t)
+	AssertEqual("_labelApplication", ne.Node.Properties["_labelApplication"], "shop", t) // part-of takes precedence
+	AssertEqual("UID", appEvent.Node.UID, LabelApplicationUID("shop"), t)
+	AssertEqual("kind", appEvent.Node.Properties["kind"], "Application", t)
+	AssertEqual("name", appEvent.Node.Properties["name"], "shop", t)
+	AssertEqual("_synthetic", appEvent.Node.Properties["_synthetic"], true, t)
+
+	// Resources without the labels don't have an application.
+	other := NodeEvent{Node: Node{Properties: map[string]interface{}{"kind": "Pod", "name": "p"}}}
+	_, ok = labelApplicationEvent(&other)
+	AssertEqual("has application", ok, false, t)
+	AssertEqual("_labelApplication", other.Node.Properties["_labelApplication"], nil, t)
+
+	// Edges from every member.
+	nodeStore := BuildFakeNodeStore([]Node{ne.Node, other.Node, appEvent.Node})
+	edges := appEvent.ComputeEdges(nodeStore)
+	AssertEqual("Application edge total:", len(edges), 1, t)
+	AssertEqual("partOf", edges[0].EdgeType, EdgeType("partOf"), t)
+	AssertEqual("partOf", edges[0].SourceUID, ne.Node.UID, t)
+	AssertEqual("partOf", edges[0].DestUID, appEvent.Node.UID, t)
+}
@@ -0,0 +1,87 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// LimitRangeResource ...
+type LimitRangeResource struct {
+	node Node
+}
+
+// LimitRangeResourceBuilder ...
+func LimitRangeResourceBuilder(l *v1.LimitRange) *LimitRangeResource {
+	node := transformCommon(l)         // Start off with the common properties
+	apiGroupVersion(l.TypeMeta, &node) // add kind, apigroup and version
+	// Extract the properties specific to this type
+	// Only the Container limits have defaults, they're injected into the containers that don't set them.
+	defaultLimit := make(map[string]string)
+	defaultRequest := make(map[string]string)
+	for _, limit := range l.Spec.Limits {
+		if limit.Type != v1.LimitTypeContainer {
+			continue
+		}
+		for name, quantity := range resourceListStrings(limit.Default) {
+			defaultLimit[name] = quantity
+		}
+		for name, quantity := range resourceListStrings(limit.DefaultRequest) {
+			defaultRequest[name] = quantity
+		}
+	}
+	node.Properties["defaultLimit"] = defaultLimit
+	node.Properties["defaultRequest"] = defaultRequest
+
+	return &LimitRangeResource{node: node}
+}
+
+// BuildNode construct the node for the LimitRange Resources
+func (l LimitRangeResource) BuildNode() Node {
+	return l.node
+}
+
+// BuildEdges construct the edges for the LimitRange Resources
+func (l LimitRangeResource) BuildEdges(ns NodeStore) []Edge {
+	return CommonEdges(l.node.UID, ns)
+}
+
+// Returns the container defaults injected by the LimitRanges of the namespace, the union of the defaults of every
+// LimitRange. The admission plugin applies a default only when the container doesn't have one yet, so when
+// several LimitRanges set a default for the same resource the first one applied wins. The order isn't defined by
+// Kubernetes, we keep the LimitRange with the first name and list the resources with conflicting defaults.
+func limitRangeDefaults(ns NodeStore, namespace string) (limits, requests map[string]string, conflicts []string) {
+	limitRanges := ns.ByKindNamespaceName["LimitRange"][namespace]
+	names := make([]string, 0, len(limitRanges))
+	for name := range limitRanges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	limits = make(map[string]string)
+	requests = make(map[string]string)
+	conflicting := make(map[string]struct{})
+	merge := func(defaults map[string]string, values interface{}) {
+		valueMap, _ := values.(map[string]string)
+		for name, quantity := range valueMap {
+			if current, ok := defaults[name]; !ok {
+				defaults[name] = quantity
+			} else if current != quantity {
+				conflicting[name] = struct{}{}
+			}
+		}
+	}
+	for _, name := range names {
+		merge(limits, limitRanges[name].Properties["defaultLimit"])
+		merge(requests, limitRanges[name].Properties["defaultRequest"])
+	}
+
+	conflicts = make([]string, 0, len(conflicting))
+	for name := range conflicting {
+		conflicts = append(conflicts, name)
+	}
+	sort.Strings(conflicts)
+	return limits, requests, conflicts
+}
@@ -0,0 +1,45 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestTransformLimitRange(t *testing.T) {
+	var l v1.LimitRange
+	UnmarshalFile("limitrange.json", &l, t)
+	node := LimitRangeResourceBuilder(&l).BuildNode()
+
+	// Test only the fields that exist in limitrange - the common test will test the other bits
+	AssertDeepEqual("defaultLimit", node.Properties["defaultLimit"],
+		map[string]string{"cpu": "500m", "memory": "512Mi"}, t)
+	AssertDeepEqual("defaultRequest", node.Properties["defaultRequest"],
+		map[string]string{"cpu": "100m", "memory": "256Mi"}, t)
+}
+
+func TestLimitRangeDefaults(t *testing.T) {
+	var l v1.LimitRange
+	UnmarshalFile("limitrange.json", &l, t)
+	// A second LimitRange in the namespace.
+	nodeStore := BuildFakeNodeStore([]Node{LimitRangeResourceBuilder(&l).BuildNode(), {
+		UID: "uuid-limitrange-2",
+		Properties: map[string]interface{}{
+			"kind":           "LimitRange",
+			"namespace":      "default",
+			"name":           "a-memory-defaults",
+			"defaultLimit":   map[string]string{"memory": "1Gi", "ephemeral-storage": "1Gi"},
+			"defaultRequest": map[string]string{"memory": "256Mi"},
+		},
+	}})
+
+	limits, requests, conflicts := limitRangeDefaults(nodeStore, "default")
+	AssertDeepEqual("limits", limits, map[string]string{"cpu": "500m", "memory": "1Gi", "ephemeral-storage": "1Gi"}, t)
+	AssertDeepEqual("requests", requests, map[string]string{"cpu": "100m", "memory": "256Mi"}, t)
+	AssertDeepEqual("conflicts", conflicts, []string{"memory"}, t)
+
+	limits, requests, conflicts = limitRangeDefaults(nodeStore, "other")
+	AssertEqual("no limits", len(limits)+len(requests)+len(conflicts), 0, t)
+}
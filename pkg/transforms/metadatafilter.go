@@ -0,0 +1,82 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"path"
+	"strings"
+
+	"github.com/stolostron/search-collector/pkg/config"
+)
+
+// Returns the labels or annotations whose keys are kept by METADATA_KEYS_ALLOW and METADATA_KEYS_DENY.
+// The map is returned as is when every key is kept, otherwise a filtered copy, the resource is never modified.
+func filterMetadataKeys(metadata map[string]string) map[string]string {
+	for key := range metadata {
+		if keepMetadataKey(key) {
+			continue
+		}
+		filtered := make(map[string]string, len(metadata))
+		for key, value := range metadata {
+			if keepMetadataKey(key) {
+				filtered[key] = value
+			}
+		}
+		return filtered
+	}
+	return metadata
+}
+
+// FilterLabelKeys returns a copy of the node with the label keys kept by METADATA_KEYS_ALLOW and METADATA_KEYS_DENY.
+// The edges are built from all the labels, like the selectors of services, so labels are filtered when the nodes
+// leave the collector instead of when they are transformed. The node is returned as is when every key is kept.
+func FilterLabelKeys(node Node) Node {
+	labels, ok := node.Properties["label"].(map[string]string)
+	if !ok {
+		return node
+	}
+	filtered := filterMetadataKeys(labels)
+	if len(filtered) == len(labels) {
+		return node
+	}
+	properties := make(map[string]interface{}, len(node.Properties))
+	for name, value := range node.Properties {
+		properties[name] = value
+	}
+	properties["label"] = filtered
+	node.Properties = properties
+	return node
+}
+
+// A key is kept when it matches the allow list, or the allow list is empty, and it doesn't match the deny list.
+// The last applied configuration annotation can hold the values of secrets, so it's never kept.
+func keepMetadataKey(key string) bool {
+	if key == lastAppliedAnnotation {
+		return false
+	}
+	if len(config.Cfg.MetadataKeysAllow) > 0 && !matchesAnyKeyPattern(config.Cfg.MetadataKeysAllow, key) {
+		return false
+	}
+	return !matchesAnyKeyPattern(config.Cfg.MetadataKeysDeny, key)
+}
+
+// Returns true if the namespace matches EXCLUDED_NAMESPACES, its resources aren't transformed then.
+// Cluster scoped resources are never excluded.
+func isExcludedNamespace(namespace string) bool {
+	return namespace != "" && matchesAnyKeyPattern(config.Cfg.ExcludedNamespaces, namespace)
+}
+
+// A pattern ending with * matches the keys starting with the rest of the pattern, like example.com/*.
+// Other patterns are matched with path.Match, where * doesn't match the / of a key's prefix.
+func matchesAnyKeyPattern(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern && !strings.ContainsAny(prefix, `*?[\`) {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestMatchesAnyKeyPattern(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		key      string
+		expected bool
+	}{
+		{"app", "app", true},
+		{"app", "app.kubernetes.io/name", false},
+		{"app.kubernetes.io/*", "app.kubernetes.io/name", true},
+		{"app.kubernetes.io/*", "app.kubernetes.io/part-of", true},
+		{"app.kubernetes.io/*", "helm.sh/chart", false},
+		{"kapp.k14s.io/original*", "kapp.k14s.io/original-diff-md5", true},
+		{"*.openshift.io/*", "image.openshift.io/triggers", true},
+		{"*/revision", "deployment.kubernetes.io/revision", true},
+		{"*/revision", "revision", false},
+	}
+	for _, test := range tests {
+		AssertEqual(test.pattern+" "+test.key, matchesAnyKeyPattern([]string{test.pattern}, test.key),
+			test.expected, t)
+	}
+}
+
+func TestFilterMetadataKeys(t *testing.T) {
+	defer func(allow, deny []string) {
+		config.Cfg.MetadataKeysAllow = allow
+		config.Cfg.MetadataKeysDeny = deny
+	}(config.Cfg.MetadataKeysAllow, config.Cfg.MetadataKeysDeny)
+
+	labels := map[string]string{"app": "web", "app.kubernetes.io/name": "web", "helm.sh/chart": "web-1.0.0"}
+
+	config.Cfg.MetadataKeysAllow = nil
+	config.Cfg.MetadataKeysDeny = nil
+	AssertDeepEqual("nothing filtered", filterMetadataKeys(labels), labels, t)
+
+	config.Cfg.MetadataKeysAllow = []string{"app.kubernetes.io/*", "helm.sh/*"}
+	config.Cfg.MetadataKeysDeny = []string{"helm.sh/chart"}
+	AssertDeepEqual("filtered", filterMetadataKeys(labels), map[string]string{"app.kubernetes.io/name": "web"}, t)
+	AssertEqual("resource labels unchanged", len(labels), 3, t)
+
+	// The last applied configuration is denied even when METADATA_KEYS_DENY replaces the defaults.
+	config.Cfg.MetadataKeysAllow = nil
+	config.Cfg.MetadataKeysDeny = []string{"helm.sh/chart"}
+	annotations := map[string]string{lastAppliedAnnotation: `{"kind":"Secret"}`, "example.com/owner": "team-a"}
+	AssertDeepEqual("last applied", filterMetadataKeys(annotations), map[string]string{"example.com/owner": "team-a"}, t)
+}
+
+func TestFilterLabelKeys(t *testing.T) {
+	defer func(deny []string) { config.Cfg.MetadataKeysDeny = deny }(config.Cfg.MetadataKeysDeny)
+	config.Cfg.MetadataKeysDeny = []string{"pod-template-hash"}
+
+	// The node keeps all the labels for the edges, only the node sent is filtered.
+	labels := map[string]string{"app": "web", "pod-template-hash": "5d8f7c"}
+	s := v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Labels: labels}}
+	node := transformCommon(&s)
+	AssertDeepEqual("node labels", node.Properties["label"], labels, t)
+	output := FilterLabelKeys(node)
+	AssertDeepEqual("sent labels", output.Properties["label"], map[string]string{"app": "web"}, t)
+	AssertDeepEqual("store node unchanged", node.Properties["label"], labels, t)
+}
+
+func TestTransformNodeEventsExcludedNamespace(t *testing.T) {
+	defer func(excluded []string) { config.Cfg.ExcludedNamespaces = excluded }(config.Cfg.ExcludedNamespaces)
+	var p unstructured.Unstructured
+	UnmarshalFile("pod.json", &p, t)
+	var n unstructured.Unstructured
+	UnmarshalFile("node.json", &n, t)
+
+	config.Cfg.ExcludedNamespaces = []string{"openshift-*", p.GetNamespace()}
+	events, err := transformNodeEvents(&Event{Resource: &p, ResourceString: "pods", Operation: Delete})
+	AssertEqual("excluded error", err, nil, t)
+	AssertEqual("excluded events", len(events), 0, t)
+	// Cluster scoped resources aren't excluded.
+	events, _ = transformNodeEvents(&Event{Resource: &n, ResourceString: "nodes"})
+	AssertEqual("cluster scoped events", len(events), 1, t)
+
+	config.Cfg.ExcludedNamespaces = []string{"openshift-*"}
+	events, _ = transformNodeEvents(&Event{Resource: &p, ResourceString: "pods"})
+	AssertEqual("not excluded events", len(events), 1, t)
+	AssertEqual("prefix excluded", isExcludedNamespace("openshift-monitoring"), true, t)
+}
+
+func TestLastAppliedConfigurationDropped(t *testing.T) {
+	defer func(collect bool) { config.Cfg.CollectAnnotations = collect }(config.Cfg.CollectAnnotations)
+	config.Cfg.CollectAnnotations = true
+
+	annotations := map[string]string{
+		"kubectl.kubernetes.io/last-applied-configuration": `{"apiVersion":"v1","kind":"Service"}`,
+		"example.com/owner": "team-a",
+	}
+	expected := map[string]string{"example.com/owner": "team-a"}
+
+	// The typed transforms.
+	s := v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Annotations: annotations}}
+	node := transformCommon(&s)
+	AssertDeepEqual("typed annotation", node.Properties["annotation"], expected, t)
+
+	// The resources without a transform.
+	r := &unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "example.com/v1", "kind": "Widget"}}
+	r.SetName("widget")
+	r.SetAnnotations(annotations)
+	node = GenericResourceBuilder(r).BuildNode()
+	AssertDeepEqual("unstructured annotation", node.Properties["annotation"], expected, t)
+
+	config.Cfg.CollectAnnotations = false
+	AssertEqual("not collected", transformCommon(&s).Properties["annotation"], nil, t)
+}
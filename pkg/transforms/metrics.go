@@ -0,0 +1,83 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Names of the operations in the metric labels.
+var operationNames = map[Operation]string{Create: "create", Update: "update", Delete: "delete"}
+
+var (
+	transformedNodes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "search_collector",
+		Subsystem: "transformer",
+		Name:      "nodes_total",
+		Help:      "Number of nodes passed into the output of the transformer, synthetic nodes included.",
+	}, []string{"kind", "operation"})
+	transformErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "search_collector",
+		Subsystem: "transformer",
+		Name:      "errors_total",
+		Help:      "Number of resources skipped because their transform panicked.",
+	}, []string{"kind"})
+	throttledNodes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "search_collector",
+		Subsystem: "transformer",
+		Name:      "throttled_nodes_total",
+		Help:      "Number of nodes dropped because their kind was over its rate limit, or still buffered when stopped.",
+	}, []string{"kind"})
+	routinePanics = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "search_collector",
+		Subsystem: "transformer",
+		Name:      "routine_panics_total",
+		Help:      "Number of panics in the transformer routines outside of the transform of a resource.",
+	})
+	inputDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "search_collector",
+		Subsystem: "transformer",
+		Name:      "input_depth",
+		Help:      "Number of events waiting in the input of the transformer, last time it was read.",
+	})
+	redactedFields = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "search_collector",
+		Subsystem: "transformer",
+		Name:      "redacted_fields_total",
+		Help:      "Number of fields stripped from the nodes because they matched REDACTED_PATHS.",
+	}, []string{"kind"})
+	queueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "search_collector",
+		Subsystem: "transformer",
+		Name:      "queue_depth",
+		Help:      "Number of resources with an event waiting in the queue of EVENT_QUEUE_SIZE.",
+	})
+	collapsedEvents = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "search_collector",
+		Subsystem: "transformer",
+		Name:      "collapsed_events_total",
+		Help:      "Number of events that replaced the waiting event of the same resource in the queue.",
+	})
+)
+
+// Metrics returns the Prometheus collectors of the transformer metrics, for the binary to register.
+// The metrics are shared by every transformer of the process.
+func Metrics() []prometheus.Collector {
+	return []prometheus.Collector{transformedNodes, transformErrors, throttledNodes, routinePanics, inputDepth,
+		redactedFields, queueDepth, collapsedEvents}
+}
+
+// Counts the node passed into the output.
+func countTransformedNode(ne NodeEvent) {
+	kind, _ := ne.Properties["kind"].(string)
+	transformedNodes.WithLabelValues(kind, operationNames[ne.Operation]).Inc()
+}
+
+// Counts the resource of the event that failed to transform.
+func countTransformError(event *Event) {
+	kind := ""
+	if event.Resource != nil {
+		kind = event.Resource.GetKind()
+	}
+	transformErrors.WithLabelValues(kind).Inc()
+}
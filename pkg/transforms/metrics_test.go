@@ -0,0 +1,56 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	for _, collector := range Metrics() {
+		if err := registry.Register(collector); err != nil {
+			t.Fatal("Expected the metrics to register: ", err)
+		}
+	}
+	// The metrics are shared by the tests, only check how much they advanced.
+	createdPods := testutil.ToFloat64(transformedNodes.WithLabelValues("Pod", "create"))
+	updatedPods := testutil.ToFloat64(transformedNodes.WithLabelValues("Pod", "update"))
+	podErrors := testutil.ToFloat64(transformErrors.WithLabelValues("Pod"))
+
+	input := make(chan *Event)
+	output := make(chan NodeEvent)
+	transformer := NewTransformer(input, output, 1)
+	defer transformer.Stop()
+
+	var p unstructured.Unstructured
+	UnmarshalFile("pod.json", &p, t)
+	for _, operation := range []Operation{Create, Create, Update} {
+		input <- &Event{Resource: &p, ResourceString: "pods", Operation: operation}
+		<-output
+	}
+	input <- &Event{Resource: &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1", "kind": "Pod", "spec": "not a pod spec"}}}
+	<-transformer.Errors
+
+	AssertEqual("created pods", testutil.ToFloat64(transformedNodes.WithLabelValues("Pod", "create")),
+		createdPods+2, t)
+	AssertEqual("updated pods", testutil.ToFloat64(transformedNodes.WithLabelValues("Pod", "update")),
+		updatedPods+1, t)
+	AssertEqual("pod errors", testutil.ToFloat64(transformErrors.WithLabelValues("Pod")), podErrors+1, t)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal("Expected the metrics to gather: ", err)
+	}
+	names := map[string]bool{}
+	for _, family := range families {
+		names[family.GetName()] = true
+	}
+	AssertEqual("nodes metric", names["search_collector_transformer_nodes_total"], true, t)
+	AssertEqual("errors metric", names["search_collector_transformer_errors_total"], true, t)
+}
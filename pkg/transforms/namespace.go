@@ -11,6 +11,8 @@ Copyright (c) 2020 Red Hat, Inc.
 package transforms
 
 import (
+	"sort"
+
 	v1 "k8s.io/api/core/v1"
 )
 
@@ -35,7 +37,47 @@ func (n NamespaceResource) BuildNode() Node {
 }
 
 // BuildEdges construct the edges for the Namespace Resources
+// The Namespace doesn't have edges, but the container defaults of its LimitRanges are added to its node here,
+// once the LimitRanges are in the store.
 func (n NamespaceResource) BuildEdges(ns NodeStore) []Edge {
-	//no op for now to implement interface
+	if node, ok := ns.ByUID[n.node.UID]; ok {
+		name, _ := node.Properties["name"].(string)
+		limits, requests, conflicts := limitRangeDefaults(ns, name)
+		delete(node.Properties, "limitRangeDefaultLimit")
+		delete(node.Properties, "limitRangeDefaultRequest")
+		delete(node.Properties, "_limitRangeConflicts")
+		if len(limits) > 0 {
+			node.Properties["limitRangeDefaultLimit"] = limits
+		}
+		if len(requests) > 0 {
+			node.Properties["limitRangeDefaultRequest"] = requests
+		}
+		if len(conflicts) > 0 {
+			node.Properties["_limitRangeConflicts"] = conflicts
+		}
+	}
 	return []Edge{}
 }
+
+// NamespaceDeleteEvents returns Delete events for the nodes in the store that belong to the namespace with the
+// given UID, sorted by UID. The store's ByKindNamespaceName is the namespace index, the nodes of each kind are
+// looked up by the namespace's name. Returns nil if the namespace isn't in the store.
+func NamespaceDeleteEvents(ns NodeStore, namespaceUID string, time int64) []NodeEvent {
+	namespace, ok := ns.ByUID[namespaceUID].Properties["name"].(string)
+	if !ok || ns.ByUID[namespaceUID].Properties["kind"] != "Namespace" {
+		return nil
+	}
+	uids := make([]string, 0)
+	for _, namespaces := range ns.ByKindNamespaceName {
+		for _, node := range namespaces[namespace] {
+			uids = append(uids, node.UID)
+		}
+	}
+	sort.Strings(uids) // keep the order of the deletes stable
+
+	events := make([]NodeEvent, 0, len(uids))
+	for _, uid := range uids {
+		events = append(events, NodeEvent{Node: Node{UID: uid}, Time: time, Operation: Delete})
+	}
+	return events
+}
@@ -38,3 +38,46 @@ func TestNamespaceBuildEdges(t *testing.T) {
 	// Validate results
 	AssertEqual("Namespace has no edges:", len(edges), 0, t)
 }
+
+func TestNamespaceDeleteEvents(t *testing.T) {
+	nodes := []Node{
+		{UID: "uuid-ns-foo", Properties: map[string]interface{}{"kind": "Namespace", "name": "foo"}},
+		{UID: "uuid-pod-b", Properties: map[string]interface{}{"kind": "Pod", "namespace": "foo", "name": "b"}},
+		{UID: "uuid-pod-other", Properties: map[string]interface{}{"kind": "Pod", "namespace": "bar", "name": "b"}},
+		{UID: "uuid-cm-a", Properties: map[string]interface{}{"kind": "ConfigMap", "namespace": "foo", "name": "a"}},
+	}
+	nodeStore := BuildFakeNodeStore(nodes)
+	events := NamespaceDeleteEvents(nodeStore, "uuid-ns-foo", 42)
+	AssertEqual("Delete events", len(events), 2, t)
+	AssertEqual("ConfigMap", events[0].UID, "uuid-cm-a", t)
+	AssertEqual("Pod", events[1].UID, "uuid-pod-b", t)
+	AssertEqual("Operation", events[1].Operation, Delete, t)
+	AssertEqual("Time", events[1].Time, int64(42), t)
+
+	AssertEqual("Not a namespace", len(NamespaceDeleteEvents(nodeStore, "uuid-pod-b", 42)), 0, t)
+	AssertEqual("Unknown namespace", len(NamespaceDeleteEvents(nodeStore, "uuid-unknown", 42)), 0, t)
+}
+
+func TestNamespaceBuildEdgesLimitRangeDefaults(t *testing.T) {
+	var ns v1.Namespace
+	UnmarshalFile("namespace.json", &ns, t)
+	namespace := NamespaceResourceBuilder(&ns)
+	var l v1.LimitRange
+	UnmarshalFile("limitrange.json", &l, t)
+	nodeStore := BuildFakeNodeStore([]Node{namespace.BuildNode(), LimitRangeResourceBuilder(&l).BuildNode()})
+
+	edges := namespace.BuildEdges(nodeStore)
+	AssertEqual("Namespace has no edges:", len(edges), 0, t)
+	node := nodeStore.ByUID[namespace.BuildNode().UID]
+	AssertDeepEqual("limitRangeDefaultLimit", node.Properties["limitRangeDefaultLimit"],
+		map[string]string{"cpu": "500m", "memory": "512Mi"}, t)
+	AssertDeepEqual("limitRangeDefaultRequest", node.Properties["limitRangeDefaultRequest"],
+		map[string]string{"cpu": "100m", "memory": "256Mi"}, t)
+	AssertEqual("_limitRangeConflicts", node.Properties["_limitRangeConflicts"], nil, t)
+
+	// The LimitRange was deleted.
+	delete(nodeStore.ByKindNamespaceName, "LimitRange")
+	namespace.BuildEdges(nodeStore)
+	AssertEqual("limitRangeDefaultLimit", node.Properties["limitRangeDefaultLimit"], nil, t)
+	AssertEqual("limitRangeDefaultRequest", node.Properties["limitRangeDefaultRequest"], nil, t)
+}
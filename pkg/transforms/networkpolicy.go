@@ -0,0 +1,66 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	networking "k8s.io/api/networking/v1"
+)
+
+// NetworkPolicyResource ...
+type NetworkPolicyResource struct {
+	node Node
+}
+
+// NetworkPolicyResourceBuilder ...
+func NetworkPolicyResourceBuilder(n *networking.NetworkPolicy) *NetworkPolicyResource {
+	node := transformCommon(n)         // Start off with the common properties
+	apiGroupVersion(n.TypeMeta, &node) // add kind, apigroup and version
+	// Extract the properties specific to this type
+	policyTypes := networkPolicyTypes(n.Spec)
+	types := make([]string, 0, len(policyTypes))
+	for _, policyType := range policyTypes {
+		types = append(types, string(policyType))
+	}
+	node.Properties["policyTypes"] = types
+
+	// The canonical default deny policy selects every pod in the namespace and allows no traffic.
+	selectsAllPods := len(n.Spec.PodSelector.MatchLabels) == 0 && len(n.Spec.PodSelector.MatchExpressions) == 0
+	denyIngress := selectsAllPods && hasPolicyType(policyTypes, networking.PolicyTypeIngress) && len(n.Spec.Ingress) == 0
+	denyEgress := selectsAllPods && hasPolicyType(policyTypes, networking.PolicyTypeEgress) && len(n.Spec.Egress) == 0
+	node.Properties["_defaultDenyIngress"] = denyIngress
+	node.Properties["_defaultDenyEgress"] = denyEgress
+	node.Properties["_defaultDeny"] = denyIngress || denyEgress
+
+	return &NetworkPolicyResource{node: node}
+}
+
+// Returns the policy types the policy applies to. When the spec doesn't list them, the policy applies to the
+// ingress, and to the egress if it has egress rules.
+func networkPolicyTypes(spec networking.NetworkPolicySpec) []networking.PolicyType {
+	if len(spec.PolicyTypes) > 0 {
+		return spec.PolicyTypes
+	}
+	if len(spec.Egress) > 0 {
+		return []networking.PolicyType{networking.PolicyTypeIngress, networking.PolicyTypeEgress}
+	}
+	return []networking.PolicyType{networking.PolicyTypeIngress}
+}
+
+func hasPolicyType(policyTypes []networking.PolicyType, policyType networking.PolicyType) bool {
+	for _, t := range policyTypes {
+		if t == policyType {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildNode construct the node for the NetworkPolicy Resources
+func (n NetworkPolicyResource) BuildNode() Node {
+	return n.node
+}
+
+// BuildEdges construct the edges for the NetworkPolicy Resources
+func (n NetworkPolicyResource) BuildEdges(ns NodeStore) []Edge {
+	return CommonEdges(n.node.UID, ns)
+}
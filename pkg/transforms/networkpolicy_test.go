@@ -0,0 +1,53 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTransformNetworkPolicy(t *testing.T) {
+	var n networking.NetworkPolicy
+	UnmarshalFile("networkpolicy.json", &n, t)
+	node := NetworkPolicyResourceBuilder(&n).BuildNode()
+
+	// Test only the fields that exist in network policy - the common test will test the other bits
+	AssertEqual("kind", node.Properties["kind"], "NetworkPolicy", t)
+	AssertEqual("apigroup", node.Properties["apigroup"], "networking.k8s.io", t)
+	AssertDeepEqual("policyTypes", node.Properties["policyTypes"], []string{"Ingress", "Egress"}, t)
+	// The egress rule allows DNS, only the ingress is denied.
+	AssertEqual("_defaultDenyIngress", node.Properties["_defaultDenyIngress"], true, t)
+	AssertEqual("_defaultDenyEgress", node.Properties["_defaultDenyEgress"], false, t)
+	AssertEqual("_defaultDeny", node.Properties["_defaultDeny"], true, t)
+}
+
+func TestNetworkPolicyDefaultDeny(t *testing.T) {
+	var n networking.NetworkPolicy
+	UnmarshalFile("networkpolicy.json", &n, t)
+
+	n.Spec.Egress = nil
+	node := NetworkPolicyResourceBuilder(&n).BuildNode()
+	AssertEqual("deny all ingress", node.Properties["_defaultDenyIngress"], true, t)
+	AssertEqual("deny all egress", node.Properties["_defaultDenyEgress"], true, t)
+
+	// Without policy types the policy only applies to the ingress.
+	n.Spec.PolicyTypes = nil
+	node = NetworkPolicyResourceBuilder(&n).BuildNode()
+	AssertDeepEqual("default policyTypes", node.Properties["policyTypes"], []string{"Ingress"}, t)
+	AssertEqual("default types ingress", node.Properties["_defaultDenyIngress"], true, t)
+	AssertEqual("default types egress", node.Properties["_defaultDenyEgress"], false, t)
+
+	// A rule without peers allows all the ingress.
+	n.Spec.Ingress = []networking.NetworkPolicyIngressRule{{}}
+	node = NetworkPolicyResourceBuilder(&n).BuildNode()
+	AssertEqual("allow all ingress", node.Properties["_defaultDeny"], false, t)
+
+	// A policy that selects some pods isn't a default deny.
+	n.Spec.Ingress = nil
+	n.Spec.PodSelector = metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}}
+	node = NetworkPolicyResourceBuilder(&n).BuildNode()
+	AssertEqual("selected pods", node.Properties["_defaultDeny"], false, t)
+}
@@ -14,6 +14,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/stolostron/search-collector/pkg/config"
 	v1 "k8s.io/api/core/v1"
 )
 
@@ -50,10 +51,63 @@ func NodeResourceBuilder(n *v1.Node) *NodeResource {
 	// that causes a trailing null character in SystemUUID.
 	node.Properties["_systemUUID"] = strings.TrimRight(n.Status.NodeInfo.SystemUUID, "\000")
 	node.Properties["role"] = roles
+	node.Properties["image"] = nodeImages(n.Status.Images, config.Cfg.NodeImagesMax)
+	node.Properties["_allocatableCpu"] = n.Status.Allocatable.Cpu().MilliValue()
+	node.Properties["_allocatableMemory"] = n.Status.Allocatable.Memory().Value()
+	if pressure := nodePressure(n.Status.Conditions); len(pressure) > 0 {
+		node.Properties["pressure"] = pressure
+	}
+	if len(n.Spec.Taints) > 0 {
+		taints := make([]string, 0, len(n.Spec.Taints))
+		for i := range n.Spec.Taints {
+			taints = append(taints, n.Spec.Taints[i].ToString())
+		}
+		node.Properties["taint"] = taints
+	}
 
 	return &NodeResource{node: node}
 }
 
+// Returns the names of the images cached on the node, without duplicates and up to max names.
+// Each image is listed under all its tags and digests, we keep them all so the image can be found by any of them.
+// The kubelet lists the largest images first, so those are the ones kept when truncating.
+func nodeImages(images []v1.ContainerImage, max int) []string {
+	names := make([]string, 0)
+	seen := make(map[string]struct{})
+	for _, image := range images {
+		for _, name := range image.Names {
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			if max > 0 && len(names) >= max {
+				return names
+			}
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Maps the node pressure conditions to the pressure type the kubelet evicts pods for.
+var nodePressureConditions = map[v1.NodeConditionType]string{
+	v1.NodeMemoryPressure: "memory",
+	v1.NodeDiskPressure:   "disk",
+	v1.NodePIDPressure:    "pid",
+}
+
+// Returns the pressure types (memory, disk, pid) of the pressure conditions the node currently reports.
+func nodePressure(conditions []v1.NodeCondition) []string {
+	var pressure []string
+	for _, condition := range conditions {
+		if pressureType, ok := nodePressureConditions[condition.Type]; ok && condition.Status == v1.ConditionTrue {
+			pressure = append(pressure, pressureType)
+		}
+	}
+	sort.Strings(pressure)
+	return pressure
+}
+
 // BuildNode construct the node for the Node Resources
 func (n NodeResource) BuildNode() Node {
 	return n.node
@@ -64,3 +118,48 @@ func (n NodeResource) BuildEdges(ns NodeStore) []Edge {
 	//no op for now to implement interface
 	return []Edge{}
 }
+
+// Max number of pods listed in the _oomKilledPods of a node.
+const oomKilledPodsMax = 10
+
+// Returns the sums of the requests of the pods running on the node, and the percent of the node's allocatable they
+// use. Also sums the containers of those pods that were OOM killed, and lists the first pods with OOM killed
+// containers. The pods are looked up in the index of the store, by the node they run on.
+func rollupPods(node Node, ds DeriveStore) map[string]interface{} {
+	name, _ := node.Properties["name"].(string)
+	requestedCPU, requestedMemory := int64(0), int64(0)
+	oomKills := int64(0)
+	oomKilledPods := make([]string, 0)
+	for _, pod := range ds.podsByNode[name] {
+		if cpu, ok := pod.Properties["_requestedCpu"].(int64); ok {
+			requestedCPU += cpu
+		}
+		if memory, ok := pod.Properties["_requestedMemory"].(int64); ok {
+			requestedMemory += memory
+		}
+		if killed, ok := pod.Properties["_oomKilledContainers"].(int64); ok && killed > 0 {
+			oomKills += killed
+			namespace, _ := pod.Properties["namespace"].(string)
+			podName, _ := pod.Properties["name"].(string)
+			oomKilledPods = append(oomKilledPods, namespace+"/"+podName)
+		}
+	}
+	// Keep the same pods on every pass, the map iteration order is random.
+	sort.Strings(oomKilledPods)
+	if len(oomKilledPods) > oomKilledPodsMax {
+		oomKilledPods = oomKilledPods[:oomKilledPodsMax]
+	}
+	rollup := map[string]interface{}{
+		"_oomKills":        oomKills,
+		"_oomKilledPods":   oomKilledPods,
+		"_requestedCpu":    requestedCPU,
+		"_requestedMemory": requestedMemory,
+	}
+	if allocatable, ok := node.Properties["_allocatableCpu"].(int64); ok && allocatable > 0 {
+		rollup["_requestedCpuPercent"] = requestedCPU * 100 / allocatable
+	}
+	if allocatable, ok := node.Properties["_allocatableMemory"].(int64); ok && allocatable > 0 {
+		rollup["_requestedMemoryPercent"] = requestedMemory * 100 / allocatable
+	}
+	return rollup
+}
@@ -11,6 +11,7 @@ Copyright (c) 2020 Red Hat, Inc.
 package transforms
 
 import (
+	"fmt"
 	"testing"
 
 	v1 "k8s.io/api/core/v1"
@@ -27,6 +28,37 @@ func TestTransformNode(t *testing.T) {
 	AssertEqual("osImage", node.Properties["osImage"], "Ubuntu 16.04.5 LTS", t)
 	AssertEqual("_systemUUID", node.Properties["_systemUUID"], "4BCDE0D7-CFFB-4A8F-B6F8-0026F347AD93", t)
 	AssertDeepEqual("role", node.Properties["role"], []string{"etcd", "main", "management", "proxy", "va"}, t)
+	AssertEqual("pressure", node.Properties["pressure"], nil, t)
+	AssertDeepEqual("taint", node.Properties["taint"], []string{"dedicated=infra:NoSchedule"}, t)
+	AssertDeepEqual("image", node.Properties["image"], []string{
+		"fake-test-image@sha256:9192e54ba49129c94d3c0afdcc0b1a309946dc291f7f2bcce9b488b5a8da294d",
+		"fake-test-image:3.1.2"}, t)
+}
+
+func TestNodeImages(t *testing.T) {
+	images := []v1.ContainerImage{
+		{Names: []string{"quay.io/foo/bar@sha256:aaaa", "quay.io/foo/bar:1.0", "quay.io/foo/bar:latest"}},
+		{Names: []string{"quay.io/foo/bar:latest", "quay.io/foo/baz:2.0"}},
+		{Names: []string{"quay.io/foo/qux:3.0"}},
+	}
+
+	AssertDeepEqual("dedup", nodeImages(images, 0),
+		[]string{"quay.io/foo/bar@sha256:aaaa", "quay.io/foo/bar:1.0", "quay.io/foo/bar:latest", "quay.io/foo/baz:2.0",
+			"quay.io/foo/qux:3.0"}, t)
+	AssertDeepEqual("truncated", nodeImages(images, 4),
+		[]string{"quay.io/foo/bar@sha256:aaaa", "quay.io/foo/bar:1.0", "quay.io/foo/bar:latest", "quay.io/foo/baz:2.0"}, t)
+}
+
+func TestTransformNodePressure(t *testing.T) {
+	var n v1.Node
+	UnmarshalFile("node.json", &n, t)
+	n.Status.Conditions = append(n.Status.Conditions,
+		v1.NodeCondition{Type: v1.NodePIDPressure, Status: v1.ConditionTrue},
+		v1.NodeCondition{Type: v1.NodeDiskPressure, Status: v1.ConditionFalse},
+		v1.NodeCondition{Type: v1.NodeMemoryPressure, Status: v1.ConditionTrue})
+	node := NodeResourceBuilder(&n).BuildNode()
+
+	AssertDeepEqual("pressure", node.Properties["pressure"], []string{"memory", "pid"}, t)
 }
 
 func TestNodeBuildEdges(t *testing.T) {
@@ -42,3 +74,55 @@ func TestNodeBuildEdges(t *testing.T) {
 	// Validate results
 	AssertEqual("Node has no edges:", len(edges), 0, t)
 }
+
+func TestNodeRollupPodRequests(t *testing.T) {
+	var n v1.Node
+	UnmarshalFile("node.json", &n, t)
+	node := NodeResourceBuilder(&n)
+	AssertEqual("_allocatableCpu", node.BuildNode().Properties["_allocatableCpu"], int64(7600), t)
+	AssertEqual("_allocatableMemory", node.BuildNode().Properties["_allocatableMemory"], int64(23538432*1024), t)
+
+	nodeName := node.BuildNode().Properties["name"].(string)
+	pod := func(uid, namespace, nodeName string, cpu, memory int64) Node {
+		return Node{UID: uid, Properties: map[string]interface{}{"kind": "Pod", "namespace": namespace, "name": uid,
+			"_nodeName": nodeName, "_requestedCpu": cpu, "_requestedMemory": memory}}
+	}
+	nodeStore := BuildFakeNodeStore([]Node{
+		node.BuildNode(),
+		pod("pod-1", "default", nodeName, 3800, 1024*1024*1024),
+		pod("pod-2", "kube-system", nodeName, 1900, 0),
+		pod("pod-3", "kube-system", "other-node", 1000, 0),
+	})
+	properties := DeriveProperties(node.BuildNode(), NewDeriveStore(nodeStore))
+	AssertEqual("_requestedCpu", properties["_requestedCpu"], int64(5700), t)
+	AssertEqual("_requestedMemory", properties["_requestedMemory"], int64(1024*1024*1024), t)
+	AssertEqual("_requestedCpuPercent", properties["_requestedCpuPercent"], int64(75), t)
+	AssertEqual("_requestedMemoryPercent", properties["_requestedMemoryPercent"], int64(4), t)
+}
+
+func TestNodeRollupOOMKills(t *testing.T) {
+	var n v1.Node
+	UnmarshalFile("node.json", &n, t)
+	node := NodeResourceBuilder(&n)
+	nodeName := node.BuildNode().Properties["name"].(string)
+	pod := func(name, nodeName string, killed int64) Node {
+		return Node{UID: name, Properties: map[string]interface{}{"kind": "Pod", "namespace": "default", "name": name,
+			"_nodeName": nodeName, "_oomKilledContainers": killed}}
+	}
+	nodes := []Node{node.BuildNode(), pod("pod-1", nodeName, 2), pod("pod-2", nodeName, 0), pod("pod-3", "other-node", 1)}
+	for i := 0; i < oomKilledPodsMax; i++ {
+		nodes = append(nodes, pod(fmt.Sprintf("pod-z%02d", i), nodeName, 1))
+	}
+	properties := DeriveProperties(node.BuildNode(), NewDeriveStore(BuildFakeNodeStore(nodes)))
+	AssertEqual("_oomKills", properties["_oomKills"], int64(2+oomKilledPodsMax), t)
+	oomKilledPods := properties["_oomKilledPods"].([]string)
+	AssertEqual("_oomKilledPods", len(oomKilledPods), oomKilledPodsMax, t)
+	AssertEqual("first _oomKilledPods", oomKilledPods[0], "default/pod-1", t)
+
+	// The rollup is recomputed, not added to the last one.
+	nodeStore := BuildFakeNodeStore([]Node{node.BuildNode(), pod("pod-2", nodeName, 0)})
+	properties = DeriveProperties(node.BuildNode(), NewDeriveStore(nodeStore))
+	AssertEqual("recomputed _oomKills", properties["_oomKills"], int64(0), t)
+	AssertDeepEqual("recomputed _oomKilledPods", properties["_oomKilledPods"], []string{}, t)
+	AssertEqual("node unchanged", node.BuildNode().Properties["_oomKills"], nil, t)
+}
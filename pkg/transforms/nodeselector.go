@@ -0,0 +1,148 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Returns true if the node's labels match every key/value in the selector.
+func matchesNodeLabels(selector map[string]string, labels map[string]string) bool {
+	for key, value := range selector {
+		if labelValue, ok := labels[key]; !ok || labelValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if the node matches a node selector. Follows the scheduler's semantics: the terms are ORed,
+// and the requirements in each term are ANDed. A selector without terms, or a term without requirements,
+// doesn't match any node.
+func matchesNodeSelectorTerms(terms []v1.NodeSelectorTerm, name string, labels map[string]string) bool {
+	for _, term := range terms {
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			continue
+		}
+		matches := true
+		for _, req := range term.MatchExpressions {
+			value, ok := labels[req.Key]
+			if !matchesNodeSelectorRequirement(req, value, ok) {
+				matches = false
+				break
+			}
+		}
+		for _, req := range term.MatchFields {
+			// metadata.name is the only field supported by the scheduler.
+			if !matches || req.Key != "metadata.name" || !matchesNodeSelectorRequirement(req, name, true) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the value matches the requirement. found is false when the node doesn't have the key.
+func matchesNodeSelectorRequirement(req v1.NodeSelectorRequirement, value string, found bool) bool {
+	switch req.Operator {
+	case v1.NodeSelectorOpIn:
+		return found && containsString(req.Values, value)
+	case v1.NodeSelectorOpNotIn:
+		return !found || !containsString(req.Values, value)
+	case v1.NodeSelectorOpExists:
+		return found
+	case v1.NodeSelectorOpDoesNotExist:
+		return !found
+	case v1.NodeSelectorOpGt, v1.NodeSelectorOpLt:
+		if !found || len(req.Values) != 1 {
+			return false
+		}
+		nodeValue, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false
+		}
+		reqValue, err := strconv.ParseInt(req.Values[0], 10, 64)
+		if err != nil {
+			return false
+		}
+		if req.Operator == v1.NodeSelectorOpGt {
+			return nodeValue > reqValue
+		}
+		return nodeValue < reqValue
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the required node affinity terms in the pod spec, or nil if the pod doesn't require any.
+func requiredNodeAffinityTerms(spec v1.PodSpec) []v1.NodeSelectorTerm {
+	if spec.Affinity == nil || spec.Affinity.NodeAffinity == nil ||
+		spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return nil
+	}
+	return spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+}
+
+// Returns true if the pod's node selector and required node affinity allow it to run on the node.
+// Taints, tolerations and resources aren't considered.
+func podMatchesNode(spec v1.PodSpec, node Node) bool {
+	name, _ := node.Properties["name"].(string)
+	labels, _ := node.Properties["label"].(map[string]string)
+	if !matchesNodeLabels(spec.NodeSelector, labels) {
+		return false
+	}
+	if terms := requiredNodeAffinityTerms(spec); terms != nil {
+		return matchesNodeSelectorTerms(terms, name, labels)
+	}
+	return true
+}
+
+// Parses a taint property of a node, in the '<key>=<value>:<effect>' format of Taint.ToString().
+func parseTaint(taint string) v1.Taint {
+	var t v1.Taint
+	if i := strings.LastIndex(taint, ":"); i >= 0 {
+		t.Effect = v1.TaintEffect(taint[i+1:])
+		taint = taint[:i]
+	}
+	t.Key, t.Value, _ = strings.Cut(taint, "=")
+	return t
+}
+
+// Returns the taints of the node that keep the pod from being scheduled or running on it, those with the
+// NoSchedule or NoExecute effect that aren't tolerated. PreferNoSchedule taints only make the node less preferred.
+func untoleratedTaints(tolerations []v1.Toleration, node Node) []string {
+	taints, _ := node.Properties["taint"].([]string)
+	untolerated := make([]string, 0)
+	for _, taintString := range taints {
+		taint := parseTaint(taintString)
+		if taint.Effect != v1.TaintEffectNoSchedule && taint.Effect != v1.TaintEffectNoExecute {
+			continue
+		}
+		tolerated := false
+		for i := range tolerations {
+			if tolerations[i].ToleratesTaint(&taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			untolerated = append(untolerated, taintString)
+		}
+	}
+	return untolerated
+}
@@ -0,0 +1,94 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestMatchesNodeSelectorTerms(t *testing.T) {
+	labels := map[string]string{"kubernetes.io/arch": "amd64", "zone": "us-east-1a", "cores": "8"}
+	expr := func(key string, op v1.NodeSelectorOperator, values ...string) v1.NodeSelectorRequirement {
+		return v1.NodeSelectorRequirement{Key: key, Operator: op, Values: values}
+	}
+	term := func(reqs ...v1.NodeSelectorRequirement) []v1.NodeSelectorTerm {
+		return []v1.NodeSelectorTerm{{MatchExpressions: reqs}}
+	}
+
+	var tests = []struct {
+		name     string
+		terms    []v1.NodeSelectorTerm
+		expected bool
+	}{
+		{"In", term(expr("zone", v1.NodeSelectorOpIn, "us-east-1a", "us-east-1b")), true},
+		{"In missing value", term(expr("zone", v1.NodeSelectorOpIn, "us-east-1b")), false},
+		{"NotIn", term(expr("zone", v1.NodeSelectorOpNotIn, "us-east-1b")), true},
+		{"NotIn missing key", term(expr("disk", v1.NodeSelectorOpNotIn, "ssd")), true},
+		{"Exists", term(expr("kubernetes.io/arch", v1.NodeSelectorOpExists)), true},
+		{"DoesNotExist", term(expr("kubernetes.io/arch", v1.NodeSelectorOpDoesNotExist)), false},
+		{"Gt", term(expr("cores", v1.NodeSelectorOpGt, "4")), true},
+		{"Lt", term(expr("cores", v1.NodeSelectorOpLt, "4")), false},
+		{"Gt not a number", term(expr("zone", v1.NodeSelectorOpGt, "4")), false},
+		{"ANDed requirements", term(expr("zone", v1.NodeSelectorOpIn, "us-east-1a"),
+			expr("cores", v1.NodeSelectorOpLt, "4")), false},
+		{"ORed terms", append(term(expr("zone", v1.NodeSelectorOpIn, "us-east-1b")),
+			term(expr("cores", v1.NodeSelectorOpGt, "4"))...), true},
+		{"Empty term", []v1.NodeSelectorTerm{{}}, false},
+		{"No terms", []v1.NodeSelectorTerm{}, false},
+		{"Field", []v1.NodeSelectorTerm{{MatchFields: []v1.NodeSelectorRequirement{
+			expr("metadata.name", v1.NodeSelectorOpIn, "1.1.1.1")}}}, true},
+		{"Unsupported field", []v1.NodeSelectorTerm{{MatchFields: []v1.NodeSelectorRequirement{
+			expr("spec.unschedulable", v1.NodeSelectorOpIn, "false")}}}, false},
+	}
+
+	for _, test := range tests {
+		AssertEqual(test.name, matchesNodeSelectorTerms(test.terms, "1.1.1.1", labels), test.expected, t)
+	}
+}
+
+func TestPodMatchesNode(t *testing.T) {
+	node := Node{UID: "uuid-123-node", Properties: map[string]interface{}{
+		"kind": "Node", "name": "1.1.1.1", "label": map[string]string{"disk": "ssd", "zone": "us-east-1a"}}}
+
+	spec := v1.PodSpec{NodeSelector: map[string]string{"disk": "ssd"}}
+	AssertEqual("node selector", podMatchesNode(spec, node), true, t)
+
+	spec.Affinity = &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{{
+			MatchExpressions: []v1.NodeSelectorRequirement{
+				{Key: "zone", Operator: v1.NodeSelectorOpIn, Values: []string{"us-east-1b"}}},
+		}}}}}
+	AssertEqual("node selector and affinity", podMatchesNode(spec, node), false, t)
+
+	spec.NodeSelector = map[string]string{"disk": "hdd"}
+	spec.Affinity = nil
+	AssertEqual("node selector mismatch", podMatchesNode(spec, node), false, t)
+}
+
+func TestParseTaint(t *testing.T) {
+	for _, taint := range []v1.Taint{
+		{Key: "dedicated", Value: "infra", Effect: v1.TaintEffectNoSchedule},
+		{Key: "example.com/gpu", Effect: v1.TaintEffectNoExecute},
+		{Key: "dedicated", Value: "infra"},
+		{Key: "dedicated"},
+	} {
+		AssertEqual(taint.ToString(), parseTaint(taint.ToString()), taint, t)
+	}
+}
+
+func TestUntoleratedTaints(t *testing.T) {
+	node := Node{UID: "uuid-123-node", Properties: map[string]interface{}{
+		"kind": "Node", "name": "1.1.1.1",
+		"taint": []string{"dedicated=infra:NoSchedule", "gpu:NoExecute", "spot=true:PreferNoSchedule"}}}
+
+	AssertDeepEqual("no tolerations", untoleratedTaints(nil, node),
+		[]string{"dedicated=infra:NoSchedule", "gpu:NoExecute"}, t)
+	AssertDeepEqual("some tolerated", untoleratedTaints([]v1.Toleration{
+		{Key: "dedicated", Operator: v1.TolerationOpEqual, Value: "infra", Effect: v1.TaintEffectNoSchedule},
+		{Key: "gpu", Operator: v1.TolerationOpEqual, Value: "true"},
+	}, node), []string{"gpu:NoExecute"}, t)
+	AssertDeepEqual("tolerate everything", untoleratedTaints([]v1.Toleration{{Operator: v1.TolerationOpExists}}, node),
+		[]string{}, t)
+}
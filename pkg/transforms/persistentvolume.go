@@ -11,6 +11,7 @@ Copyright (c) 2020 Red Hat, Inc.
 package transforms
 
 import (
+	"sort"
 	"strings"
 
 	v1 "k8s.io/api/core/v1"
@@ -19,6 +20,7 @@ import (
 // PersistentVolumeResource ...
 type PersistentVolumeResource struct {
 	node Node
+	Spec v1.PersistentVolumeSpec
 }
 
 // PersistentVolumeResourceBuilder ...
@@ -65,7 +67,7 @@ func PersistentVolumeResourceBuilder(p *v1.PersistentVolume) *PersistentVolumeRe
 		node.Properties["path"] = p.Spec.VsphereVolume.VolumePath
 	}
 
-	return &PersistentVolumeResource{node: node}
+	return &PersistentVolumeResource{node: node, Spec: p.Spec}
 }
 
 // Get the type of PersistentVolumeSpec
@@ -107,7 +109,30 @@ func (p PersistentVolumeResource) BuildNode() Node {
 }
 
 // BuildEdges construct the edges for the PersistentVolume Resources
+// PVs with a required node affinity, like local PVs, are attached to the nodes matching it.
 func (p PersistentVolumeResource) BuildEdges(ns NodeStore) []Edge {
-	//no op for now to implement interface
-	return []Edge{}
+	if p.Spec.NodeAffinity == nil || p.Spec.NodeAffinity.Required == nil {
+		return []Edge{}
+	}
+	nodeNames := make([]string, 0, len(ns.ByKindNamespaceName["Node"]["_NONE"]))
+	for name := range ns.ByKindNamespaceName["Node"]["_NONE"] {
+		nodeNames = append(nodeNames, name)
+	}
+	sort.Strings(nodeNames) // keep the order of the edges stable
+
+	ret := make([]Edge, 0)
+	for _, name := range nodeNames {
+		dest := ns.ByKindNamespaceName["Node"]["_NONE"][name]
+		labels, _ := dest.Properties["label"].(map[string]string)
+		if matchesNodeSelectorTerms(p.Spec.NodeAffinity.Required.NodeSelectorTerms, name, labels) {
+			ret = append(ret, Edge{
+				SourceUID:  p.node.UID,
+				DestUID:    dest.UID,
+				EdgeType:   "attachedTo",
+				SourceKind: p.node.Properties["kind"].(string),
+				DestKind:   dest.Properties["kind"].(string),
+			})
+		}
+	}
+	return ret
 }
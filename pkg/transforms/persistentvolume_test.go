@@ -30,3 +30,30 @@ func TestTransformPersistentVolume(t *testing.T) {
 	AssertEqual("claimRef", node.Properties["claimRef"], "kube-system/test-pvc", t)
 	AssertEqual("path", node.Properties["path"], "/var/lib/icp/helmrepo", t)
 }
+
+func TestPersistentVolumeBuildEdges(t *testing.T) {
+	nodeStore := BuildFakeNodeStore([]Node{{
+		UID:        "local-cluster/uuid-node-1",
+		Properties: map[string]interface{}{"kind": "Node", "name": "worker-1", "label": map[string]string{"disk": "ssd"}},
+	}, {
+		UID:        "local-cluster/uuid-node-2",
+		Properties: map[string]interface{}{"kind": "Node", "name": "worker-2", "label": map[string]string{}},
+	}})
+
+	var p v1.PersistentVolume
+	UnmarshalFile("persistentvolume.json", &p, t)
+
+	// PVs without node affinity aren't attached to any node.
+	edges := PersistentVolumeResourceBuilder(&p).BuildEdges(nodeStore)
+	AssertEqual("PersistentVolume edge total:", len(edges), 0, t)
+
+	p.Spec.NodeAffinity = &v1.VolumeNodeAffinity{Required: &v1.NodeSelector{
+		NodeSelectorTerms: []v1.NodeSelectorTerm{{MatchExpressions: []v1.NodeSelectorRequirement{
+			{Key: "disk", Operator: v1.NodeSelectorOpIn, Values: []string{"ssd"}},
+		}}},
+	}}
+	edges = PersistentVolumeResourceBuilder(&p).BuildEdges(nodeStore)
+	AssertEqual("PersistentVolume edge total:", len(edges), 1, t)
+	AssertEqual("PersistentVolume attachedTo", edges[0].EdgeType, EdgeType("attachedTo"), t)
+	AssertEqual("PersistentVolume attachedTo", edges[0].DestUID, "local-cluster/uuid-node-1", t)
+}
@@ -41,6 +41,9 @@ func PersistentVolumeClaimResourceBuilder(p *v1.PersistentVolumeClaim) *Persiste
 		accessModes[i] = string(p.Spec.AccessModes[i])
 	}
 	node.Properties["accessMode"] = accessModes
+	if p.Spec.VolumeMode != nil {
+		node.Properties["volumeMode"] = string(*p.Spec.VolumeMode)
+	}
 
 	if p.Spec.Resources.Requests != nil {
 		request, ok := p.Spec.Resources.Requests["storage"]
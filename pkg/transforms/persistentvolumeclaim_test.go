@@ -26,5 +26,39 @@ func TestTransformPersistentVolumeClaim(t *testing.T) {
 	AssertEqual("status", node.Properties["status"], "Bound", t)
 	AssertEqual("storageClassName", node.Properties["storageClassName"], "test-storage", t)
 	AssertEqual("capacity", node.Properties["capacity"], "5Gi", t)
+	AssertEqual("request", node.Properties["request"], "5Gi", t)
 	AssertDeepEqual("accessMode", node.Properties["accessMode"], []string{"ReadWriteOnce"}, t)
+	AssertEqual("volumeMode", node.Properties["volumeMode"], nil, t)
+
+	block := v1.PersistentVolumeBlock
+	p.Spec.VolumeMode = &block
+	node = PersistentVolumeClaimResourceBuilder(&p).BuildNode()
+	AssertEqual("volumeMode", node.Properties["volumeMode"], "Block", t)
+}
+
+func TestPersistentVolumeClaimBuildEdges(t *testing.T) {
+	var p v1.PersistentVolumeClaim
+	UnmarshalFile("persistentvolumeclaim.json", &p, t)
+	claim := PersistentVolumeClaimResourceBuilder(&p)
+	volume := Node{
+		UID:        "local-cluster/uuid-test-pv",
+		Properties: map[string]interface{}{"kind": "PersistentVolume", "name": "test-pv"},
+	}
+
+	// A bound claim is bound to its volume.
+	edges := claim.BuildEdges(BuildFakeNodeStore([]Node{claim.BuildNode(), volume}))
+	AssertEqual("bound edges", len(edges), 1, t)
+	AssertEqual("boundTo", string(edges[0].EdgeType), "boundTo", t)
+	AssertEqual("boundTo volume", edges[0].DestUID, volume.UID, t)
+
+	// An unbound claim doesn't have a volume name, or edges.
+	p.Spec.VolumeName = ""
+	p.Status.Phase = v1.ClaimPending
+	p.Status.Capacity = nil
+	unbound := PersistentVolumeClaimResourceBuilder(&p)
+	node := unbound.BuildNode()
+	AssertEqual("unbound volumeName", node.Properties["volumeName"], "", t)
+	AssertEqual("unbound status", node.Properties["status"], "Pending", t)
+	AssertEqual("unbound capacity", node.Properties["capacity"], "", t)
+	AssertEqual("unbound edges", len(unbound.BuildEdges(BuildFakeNodeStore([]Node{node, volume}))), 0, t)
 }
@@ -12,16 +12,22 @@ package transforms
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/stolostron/search-collector/pkg/config"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 // PodResource ...
 type PodResource struct {
-	node Node
-	Spec v1.PodSpec
+	node         Node
+	Spec         v1.PodSpec
+	imageDigests []string // Manifest digests of the images the containers run
 }
 
 // PodResourceBuilder ...
@@ -29,9 +35,26 @@ func PodResourceBuilder(p *v1.Pod) *PodResource {
 	// Loop over spec to get the container and image names
 	var containers []string
 	var images []string
+	var fallbackToLogs []string
+	probes := map[string][]string{}                 // Containers with each type of probe
+	probeHandlers := map[string]map[string]string{} // Handler of each container's probe, by probe type
 	for _, container := range p.Spec.Containers {
 		containers = append(containers, container.Name)
 		images = append(images, container.Image)
+		if container.TerminationMessagePolicy == v1.TerminationMessageFallbackToLogsOnError {
+			fallbackToLogs = append(fallbackToLogs, container.Name)
+		}
+		for probeType, probe := range containerProbes(container) {
+			if probe != nil {
+				probes[probeType] = append(probes[probeType], container.Name)
+				if handler := probeHandlerType(probe); handler != "" {
+					if probeHandlers[probeType] == nil {
+						probeHandlers[probeType] = map[string]string{}
+					}
+					probeHandlers[probeType][container.Name] = handler
+				}
+			}
+		}
 	}
 
 	// Loop over init container status or container status to get restarts and build status message
@@ -111,10 +134,48 @@ func PodResourceBuilder(p *v1.Pod) *PodResource {
 	// Extract the properties specific to this type
 	node.Properties["hostIP"] = p.Status.HostIP
 	node.Properties["podIP"] = p.Status.PodIP
+	if ips := podIPs(p.Status); len(ips) > 0 {
+		node.Properties["podIPs"] = ips
+	}
 	node.Properties["restarts"] = restarts
 	node.Properties["status"] = reason
 	node.Properties["container"] = containers
 	node.Properties["image"] = images
+	if len(fallbackToLogs) > 0 {
+		node.Properties["fallbackToLogsOnError"] = fallbackToLogs
+	}
+	for probeType, probeContainers := range probes {
+		node.Properties[probeType] = probeContainers
+	}
+	for probeType, handlers := range probeHandlers {
+		node.Properties[probeType+"Handler"] = handlers
+	}
+	// Rolled up on the node, to find the nodes where the pods are often OOM killed.
+	node.Properties["_oomKilledContainers"] = oomKilledContainers(p)
+	waiting, crashLooping, configError := containerWaitingReasons(p)
+	if len(waiting) > 0 {
+		node.Properties["containerWaiting"] = waiting
+	}
+	node.Properties["_crashLooping"] = crashLooping
+	node.Properties["_configError"] = configError
+	// How many failed probes take the pod out of the endpoints of its services.
+	if threshold, ok := readinessFailureThreshold(p.Spec.Containers); ok {
+		node.Properties["_readinessFailureThreshold"] = threshold
+	}
+	if containerRestarts, lastErrors, livenessRestarts := restartHistory(p); len(containerRestarts) > 0 {
+		node.Properties["containerRestarts"] = containerRestarts
+		if len(lastErrors) > 0 {
+			node.Properties["lastTerminatedError"] = lastErrors
+		}
+		node.Properties["_livenessRestarts"] = livenessRestarts
+	}
+	imageIDs, lastReasons := containerImageIDs(p)
+	if len(imageIDs) > 0 {
+		node.Properties["imageID"] = imageIDs
+	}
+	if len(lastReasons) > 0 {
+		node.Properties["lastTerminationReason"] = lastReasons
+	}
 	node.Properties["startedAt"] = ""
 	if len(ownerReferences) > 0 &&
 		(ownerReferences[0].Kind == "ReplicationController" || ownerReferences[0].Kind == "ReplicaSet") {
@@ -123,8 +184,754 @@ func PodResourceBuilder(p *v1.Pod) *PodResource {
 	if p.Status.StartTime != nil {
 		node.Properties["startedAt"] = p.Status.StartTime.UTC().Format(time.RFC3339)
 	}
+	if p.Spec.ServiceAccountName != "" {
+		node.Properties["serviceAccount"] = p.Spec.ServiceAccountName
+	}
+	if expiration, ok := projectedTokenExpiration(p.Spec.Volumes); ok {
+		node.Properties["projectedTokenExpirationSeconds"] = expiration
+	}
+	if audiences := projectedTokenAudiences(p.Spec.Volumes); len(audiences) > 0 {
+		node.Properties["projectedTokenAudiences"] = audiences
+	}
+	required, preferred := antiAffinityTopologyKeys(p.Spec.Affinity)
+	if len(required) > 0 {
+		node.Properties["requiredAntiAffinityTopologyKeys"] = required
+	}
+	if len(preferred) > 0 {
+		node.Properties["preferredAntiAffinityTopologyKeys"] = preferred
+	}
+	node.Properties["_hasZoneAntiAffinity"] = containsString(required, v1.LabelTopologyZone) ||
+		containsString(preferred, v1.LabelTopologyZone) || containsString(required, v1.LabelFailureDomainBetaZone) ||
+		containsString(preferred, v1.LabelFailureDomainBetaZone)
+	// Raw block volumes are exposed to the containers as devices, they aren't in the volume mounts.
+	if devices := volumeDevicePaths(p.Spec.Containers); len(devices) > 0 {
+		node.Properties["volumeDevices"] = devices
+	}
+	// Used to sum the requests of the pods on each node. Terminated pods don't count against the node's allocatable.
+	if p.Spec.NodeName != "" && p.Status.Phase != v1.PodSucceeded && p.Status.Phase != v1.PodFailed {
+		node.Properties["_nodeName"] = p.Spec.NodeName
+		node.Properties["_requestedCpu"], node.Properties["_requestedMemory"] = podRequests(p.Spec)
+	}
+	if qosClass := podQOSClass(p); qosClass != "" {
+		node.Properties["qosClass"] = string(qosClass)
+	}
+	requests, usesGPU := extendedResourceRequests(p.Spec)
+	for name, containerRequests := range requests {
+		node.Properties[name] = containerRequests
+	}
+	node.Properties["_usesGpu"] = usesGPU
+	// Bytes of the node's ephemeral storage, to correlate with the evictions for disk pressure.
+	node.Properties["ephemeralStorageRequests"], node.Properties["ephemeralStorageLimits"] = podEphemeralStorage(p.Spec)
+	if rank, ok := oomRiskRank(p); ok {
+		node.Properties["_oomRiskRank"] = rank
+	}
+	// The last transitions of these conditions are used to find pods that recently became unready or rescheduled.
+	for _, condition := range p.Status.Conditions {
+		if condition.LastTransitionTime.IsZero() {
+			continue
+		}
+		switch condition.Type {
+		case v1.PodReady:
+			node.Properties["readyTransitionTime"] = condition.LastTransitionTime.UTC().Format(time.RFC3339)
+		case v1.PodScheduled:
+			node.Properties["scheduledTransitionTime"] = condition.LastTransitionTime.UTC().Format(time.RFC3339)
+			// Time the pod waited for the scheduler. Skipped until the pod is scheduled.
+			if condition.Status == v1.ConditionTrue && !p.CreationTimestamp.IsZero() {
+				latency := condition.LastTransitionTime.Sub(p.CreationTimestamp.Time)
+				node.Properties["_scheduleLatencySeconds"] = int64(latency.Seconds())
+			}
+		}
+	}
+	if reason := unschedulableReason(p); reason != "" {
+		node.Properties["_unschedulableReason"] = reason
+	}
+	if config.Cfg.ContainerCommands {
+		commands, args := containerCommands(p.Spec.Containers)
+		if len(commands) > 0 {
+			node.Properties["command"] = commands
+		}
+		if len(args) > 0 {
+			node.Properties["args"] = args
+		}
+	}
+	if gates := readinessGates(p); len(gates) > 0 {
+		node.Properties["readinessGates"] = gates
+	}
+	if p.DeletionTimestamp != nil && p.DeletionGracePeriodSeconds != nil {
+		node.Properties["deletionGracePeriodSeconds"] = *p.DeletionGracePeriodSeconds
+	}
+	if p.Status.Reason == "Evicted" {
+		if pressure := evictionPressure(p.Status.Message); pressure != "" {
+			node.Properties["evictionPressure"] = pressure
+			node.Metadata["NodeName"] = p.Spec.NodeName
+		}
+	}
+	if profile := seccompProfile(p); profile != "" {
+		node.Properties["seccompProfile"] = profile
+	}
+	node.Properties["hasAppArmorProfile"] = hasAppArmorProfile(p.Spec, p.Annotations, nil)
+
+	// The controller in the owner references, OwnerUID can also be a helm release.
+	if controller := ownerRefUID(p.OwnerReferences); controller != "" {
+		node.Metadata["ControllerUID"] = controller
+	}
+
+	return &PodResource{node: node, Spec: p.Spec, imageDigests: imageDigests(p)}
+}
+
+// Returns the cpu (millicores) and memory (bytes) requested by the pod, the way the scheduler computes it:
+// the larger of the sum of the containers and the largest init container, plus the pod overhead.
+func podRequests(spec v1.PodSpec) (int64, int64) {
+	cpu, memory := int64(0), int64(0)
+	for _, container := range spec.Containers {
+		cpu += container.Resources.Requests.Cpu().MilliValue()
+		memory += container.Resources.Requests.Memory().Value()
+	}
+	for _, container := range spec.InitContainers {
+		if initCPU := container.Resources.Requests.Cpu().MilliValue(); initCPU > cpu {
+			cpu = initCPU
+		}
+		if initMemory := container.Resources.Requests.Memory().Value(); initMemory > memory {
+			memory = initMemory
+		}
+	}
+	cpu += spec.Overhead.Cpu().MilliValue()
+	memory += spec.Overhead.Memory().Value()
+	return cpu, memory
+}
+
+// Returns the ephemeral storage (bytes) requested and limited for the pod, computed like the cpu and memory in
+// podRequests. Containers without a request or limit count as 0.
+func podEphemeralStorage(spec v1.PodSpec) (int64, int64) {
+	requests, limits := int64(0), int64(0)
+	for _, container := range spec.Containers {
+		requests += container.Resources.Requests.StorageEphemeral().Value()
+		limits += container.Resources.Limits.StorageEphemeral().Value()
+	}
+	for _, container := range spec.InitContainers {
+		if initRequests := container.Resources.Requests.StorageEphemeral().Value(); initRequests > requests {
+			requests = initRequests
+		}
+		if initLimits := container.Resources.Limits.StorageEphemeral().Value(); initLimits > limits {
+			limits = initLimits
+		}
+	}
+	requests += spec.Overhead.StorageEphemeral().Value()
+	limits += spec.Overhead.StorageEphemeral().Value()
+	return requests, limits
+}
+
+// Returns the extended resources requested by each container, like nvidia.com/gpu, keyed by the property name of
+// the resource and then by container. Whole counts are int64, fractional counts float64. Extended resources can't
+// be overcommitted, so the request defaults to the limit when only the limit is set. Returns true if any container
+// requests a GPU.
+func extendedResourceRequests(spec v1.PodSpec) (map[string]map[string]interface{}, bool) {
+	requests := map[string]map[string]interface{}{}
+	usesGPU := false
+	for _, containers := range [][]v1.Container{spec.InitContainers, spec.Containers} {
+		for _, container := range containers {
+			for name, quantity := range container.Resources.Limits {
+				if _, ok := container.Resources.Requests[name]; !ok {
+					usesGPU = addExtendedResourceRequest(requests, container.Name, name, quantity) || usesGPU
+				}
+			}
+			for name, quantity := range container.Resources.Requests {
+				usesGPU = addExtendedResourceRequest(requests, container.Name, name, quantity) || usesGPU
+			}
+		}
+	}
+	return requests, usesGPU
+}
+
+// Adds the container's request of the resource if it's an extended resource. Returns true if it's a GPU.
+func addExtendedResourceRequest(requests map[string]map[string]interface{}, container string,
+	name v1.ResourceName, quantity resource.Quantity) bool {
+	if !isExtendedResource(name) || quantity.IsZero() {
+		return false
+	}
+	property := "request_" + sanitizePropertyKey(string(name))
+	if requests[property] == nil {
+		requests[property] = map[string]interface{}{}
+	}
+	if quantity.MilliValue()%1000 == 0 {
+		requests[property][container] = quantity.Value()
+	} else {
+		requests[property][container] = float64(quantity.MilliValue()) / 1000
+	}
+	return isGPUResource(name)
+}
+
+// Returns true for the GPUs of the device plugins, like nvidia.com/gpu or amd.com/gpu, and the NVIDIA MIG slices.
+func isGPUResource(name v1.ResourceName) bool {
+	return strings.HasSuffix(string(name), "/gpu") || strings.HasPrefix(string(name), "nvidia.com/mig-")
+}
+
+// Returns true for the resources advertised by device plugins or the cluster admins, outside the kubernetes.io
+// domain, like nvidia.com/gpu. The requests.* prefix is only used in quotas.
+func isExtendedResource(name v1.ResourceName) bool {
+	domain, _, found := strings.Cut(string(name), "/")
+	return found && domain != "kubernetes.io" && !strings.HasSuffix(domain, ".kubernetes.io") &&
+		!strings.HasPrefix(string(name), v1.DefaultResourceRequestsPrefix)
+}
+
+// Replaces the characters of the name that can't be in a property name with underscores, like nvidia_com_gpu.
+func sanitizePropertyKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// Returns a rank from 0 (lowest) to 3 (highest) approximating how likely the pod is to be OOM killed or evicted
+// under memory pressure. It is a heuristic based on the QoS class, not the kernel's OOM score:
+//   - 0: Guaranteed, the requests equal the limits for all containers.
+//   - 1: Burstable, with a memory request on all containers.
+//   - 2: Burstable, with some container that doesn't request memory.
+//   - 3: BestEffort, no requests or limits.
+//
+// The second return value is false if the QoS class can't be computed.
+func oomRiskRank(p *v1.Pod) (int64, bool) {
+	switch podQOSClass(p) {
+	case v1.PodQOSGuaranteed:
+		return 0, true
+	case v1.PodQOSBurstable:
+		for _, container := range p.Spec.Containers {
+			if container.Resources.Requests.Memory().IsZero() {
+				return 2, true
+			}
+		}
+		return 1, true
+	case v1.PodQOSBestEffort:
+		return 3, true
+	}
+	return 0, false
+}
+
+// Returns the QoS class of the pod. It's the class set by the API server, or when it isn't set yet, the class
+// computed the same way from the cpu and memory of the init containers and the containers:
+//   - BestEffort: no container has requests or limits.
+//   - Guaranteed: every container has cpu and memory limits, and the requests of the pod equal its limits.
+//   - Burstable: any other pod.
+func podQOSClass(p *v1.Pod) v1.PodQOSClass {
+	if p.Status.QOSClass != "" {
+		return p.Status.QOSClass
+	}
+	requests, limits := v1.ResourceList{}, v1.ResourceList{}
+	guaranteed := true
+	for _, container := range append(p.Spec.InitContainers, p.Spec.Containers...) {
+		limited := 0
+		for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+			if request, ok := container.Resources.Requests[name]; ok && !request.IsZero() {
+				total := requests[name]
+				total.Add(request)
+				requests[name] = total
+			}
+			if limit, ok := container.Resources.Limits[name]; ok && !limit.IsZero() {
+				total := limits[name]
+				total.Add(limit)
+				limits[name] = total
+				limited++
+			}
+		}
+		if limited < 2 {
+			guaranteed = false
+		}
+	}
+	if len(requests) == 0 && len(limits) == 0 {
+		return v1.PodQOSBestEffort
+	}
+	if guaranteed && len(requests) == len(limits) {
+		for name, request := range requests {
+			if limit := limits[name]; limit.Cmp(request) != 0 {
+				return v1.PodQOSBurstable
+			}
+		}
+		return v1.PodQOSGuaranteed
+	}
+	return v1.PodQOSBurstable
+}
+
+// Returns all the IPs assigned to the pod, in the order reported by the kubelet (IPv4/IPv6 order matches the cluster).
+// Older kubelets and single stack clusters may only report podIP, so fall back to it.
+func podIPs(status v1.PodStatus) []string {
+	ips := make([]string, 0, len(status.PodIPs))
+	for _, podIP := range status.PodIPs {
+		if podIP.IP != "" {
+			ips = append(ips, podIP.IP)
+		}
+	}
+	if len(ips) == 0 && status.PodIP != "" {
+		ips = append(ips, status.PodIP)
+	}
+	return ips
+}
+
+// Returns the longest expiration of the service account tokens projected into the pod's volumes.
+// Short lived tokens are only in use if every projected token is short lived, so we report the longest one.
+// The second return value is false if the pod doesn't use any projected service account token.
+func projectedTokenExpiration(volumes []v1.Volume) (int64, bool) {
+	found := false
+	longest := int64(0)
+	for _, volume := range volumes {
+		if volume.Projected == nil {
+			continue
+		}
+		for _, source := range volume.Projected.Sources {
+			if source.ServiceAccountToken == nil {
+				continue
+			}
+			// The API server defaults expirationSeconds to 1 hour when it isn't set.
+			expiration := int64(3600)
+			if source.ServiceAccountToken.ExpirationSeconds != nil {
+				expiration = *source.ServiceAccountToken.ExpirationSeconds
+			}
+			if !found || expiration > longest {
+				longest = expiration
+			}
+			found = true
+		}
+	}
+	return longest, found
+}
+
+// Returns the scheduler's message for a pending pod that can't be scheduled, like "0/5 nodes are available: 5 node(s)
+// didn't match Pod's node affinity/selector.". Returns an empty string for any other pod.
+func unschedulableReason(p *v1.Pod) string {
+	if p.Status.Phase != v1.PodPending {
+		return ""
+	}
+	for _, condition := range p.Status.Conditions {
+		if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse &&
+			condition.Reason == v1.PodReasonUnschedulable {
+			return condition.Message
+		}
+	}
+	return ""
+}
+
+// Returns the audiences of the service account tokens projected into the volumes, without duplicates and in the
+// order of the volumes. Tokens without an audience are for the API server and aren't listed.
+func projectedTokenAudiences(volumes []v1.Volume) []string {
+	audiences := make([]string, 0)
+	for _, volume := range volumes {
+		if volume.Projected == nil {
+			continue
+		}
+		for _, source := range volume.Projected.Sources {
+			if source.ServiceAccountToken == nil || source.ServiceAccountToken.Audience == "" ||
+				containsString(audiences, source.ServiceAccountToken.Audience) {
+				continue
+			}
+			audiences = append(audiences, source.ServiceAccountToken.Audience)
+		}
+	}
+	return audiences
+}
+
+// Returns the topology keys of the pod's required and preferred anti-affinity terms, without duplicates and in the
+// order of the terms. Pods without anti-affinity get empty lists.
+func antiAffinityTopologyKeys(affinity *v1.Affinity) (required, preferred []string) {
+	required, preferred = make([]string, 0), make([]string, 0)
+	if affinity == nil || affinity.PodAntiAffinity == nil {
+		return required, preferred
+	}
+	for _, term := range affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+		if term.TopologyKey != "" && !containsString(required, term.TopologyKey) {
+			required = append(required, term.TopologyKey)
+		}
+	}
+	for _, weighted := range affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		if key := weighted.PodAffinityTerm.TopologyKey; key != "" && !containsString(preferred, key) {
+			preferred = append(preferred, key)
+		}
+	}
+	return required, preferred
+}
+
+// Returns the device path of each raw block volume, by volume name. Containers can attach the same volume at
+// different paths, the paths are listed in the order of the containers.
+func volumeDevicePaths(containers []v1.Container) map[string]string {
+	devices := make(map[string]string)
+	for _, container := range containers {
+		for _, device := range container.VolumeDevices {
+			paths, ok := devices[device.Name]
+			if !ok {
+				devices[device.Name] = device.DevicePath
+			} else if !containsString(strings.Split(paths, ", "), device.DevicePath) {
+				devices[device.Name] = paths + ", " + device.DevicePath
+			}
+		}
+	}
+	return devices
+}
+
+// The resources and node conditions named in the kubelet's eviction messages, with their pressure type.
+// The kubelet reports either "The node was low on resource: memory. ..." or "The node had condition: [DiskPressure]. ",
+// with every condition the node had, like "[MemoryPressure, DiskPressure]". The first match wins, so the memory
+// pressure is reported ahead of the disk and pid pressures.
+var evictionResources = []struct {
+	match    string
+	pressure string
+}{
+	{"resource: memory", "memory"},
+	{"memorypressure", "memory"},
+	{"resource: ephemeral-storage", "disk"},
+	{"resource: nodefs", "disk"},
+	{"resource: imagefs", "disk"},
+	{"diskpressure", "disk"},
+	{"resource: pids", "pid"},
+	{"pidpressure", "pid"},
+}
+
+// Returns the pressure type (memory, disk, pid) that caused the eviction, or "" if the message doesn't tell.
+func evictionPressure(message string) string {
+	message = strings.ToLower(message)
+	for _, resource := range evictionResources {
+		if strings.Contains(message, resource.match) {
+			return resource.pressure
+		}
+	}
+	return ""
+}
+
+// Adds the cpu (millicores) and memory (bytes) allocated to the pod's containers as _allocatedCpu and
+// _allocatedMemory. Clusters with in-place pod resize report the live allocation in
+// status.containerStatuses[].resources, which isn't in the k8s API version we build with, so it's read from the
+// unstructured resource. Containers without it fall back to their spec requests.
+// _allocatedFromStatus is true if the allocation of any container came from its status.
+func (p *PodResource) addAllocatedResources(object map[string]interface{}) {
+	statusRequests := make(map[string]v1.ResourceList)
+	containerStatuses, _, _ := unstructured.NestedSlice(object, "status", "containerStatuses")
+	for _, status := range containerStatuses {
+		statusMap, ok := status.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(statusMap, "name")
+		requests, found, _ := unstructured.NestedStringMap(statusMap, "resources", "requests")
+		if !found {
+			continue
+		}
+		resources := v1.ResourceList{}
+		for resourceName, value := range requests {
+			quantity, err := resource.ParseQuantity(value)
+			if err != nil {
+				glog.V(3).Infof("Ignoring invalid %s quantity %s in the status of container %s", resourceName, value, name)
+				continue
+			}
+			resources[v1.ResourceName(resourceName)] = quantity
+		}
+		statusRequests[name] = resources
+	}
+
+	cpu, memory := int64(0), int64(0)
+	fromStatus := false
+	for _, container := range p.Spec.Containers {
+		requests := container.Resources.Requests
+		if statusResources, ok := statusRequests[container.Name]; ok {
+			requests = statusResources
+			fromStatus = true
+		}
+		cpu += requests.Cpu().MilliValue()
+		memory += requests.Memory().Value()
+	}
+	p.node.Properties["_allocatedCpu"] = cpu
+	p.node.Properties["_allocatedMemory"] = memory
+	p.node.Properties["_allocatedFromStatus"] = fromStatus
+}
+
+// Returns the container's probes keyed by their property name. Probes that aren't set are nil.
+func containerProbes(container v1.Container) map[string]*v1.Probe {
+	return map[string]*v1.Probe{
+		"startupProbe":   container.StartupProbe,
+		"livenessProbe":  container.LivenessProbe,
+		"readinessProbe": container.ReadinessProbe,
+	}
+}
 
-	return &PodResource{node: node, Spec: p.Spec}
+// Returns the type of the probe's handler: exec, httpGet, tcpSocket or grpc. Exec probes start a process in the
+// container on each run, they're heavier than the others.
+func probeHandlerType(probe *v1.Probe) string {
+	switch {
+	case probe.Exec != nil:
+		return "exec"
+	case probe.HTTPGet != nil:
+		return "httpGet"
+	case probe.TCPSocket != nil:
+		return "tcpSocket"
+	case probe.GRPC != nil:
+		return "grpc"
+	}
+	return ""
+}
+
+// The failure threshold the API server defaults the probes to.
+const defaultProbeFailureThreshold = 3
+
+// Returns the lowest failure threshold of the containers' readiness probes. The pod isn't ready once any
+// container fails that many probes in a row. Returns false when no container has a readiness probe.
+func readinessFailureThreshold(containers []v1.Container) (int64, bool) {
+	threshold, found := int64(0), false
+	for _, container := range containers {
+		if container.ReadinessProbe == nil {
+			continue
+		}
+		containerThreshold := int64(container.ReadinessProbe.FailureThreshold)
+		if containerThreshold < 1 {
+			containerThreshold = defaultProbeFailureThreshold
+		}
+		if !found || containerThreshold < threshold {
+			threshold, found = containerThreshold, true
+		}
+	}
+	return threshold, found
+}
+
+// Exit codes of a container stopped by SIGKILL (128+9) or SIGTERM (128+15).
+const (
+	exitCodeSIGKILL = 137
+	exitCodeSIGTERM = 143
+)
+
+// Returns the restart counts of the containers as name=count, the containers whose last termination has the
+// Error reason, and an estimate of the restarts caused by failing liveness probes.
+// The kubelet kills a container when its liveness probe fails, so it ends with SIGTERM, or SIGKILL after the
+// grace period, and the Error reason. Crashes usually exit with the application's own code, and the OOM killer sets
+// the OOMKilled reason. The status only has the last termination, so the estimate counts all the restarts of each
+// container that has a liveness probe and was last killed by a signal with the Error reason.
+func restartHistory(p *v1.Pod) ([]string, []string, int64) {
+	hasLivenessProbe := make(map[string]bool, len(p.Spec.Containers))
+	for _, container := range p.Spec.Containers {
+		hasLivenessProbe[container.Name] = container.LivenessProbe != nil
+	}
+	restarts := make([]string, 0, len(p.Status.ContainerStatuses))
+	lastErrors := make([]string, 0)
+	livenessRestarts := int64(0)
+	for _, status := range p.Status.ContainerStatuses {
+		restarts = append(restarts, fmt.Sprintf("%s=%d", status.Name, status.RestartCount))
+		terminated := status.LastTerminationState.Terminated
+		if terminated == nil || terminated.Reason != "Error" {
+			continue
+		}
+		lastErrors = append(lastErrors, status.Name)
+		if hasLivenessProbe[status.Name] &&
+			(terminated.ExitCode == exitCodeSIGKILL || terminated.ExitCode == exitCodeSIGTERM) {
+			livenessRestarts += int64(status.RestartCount)
+		}
+	}
+	return restarts, lastErrors, livenessRestarts
+}
+
+// Returns the imageID of each container from its status, the image actually running, and the reason of the last
+// termination of each container that terminated, like main=OOMKilled. Containers that didn't start yet don't
+// have an imageID.
+func containerImageIDs(p *v1.Pod) ([]string, []string) {
+	imageIDs := make([]string, 0, len(p.Status.ContainerStatuses))
+	lastReasons := make([]string, 0)
+	for _, status := range p.Status.ContainerStatuses {
+		if status.ImageID != "" {
+			imageIDs = append(imageIDs, status.ImageID)
+		}
+		if terminated := status.LastTerminationState.Terminated; terminated != nil && terminated.Reason != "" {
+			lastReasons = append(lastReasons, fmt.Sprintf("%s=%s", status.Name, terminated.Reason))
+		}
+	}
+	return imageIDs, lastReasons
+}
+
+// Waiting reasons of the containers that couldn't be created or started. They never ran, unlike the containers
+// in CrashLoopBackOff.
+var configErrorReasons = map[string]struct{}{
+	"CreateContainerConfigError": {},
+	"CreateContainerError":       {},
+	"RunContainerError":          {},
+}
+
+// Reasons of the last termination of a container that failed to start, with containerd and docker.
+var startErrorReasons = map[string]struct{}{
+	"StartError":         {},
+	"ContainerCannotRun": {},
+}
+
+// Returns the waiting reason of each waiting container, like main=CrashLoopBackOff, init containers included.
+// Also returns true if a container is crash looping after it ran, and true if a container can't be created or
+// started because of its configuration. The kubelet backs off the restarts of both, so a container that fails to
+// start can be in CrashLoopBackOff too; its last termination tells them apart.
+func containerWaitingReasons(p *v1.Pod) ([]string, bool, bool) {
+	waiting := make([]string, 0)
+	crashLooping, configError := false, false
+	for _, statuses := range [][]v1.ContainerStatus{p.Status.InitContainerStatuses, p.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if status.State.Waiting == nil || status.State.Waiting.Reason == "" {
+				continue
+			}
+			reason := status.State.Waiting.Reason
+			waiting = append(waiting, status.Name+"="+reason)
+			if _, ok := configErrorReasons[reason]; ok {
+				configError = true
+			} else if reason == "CrashLoopBackOff" {
+				terminated := status.LastTerminationState.Terminated
+				if _, startError := startErrorReasons[terminatedReason(terminated)]; startError {
+					configError = true
+				} else {
+					crashLooping = true
+				}
+			}
+		}
+	}
+	return waiting, crashLooping, configError
+}
+
+// Returns the number of containers, init containers included, whose last termination was an OOM kill. The
+// containers that were OOM killed and haven't restarted yet count as well.
+func oomKilledContainers(p *v1.Pod) int64 {
+	killed := int64(0)
+	for _, statuses := range [][]v1.ContainerStatus{p.Status.InitContainerStatuses, p.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if terminatedReason(status.LastTerminationState.Terminated) == "OOMKilled" ||
+				terminatedReason(status.State.Terminated) == "OOMKilled" {
+				killed++
+			}
+		}
+	}
+	return killed
+}
+
+func terminatedReason(terminated *v1.ContainerStateTerminated) string {
+	if terminated == nil {
+		return ""
+	}
+	return terminated.Reason
+}
+
+// Seccomp profiles of the deprecated annotations, mapped to the type of the securityContext field.
+func seccompAnnotationType(value string) string {
+	switch {
+	case value == "runtime/default" || value == "docker/default":
+		return string(v1.SeccompProfileTypeRuntimeDefault)
+	case value == "unconfined":
+		return string(v1.SeccompProfileTypeUnconfined)
+	case strings.HasPrefix(value, "localhost/"):
+		return string(v1.SeccompProfileTypeLocalhost)
+	}
+	return ""
+}
+
+// Returns the type of the pod's seccomp profile. The securityContext field takes precedence over the annotation
+// used before k8s 1.19. Pods without a pod level profile get the profile of their containers if all of them have
+// the same one. Returns an empty string if the pod doesn't have a profile.
+func seccompProfile(p *v1.Pod) string {
+	if p.Spec.SecurityContext != nil && p.Spec.SecurityContext.SeccompProfile != nil {
+		return string(p.Spec.SecurityContext.SeccompProfile.Type)
+	}
+	if profile := seccompAnnotationType(p.Annotations["seccomp.security.alpha.kubernetes.io/pod"]); profile != "" {
+		return profile
+	}
+	containerProfile := ""
+	for _, container := range append(p.Spec.InitContainers, p.Spec.Containers...) {
+		profile := ""
+		if container.SecurityContext != nil && container.SecurityContext.SeccompProfile != nil {
+			profile = string(container.SecurityContext.SeccompProfile.Type)
+		} else {
+			profile = seccompAnnotationType(p.Annotations["container.seccomp.security.alpha.kubernetes.io/"+container.Name])
+		}
+		if profile == "" || (containerProfile != "" && profile != containerProfile) {
+			return ""
+		}
+		containerProfile = profile
+	}
+	return containerProfile
+}
+
+// Returns true if every container of the pod runs with an AppArmor profile other than unconfined.
+// The appArmorProfile securityContext fields replace the annotations in k8s 1.30. They are newer than the k8s API
+// version we build with, so they're read from the unstructured object when it's given. A container field takes
+// precedence over the container annotation, which takes precedence over the pod field.
+func hasAppArmorProfile(spec v1.PodSpec, annotations map[string]string, object map[string]interface{}) bool {
+	podProfile, _, _ := unstructured.NestedString(object, "spec", "securityContext", "appArmorProfile", "type")
+	containerFields := map[string]string{}
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, _, _ := unstructured.NestedSlice(object, "spec", field)
+		for _, container := range containers {
+			if containerMap, ok := container.(map[string]interface{}); ok {
+				name, _, _ := unstructured.NestedString(containerMap, "name")
+				profile, _, _ := unstructured.NestedString(containerMap, "securityContext", "appArmorProfile", "type")
+				containerFields[name] = profile
+			}
+		}
+	}
+
+	containers := append(spec.InitContainers, spec.Containers...)
+	if len(containers) == 0 {
+		return false
+	}
+	for _, container := range containers {
+		profile := containerFields[container.Name]
+		if profile == "" {
+			profile = annotations["container.apparmor.security.beta.kubernetes.io/"+container.Name]
+		}
+		if profile == "" {
+			profile = podProfile
+		}
+		if profile == "" || strings.EqualFold(profile, "unconfined") {
+			return false
+		}
+	}
+	return true
+}
+
+// Updates hasAppArmorProfile with the appArmorProfile fields of the unstructured resource.
+func (p *PodResource) addAppArmorProfile(object map[string]interface{}) {
+	annotations, _, _ := unstructured.NestedStringMap(object, "metadata", "annotations")
+	p.node.Properties["hasAppArmorProfile"] = hasAppArmorProfile(p.Spec, annotations, object)
+}
+
+// Max length of each entry in the command and args properties. Longer entries are truncated.
+const maxContainerCommandLength = 1024
+
+// Returns the command and the args of each container that sets them, as "<container>: <joined by spaces>".
+// The entries are truncated to maxContainerCommandLength, since scripts inlined in the args can be very large.
+func containerCommands(containers []v1.Container) ([]string, []string) {
+	commands, args := []string{}, []string{}
+	format := func(name string, values []string) string {
+		entry := name + ": " + strings.Join(values, " ")
+		if len(entry) > maxContainerCommandLength {
+			entry = entry[:maxContainerCommandLength]
+		}
+		return entry
+	}
+	for _, container := range containers {
+		if len(container.Command) > 0 {
+			commands = append(commands, format(container.Name, container.Command))
+		}
+		if len(container.Args) > 0 {
+			args = append(args, format(container.Name, container.Args))
+		}
+	}
+	return commands, args
+}
+
+// Returns the status of the condition for each readiness gate in the pod spec. Gates without a condition yet
+// are reported as False, like the kubelet does when it evaluates the pod's readiness.
+func readinessGates(p *v1.Pod) map[string]string {
+	if len(p.Spec.ReadinessGates) == 0 {
+		return nil
+	}
+	conditions := make(map[v1.PodConditionType]v1.ConditionStatus, len(p.Status.Conditions))
+	for _, condition := range p.Status.Conditions {
+		conditions[condition.Type] = condition.Status
+	}
+	gates := make(map[string]string, len(p.Spec.ReadinessGates))
+	for _, gate := range p.Spec.ReadinessGates {
+		status, ok := conditions[gate.ConditionType]
+		if !ok {
+			status = v1.ConditionFalse
+		}
+		gates[string(gate.ConditionType)] = string(status)
+	}
+	return gates
 }
 
 // BuildNode construct the node for the Pod Resources
@@ -150,6 +957,7 @@ func (p PodResource) BuildEdges(ns NodeStore) []Edge {
 	configmapMap := make(map[string]struct{})
 	volumeClaimMap := make(map[string]struct{})
 	volumeMap := make(map[string]struct{})
+	claimVolumes := make(map[string]string) // volume name by claim name
 
 	// Parse the pod's spec to create a list of all the secrets, configmaps and volumes it is attached to
 	for _, container := range p.Spec.Containers {
@@ -164,6 +972,10 @@ func (p PodResource) BuildEdges(ns NodeStore) []Edge {
 		}
 	}
 
+	for _, name := range imagePullSecretNames(p.Spec) {
+		secretMap[name] = struct{}{}
+	}
+
 	for _, volume := range p.Spec.Volumes {
 		if volume.Secret != nil {
 			secretMap[volume.Secret.SecretName] = struct{}{}
@@ -172,6 +984,7 @@ func (p PodResource) BuildEdges(ns NodeStore) []Edge {
 		} else if volume.PersistentVolumeClaim != nil {
 			volumeClaimName := volume.PersistentVolumeClaim.ClaimName
 			volumeClaimMap[volumeClaimName] = struct{}{}
+			claimVolumes[volumeClaimName] = volume.Name
 			if pvClaimNode, ok := ns.ByKindNamespaceName["PersistentVolumeClaim"][nodeInfo.NameSpace][volumeClaimName]; ok {
 				if volName, ok := pvClaimNode.Properties["volumeName"].(string); ok && pvClaimNode.Properties["volumeName"] != "" {
 					volumeMap[volName] = struct{}{}
@@ -183,7 +996,18 @@ func (p PodResource) BuildEdges(ns NodeStore) []Edge {
 	// Create all 'attachedTo' edges between pod and nodes of a specific kind(secrets, configmaps, volumeClaims, volumes)
 	ret = append(ret, edgesByDestinationName(secretMap, "Secret", nodeInfo, ns, []string{})...)
 	ret = append(ret, edgesByDestinationName(configmapMap, "ConfigMap", nodeInfo, ns, []string{})...)
-	ret = append(ret, edgesByDestinationName(volumeClaimMap, "PersistentVolumeClaim", nodeInfo, ns, []string{})...)
+	claimEdges := edgesByDestinationName(volumeClaimMap, "PersistentVolumeClaim", nodeInfo, ns, []string{})
+	blockDeviceEdges(claimEdges, claimVolumes, volumeDevicePaths(p.Spec.Containers), ns)
+	ret = append(ret, claimEdges...)
+
+	// uses edges to the service account the pod's tokens are issued for
+	if p.Spec.ServiceAccountName != "" {
+		saNodeInfo := nodeInfo
+		saNodeInfo.EdgeType = "uses"
+		serviceAccountMap := map[string]struct{}{p.Spec.ServiceAccountName: {}}
+		ret = append(ret, edgesByDestinationName(serviceAccountMap, "ServiceAccount", saNodeInfo, ns, []string{})...)
+	}
+
 	nodeInfo.NameSpace = "_NONE"
 	ret = append(ret, edgesByDestinationName(volumeMap, "PersistentVolume", nodeInfo, ns, []string{})...)
 
@@ -206,5 +1030,101 @@ func (p PodResource) BuildEdges(ns NodeStore) []Edge {
 				p.node.Properties["namespace"].(string)+"/"+p.node.Properties["name"].(string), "_NONE/"+nodeName)
 		}
 	}
+
+	// canRunOn edges
+	if config.Cfg.EligibleNodeEdges {
+		ret = append(ret, p.eligibleNodeEdges(ns)...)
+	}
+
+	// scannedBy edges to the vulnerability reports of the images the containers run
+	ret = append(ret, vulnerabilityEdges(p.node, p.imageDigests, ns)...)
+	return ret
+}
+
+// Returns the properties of the pod computed from the other nodes: the _ownerDepth and _orphanedController of its
+// owners, and the evictionNodePressure of the node it was evicted from.
+func podDerivedProperties(node Node, ds DeriveStore) map[string]interface{} {
+	depth, orphaned := ownerChain(node.GetMetadata("ControllerUID"), ds.NodeStore)
+	derived := map[string]interface{}{"_ownerDepth": depth, "_orphanedController": orphaned}
+
+	// Correlate the eviction with the pressure the node reports.
+	pressure, evicted := node.Properties["evictionPressure"].(string)
+	if dest, ok := ds.ByKindNamespaceName["Node"]["_NONE"][node.GetMetadata("NodeName")]; evicted && ok {
+		nodePressure, _ := dest.Properties["pressure"].([]string)
+		derived["evictionNodePressure"] = false
+		for _, reported := range nodePressure {
+			if reported == pressure {
+				derived["evictionNodePressure"] = true
+			}
+		}
+	}
+	return derived
+}
+
+// Returns the number of controllers in the owner chain starting at the controller with the given UID, like 2 for a
+// pod owned by a ReplicaSet of a Deployment. The chain stops at the first controller that isn't in the store.
+// Returns true if the first controller isn't in the store, the resource is orphaned then. A resource without a
+// controller has a depth of 0 and isn't orphaned.
+func ownerChain(controllerUID string, ns NodeStore) (int64, bool) {
+	if controllerUID == "" {
+		return 0, false
+	}
+	depth := int64(0)
+	seen := map[string]struct{}{}
+	for uid := controllerUID; uid != ""; {
+		owner, ok := ns.ByUID[uid]
+		if _, loop := seen[uid]; !ok || loop {
+			break
+		}
+		seen[uid] = struct{}{}
+		depth++
+		uid = owner.GetMetadata("OwnerUID")
+	}
+	return depth, depth == 0
+}
+
+// Sets the devicePath edge property on the edges to the claims with the Block volume mode, to the device path of
+// the claim's volume in the containers.
+func blockDeviceEdges(claimEdges []Edge, claimVolumes map[string]string, devices map[string]string, ns NodeStore) {
+	for i := range claimEdges {
+		claimNode, ok := ns.ByUID[claimEdges[i].DestUID]
+		if !ok || claimNode.Properties["volumeMode"] != string(v1.PersistentVolumeBlock) {
+			continue
+		}
+		claimName, _ := claimNode.Properties["name"].(string)
+		if path, ok := devices[claimVolumes[claimName]]; ok {
+			claimEdges[i].Properties = map[string]interface{}{"devicePath": path}
+		}
+	}
+}
+
+// Returns canRunOn edges to the nodes matching the pod's node selector and required node affinity.
+// Pods without either can run on any node, we don't add edges for those. We also skip the node the pod runs on,
+// it already has the runsOn edge.
+func (p PodResource) eligibleNodeEdges(ns NodeStore) []Edge {
+	if len(p.Spec.NodeSelector) == 0 && requiredNodeAffinityTerms(p.Spec) == nil {
+		return []Edge{}
+	}
+	nodeNames := make([]string, 0, len(ns.ByKindNamespaceName["Node"]["_NONE"]))
+	for name := range ns.ByKindNamespaceName["Node"]["_NONE"] {
+		if name != p.Spec.NodeName {
+			nodeNames = append(nodeNames, name)
+		}
+	}
+	sort.Strings(nodeNames) // keep the order of the edges stable
+
+	ret := make([]Edge, 0)
+	for _, name := range nodeNames {
+		dest := ns.ByKindNamespaceName["Node"]["_NONE"][name]
+		if podMatchesNode(p.Spec, dest) {
+			ret = append(ret, Edge{
+				SourceUID:  p.node.UID,
+				DestUID:    dest.UID,
+				EdgeType:   "canRunOn",
+				SourceKind: p.node.Properties["kind"].(string),
+				DestKind:   dest.Properties["kind"].(string),
+			})
+		}
+	}
 	return ret
 }
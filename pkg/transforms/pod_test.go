@@ -11,10 +11,15 @@ Copyright (c) 2020 Red Hat, Inc.
 package transforms
 
 import (
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/stolostron/search-collector/pkg/config"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 func TestTransformPod(t *testing.T) {
@@ -30,12 +35,80 @@ func TestTransformPod(t *testing.T) {
 	AssertEqual("kind", node.Properties["kind"], "Pod", t)
 	AssertEqual("hostIP", node.Properties["hostIP"], "1.1.1.1", t)
 	AssertEqual("podIP", node.Properties["podIP"], "2.2.2.2", t)
+	AssertDeepEqual("podIPs", node.Properties["podIPs"], []string{"2.2.2.2", "fd00:10:244::2"}, t)
 	AssertEqual("restarts", node.Properties["restarts"], int64(0), t)
 	AssertDeepEqual("container", node.Properties["container"], []string{"fake-pod"}, t)
 	AssertDeepEqual("image", node.Properties["image"], []string{"fake-image:latest"}, t)
 	AssertEqual("startedAt", node.Properties["startedAt"], date.UTC().Format(time.RFC3339), t)
 	AssertEqual("status", node.Properties["status"], string(v1.PodRunning), t)
 	AssertEqual("_ownerUID", node.Properties["_ownerUID"], "local-cluster/eb762405-361f-11e9-85ca-00163e019656", t)
+	AssertEqual("serviceAccount", node.Properties["serviceAccount"], "default", t)
+	AssertEqual("projectedTokenExpirationSeconds", node.Properties["projectedTokenExpirationSeconds"], int64(3607), t)
+	AssertEqual("terminating", node.Properties["terminating"], false, t)
+	AssertEqual("deletionTimestamp", node.Properties["deletionTimestamp"], nil, t)
+	AssertEqual("readyTransitionTime", node.Properties["readyTransitionTime"], "2019-03-03T15:13:24Z", t)
+	AssertEqual("scheduledTransitionTime", node.Properties["scheduledTransitionTime"], "2019-02-21T21:30:33Z", t)
+	AssertEqual("readinessGates", node.Properties["readinessGates"], nil, t)
+	AssertEqual("seccompProfile", node.Properties["seccompProfile"], nil, t)
+	AssertEqual("fallbackToLogsOnError", node.Properties["fallbackToLogsOnError"], nil, t)
+	AssertEqual("startupProbe", node.Properties["startupProbe"], nil, t)
+	AssertEqual("hasAppArmorProfile", node.Properties["hasAppArmorProfile"], false, t)
+	AssertEqual("_scheduleLatencySeconds", node.Properties["_scheduleLatencySeconds"], int64(0), t)
+	AssertDeepEqual("imageID", node.Properties["imageID"], []string{
+		"docker-pullable://fake-image@sha256:396c3d5a7ee6174f6f9ca0f626474673a003b0be87afec31a4e91e61ebd9ab70"}, t)
+	AssertEqual("lastTerminationReason", node.Properties["lastTerminationReason"], nil, t)
+}
+
+func TestTransformPodScheduleLatency(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	created := time.Date(2019, 02, 21, 21, 30, 0, 0, time.UTC)
+	p.CreationTimestamp = metav1.NewTime(created)
+	p.Status.Conditions = []v1.PodCondition{{
+		Type:               v1.PodScheduled,
+		Status:             v1.ConditionTrue,
+		LastTransitionTime: metav1.NewTime(created.Add(12 * time.Second)),
+	}}
+	node := PodResourceBuilder(&p).BuildNode()
+	AssertEqual("_scheduleLatencySeconds", node.Properties["_scheduleLatencySeconds"], int64(12), t)
+
+	// Pending pods aren't scheduled yet.
+	p.Status.Conditions[0].Status = v1.ConditionFalse
+	node = PodResourceBuilder(&p).BuildNode()
+	AssertEqual("_scheduleLatencySeconds", node.Properties["_scheduleLatencySeconds"], nil, t)
+}
+
+func TestTransformPodReadinessGates(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	p.Spec.ReadinessGates = []v1.PodReadinessGate{
+		{ConditionType: "target-health.elbv2.k8s.aws/tg-1"},
+		{ConditionType: "target-health.elbv2.k8s.aws/tg-2"},
+	}
+	p.Status.Conditions = append(p.Status.Conditions,
+		v1.PodCondition{Type: "target-health.elbv2.k8s.aws/tg-1", Status: v1.ConditionTrue})
+	node := PodResourceBuilder(&p).BuildNode()
+
+	// tg-2 doesn't have a condition yet.
+	AssertDeepEqual("readinessGates", node.Properties["readinessGates"], map[string]string{
+		"target-health.elbv2.k8s.aws/tg-1": "True",
+		"target-health.elbv2.k8s.aws/tg-2": "False",
+	}, t)
+}
+
+func TestTransformPodTerminating(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	deletion := metav1.NewTime(time.Date(2019, 03, 03, 15, 20, 0, 0, time.UTC))
+	gracePeriod := int64(30)
+	p.DeletionTimestamp = &deletion
+	p.DeletionGracePeriodSeconds = &gracePeriod
+	node := PodResourceBuilder(&p).BuildNode()
+
+	AssertEqual("status", node.Properties["status"], "Terminating", t)
+	AssertEqual("terminating", node.Properties["terminating"], true, t)
+	AssertEqual("deletionTimestamp", node.Properties["deletionTimestamp"], "2019-03-03T15:20:00Z", t)
+	AssertEqual("deletionGracePeriodSeconds", node.Properties["deletionGracePeriodSeconds"], int64(30), t)
 }
 
 func TestTransformPodInitWaiting(t *testing.T) {
@@ -44,6 +117,7 @@ func TestTransformPodInitWaiting(t *testing.T) {
 	node := PodResourceBuilder(&p).BuildNode()
 
 	AssertEqual("podIP", node.Properties["podIP"], "2.2.2.3", t)
+	AssertDeepEqual("podIPs", node.Properties["podIPs"], []string{"2.2.2.3"}, t)
 	AssertEqual("restarts", node.Properties["restarts"], int64(2), t)
 	AssertEqual("status", node.Properties["status"], "Init:CrashLoopBackOff", t)
 }
@@ -57,6 +131,50 @@ func TestTransformPodInitFailed(t *testing.T) {
 	AssertEqual("status", node.Properties["status"], "Init:ExitCode:255", t)
 }
 
+func TestTransformPodEvicted(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod-evicted.json", &p, t)
+	node := PodResourceBuilder(&p).BuildNode()
+
+	AssertEqual("status", node.Properties["status"], "Evicted", t)
+	AssertEqual("evictionPressure", node.Properties["evictionPressure"], "memory", t)
+	AssertEqual("podIPs", node.Properties["podIPs"], nil, t)
+	AssertEqual("readyTransitionTime", node.Properties["readyTransitionTime"], nil, t)
+}
+
+func TestEvictionPressure(t *testing.T) {
+	AssertEqual("memory", evictionPressure("The node was low on resource: memory. Threshold: 100Mi."), "memory", t)
+	AssertEqual("disk", evictionPressure("The node was low on resource: ephemeral-storage. "), "disk", t)
+	AssertEqual("pid", evictionPressure("The node was low on resource: pids. "), "pid", t)
+	AssertEqual("condition", evictionPressure("The node had condition: [DiskPressure]. "), "disk", t)
+	AssertEqual("conditions", evictionPressure("The node had condition: [PIDPressure, DiskPressure]. "), "disk", t)
+	AssertEqual("memory first", evictionPressure("The node had condition: [DiskPressure, MemoryPressure]. "), "memory", t)
+	AssertEqual("unknown", evictionPressure("Pod was evicted."), "", t)
+}
+
+func TestPodBuildEdgesEvicted(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod-evicted.json", &p, t)
+	pod := PodResourceBuilder(&p)
+
+	nodes := []Node{pod.BuildNode(), {
+		UID: "uuid-123-node",
+		Properties: map[string]interface{}{
+			"kind": "Node", "namespace": "_NONE", "name": "1.1.1.1", "pressure": []string{"memory"}},
+	}}
+	nodeStore := BuildFakeNodeStore(nodes)
+	edges := pod.BuildEdges(nodeStore)
+
+	AssertEqual("Pod edge total: ", len(edges), 1, t)
+	derived := DeriveProperties(pod.BuildNode(), NewDeriveStore(nodeStore))
+	AssertEqual("evictionNodePressure", derived["evictionNodePressure"], true, t)
+
+	// The node no longer reports the pressure.
+	delete(nodes[1].Properties, "pressure")
+	derived = DeriveProperties(pod.BuildNode(), NewDeriveStore(nodeStore))
+	AssertEqual("evictionNodePressure", derived["evictionNodePressure"], false, t)
+}
+
 func TestPodBuildEdges(t *testing.T) {
 
 	// Build a fake NodeStore with nodes needed to generate edges.
@@ -72,6 +190,9 @@ func TestPodBuildEdges(t *testing.T) {
 	}, {
 		UID:        "uuid-123-pvc",
 		Properties: map[string]interface{}{"kind": "PersistentVolumeClaim", "namespace": "default", "name": "test-pvc", "volumeName": "test-pv"},
+	}, {
+		UID:        "uuid-123-serviceaccount",
+		Properties: map[string]interface{}{"kind": "ServiceAccount", "namespace": "default", "name": "default"},
 	}, {
 		UID:        "uuid-123-node",
 		Properties: map[string]interface{}{"kind": "Node", "namespace": "_NONE", "name": "1.1.1.1"},
@@ -87,10 +208,597 @@ func TestPodBuildEdges(t *testing.T) {
 	edges := PodResourceBuilder(&p).BuildEdges(nodeStore)
 
 	// Verify created edges.
-	AssertEqual("Pod edge total: ", len(edges), 5, t)
+	AssertEqual("Pod edge total: ", len(edges), 6, t)
 	AssertEqual("Pod attachedTo", edges[0].DestKind, "Secret", t)
 	AssertEqual("Pod attachedTo", edges[1].DestKind, "ConfigMap", t)
 	AssertEqual("Pod attachedTo", edges[2].DestKind, "PersistentVolumeClaim", t)
-	AssertEqual("Pod attachedTo", edges[3].DestKind, "PersistentVolume", t)
-	AssertEqual("Pod runsOn", edges[4].DestKind, "Node", t)
+	AssertEqual("Pod uses", edges[3].DestKind, "ServiceAccount", t)
+	AssertEqual("Pod uses", string(edges[3].EdgeType), "uses", t)
+	AssertEqual("Pod attachedTo", edges[4].DestKind, "PersistentVolume", t)
+	AssertEqual("Pod runsOn", edges[5].DestKind, "Node", t)
+}
+
+func TestPodBuildEdgesEligibleNodes(t *testing.T) {
+	config.Cfg.EligibleNodeEdges = true
+	defer func() { config.Cfg.EligibleNodeEdges = false }()
+
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	p.Spec.NodeSelector = map[string]string{"disk": "ssd"}
+	pod := PodResourceBuilder(&p)
+
+	nodes := []Node{pod.BuildNode()}
+	for _, n := range []struct{ name, disk string }{{"1.1.1.1", "ssd"}, {"1.1.1.2", "hdd"}, {"1.1.1.3", "ssd"}} {
+		nodes = append(nodes, Node{
+			UID: "uuid-node-" + n.name,
+			Properties: map[string]interface{}{
+				"kind": "Node", "namespace": "_NONE", "name": n.name, "label": map[string]string{"disk": n.disk}},
+		})
+	}
+	edges := pod.BuildEdges(BuildFakeNodeStore(nodes))
+
+	// The pod runs on 1.1.1.1, so that node gets a runsOn edge instead of canRunOn.
+	AssertEqual("Pod edge total: ", len(edges), 2, t)
+	AssertEqual("Pod runsOn", string(edges[0].EdgeType), "runsOn", t)
+	AssertEqual("Pod runsOn", edges[0].DestUID, "uuid-node-1.1.1.1", t)
+	AssertEqual("Pod canRunOn", string(edges[1].EdgeType), "canRunOn", t)
+	AssertEqual("Pod canRunOn", edges[1].DestUID, "uuid-node-1.1.1.3", t)
+}
+
+func TestPodRequests(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	node := PodResourceBuilder(&p).BuildNode()
+	AssertEqual("_nodeName", node.Properties["_nodeName"], "1.1.1.1", t)
+	AssertEqual("_requestedCpu", node.Properties["_requestedCpu"], int64(0), t)
+
+	requests := func(cpu, memory string) v1.ResourceRequirements {
+		return v1.ResourceRequirements{Requests: v1.ResourceList{
+			v1.ResourceCPU: resource.MustParse(cpu), v1.ResourceMemory: resource.MustParse(memory)}}
+	}
+	spec := v1.PodSpec{
+		Containers:     []v1.Container{{Resources: requests("100m", "64Mi")}, {Resources: requests("200m", "64Mi")}},
+		InitContainers: []v1.Container{{Resources: requests("500m", "32Mi")}},
+		Overhead:       v1.ResourceList{v1.ResourceCPU: resource.MustParse("10m")},
+	}
+	cpu, memory := podRequests(spec)
+	AssertEqual("cpu", cpu, int64(510), t)
+	AssertEqual("memory", memory, int64(128*1024*1024), t)
+
+	// A heavy init container sets the requests of the pod.
+	spec.InitContainers = append(spec.InitContainers, v1.Container{Resources: requests("100m", "1Gi")})
+	cpu, memory = podRequests(spec)
+	AssertEqual("init cpu", cpu, int64(510), t)
+	AssertEqual("init memory", memory, int64(1024*1024*1024), t)
+
+	// Pods that completed don't count against the node.
+	p.Status.Phase = v1.PodSucceeded
+	AssertEqual("_nodeName", PodResourceBuilder(&p).BuildNode().Properties["_nodeName"], nil, t)
+}
+
+func TestPodEphemeralStorage(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	node := PodResourceBuilder(&p).BuildNode()
+	AssertEqual("ephemeralStorageRequests", node.Properties["ephemeralStorageRequests"], int64(0), t)
+	AssertEqual("ephemeralStorageLimits", node.Properties["ephemeralStorageLimits"], int64(0), t)
+
+	storage := func(request, limit string) v1.ResourceRequirements {
+		return v1.ResourceRequirements{
+			Requests: v1.ResourceList{v1.ResourceEphemeralStorage: resource.MustParse(request)},
+			Limits:   v1.ResourceList{v1.ResourceEphemeralStorage: resource.MustParse(limit)},
+		}
+	}
+	p.Spec.Containers = []v1.Container{{Resources: storage("1Gi", "2Gi")}, {Resources: storage("1Gi", "1Gi")}, {}}
+	p.Spec.InitContainers = []v1.Container{{Resources: storage("4Gi", "4Gi")}}
+	node = PodResourceBuilder(&p).BuildNode()
+	AssertEqual("ephemeralStorageRequests", node.Properties["ephemeralStorageRequests"], int64(4*1024*1024*1024), t)
+	AssertEqual("ephemeralStorageLimits", node.Properties["ephemeralStorageLimits"], int64(4*1024*1024*1024), t)
+
+	// The sum of the containers is larger than the init container.
+	p.Spec.InitContainers = []v1.Container{{Resources: storage("512Mi", "512Mi")}}
+	requests, limits := podEphemeralStorage(p.Spec)
+	AssertEqual("requests", requests, int64(2*1024*1024*1024), t)
+	AssertEqual("limits", limits, int64(3*1024*1024*1024), t)
+}
+
+func TestPodOOMRiskRank(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	AssertEqual("BestEffort", PodResourceBuilder(&p).BuildNode().Properties["_oomRiskRank"], int64(3), t)
+
+	p.Status.QOSClass = v1.PodQOSGuaranteed
+	AssertEqual("Guaranteed", PodResourceBuilder(&p).BuildNode().Properties["_oomRiskRank"], int64(0), t)
+
+	p.Status.QOSClass = v1.PodQOSBurstable
+	AssertEqual("Burstable without memory request", PodResourceBuilder(&p).BuildNode().Properties["_oomRiskRank"],
+		int64(2), t)
+
+	p.Spec.Containers[0].Resources.Requests = v1.ResourceList{v1.ResourceMemory: resource.MustParse("64Mi")}
+	AssertEqual("Burstable", PodResourceBuilder(&p).BuildNode().Properties["_oomRiskRank"], int64(1), t)
+
+	// The QoS class is computed when the API server hasn't set it yet.
+	p.Status.QOSClass = ""
+	AssertEqual("QoS class not set", PodResourceBuilder(&p).BuildNode().Properties["_oomRiskRank"], int64(1), t)
+}
+
+func TestPodQOSClass(t *testing.T) {
+	resources := func(cpu, memory string) v1.ResourceList {
+		return v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpu), v1.ResourceMemory: resource.MustParse(memory)}
+	}
+	guaranteed := v1.ResourceRequirements{Requests: resources("100m", "64Mi"), Limits: resources("100m", "64Mi")}
+	tests := []struct {
+		name     string
+		spec     v1.PodSpec
+		expected v1.PodQOSClass
+	}{
+		{"no requests", v1.PodSpec{Containers: []v1.Container{{}}}, v1.PodQOSBestEffort},
+		{"init container requests", v1.PodSpec{
+			InitContainers: []v1.Container{{Resources: v1.ResourceRequirements{Requests: resources("1", "1Gi")}}},
+			Containers:     []v1.Container{{}}}, v1.PodQOSBurstable},
+		{"requests equal limits", v1.PodSpec{
+			InitContainers: []v1.Container{{Resources: guaranteed}},
+			Containers:     []v1.Container{{Resources: guaranteed}, {Resources: guaranteed}}}, v1.PodQOSGuaranteed},
+		{"init container without limits", v1.PodSpec{
+			InitContainers: []v1.Container{{}},
+			Containers:     []v1.Container{{Resources: guaranteed}}}, v1.PodQOSBurstable},
+		{"requests below limits", v1.PodSpec{Containers: []v1.Container{{Resources: v1.ResourceRequirements{
+			Requests: resources("50m", "64Mi"), Limits: resources("100m", "64Mi")}}}}, v1.PodQOSBurstable},
+	}
+	for _, test := range tests {
+		p := v1.Pod{Spec: test.spec}
+		AssertEqual(test.name, podQOSClass(&p), test.expected, t)
+		AssertEqual(test.name, PodResourceBuilder(&p).BuildNode().Properties["qosClass"], string(test.expected), t)
+	}
+
+	// The class set by the API server takes precedence.
+	p := v1.Pod{Status: v1.PodStatus{QOSClass: v1.PodQOSBurstable}}
+	AssertEqual("status", podQOSClass(&p), v1.PodQOSBurstable, t)
+}
+
+func TestPodAllocatedResources(t *testing.T) {
+	var p v1.Pod
+	var u unstructured.Unstructured
+	UnmarshalFile("pod.json", &p, t)
+	UnmarshalFile("pod.json", &u, t)
+	p.Spec.Containers[0].Resources.Requests = v1.ResourceList{
+		v1.ResourceCPU: resource.MustParse("100m"), v1.ResourceMemory: resource.MustParse("64Mi")}
+
+	// Falls back to the spec when the status doesn't have the resources.
+	pod := PodResourceBuilder(&p)
+	pod.addAllocatedResources(u.Object)
+	node := pod.BuildNode()
+	AssertEqual("_allocatedCpu", node.Properties["_allocatedCpu"], int64(100), t)
+	AssertEqual("_allocatedMemory", node.Properties["_allocatedMemory"], int64(64*1024*1024), t)
+	AssertEqual("_allocatedFromStatus", node.Properties["_allocatedFromStatus"], false, t)
+
+	// The pod was resized in place.
+	statuses, _, _ := unstructured.NestedSlice(u.Object, "status", "containerStatuses")
+	statuses[0].(map[string]interface{})["resources"] = map[string]interface{}{
+		"requests": map[string]interface{}{"cpu": "250m", "memory": "128Mi"}}
+	if err := unstructured.SetNestedSlice(u.Object, statuses, "status", "containerStatuses"); err != nil {
+		t.Fatal(err)
+	}
+	pod = PodResourceBuilder(&p)
+	pod.addAllocatedResources(u.Object)
+	node = pod.BuildNode()
+	AssertEqual("_allocatedCpu", node.Properties["_allocatedCpu"], int64(250), t)
+	AssertEqual("_allocatedMemory", node.Properties["_allocatedMemory"], int64(128*1024*1024), t)
+	AssertEqual("_allocatedFromStatus", node.Properties["_allocatedFromStatus"], true, t)
+}
+
+func TestTransformPodContainerCommands(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	p.Spec.Containers[0].Command = []string{"/bin/sh", "-c"}
+	p.Spec.Containers[0].Args = []string{"echo hello && sleep 3600"}
+	p.Spec.Containers = append(p.Spec.Containers, v1.Container{Name: "sidecar", Args: []string{strings.Repeat("x", 2000)}})
+
+	// Off by default.
+	node := PodResourceBuilder(&p).BuildNode()
+	AssertEqual("command", node.Properties["command"], nil, t)
+
+	config.Cfg.ContainerCommands = true
+	defer func() { config.Cfg.ContainerCommands = false }()
+	node = PodResourceBuilder(&p).BuildNode()
+	AssertDeepEqual("command", node.Properties["command"], []string{"fake-pod: /bin/sh -c"}, t)
+	args := node.Properties["args"].([]string)
+	AssertEqual("args", args[0], "fake-pod: echo hello && sleep 3600", t)
+	AssertEqual("truncated args", len(args[1]), maxContainerCommandLength, t)
+}
+
+func TestPodSeccompProfile(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+
+	// Annotation used before k8s 1.19.
+	p.Annotations = map[string]string{"seccomp.security.alpha.kubernetes.io/pod": "runtime/default"}
+	AssertEqual("seccompProfile", seccompProfile(&p), "RuntimeDefault", t)
+
+	// The field takes precedence over the annotation.
+	p.Spec.SecurityContext = &v1.PodSecurityContext{
+		SeccompProfile: &v1.SeccompProfile{Type: v1.SeccompProfileTypeLocalhost}}
+	AssertEqual("seccompProfile", seccompProfile(&p), "Localhost", t)
+
+	// Profile of the containers when all of them have the same one.
+	p.Annotations = map[string]string{"container.seccomp.security.alpha.kubernetes.io/fake-pod": "unconfined"}
+	p.Spec.SecurityContext = nil
+	AssertEqual("seccompProfile", seccompProfile(&p), "Unconfined", t)
+	p.Spec.Containers = append(p.Spec.Containers, v1.Container{Name: "sidecar"})
+	AssertEqual("seccompProfile", seccompProfile(&p), "", t)
+}
+
+func TestPodAppArmorProfile(t *testing.T) {
+	var p v1.Pod
+	var u unstructured.Unstructured
+	UnmarshalFile("pod.json", &p, t)
+	UnmarshalFile("pod.json", &u, t)
+
+	// Annotation used before k8s 1.30.
+	annotations := map[string]string{"container.apparmor.security.beta.kubernetes.io/fake-pod": "runtime/default"}
+	AssertEqual("hasAppArmorProfile", hasAppArmorProfile(p.Spec, annotations, nil), true, t)
+	annotations["container.apparmor.security.beta.kubernetes.io/fake-pod"] = "unconfined"
+	AssertEqual("hasAppArmorProfile", hasAppArmorProfile(p.Spec, annotations, nil), false, t)
+
+	// The pod field applies to containers without their own profile.
+	if err := unstructured.SetNestedField(u.Object, "RuntimeDefault", "spec", "securityContext", "appArmorProfile",
+		"type"); err != nil {
+		t.Fatal(err)
+	}
+	pod := PodResourceBuilder(&p)
+	pod.addAppArmorProfile(u.Object)
+	AssertEqual("hasAppArmorProfile", pod.BuildNode().Properties["hasAppArmorProfile"], true, t)
+}
+
+func TestTransformPodFallbackToLogsOnError(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	p.Spec.Containers = append(p.Spec.Containers,
+		v1.Container{Name: "sidecar", TerminationMessagePolicy: v1.TerminationMessageFallbackToLogsOnError})
+	node := PodResourceBuilder(&p).BuildNode()
+
+	AssertDeepEqual("fallbackToLogsOnError", node.Properties["fallbackToLogsOnError"], []string{"sidecar"}, t)
+}
+
+func TestTransformPodProbes(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	p.Spec.Containers[0].StartupProbe = &v1.Probe{FailureThreshold: 30}
+	p.Spec.Containers[0].LivenessProbe = &v1.Probe{}
+	p.Spec.Containers = append(p.Spec.Containers, v1.Container{Name: "sidecar", LivenessProbe: &v1.Probe{}})
+	node := PodResourceBuilder(&p).BuildNode()
+
+	AssertDeepEqual("startupProbe", node.Properties["startupProbe"], []string{"fake-pod"}, t)
+	AssertDeepEqual("livenessProbe", node.Properties["livenessProbe"], []string{"fake-pod", "sidecar"}, t)
+	AssertEqual("readinessProbe", node.Properties["readinessProbe"], nil, t)
+}
+
+func TestTransformPodProbeHandlers(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	p.Spec.Containers[0].LivenessProbe = &v1.Probe{
+		ProbeHandler: v1.ProbeHandler{Exec: &v1.ExecAction{Command: []string{"pg_isready"}}}}
+	p.Spec.Containers[0].ReadinessProbe = &v1.Probe{
+		ProbeHandler: v1.ProbeHandler{HTTPGet: &v1.HTTPGetAction{Path: "/ready"}}}
+	p.Spec.Containers = append(p.Spec.Containers,
+		v1.Container{Name: "sidecar",
+			LivenessProbe: &v1.Probe{ProbeHandler: v1.ProbeHandler{GRPC: &v1.GRPCAction{Port: 9090}}}},
+		v1.Container{Name: "proxy",
+			LivenessProbe: &v1.Probe{ProbeHandler: v1.ProbeHandler{TCPSocket: &v1.TCPSocketAction{}}}})
+	node := PodResourceBuilder(&p).BuildNode()
+
+	AssertDeepEqual("livenessProbeHandler", node.Properties["livenessProbeHandler"],
+		map[string]string{"fake-pod": "exec", "sidecar": "grpc", "proxy": "tcpSocket"}, t)
+	AssertDeepEqual("readinessProbeHandler", node.Properties["readinessProbeHandler"],
+		map[string]string{"fake-pod": "httpGet"}, t)
+	AssertEqual("startupProbeHandler", node.Properties["startupProbeHandler"], nil, t)
+}
+
+func TestPodOwnerChain(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	podNode := PodResourceBuilder(&p).BuildNode()
+
+	// The ReplicaSet was deleted, the pod lingers.
+	derived := DeriveProperties(podNode, NewDeriveStore(BuildFakeNodeStore([]Node{podNode})))
+	AssertEqual("orphaned _ownerDepth", derived["_ownerDepth"], int64(0), t)
+	AssertEqual("orphaned _orphanedController", derived["_orphanedController"], true, t)
+
+	replicaSet := Node{UID: "local-cluster/eb762405-361f-11e9-85ca-00163e019656",
+		Properties: map[string]interface{}{"kind": "ReplicaSet", "namespace": "default", "name": "fake-replicaset"},
+		Metadata:   map[string]string{"OwnerUID": "local-cluster/uuid-fake-deployment"}}
+	deployment := Node{UID: "local-cluster/uuid-fake-deployment",
+		Properties: map[string]interface{}{"kind": "Deployment", "namespace": "default", "name": "fake-deployment"}}
+	derived = DeriveProperties(podNode, NewDeriveStore(BuildFakeNodeStore([]Node{podNode, replicaSet, deployment})))
+	AssertEqual("_ownerDepth", derived["_ownerDepth"], int64(2), t)
+	AssertEqual("_orphanedController", derived["_orphanedController"], false, t)
+	AssertEqual("node unchanged", podNode.Properties["_ownerDepth"], nil, t)
+
+	// The chain stops at the missing owner, the pod still has its ReplicaSet.
+	derived = DeriveProperties(podNode, NewDeriveStore(BuildFakeNodeStore([]Node{podNode, replicaSet})))
+	AssertEqual("broken chain _ownerDepth", derived["_ownerDepth"], int64(1), t)
+	AssertEqual("broken chain _orphanedController", derived["_orphanedController"], false, t)
+
+	// Only the controller is followed, the other owners don't make the pod orphaned.
+	p.OwnerReferences = []metav1.OwnerReference{{Kind: "ConfigMap", Name: "owner", UID: "uuid-other-owner"}}
+	podNode = PodResourceBuilder(&p).BuildNode()
+	derived = DeriveProperties(podNode, NewDeriveStore(BuildFakeNodeStore([]Node{podNode})))
+	AssertEqual("no controller _ownerDepth", derived["_ownerDepth"], int64(0), t)
+	AssertEqual("no controller _orphanedController", derived["_orphanedController"], false, t)
+}
+
+func TestOwnerChainLoop(t *testing.T) {
+	nodes := []Node{
+		{UID: "uid-a", Properties: map[string]interface{}{"kind": "A", "name": "a"},
+			Metadata: map[string]string{"OwnerUID": "uid-b"}},
+		{UID: "uid-b", Properties: map[string]interface{}{"kind": "B", "name": "b"},
+			Metadata: map[string]string{"OwnerUID": "uid-a"}},
+	}
+	depth, orphaned := ownerChain("uid-a", BuildFakeNodeStore(nodes))
+
+	AssertEqual("depth", depth, int64(2), t)
+	AssertEqual("orphaned", orphaned, false, t)
+}
+
+func TestTransformPodOOMKilledContainers(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	oomKilled := v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}}
+	p.Status.ContainerStatuses = []v1.ContainerStatus{
+		{Name: "main", LastTerminationState: oomKilled},
+		{Name: "sidecar", State: oomKilled},
+		{Name: "proxy", LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "Error"}}},
+	}
+	node := PodResourceBuilder(&p).BuildNode()
+
+	AssertEqual("_oomKilledContainers", node.Properties["_oomKilledContainers"], int64(2), t)
+}
+
+func TestTransformPodContainerWaiting(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	node := PodResourceBuilder(&p).BuildNode()
+
+	AssertEqual("containerWaiting", node.Properties["containerWaiting"], nil, t)
+	AssertEqual("running _crashLooping", node.Properties["_crashLooping"], false, t)
+	AssertEqual("running _configError", node.Properties["_configError"], false, t)
+
+	crashLoop := v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}
+	p.Status.ContainerStatuses = []v1.ContainerStatus{{Name: "main", State: crashLoop,
+		LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "Error", ExitCode: 1}}}}
+	node = PodResourceBuilder(&p).BuildNode()
+
+	AssertDeepEqual("crash loop containerWaiting", node.Properties["containerWaiting"],
+		[]string{"main=CrashLoopBackOff"}, t)
+	AssertEqual("crash loop _crashLooping", node.Properties["_crashLooping"], true, t)
+	AssertEqual("crash loop _configError", node.Properties["_configError"], false, t)
+
+	// The container never ran, the kubelet backs off the attempts to start it.
+	p.Status.ContainerStatuses[0].LastTerminationState.Terminated.Reason = "StartError"
+	node = PodResourceBuilder(&p).BuildNode()
+
+	AssertEqual("start error _crashLooping", node.Properties["_crashLooping"], false, t)
+	AssertEqual("start error _configError", node.Properties["_configError"], true, t)
+
+	p.Status.ContainerStatuses[0] = v1.ContainerStatus{Name: "main",
+		State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CreateContainerConfigError"}}}
+	p.Status.InitContainerStatuses = []v1.ContainerStatus{{Name: "setup", State: crashLoop}}
+	node = PodResourceBuilder(&p).BuildNode()
+
+	AssertDeepEqual("config error containerWaiting", node.Properties["containerWaiting"],
+		[]string{"setup=CrashLoopBackOff", "main=CreateContainerConfigError"}, t)
+	AssertEqual("config error _crashLooping", node.Properties["_crashLooping"], true, t)
+	AssertEqual("config error _configError", node.Properties["_configError"], true, t)
+}
+
+func TestTransformPodReadinessFailureThreshold(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	node := PodResourceBuilder(&p).BuildNode()
+
+	AssertEqual("no readiness probe", node.Properties["_readinessFailureThreshold"], nil, t)
+
+	p.Spec.Containers[0].ReadinessProbe = &v1.Probe{FailureThreshold: 5}
+	p.Spec.Containers = append(p.Spec.Containers,
+		v1.Container{Name: "sidecar", ReadinessProbe: &v1.Probe{FailureThreshold: 2}},
+		v1.Container{Name: "proxy", LivenessProbe: &v1.Probe{FailureThreshold: 1}})
+	node = PodResourceBuilder(&p).BuildNode()
+
+	// The liveness probe doesn't take the pod out of the endpoints, only the readiness probes count.
+	AssertEqual("lowest threshold", node.Properties["_readinessFailureThreshold"], int64(2), t)
+
+	p.Spec.Containers[1].ReadinessProbe.FailureThreshold = 0
+	p.Spec.Containers[0].ReadinessProbe.FailureThreshold = 10
+	node = PodResourceBuilder(&p).BuildNode()
+
+	AssertEqual("default threshold", node.Properties["_readinessFailureThreshold"], int64(3), t)
+}
+
+func TestTransformPodRestartHistory(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	node := PodResourceBuilder(&p).BuildNode()
+	AssertDeepEqual("containerRestarts", node.Properties["containerRestarts"], []string{"fake-pod=0"}, t)
+	AssertEqual("lastTerminatedError", node.Properties["lastTerminatedError"], nil, t)
+	AssertEqual("_livenessRestarts", node.Properties["_livenessRestarts"], int64(0), t)
+
+	terminated := func(reason string, exitCode int32) v1.ContainerState {
+		return v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: reason, ExitCode: exitCode}}
+	}
+	p.Spec.Containers = []v1.Container{
+		{Name: "killed", LivenessProbe: &v1.Probe{}},
+		{Name: "crashed", LivenessProbe: &v1.Probe{}},
+		{Name: "no-probe"},
+		{Name: "oom", LivenessProbe: &v1.Probe{}},
+	}
+	p.Status.ContainerStatuses = []v1.ContainerStatus{
+		{Name: "killed", RestartCount: 4, LastTerminationState: terminated("Error", 137)},
+		{Name: "crashed", RestartCount: 2, LastTerminationState: terminated("Error", 1)},
+		{Name: "no-probe", RestartCount: 3, LastTerminationState: terminated("Error", 143)},
+		{Name: "oom", RestartCount: 1, LastTerminationState: terminated("OOMKilled", 137)},
+	}
+	node = PodResourceBuilder(&p).BuildNode()
+	AssertDeepEqual("containerRestarts", node.Properties["containerRestarts"],
+		[]string{"killed=4", "crashed=2", "no-probe=3", "oom=1"}, t)
+	AssertDeepEqual("lastTerminatedError", node.Properties["lastTerminatedError"],
+		[]string{"killed", "crashed", "no-probe"}, t)
+	AssertEqual("_livenessRestarts", node.Properties["_livenessRestarts"], int64(4), t)
+	AssertDeepEqual("lastTerminationReason", node.Properties["lastTerminationReason"],
+		[]string{"killed=Error", "crashed=Error", "no-probe=Error", "oom=OOMKilled"}, t)
+}
+
+func TestProjectedTokenAudiences(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	node := PodResourceBuilder(&p).BuildNode()
+	AssertEqual("no audience", node.Properties["projectedTokenAudiences"], nil, t)
+
+	token := func(audience string) v1.VolumeProjection {
+		return v1.VolumeProjection{ServiceAccountToken: &v1.ServiceAccountTokenProjection{Audience: audience}}
+	}
+	volumes := []v1.Volume{
+		{Name: "aws-token", VolumeSource: v1.VolumeSource{Projected: &v1.ProjectedVolumeSource{
+			Sources: []v1.VolumeProjection{token("sts.amazonaws.com")}}}},
+		{Name: "tokens", VolumeSource: v1.VolumeSource{Projected: &v1.ProjectedVolumeSource{
+			Sources: []v1.VolumeProjection{token(""), token("vault"), token("sts.amazonaws.com")}}}},
+		{Name: "empty", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+	}
+	AssertDeepEqual("audiences", projectedTokenAudiences(volumes), []string{"sts.amazonaws.com", "vault"}, t)
+}
+
+func TestPodUnschedulableReason(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	node := PodResourceBuilder(&p).BuildNode()
+	AssertEqual("running pod", node.Properties["_unschedulableReason"], nil, t)
+
+	message := "0/5 nodes are available: 5 node(s) didn't match Pod's node affinity/selector."
+	p.Status.Phase = v1.PodPending
+	p.Status.Conditions = []v1.PodCondition{{
+		Type: v1.PodScheduled, Status: v1.ConditionFalse, Reason: v1.PodReasonUnschedulable, Message: message}}
+	node = PodResourceBuilder(&p).BuildNode()
+	AssertEqual("unschedulable pod", node.Properties["_unschedulableReason"], message, t)
+
+	p.Status.Conditions[0].Reason = "SchedulerError"
+	node = PodResourceBuilder(&p).BuildNode()
+	AssertEqual("other reason", node.Properties["_unschedulableReason"], nil, t)
+}
+
+func TestPodVolumeDevices(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	node := PodResourceBuilder(&p).BuildNode()
+	AssertEqual("no devices", node.Properties["volumeDevices"], nil, t)
+
+	p.Spec.Containers[0].VolumeDevices = []v1.VolumeDevice{
+		{Name: "mounted-persistentVolumeClaim", DevicePath: "/dev/xvda"}}
+	p.Spec.Containers = append(p.Spec.Containers, v1.Container{Name: "backup", VolumeDevices: []v1.VolumeDevice{
+		{Name: "mounted-persistentVolumeClaim", DevicePath: "/dev/xvda"},
+		{Name: "mounted-persistentVolumeClaim", DevicePath: "/dev/backup"}}})
+	node = PodResourceBuilder(&p).BuildNode()
+	AssertDeepEqual("volumeDevices", node.Properties["volumeDevices"],
+		map[string]string{"mounted-persistentVolumeClaim": "/dev/xvda, /dev/backup"}, t)
+}
+
+func TestPodBuildEdgesBlockDevice(t *testing.T) {
+	claim := Node{
+		UID:        "uuid-123-pvc",
+		Properties: map[string]interface{}{"kind": "PersistentVolumeClaim", "namespace": "default", "name": "test-pvc"},
+	}
+	nodeStore := BuildFakeNodeStore([]Node{claim})
+
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	p.Spec.Containers[0].VolumeDevices = []v1.VolumeDevice{
+		{Name: "mounted-persistentVolumeClaim", DevicePath: "/dev/xvda"}}
+	pod := PodResourceBuilder(&p)
+
+	// The claim's volume mode isn't Block, the device path isn't on the edge.
+	edges := pod.BuildEdges(nodeStore)
+	AssertEqual("Pod edge total: ", len(edges), 1, t)
+	AssertEqual("filesystem claim", edges[0].Properties == nil, true, t)
+
+	claim.Properties["volumeMode"] = "Block"
+	edges = pod.BuildEdges(nodeStore)
+	AssertEqual("Pod edge total: ", len(edges), 1, t)
+	AssertDeepEqual("block claim", edges[0].Properties, map[string]interface{}{"devicePath": "/dev/xvda"}, t)
+}
+
+func TestPodAntiAffinity(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	node := PodResourceBuilder(&p).BuildNode()
+	AssertEqual("no affinity", node.Properties["_hasZoneAntiAffinity"], false, t)
+	AssertEqual("no required keys", node.Properties["requiredAntiAffinityTopologyKeys"], nil, t)
+
+	term := func(topologyKey string) v1.PodAffinityTerm {
+		return v1.PodAffinityTerm{
+			LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+			TopologyKey:   topologyKey,
+		}
+	}
+	p.Spec.Affinity = &v1.Affinity{PodAntiAffinity: &v1.PodAntiAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{
+			term("kubernetes.io/hostname"), term("kubernetes.io/hostname")},
+	}}
+	node = PodResourceBuilder(&p).BuildNode()
+	AssertDeepEqual("required keys", node.Properties["requiredAntiAffinityTopologyKeys"],
+		[]string{"kubernetes.io/hostname"}, t)
+	AssertEqual("hostname only", node.Properties["_hasZoneAntiAffinity"], false, t)
+
+	p.Spec.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = []v1.WeightedPodAffinityTerm{
+		{Weight: 100, PodAffinityTerm: term("topology.kubernetes.io/zone")}}
+	node = PodResourceBuilder(&p).BuildNode()
+	AssertDeepEqual("preferred keys", node.Properties["preferredAntiAffinityTopologyKeys"],
+		[]string{"topology.kubernetes.io/zone"}, t)
+	AssertEqual("zone", node.Properties["_hasZoneAntiAffinity"], true, t)
+
+	// Affinity without anti-affinity.
+	p.Spec.Affinity = &v1.Affinity{NodeAffinity: &v1.NodeAffinity{}}
+	node = PodResourceBuilder(&p).BuildNode()
+	AssertEqual("node affinity only", node.Properties["_hasZoneAntiAffinity"], false, t)
+}
+
+func TestPodExtendedResourceRequests(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	node := PodResourceBuilder(&p).BuildNode()
+
+	AssertEqual("_usesGpu without requests", node.Properties["_usesGpu"], false, t)
+
+	p.Spec.Containers[0].Resources.Requests = v1.ResourceList{
+		v1.ResourceCPU:         resource.MustParse("1"),
+		"nvidia.com/gpu":       resource.MustParse("2"),
+		"example.com/fpga-0.5": resource.MustParse("500m"),
+	}
+	// The request defaults to the limit.
+	p.Spec.Containers = append(p.Spec.Containers, v1.Container{Name: "sidecar", Resources: v1.ResourceRequirements{
+		Limits: v1.ResourceList{"nvidia.com/gpu": resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("1Gi")},
+	}})
+	p.Spec.InitContainers = []v1.Container{{Name: "warmup", Resources: v1.ResourceRequirements{
+		Requests: v1.ResourceList{"hugepages-2Mi": resource.MustParse("1Gi"), "example.com/fpga-0.5": resource.MustParse("1")},
+	}}}
+	node = PodResourceBuilder(&p).BuildNode()
+
+	AssertDeepEqual("request_nvidia_com_gpu", node.Properties["request_nvidia_com_gpu"],
+		map[string]interface{}{"fake-pod": int64(2), "sidecar": int64(1)}, t)
+	AssertDeepEqual("request_example_com_fpga_0_5", node.Properties["request_example_com_fpga_0_5"],
+		map[string]interface{}{"fake-pod": 0.5, "warmup": int64(1)}, t)
+	AssertEqual("hugepages", node.Properties["request_hugepages_2Mi"], nil, t)
+	AssertEqual("_usesGpu", node.Properties["_usesGpu"], true, t)
+}
+
+func TestIsExtendedResource(t *testing.T) {
+	for name, expected := range map[v1.ResourceName]bool{
+		"nvidia.com/gpu":             true,
+		"example.com/foo":            true,
+		v1.ResourceCPU:               false,
+		v1.ResourceEphemeralStorage:  false,
+		"hugepages-1Gi":              false,
+		"kubernetes.io/batch-cpu":    false,
+		"scheduling.kubernetes.io/x": false,
+		"requests.nvidia.com/gpu":    false,
+	} {
+		AssertEqual(string(name), isExtendedResource(name), expected, t)
+	}
 }
@@ -11,12 +11,15 @@ Copyright (c) 2020 Red Hat, Inc.
 package transforms
 
 import (
+	"github.com/golang/glog"
 	p "github.com/stolostron/governance-policy-propagator/api/v1"
 )
 
 // PolicyResource ...
 type PolicyResource struct {
-	node Node
+	node            Node
+	parentNamespace string // From the parent-namespace label, set on the policies propagated to a cluster
+	parentPolicy    string // From the parent-policy label
 }
 
 // PolicyResourceBuilder ...
@@ -37,7 +40,7 @@ func PolicyResourceBuilder(p *p.Policy) *PolicyResource {
 	if okns && okpp {
 		node.Properties["_parentPolicy"] = pnamespace + "/" + ppolicy
 	}
-	return &PolicyResource{node: node}
+	return &PolicyResource{node: node, parentNamespace: pnamespace, parentPolicy: ppolicy}
 }
 
 // BuildNode construct the node for Policy Resources
@@ -46,7 +49,26 @@ func (p PolicyResource) BuildNode() Node {
 }
 
 // BuildEdges construct the edges for Policy Resources
+// A propagated policy is ownedBy the parent policy in its parent-namespace and parent-policy labels.
 func (p PolicyResource) BuildEdges(ns NodeStore) []Edge {
-	//no op for now to implement interface
-	return []Edge{}
+	ret := []Edge{}
+	if p.parentNamespace == "" || p.parentPolicy == "" {
+		return ret
+	}
+	parent, ok := ns.ByKindNamespaceName["Policy"][p.parentNamespace][p.parentPolicy]
+	if !ok {
+		glog.V(4).Infof("Policy %s ownedBy edge not created: parent Policy %s not found", p.node.UID,
+			p.parentNamespace+"/"+p.parentPolicy)
+		return ret
+	}
+	if parent.UID != p.node.UID { // avoid connecting node to itself
+		ret = append(ret, Edge{
+			SourceUID:  p.node.UID,
+			DestUID:    parent.UID,
+			EdgeType:   "ownedBy",
+			SourceKind: "Policy",
+			DestKind:   "Policy",
+		})
+	}
+	return ret
 }
@@ -26,3 +26,29 @@ func TestTransformPolicy(t *testing.T) {
 	AssertEqual("disabled", node.Properties["disabled"], false, t)
 	AssertEqual("numRules", node.Properties["numRules"], 1, t)
 }
+
+func TestPolicyBuildEdges(t *testing.T) {
+	var parent policy.Policy
+	UnmarshalFile("parent-policy.json", &parent, t)
+	parentNode := PolicyResourceBuilder(&parent).BuildNode()
+	var child policy.Policy
+	UnmarshalFile("policy.json", &child, t)
+	child.Labels["parent-namespace"] = "default"
+	child.Labels["parent-policy"] = "policy-01"
+	childResource := PolicyResourceBuilder(&child)
+
+	nodeStore := BuildFakeNodeStore([]Node{parentNode, childResource.BuildNode()})
+
+	edges := childResource.BuildEdges(nodeStore)
+	AssertEqual("Policy edge total:", len(edges), 1, t)
+	AssertEqual("Policy ownedBy", string(edges[0].EdgeType), "ownedBy", t)
+	AssertEqual("Policy ownedBy", edges[0].DestUID, parentNode.UID, t)
+	AssertEqual("Policy ownedBy", edges[0].DestKind, "Policy", t)
+
+	// The parent policy doesn't have a parent.
+	AssertEqual("Parent edge total:", len(PolicyResourceBuilder(&parent).BuildEdges(nodeStore)), 0, t)
+
+	// The parent isn't in the store yet.
+	nodeStore = BuildFakeNodeStore([]Node{childResource.BuildNode()})
+	AssertEqual("Missing parent edge total:", len(childResource.BuildEdges(nodeStore)), 0, t)
+}
@@ -0,0 +1,151 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// EventQueue holds the events between the informers and the transformer, collapsing the events of the same
+// resource. An event added while an older event of the same resource is still waiting replaces it, in the same
+// place in the queue, so a burst of updates of a resource is transformed once with its latest state.
+// The queue holds at most the given number of resources. Adding the event of another resource blocks while the
+// queue is full, the events of the resources already waiting are always collapsed without blocking.
+type EventQueue struct {
+	mutex   sync.Mutex
+	changed *sync.Cond        // Signaled when an event is added or taken, or the queue is closed
+	pending map[string]*Event // The waiting event of each resource, by key
+	order   []string          // The keys of the waiting events, oldest first
+	size    int
+	closed  bool
+	passing bool // An event was taken and isn't in the input yet
+}
+
+// NewEventQueue creates a queue holding the events of at most size resources. A size under 1 holds one.
+func NewEventQueue(size int) *EventQueue {
+	if size < 1 {
+		size = 1
+	}
+	q := &EventQueue{pending: make(map[string]*Event), size: size}
+	q.changed = sync.NewCond(&q.mutex)
+	return q
+}
+
+// Returns the key of the resource, its UID or its kind, namespace and name if it doesn't have one.
+func eventQueueKey(r *unstructured.Unstructured) string {
+	if uid := r.GetUID(); uid != "" {
+		return string(uid)
+	}
+	return r.GetKind() + "/" + r.GetNamespace() + "/" + r.GetName()
+}
+
+// Add queues the event, replacing the waiting event of the same resource. A replaced Create stays a Create, the
+// resource wasn't transformed yet. Blocks while the queue is full. Events added after Close are dropped.
+func (q *EventQueue) Add(event *Event) {
+	key := eventQueueKey(event.Resource)
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for {
+		if q.closed {
+			return
+		}
+		if waiting, ok := q.pending[key]; ok {
+			if waiting.Operation == Create {
+				event.Operation = Create
+			}
+			q.pending[key] = event
+			collapsedEvents.Inc()
+			return
+		}
+		if len(q.order) < q.size {
+			break
+		}
+		q.changed.Wait()
+	}
+	q.pending[key] = event
+	q.order = append(q.order, key)
+	queueDepth.Set(float64(len(q.order)))
+	q.changed.Broadcast()
+}
+
+// Forget drops the waiting event of the resource, so a resource deleted while its update is waiting isn't
+// transformed again after its delete.
+func (q *EventQueue) Forget(r *unstructured.Unstructured) {
+	key := eventQueueKey(r)
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if _, ok := q.pending[key]; !ok {
+		return
+	}
+	delete(q.pending, key)
+	for i, k := range q.order {
+		if k == key {
+			q.order = append(q.order[:i], q.order[i+1:]...)
+			break
+		}
+	}
+	queueDepth.Set(float64(len(q.order)))
+	q.changed.Broadcast()
+}
+
+// Takes the oldest event, blocking until there's one. Returns false once the queue is closed and empty.
+func (q *EventQueue) take() (*Event, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for len(q.order) == 0 {
+		if q.closed {
+			return nil, false
+		}
+		q.changed.Wait()
+	}
+	key := q.order[0]
+	q.order = q.order[1:]
+	event := q.pending[key]
+	delete(q.pending, key)
+	q.passing = true
+	queueDepth.Set(float64(len(q.order)))
+	q.changed.Broadcast()
+	return event, true
+}
+
+// Signals the event taken is in the input.
+func (q *EventQueue) passed() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.passing = false
+	q.changed.Broadcast()
+}
+
+// WaitForwarded blocks until the queue is empty and Forward passed the last event taken into the input. Events
+// added meanwhile are waited for too. Returns right away once the queue is closed.
+func (q *EventQueue) WaitForwarded() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for (len(q.order) > 0 || q.passing) && !q.closed {
+		q.changed.Wait()
+	}
+}
+
+// Forward passes the events into the input of the transformer, oldest first, until the queue is closed and the
+// events left are passed on. Each event is taken out of the queue before it's passed on, an event added while the
+// input is full is queued again.
+func (q *EventQueue) Forward(input chan *Event) {
+	for {
+		event, ok := q.take()
+		if !ok {
+			return
+		}
+		input <- event
+		q.passed()
+	}
+}
+
+// Close stops the queue from taking events. Forward returns once it passed on the events left.
+func (q *EventQueue) Close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.closed = true
+	q.changed.Broadcast()
+}
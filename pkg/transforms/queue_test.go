@@ -0,0 +1,99 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func queueTestEvent(uid string, operation Operation, generation int64) *Event {
+	r := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "Pod"}}
+	r.SetUID(types.UID("uid-" + uid))
+	r.SetName(uid)
+	r.SetGeneration(generation)
+	return &Event{Resource: r, ResourceString: "pods", Operation: operation}
+}
+
+func TestEventQueueCollapsesEvents(t *testing.T) {
+	q := NewEventQueue(10)
+	collapsed := testutil.ToFloat64(collapsedEvents)
+
+	q.Add(queueTestEvent("a", Create, 1))
+	q.Add(queueTestEvent("b", Update, 1))
+	q.Add(queueTestEvent("a", Update, 2))
+	q.Add(queueTestEvent("b", Update, 2))
+	q.Add(queueTestEvent("c", Update, 1))
+	q.Forget(queueTestEvent("c", Delete, 1).Resource)
+	q.Close()
+
+	input := make(chan *Event, 10)
+	q.Forward(input) // Returns once the queue is empty
+	AssertEqual("forwarded", len(input), 2, t)
+	// The latest state of each resource, in the order of their first event.
+	first, second := <-input, <-input
+	AssertEqual("first", first.Resource.GetName(), "a", t)
+	AssertEqual("first generation", first.Resource.GetGeneration(), int64(2), t)
+	AssertEqual("first stays a create", first.Operation, Create, t)
+	AssertEqual("second", second.Resource.GetName(), "b", t)
+	AssertEqual("second generation", second.Resource.GetGeneration(), int64(2), t)
+	AssertEqual("second operation", second.Operation, Update, t)
+	AssertEqual("collapsed", testutil.ToFloat64(collapsedEvents)-collapsed, float64(2), t)
+}
+
+func TestEventQueueBlocksWhenFull(t *testing.T) {
+	q := NewEventQueue(1)
+	q.Add(queueTestEvent("a", Update, 1))
+	q.Add(queueTestEvent("a", Update, 2)) // The resource is already waiting, it doesn't block
+
+	added := make(chan struct{})
+	go func() {
+		q.Add(queueTestEvent("b", Update, 1))
+		close(added)
+	}()
+	select {
+	case <-added:
+		t.Fatal("Expected the event of another resource to wait while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	input := make(chan *Event)
+	go q.Forward(input)
+	AssertEqual("first", (<-input).Resource.GetName(), "a", t)
+	AssertEqual("second", (<-input).Resource.GetName(), "b", t)
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the event to be added once the queue had room")
+	}
+	q.Close()
+}
+
+func TestEventQueueWaitForwarded(t *testing.T) {
+	q := NewEventQueue(10)
+	defer q.Close()
+	q.Add(queueTestEvent("a", Update, 1))
+	input := make(chan *Event)
+	go q.Forward(input)
+
+	forwarded := make(chan struct{})
+	go func() {
+		q.WaitForwarded()
+		close(forwarded)
+	}()
+	select {
+	case <-forwarded:
+		t.Fatal("Expected to wait until the event is in the input")
+	case <-time.After(50 * time.Millisecond):
+	}
+	<-input
+	select {
+	case <-forwarded:
+	case <-time.After(time.Second):
+		t.Fatal("Expected to return once the event is in the input")
+	}
+}
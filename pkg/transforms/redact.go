@@ -0,0 +1,53 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/stolostron/search-collector/pkg/config"
+)
+
+// Annotation where kubectl apply keeps the last applied manifest, which holds the data of the Secrets applied with
+// kubectl.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// Returns true if the dot separated path of a field matches REDACTED_PATHS. Patterns are dot separated paths
+// too, where a * segment matches any key or array index, like spec.users.*.password. A matched field is
+// redacted with everything under it.
+func isRedactedPath(path string) bool {
+	for _, pattern := range config.Cfg.RedactedPaths {
+		if matchesPathPattern(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesPathPattern(pattern, path string) bool {
+	patternSegments := strings.Split(pattern, ".")
+	pathSegments := strings.Split(path, ".")
+	if len(patternSegments) != len(pathSegments) {
+		return false
+	}
+	for i, segment := range patternSegments {
+		if segment != "*" && segment != pathSegments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Logs the fields that were stripped from the node, never their values, so it can be audited what didn't leave
+// the cluster. Nothing is logged when nothing was stripped.
+func auditRedactedFields(node Node, fields []string) {
+	if len(fields) == 0 {
+		return
+	}
+	kind, _ := node.Properties["kind"].(string)
+	namespace, _ := node.Properties["namespace"].(string)
+	name, _ := node.Properties["name"].(string)
+	redactedFields.WithLabelValues(kind).Add(float64(len(fields)))
+	glog.Infof("Redacted fields of %s %s/%s: %s", kind, namespace, name, strings.Join(fields, ", "))
+}
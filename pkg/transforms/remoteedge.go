@@ -0,0 +1,59 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"strings"
+
+	"github.com/stolostron/search-collector/pkg/config"
+)
+
+// The edge properties identifying the destination of an edge to a resource of another cluster.
+const (
+	remoteClusterProperty   = "remoteCluster"
+	remoteNamespaceProperty = "remoteNamespace"
+	remoteNameProperty      = "remoteName"
+)
+
+// RemoteUID returns the UID of a resource of another cluster, like local-cluster/Channel/<namespace>/<name>.
+// The collector doesn't know the UID of the remote resource, so it's identified by its kind, namespace and name.
+func RemoteUID(cluster, kind, namespace, name string) string {
+	return cluster + "/" + kind + "/" + namespace + "/" + name
+}
+
+// IsRemoteEdge returns true if the destination of the edge is a resource of another cluster.
+func IsRemoteEdge(edge Edge) bool {
+	_, ok := edge.Properties[remoteClusterProperty]
+	return ok
+}
+
+// Returns the edge from the node to a resource of the REMOTE_EDGES_CLUSTER, the hub, that isn't collected here,
+// like the Channel of a Subscription propagated to a managed cluster. The destination is identified by the
+// remoteCluster, remoteNamespace and remoteName edge properties, for the aggregator to stitch the edge to the
+// remote node. Returns false if REMOTE_EDGES_CLUSTER isn't set, or is this cluster.
+func remoteEdge(nodeInfo NodeInfo, destKind, namespace, name string) (Edge, bool) {
+	cluster := config.Cfg.RemoteEdgesCluster
+	if cluster == "" || cluster == config.Cfg.ClusterName || name == "" {
+		return Edge{}, false
+	}
+	return Edge{
+		SourceUID:  nodeInfo.UID,
+		DestUID:    RemoteUID(cluster, destKind, namespace, name),
+		EdgeType:   nodeInfo.EdgeType,
+		SourceKind: nodeInfo.Kind,
+		DestKind:   destKind,
+		Properties: map[string]interface{}{
+			remoteClusterProperty:   cluster,
+			remoteNamespaceProperty: namespace,
+			remoteNameProperty:      name,
+		},
+	}, true
+}
+
+// Splits a reference like namespace/name. References without a namespace are in the default namespace.
+func splitNamespacedName(ref, defaultNamespace string) (string, string) {
+	if i := strings.Index(ref, "/"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return defaultNamespace, ref
+}
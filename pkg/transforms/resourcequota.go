@@ -0,0 +1,65 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"math"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ResourceQuotaResource ...
+type ResourceQuotaResource struct {
+	node Node
+}
+
+// ResourceQuotaResourceBuilder ...
+func ResourceQuotaResourceBuilder(r *v1.ResourceQuota) *ResourceQuotaResource {
+	node := transformCommon(r) // Start off with the common properties
+
+	apiGroupVersion(r.TypeMeta, &node) // add kind, apigroup and version
+	// Extract the properties specific to this type
+	node.Properties["hard"] = resourceListStrings(r.Status.Hard)
+	node.Properties["used"] = resourceListStrings(r.Status.Used)
+	node.Properties["_utilization"] = quotaUtilization(r.Status.Hard, r.Status.Used)
+
+	return &ResourceQuotaResource{node: node}
+}
+
+// Returns the quantities in the resource list as strings, keyed by the resource name.
+func resourceListStrings(resources v1.ResourceList) map[string]string {
+	ret := make(map[string]string, len(resources))
+	for name, quantity := range resources {
+		ret[string(name)] = quantity.String()
+	}
+	return ret
+}
+
+// Returns the percent of the hard limit that is used for each resource, rounded to the nearest integer.
+// A resource with a hard limit but no usage reported is at 0%. Resources that are used but don't have a hard limit,
+// or have a hard limit of 0, don't have a meaningful percent so we leave them out.
+func quotaUtilization(hard, used v1.ResourceList) map[string]int64 {
+	ret := make(map[string]int64, len(hard))
+	for name, hardQuantity := range hard {
+		if hardQuantity.IsZero() {
+			continue
+		}
+		usedValue := float64(0)
+		if usedQuantity, ok := used[name]; ok {
+			usedValue = usedQuantity.AsApproximateFloat64()
+		}
+		ret[string(name)] = int64(math.Round(usedValue / hardQuantity.AsApproximateFloat64() * 100))
+	}
+	return ret
+}
+
+// BuildNode construct the node for the ResourceQuota Resources
+func (r ResourceQuotaResource) BuildNode() Node {
+	return r.node
+}
+
+// BuildEdges construct the edges for the ResourceQuota Resources
+func (r ResourceQuotaResource) BuildEdges(ns NodeStore) []Edge {
+	//no op for now to implement interface
+	return []Edge{}
+}
@@ -0,0 +1,33 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestTransformResourceQuota(t *testing.T) {
+	var r v1.ResourceQuota
+	UnmarshalFile("resourcequota.json", &r, t)
+	node := ResourceQuotaResourceBuilder(&r).BuildNode()
+
+	// Test only the fields that exist in resource quota - the common test will test the other bits
+	AssertEqual("kind", node.Properties["kind"], "ResourceQuota", t)
+	AssertDeepEqual("hard", node.Properties["hard"], map[string]string{
+		"limits.memory": "4Gi", "pods": "10", "requests.cpu": "2", "requests.storage": "0", "services": "5"}, t)
+	AssertDeepEqual("used", node.Properties["used"], map[string]string{
+		"count/jobs.batch": "3", "limits.memory": "1Gi", "pods": "3", "requests.cpu": "500m", "requests.storage": "0"}, t)
+	// count/jobs.batch has no hard limit, requests.storage has a hard limit of 0 and services has no usage reported.
+	AssertDeepEqual("_utilization", node.Properties["_utilization"], map[string]int64{
+		"limits.memory": 25, "pods": 30, "requests.cpu": 25, "services": 0}, t)
+}
+
+func TestResourceQuotaBuildEdges(t *testing.T) {
+	var r v1.ResourceQuota
+	UnmarshalFile("resourcequota.json", &r, t)
+	edges := ResourceQuotaResourceBuilder(&r).BuildEdges(BuildFakeNodeStore([]Node{}))
+
+	AssertEqual("ResourceQuota has no edges:", len(edges), 0, t)
+}
@@ -0,0 +1,102 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/stolostron/search-collector/pkg/config"
+)
+
+// ResyncMarkerKind is the kind of the synthetic node the transformer emits when a full resync starts and ends.
+// The node has the _resyncMarker and _synthetic properties, so consumers can tell it from the real nodes.
+const ResyncMarkerKind = "CollectorResyncMarker"
+
+// Tracks the resync signaled by the caller of the transformer.
+type resyncMarkers struct {
+	inFlight   sync.RWMutex // Held for reading while an event is transformed, the markers wait for those events
+	generation int64        // Number of the last resync started
+	started    time.Time    // Start of the resync in progress, zero when there's none
+}
+
+// Transforms the event, holding back the markers until it's done. A nil resync doesn't hold anything back.
+func (r *resyncMarkers) transform(event *Event, output chan NodeEvent, manifest *syncManifest,
+	throttle *kindThrottle) error {
+	if r == nil {
+		return manifest.transform(event, output, throttle)
+	}
+	r.inFlight.RLock()
+	defer r.inFlight.RUnlock() // The routine may panic, see handleRoutineExit
+	return manifest.transform(event, output, throttle)
+}
+
+// Builds the resync marker node. _syncComplete is only set once the resync is complete.
+func resyncMarkerNode(generation int64, started, completed time.Time) Node {
+	node := Node{
+		UID:            PrefixedUID(ResyncMarkerKind, "search-collector-resync-marker"),
+		ResourceString: "collectorresyncmarkers",
+		Properties: map[string]interface{}{
+			"kind":              ResyncMarkerKind,
+			"kind_plural":       "collectorresyncmarkers",
+			"name":              "search-collector-resync-marker",
+			"_clusterNamespace": config.Cfg.ClusterNamespace,
+			"_synthetic":        true,
+			"_resyncMarker":     true,
+			"_resyncGeneration": generation,
+			"_syncStart":        started.UTC().Format(time.RFC3339),
+		},
+		Metadata: map[string]string{},
+	}
+	if !completed.IsZero() {
+		node.Properties["_syncComplete"] = completed.UTC().Format(time.RFC3339)
+	}
+	return node
+}
+
+// ResyncStart tells the transformer the caller is about to pass in every resource again. It waits for the events
+// passed in before, including the ones queued in the worker pools or waiting for a retry and the nodes held back by
+// the rate limits, then emits the resync marker with _syncStart. The nodes emitted after the marker are part of
+// the resync. Starting a resync while one is in progress starts over with a new generation.
+// Only emits the marker when RESYNC_MARKERS is enabled.
+func (t Transformer) ResyncStart() {
+	if t.resync == nil {
+		return
+	}
+	waitIdle(&t.resync.inFlight, t.idle)
+	defer t.resync.inFlight.Unlock()
+	t.resync.generation++
+	t.resync.started = time.Now()
+	glog.Infof("Resync %d started", t.resync.generation)
+	t.emitResyncMarker(resyncMarkerNode(t.resync.generation, t.resync.started, time.Time{}))
+}
+
+// ResyncComplete tells the transformer every resource of the resync was passed in. It waits for the events of the
+// resync like ResyncStart, then emits the resync marker with _syncStart and _syncComplete. Consumers can delete the
+// nodes they didn't receive since the start marker of the same generation.
+// Doesn't emit anything if no resync is in progress, or when RESYNC_MARKERS is disabled.
+func (t Transformer) ResyncComplete() {
+	if t.resync == nil {
+		return
+	}
+	waitIdle(&t.resync.inFlight, t.idle)
+	defer t.resync.inFlight.Unlock()
+	if t.resync.started.IsZero() {
+		return
+	}
+	glog.Infof("Resync %d complete", t.resync.generation)
+	t.emitResyncMarker(resyncMarkerNode(t.resync.generation, t.resync.started, time.Now()))
+	t.resync.started = time.Time{}
+}
+
+// Emits the marker on Output, or UpdateOutput when the output is split. The marker is dropped once the
+// transformer is stopped.
+func (t Transformer) emitResyncMarker(node Node) {
+	t.emit(NodeEvent{
+		Node:         node,
+		ComputeEdges: func(ns NodeStore) []Edge { return []Edge{} },
+		Time:         time.Now().Unix(),
+		Operation:    Update,
+	})
+}
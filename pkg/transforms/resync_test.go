@@ -0,0 +1,112 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestResyncMarkers(t *testing.T) {
+	config.Cfg.ResyncMarkers = true
+	defer func() { config.Cfg.ResyncMarkers = false }()
+	input := make(chan *Event)
+	output := make(chan NodeEvent)
+	transformer := NewTransformer(input, output, 2)
+	defer transformer.Stop()
+
+	// Nothing to complete before a resync starts.
+	transformer.ResyncComplete()
+
+	go transformer.ResyncStart()
+	start := <-output
+	AssertEqual("kind", start.Properties["kind"], ResyncMarkerKind, t)
+	AssertEqual("_synthetic", start.Properties["_synthetic"], true, t)
+	AssertEqual("_resyncMarker", start.Properties["_resyncMarker"], true, t)
+	AssertEqual("_resyncGeneration", start.Properties["_resyncGeneration"], int64(1), t)
+	AssertEqual("start _syncComplete", start.Properties["_syncComplete"], nil, t)
+	if start.Properties["_syncStart"] == nil {
+		t.Error("Expected the start marker to have _syncStart")
+	}
+
+	var p unstructured.Unstructured
+	UnmarshalFile("pod.json", &p, t)
+	input <- &Event{Operation: Update, Resource: &p, ResourceString: "pods"}
+	AssertEqual("resynced pod", (<-output).Properties["kind"], "Pod", t)
+
+	go transformer.ResyncComplete()
+	complete := <-output
+	AssertEqual("complete UID", complete.UID, start.UID, t)
+	AssertEqual("complete _resyncGeneration", complete.Properties["_resyncGeneration"], int64(1), t)
+	AssertEqual("complete _syncStart", complete.Properties["_syncStart"], start.Properties["_syncStart"], t)
+	if complete.Properties["_syncComplete"] == nil {
+		t.Error("Expected the complete marker to have _syncComplete")
+	}
+
+	// The resync is complete, the next one has a new generation.
+	transformer.ResyncComplete()
+	go transformer.ResyncStart()
+	AssertEqual("next _resyncGeneration", (<-output).Properties["_resyncGeneration"], int64(2), t)
+}
+
+func TestResyncMarkersWaitForPools(t *testing.T) {
+	config.Cfg.ResyncMarkers = true
+	config.Cfg.KindWorkerPools = map[string]string{"Pod": "1"}
+	defer func() {
+		config.Cfg.ResyncMarkers = false
+		config.Cfg.KindWorkerPools = nil
+	}()
+	input := make(chan *Event)
+	output := make(chan NodeEvent)
+	transformer := NewTransformer(input, output, 1)
+	defer transformer.Stop()
+
+	go transformer.ResyncStart()
+	AssertEqual("start marker", (<-output).Properties["kind"], ResyncMarkerKind, t)
+
+	var p unstructured.Unstructured
+	UnmarshalFile("pod.json", &p, t)
+	other := p.DeepCopy()
+	other.SetUID("other-pod-uid")
+	// The routine of the pool waits on the output with the first pod, the second pod waits in the pool.
+	input <- &Event{Operation: Update, Resource: &p, ResourceString: "pods"}
+	input <- &Event{Operation: Update, Resource: other, ResourceString: "pods"}
+
+	go transformer.ResyncComplete()
+	time.Sleep(50 * time.Millisecond) // ResyncComplete waits for the pool, not only for the first pod
+	for _, uid := range []string{PrefixedUID("Pod", p.GetUID()), PrefixedUID("Pod", other.GetUID())} {
+		AssertEqual("pod before the complete marker", (<-output).UID, uid, t)
+	}
+	complete := <-output
+	AssertEqual("complete marker", complete.Properties["kind"], ResyncMarkerKind, t)
+	if complete.Properties["_syncComplete"] == nil {
+		t.Error("Expected the complete marker to have _syncComplete")
+	}
+}
+
+func TestTransformerIdleWaitsForRetries(t *testing.T) {
+	transformer := NewTransformer(make(chan *Event), make(chan NodeEvent), 1)
+	defer transformer.Stop()
+	transformer.pending = newPendingRetries()
+
+	var p unstructured.Unstructured
+	UnmarshalFile("pod.json", &p, t)
+	event := &Event{Operation: Update, Resource: &p, ResourceString: "pods"}
+	transformer.pending.add(event)
+	AssertEqual("idle with a pending retry", transformer.idle(), false, t)
+	transformer.pending.remove(event)
+	AssertEqual("idle", transformer.idle(), true, t)
+}
+
+func TestResyncMarkersDisabled(t *testing.T) {
+	output := make(chan NodeEvent)
+	transformer := NewTransformer(make(chan *Event), output, 1)
+	defer transformer.Stop()
+
+	// Would block if a marker was emitted, nothing reads the output
+	transformer.ResyncStart()
+	transformer.ResyncComplete()
+}
@@ -0,0 +1,134 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// PropertyType is the type of value expected for a property.
+type PropertyType string
+
+const (
+	StringProperty PropertyType = "string"
+	NumberProperty PropertyType = "number" // Any integer or float type
+	BoolProperty   PropertyType = "bool"
+	ListProperty   PropertyType = "list" // []string or []interface{}
+	MapProperty    PropertyType = "map"  // map[string]string or map[string]interface{}
+)
+
+// PropertySchema describes a property of a node.
+type PropertySchema struct {
+	Type     PropertyType
+	Required bool
+}
+
+// NodeSchema maps the property names to the schema the property must match.
+// Properties that aren't in the schema aren't validated.
+type NodeSchema map[string]PropertySchema
+
+// Properties every node must have, regardless of the kind.
+var commonSchema = NodeSchema{
+	"kind":        {Type: StringProperty, Required: true},
+	"kind_plural": {Type: StringProperty, Required: true},
+	"name":        {Type: StringProperty, Required: true},
+	"namespace":   {Type: StringProperty},
+	"created":     {Type: StringProperty},
+	"apigroup":    {Type: StringProperty},
+	"apiversion":  {Type: StringProperty},
+	"label":       {Type: MapProperty},
+	"annotation":  {Type: MapProperty},
+	"finalizers":  {Type: ListProperty},
+	"terminating": {Type: BoolProperty},
+}
+
+var (
+	nodeSchemas = map[string]NodeSchema{
+		"Deployment": {
+			"available": {Type: NumberProperty, Required: true},
+			"current":   {Type: NumberProperty, Required: true},
+			"desired":   {Type: NumberProperty, Required: true},
+			"ready":     {Type: NumberProperty, Required: true},
+		},
+		"Node": {
+			"architecture": {Type: StringProperty, Required: true},
+			"cpu":          {Type: NumberProperty, Required: true},
+			"image":        {Type: ListProperty},
+			"role":         {Type: ListProperty, Required: true},
+		},
+		"Pod": {
+			"container":      {Type: ListProperty},
+			"hostIP":         {Type: StringProperty, Required: true},
+			"image":          {Type: ListProperty},
+			"podIP":          {Type: StringProperty, Required: true},
+			"podIPs":         {Type: ListProperty},
+			"readinessGates": {Type: MapProperty},
+			"restarts":       {Type: NumberProperty, Required: true},
+			"status":         {Type: StringProperty, Required: true},
+		},
+	}
+	nodeSchemasMutex = sync.RWMutex{}
+)
+
+// RegisterNodeSchema sets the schema used to validate the nodes of the given kind.
+// The common schema is always validated and doesn't need to be included.
+func RegisterNodeSchema(kind string, schema NodeSchema) {
+	nodeSchemasMutex.Lock()
+	defer nodeSchemasMutex.Unlock()
+	nodeSchemas[kind] = schema
+}
+
+// ValidateNode checks the node's properties against the common schema and the schema registered for its kind.
+// Returns an error listing every property that doesn't match.
+func ValidateNode(node Node) error {
+	problems := validateProperties(node.Properties, commonSchema)
+
+	kind, _ := node.Properties["kind"].(string)
+	nodeSchemasMutex.RLock()
+	schema, ok := nodeSchemas[kind]
+	nodeSchemasMutex.RUnlock()
+	if ok {
+		problems = append(problems, validateProperties(node.Properties, schema)...)
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems) // map iteration order is random, keep the message stable
+		return fmt.Errorf("node %s doesn't match the schema for kind %q: %v", node.UID, kind, problems)
+	}
+	return nil
+}
+
+func validateProperties(properties map[string]interface{}, schema NodeSchema) []string {
+	var problems []string
+	for name, propSchema := range schema {
+		value, ok := properties[name]
+		if !ok || value == nil {
+			if propSchema.Required {
+				problems = append(problems, fmt.Sprintf("missing required property %s", name))
+			}
+			continue
+		}
+		if !hasPropertyType(value, propSchema.Type) {
+			problems = append(problems, fmt.Sprintf("property %s is %T, expected %s", name, value, propSchema.Type))
+		}
+	}
+	return problems
+}
+
+func hasPropertyType(value interface{}, propType PropertyType) bool {
+	switch value.(type) {
+	case string:
+		return propType == StringProperty
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return propType == NumberProperty
+	case bool:
+		return propType == BoolProperty
+	case []string, []interface{}:
+		return propType == ListProperty
+	case map[string]string, map[string]interface{}:
+		return propType == MapProperty
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestValidateNode(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	var n v1.Node
+	UnmarshalFile("node.json", &n, t)
+	var d apps.Deployment
+	UnmarshalFile("deployment.json", &d, t)
+
+	event := &Event{Time: time.Now().Unix(), Operation: Create}
+	for resourceString, trans := range map[string]Transform{
+		"pods":        PodResourceBuilder(&p),
+		"nodes":       NodeResourceBuilder(&n),
+		"deployments": DeploymentResourceBuilder(&d),
+	} {
+		ne := NewNodeEvent(event, trans, resourceString)
+		if err := ValidateNode(ne.Node); err != nil {
+			t.Errorf("Expected %s node to be valid, got: %v", resourceString, err)
+		}
+	}
+}
+
+func TestValidateNodeInvalid(t *testing.T) {
+	node := Node{
+		UID: "local-cluster/uuid-invalid-pod",
+		Properties: map[string]interface{}{
+			"kind":        "Pod",
+			"kind_plural": "pods",
+			"name":        "invalid-pod",
+			"hostIP":      "1.1.1.1",
+			"podIP":       "2.2.2.2",
+			"restarts":    "0",
+			"label":       []string{"app=test"},
+		},
+	}
+
+	err := ValidateNode(node)
+	if err == nil {
+		t.Fatal("Expected an error validating the pod")
+	}
+	for _, problem := range []string{
+		"property label is []string, expected map",
+		"property restarts is string, expected number",
+		"missing required property status",
+	} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("Expected the error to contain %q, got: %v", problem, err)
+		}
+	}
+}
+
+func TestTransformRoutineDropsInvalidNodes(t *testing.T) {
+	config.Cfg.ValidateNodes = true
+	RegisterNodeSchema("foobar", NodeSchema{"status": {Type: StringProperty, Required: true}})
+	defer func() {
+		config.Cfg.ValidateNodes = false
+		nodeSchemasMutex.Lock()
+		delete(nodeSchemas, "foobar")
+		nodeSchemasMutex.Unlock()
+	}()
+
+	input := make(chan *Event)
+	output := make(chan NodeEvent)
+	go TransformRoutine(input, output)
+
+	invalid := unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":     "foobar",
+		"metadata": map[string]interface{}{"name": "invalid", "uid": "1234"},
+	}}
+	valid := unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":     "foobaz",
+		"metadata": map[string]interface{}{"name": "valid", "uid": "5678"},
+	}}
+	input <- &Event{Operation: Create, Resource: &invalid, ResourceString: "foobars"}
+	input <- &Event{Operation: Create, Resource: &valid, ResourceString: "foobazs"}
+
+	// The invalid node is dropped, so the first node out is the valid one.
+	actual := <-output
+	AssertEqual("name", actual.Node.Properties["name"], "valid", t)
+}
+
+func TestTransformerReportsInvalidNodes(t *testing.T) {
+	config.Cfg.ValidateNodes = true
+	RegisterNodeSchema("foobar", NodeSchema{"status": {Type: StringProperty, Required: true}})
+	defer func() {
+		config.Cfg.ValidateNodes = false
+		nodeSchemasMutex.Lock()
+		delete(nodeSchemas, "foobar")
+		nodeSchemasMutex.Unlock()
+	}()
+	input := make(chan *Event)
+	transformer := NewTransformer(input, make(chan NodeEvent), 1)
+	defer transformer.Stop()
+
+	invalid := unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":     "foobar",
+		"metadata": map[string]interface{}{"name": "invalid", "uid": "1234"},
+	}}
+	input <- &Event{Operation: Create, Resource: &invalid, ResourceString: "foobars"}
+
+	// The invalid node is reported like a resource that failed to transform.
+	select {
+	case err := <-transformer.Errors:
+		if !strings.Contains(err.Error(), "missing required property status") {
+			t.Errorf("Expected the validation error, got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the invalid node to be reported on Errors")
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"github.com/stolostron/search-collector/pkg/config"
+)
+
+// CurrentSchemaVersion is the version of the property names set by the transforms.
+// Bump it and add the renames to schemaVersionRenames when renaming a property.
+const CurrentSchemaVersion = 1
+
+// The properties renamed by each schema version, from the name in the previous version to the name in this one.
+// The renames are listed by kind, "*" applies to every kind.
+var schemaVersionRenames = map[int]map[string]map[string]string{
+	// Version 1 is the first versioned schema, there's nothing to rename.
+}
+
+// Returns the schema version the nodes are sent with. It's the current version unless an older one is pinned.
+func pinnedSchemaVersion() int {
+	if config.Cfg.SchemaVersion < 1 || config.Cfg.SchemaVersion > CurrentSchemaVersion {
+		return CurrentSchemaVersion
+	}
+	return config.Cfg.SchemaVersion
+}
+
+// PinSchemaVersion returns a copy of the node with the property names of the pinned schema version, and the
+// version in _schemaVersion.
+// The edges and the other transforms use the current names, so nodes must be pinned when they leave the collector.
+func PinSchemaVersion(node Node) Node {
+	version := pinnedSchemaVersion()
+	node = pinRenames(node, CurrentSchemaVersion, version)
+	node.Properties["_schemaVersion"] = int64(version)
+	return node
+}
+
+// Returns a copy of the node with the renames from version to pinned reverted, latest first.
+func pinRenames(node Node, version, pinned int) Node {
+	properties := make(map[string]interface{}, len(node.Properties)+1)
+	for name, value := range node.Properties {
+		properties[name] = value
+	}
+	kind, _ := node.Properties["kind"].(string)
+	for v := version; v > pinned; v-- {
+		for _, renames := range []map[string]string{schemaVersionRenames[v]["*"], schemaVersionRenames[v][kind]} {
+			for oldName, newName := range renames {
+				if value, ok := properties[newName]; ok {
+					delete(properties, newName)
+					properties[oldName] = value
+				}
+			}
+		}
+	}
+	node.Properties = properties
+	return node
+}
@@ -0,0 +1,58 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+
+	"github.com/stolostron/search-collector/pkg/config"
+)
+
+func TestPinSchemaVersionCurrent(t *testing.T) {
+	node := Node{UID: "uuid-123-pod", Properties: map[string]interface{}{"kind": "Pod", "name": "foo"}}
+	pinned := PinSchemaVersion(node)
+
+	AssertEqual("_schemaVersion", pinned.Properties["_schemaVersion"], int64(CurrentSchemaVersion), t)
+	AssertEqual("name", pinned.Properties["name"], "foo", t)
+	AssertEqual("original node", node.Properties["_schemaVersion"], nil, t)
+}
+
+func TestPinSchemaVersionRenames(t *testing.T) {
+	// Pretend versions 2 and 3 renamed some properties.
+	schemaVersionRenames[CurrentSchemaVersion+1] = map[string]map[string]string{
+		"*":   {"created": "createdAt"},
+		"Pod": {"restarts": "restartCount"},
+	}
+	schemaVersionRenames[CurrentSchemaVersion+2] = map[string]map[string]string{
+		"Pod": {"restartCount": "containerRestarts"},
+	}
+	config.Cfg.SchemaVersion = CurrentSchemaVersion
+	defer func() {
+		delete(schemaVersionRenames, CurrentSchemaVersion+1)
+		delete(schemaVersionRenames, CurrentSchemaVersion+2)
+		config.Cfg.SchemaVersion = 0
+	}()
+
+	node := Node{UID: "uuid-123-pod", Properties: map[string]interface{}{
+		"kind": "Pod", "name": "foo", "createdAt": "2022-08-01T00:00:00Z", "containerRestarts": int64(3)}}
+	// The current version is still CurrentSchemaVersion, so nothing is renamed.
+	AssertEqual("not renamed", PinSchemaVersion(node).Properties["containerRestarts"], int64(3), t)
+
+	pinned := pinRenames(node, CurrentSchemaVersion+2, CurrentSchemaVersion)
+	AssertEqual("created", pinned.Properties["created"], "2022-08-01T00:00:00Z", t)
+	AssertEqual("restarts", pinned.Properties["restarts"], int64(3), t)
+	AssertEqual("containerRestarts", pinned.Properties["containerRestarts"], nil, t)
+	AssertEqual("createdAt", pinned.Properties["createdAt"], nil, t)
+}
+
+func TestPinnedSchemaVersion(t *testing.T) {
+	defer func() { config.Cfg.SchemaVersion = 0 }()
+	for _, test := range []struct{ pinned, expected int }{
+		{0, CurrentSchemaVersion},
+		{CurrentSchemaVersion, CurrentSchemaVersion},
+		{CurrentSchemaVersion + 1, CurrentSchemaVersion},
+	} {
+		config.Cfg.SchemaVersion = test.pinned
+		AssertEqual("pinned version", pinnedSchemaVersion(), test.expected, t)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/stolostron/search-collector/pkg/config"
+	v1 "k8s.io/api/core/v1"
+)
+
+// SecretResource ...
+type SecretResource struct {
+	node    Node
+	release *helmStorage // The Helm release stored in the secret, nil for other secrets
+}
+
+// Annotation set by cert-manager on the secrets it issues, with the name of their Certificate.
+const certManagerCertificateAnnotation = "cert-manager.io/certificate-name"
+
+// SecretResourceBuilder ...
+// The values of the secret are never collected, only the number of keys in data and stringData, and their names
+// when DATA_KEY_NAMES is enabled. The last applied configuration annotation holds the values of the secrets applied
+// with kubectl, it's never kept in the annotation property, see keepMetadataKey.
+func SecretResourceBuilder(s *v1.Secret) *SecretResource {
+	node := transformCommon(s)         // Start off with the common properties
+	apiGroupVersion(s.TypeMeta, &node) // add kind, apigroup and version
+	// Extract the properties specific to this type
+	node.Properties["type"] = string(s.Type)
+	keys := make([]string, 0, len(s.Data)+len(s.StringData))
+	for key := range s.Data {
+		keys = append(keys, key)
+	}
+	for key := range s.StringData {
+		if _, ok := s.Data[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	dataKeyProperties(keys, node.Properties)
+	if managedBy := secretManagedBy(s); managedBy != "" {
+		node.Properties["_managedBy"] = managedBy
+	}
+	if certificate := s.GetAnnotations()[certManagerCertificateAnnotation]; certificate != "" {
+		node.Metadata["CertificateName"] = certificate
+	}
+
+	secret := &SecretResource{node: node}
+	if s.Type == helmReleaseSecretType {
+		secret.release = newHelmStorage(s, node.UID, string(s.Data["release"]))
+	}
+	return secret
+}
+
+// Sets dataCount to the number of data keys, and dataKeys to their sorted names when DATA_KEY_NAMES is enabled.
+// Used by the transforms of Secrets and ConfigMaps, whose data values must never be copied into the properties.
+func dataKeyProperties(keys []string, properties map[string]interface{}) {
+	properties["dataCount"] = int64(len(keys))
+	if config.Cfg.DataKeyNames {
+		sort.Strings(keys)
+		properties["dataKeys"] = keys
+	}
+}
+
+// Returns a hint of what created the secret, to tell the generated secrets from the ones created by users.
+// Well-known controllers are checked first: cert-manager, then Helm (its release storage secrets and the
+// resources of its releases). Then the kind of the owner, the controller owner if there's one, and last the
+// app.kubernetes.io/managed-by label. Returns an empty string for secrets without any of those.
+func secretManagedBy(s *v1.Secret) string {
+	annotations := s.GetAnnotations()
+	labels := s.GetLabels()
+	if annotations[certManagerCertificateAnnotation] != "" {
+		return "cert-manager"
+	}
+	if labels["owner"] == "helm" || annotations["meta.helm.sh/release-name"] != "" ||
+		strings.EqualFold(labels["app.kubernetes.io/managed-by"], "helm") {
+		return "helm"
+	}
+	owners := s.GetOwnerReferences()
+	for _, ref := range owners {
+		if ref.Controller != nil && *ref.Controller {
+			return ref.Kind
+		}
+	}
+	if len(owners) > 0 {
+		return owners[0].Kind
+	}
+	return labels["app.kubernetes.io/managed-by"]
+}
+
+// BuildNode construct the node for the Secret Resources
+func (s SecretResource) BuildNode() Node {
+	return s.node
+}
+
+// BuildEdges construct the edges for the Secret Resources
+// Secrets issued by cert-manager are owned by their Certificate, even when cert-manager doesn't set the owner
+// reference. Secrets storing a Helm release link the resources of the release to its Release node.
+func (s SecretResource) BuildEdges(ns NodeStore) []Edge {
+	if name := s.node.GetMetadata("CertificateName"); name != "" && s.node.GetMetadata("OwnerUID") == "" {
+		namespace, _ := s.node.Properties["namespace"].(string)
+		if certificate, ok := ns.ByKindNamespaceName["Certificate"][namespace][name]; ok &&
+			certificate.Properties["apigroup"] == "cert-manager.io" {
+			s.node.Metadata["OwnerUID"] = certificate.UID
+		} else {
+			glog.V(3).Infof("Certificate node not found for namespace: %s name: %s", namespace, name)
+		}
+	}
+	return append(CommonEdges(s.node.UID, ns), s.release.edges(ns)...)
+}
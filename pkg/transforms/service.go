@@ -45,16 +45,53 @@ func ServiceResourceBuilder(s *v1.Service) *ServiceResource {
 		}
 		node.Properties["port"] = ports
 	}
+	// Used to debug the health checks of external load balancers.
+	if s.Spec.Type == v1.ServiceTypeLoadBalancer {
+		// Defaults to true when unset.
+		node.Properties["allocateLoadBalancerNodePorts"] = s.Spec.AllocateLoadBalancerNodePorts == nil ||
+			*s.Spec.AllocateLoadBalancerNodePorts
+		if s.Spec.HealthCheckNodePort != 0 {
+			node.Properties["healthCheckNodePort"] = int64(s.Spec.HealthCheckNodePort)
+		}
+	}
+	if s.Spec.Type == v1.ServiceTypeExternalName {
+		node.Properties["externalName"] = s.Spec.ExternalName
+	}
 	return &ServiceResource{node: node, Spec: s.Spec}
 }
 
+// Returns the namespace and name of the service an ExternalName service aliases, when the external name is the DNS
+// name of a service of the cluster, like <name>.<namespace>.svc or <name>.<namespace>.svc.cluster.local.
+func externalNameService(externalName string) (string, string, bool) {
+	parts := strings.Split(strings.TrimSuffix(externalName, "."), ".")
+	if len(parts) < 3 || parts[2] != "svc" || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[0], true
+}
+
 // BuildNode construct the node for the Service Resources
 func (s ServiceResource) BuildNode() Node {
 	return s.node
 }
 
 // BuildEdges construct the edges for the Service Resources
+// ExternalName services use the service they alias, which can be in another namespace.
 func (s ServiceResource) BuildEdges(ns NodeStore) []Edge {
+	if s.Spec.Type == v1.ServiceTypeExternalName {
+		namespace, name, ok := externalNameService(s.Spec.ExternalName)
+		if !ok {
+			return []Edge{}
+		}
+		nodeInfo := NodeInfo{
+			Name:      s.node.Properties["name"].(string),
+			NameSpace: namespace,
+			UID:       s.node.UID,
+			EdgeType:  "uses",
+			Kind:      s.node.Properties["kind"].(string)}
+		return edgesByDestinationName(map[string]struct{}{name: {}}, "Service", nodeInfo, ns, []string{})
+	}
+
 	serviceSelector := s.Spec.Selector
 
 	if serviceSelector == nil {
@@ -21,6 +21,26 @@ func TestTransformService(t *testing.T) {
 	node := ServiceResourceBuilder(&s).BuildNode()
 
 	AssertEqual("kind", node.Properties["kind"], "Service", t)
+	AssertEqual("allocateLoadBalancerNodePorts", node.Properties["allocateLoadBalancerNodePorts"], nil, t)
+}
+
+func TestTransformServiceLoadBalancer(t *testing.T) {
+	var s v1.Service
+	UnmarshalFile("service.json", &s, t)
+	s.Spec.Type = v1.ServiceTypeLoadBalancer
+	s.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeLocal
+	s.Spec.HealthCheckNodePort = 30123
+	node := ServiceResourceBuilder(&s).BuildNode()
+
+	AssertEqual("allocateLoadBalancerNodePorts", node.Properties["allocateLoadBalancerNodePorts"], true, t)
+	AssertEqual("healthCheckNodePort", node.Properties["healthCheckNodePort"], int64(30123), t)
+
+	allocate := false
+	s.Spec.AllocateLoadBalancerNodePorts = &allocate
+	s.Spec.HealthCheckNodePort = 0
+	node = ServiceResourceBuilder(&s).BuildNode()
+	AssertEqual("allocateLoadBalancerNodePorts", node.Properties["allocateLoadBalancerNodePorts"], false, t)
+	AssertEqual("healthCheckNodePort", node.Properties["healthCheckNodePort"], nil, t)
 }
 
 func TestServiceBuildEdges(t *testing.T) {
@@ -42,3 +62,27 @@ func TestServiceBuildEdges(t *testing.T) {
 
 	AssertEqual("Service usedBy: ", edges[0].DestKind, "Pod", t)
 }
+
+func TestServiceBuildEdgesExternalName(t *testing.T) {
+	// The aliased service is in another namespace than the ExternalName service.
+	nodes := []Node{{
+		UID:        "local-cluster/uuid-db-service",
+		Properties: map[string]interface{}{"kind": "Service", "namespace": "databases", "name": "postgres"},
+	}}
+	nodeStore := BuildFakeNodeStore(nodes)
+
+	var svc v1.Service
+	UnmarshalFile("service.json", &svc, t)
+	svc.Spec = v1.ServiceSpec{Type: v1.ServiceTypeExternalName, ExternalName: "postgres.databases.svc.cluster.local"}
+	service := ServiceResourceBuilder(&svc)
+	AssertEqual("externalName", service.BuildNode().Properties["externalName"], svc.Spec.ExternalName, t)
+
+	edges := service.BuildEdges(nodeStore)
+	AssertEqual("ExternalName edges", len(edges), 1, t)
+	AssertEqual("ExternalName uses", string(edges[0].EdgeType), "uses", t)
+	AssertEqual("ExternalName dest", edges[0].DestUID, "local-cluster/uuid-db-service", t)
+
+	// An external name outside of the cluster doesn't have edges.
+	svc.Spec.ExternalName = "db.example.com"
+	AssertEqual("external edges", len(ServiceResourceBuilder(&svc).BuildEdges(nodeStore)), 0, t)
+}
@@ -11,12 +11,15 @@ Copyright (c) 2020 Red Hat, Inc.
 package transforms
 
 import (
+	"github.com/golang/glog"
 	v1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 // StatefulSetResource ...
 type StatefulSetResource struct {
 	node Node
+	Spec v1.StatefulSetSpec
 }
 
 // StatefulSetResourceBuilder ...
@@ -29,8 +32,27 @@ func StatefulSetResourceBuilder(s *v1.StatefulSet) *StatefulSetResource {
 	if s.Spec.Replicas != nil {
 		node.Properties["desired"] = int64(*s.Spec.Replicas)
 	}
+	node.Properties["ordinalsStart"] = int64(0) // Replicas are numbered from 0 unless spec.ordinals is set
 
-	return &StatefulSetResource{node: node}
+	if pullSecrets := imagePullSecretNames(s.Spec.Template.Spec); len(pullSecrets) > 0 {
+		node.Properties["imagePullSecret"] = pullSecrets
+	}
+	addLastRestartedAt(s.Spec.Template, &node)
+
+	return &StatefulSetResource{node: node, Spec: s.Spec}
+}
+
+// Sets ordinalsStart from spec.ordinals.start, the number of the first replica. The field is newer than the
+// k8s API version we build with, so it's read from the unstructured resource.
+func (s *StatefulSetResource) addOrdinalsStart(object map[string]interface{}) {
+	start, found, err := unstructured.NestedInt64(object, "spec", "ordinals", "start")
+	if err != nil {
+		glog.V(3).Infof("Ignoring invalid spec.ordinals.start of StatefulSet %s: %v", s.node.Properties["name"], err)
+		return
+	}
+	if found {
+		s.node.Properties["ordinalsStart"] = start
+	}
 }
 
 // BuildNode construct the node for the StatefulSet Resources
@@ -40,6 +62,5 @@ func (s StatefulSetResource) BuildNode() Node {
 
 // BuildEdges construct the edges for the StatefulSet Resources
 func (s StatefulSetResource) BuildEdges(ns NodeStore) []Edge {
-	//no op for now to implement interface
-	return []Edge{}
+	return imagePullSecretEdges(s.Spec.Template.Spec, s.node, ns)
 }
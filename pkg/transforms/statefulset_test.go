@@ -14,6 +14,7 @@ import (
 	"testing"
 
 	v1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 func TestTransformStatefulSet(t *testing.T) {
@@ -24,11 +25,30 @@ func TestTransformStatefulSet(t *testing.T) {
 	// Test only the fields that exist in stateful set - the common test will test the other bits
 	AssertEqual("current", node.Properties["current"], int64(1), t)
 	AssertEqual("desired", node.Properties["desired"], int64(1), t)
+	AssertDeepEqual("imagePullSecret", node.Properties["imagePullSecret"], []string{"registry-secret"}, t)
+	AssertEqual("ordinalsStart", node.Properties["ordinalsStart"], int64(0), t)
+}
+
+func TestStatefulSetOrdinalsStart(t *testing.T) {
+	var s v1.StatefulSet
+	var u unstructured.Unstructured
+	UnmarshalFile("statefulset.json", &s, t)
+	UnmarshalFile("statefulset.json", &u, t)
+	if err := unstructured.SetNestedField(u.Object, int64(5), "spec", "ordinals", "start"); err != nil {
+		t.Fatal(err)
+	}
+	statefulSet := StatefulSetResourceBuilder(&s)
+	statefulSet.addOrdinalsStart(u.Object)
+
+	AssertEqual("ordinalsStart", statefulSet.BuildNode().Properties["ordinalsStart"], int64(5), t)
 }
 
 func TestStatefulSetBuildEdges(t *testing.T) {
 	// Build a fake NodeStore with nodes needed to generate edges.
-	nodes := make([]Node, 0)
+	nodes := []Node{{
+		UID:        "uuid-123-secret",
+		Properties: map[string]interface{}{"kind": "Secret", "namespace": "default", "name": "registry-secret"},
+	}}
 	nodeStore := BuildFakeNodeStore(nodes)
 
 	// Build edges from mock resource statefulset.json
@@ -37,5 +57,6 @@ func TestStatefulSetBuildEdges(t *testing.T) {
 	edges := StatefulSetResourceBuilder(&ss).BuildEdges(nodeStore)
 
 	// Validate results
-	AssertEqual("StatefulSet has no edges:", len(edges), 0, t)
+	AssertEqual("StatefulSet edge total:", len(edges), 1, t)
+	AssertEqual("StatefulSet uses", edges[0].DestKind, "Secret", t)
 }
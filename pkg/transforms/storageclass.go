@@ -0,0 +1,69 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"regexp"
+
+	storage "k8s.io/api/storage/v1"
+)
+
+// StorageClassResource ...
+type StorageClassResource struct {
+	node Node
+}
+
+// Characters replaced in the parameter keys, like the dots and slashes of csi.storage.k8s.io/fstype.
+var storageClassParameterChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// Parameters that may hold or point to credentials aren't collected.
+var storageClassCredentialParameter = regexp.MustCompile(`(?i)secret|password|passwd|token|credential|key`)
+
+// StorageClassResourceBuilder ...
+func StorageClassResourceBuilder(s *storage.StorageClass) *StorageClassResource {
+	node := transformCommon(s)         // Start off with the common properties
+	apiGroupVersion(s.TypeMeta, &node) // add kind, apigroup and version
+	// Extract the properties specific to this type
+	node.Properties["provisioner"] = s.Provisioner
+	if s.ReclaimPolicy != nil {
+		node.Properties["reclaimPolicy"] = string(*s.ReclaimPolicy)
+	}
+	if s.VolumeBindingMode != nil {
+		node.Properties["volumeBindingMode"] = string(*s.VolumeBindingMode)
+	}
+	if s.AllowVolumeExpansion != nil {
+		node.Properties["allowVolumeExpansion"] = *s.AllowVolumeExpansion
+	}
+	if len(s.MountOptions) > 0 {
+		node.Properties["mountOptions"] = s.MountOptions
+	}
+	storageClassParameters(s.Parameters, node.Properties)
+
+	return &StorageClassResource{node: node}
+}
+
+// Adds the provisioner parameters as parameters.<key> properties, like the flattened properties of generic
+// resources. Keys are sanitized, and parameters that look like credentials are skipped.
+// Properties that already exist are never overwritten.
+func storageClassParameters(parameters map[string]string, properties map[string]interface{}) {
+	for key, value := range parameters {
+		if storageClassCredentialParameter.MatchString(key) {
+			continue
+		}
+		name := "parameters." + storageClassParameterChars.ReplaceAllString(key, "_")
+		if _, exists := properties[name]; !exists {
+			properties[name] = value
+		}
+	}
+}
+
+// BuildNode construct the node for the StorageClass Resources
+func (s StorageClassResource) BuildNode() Node {
+	return s.node
+}
+
+// BuildEdges construct the edges for the StorageClass Resources
+func (s StorageClassResource) BuildEdges(ns NodeStore) []Edge {
+	//no op for now to implement interface
+	return []Edge{}
+}
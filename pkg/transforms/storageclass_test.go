@@ -0,0 +1,36 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+
+	storage "k8s.io/api/storage/v1"
+)
+
+func TestTransformStorageClass(t *testing.T) {
+	var s storage.StorageClass
+	UnmarshalFile("storageclass.json", &s, t)
+	node := StorageClassResourceBuilder(&s).BuildNode()
+
+	// Test only the fields that exist in storage class - the common test will test the other bits
+	AssertEqual("provisioner", node.Properties["provisioner"], "ebs.csi.aws.com", t)
+	AssertEqual("reclaimPolicy", node.Properties["reclaimPolicy"], "Delete", t)
+	AssertEqual("volumeBindingMode", node.Properties["volumeBindingMode"], "WaitForFirstConsumer", t)
+	AssertEqual("allowVolumeExpansion", node.Properties["allowVolumeExpansion"], true, t)
+	AssertDeepEqual("mountOptions", node.Properties["mountOptions"], []string{"debug", "noatime"}, t)
+	AssertEqual("parameters.type", node.Properties["parameters.type"], "gp3", t)
+	AssertEqual("parameters.iops", node.Properties["parameters.iops"], "4000", t)
+	AssertEqual("parameters.encrypted", node.Properties["parameters.encrypted"], "true", t)
+	AssertEqual("sanitized key", node.Properties["parameters.csi_storage_k8s_io_fstype"], "ext4", t)
+	AssertEqual("secret", node.Properties["parameters.csi_storage_k8s_io_provisioner-secret-name"], nil, t)
+	AssertEqual("key", node.Properties["parameters.kmsKeyId"], nil, t)
+}
+
+func TestStorageClassBuildEdges(t *testing.T) {
+	var s storage.StorageClass
+	UnmarshalFile("storageclass.json", &s, t)
+	edges := StorageClassResourceBuilder(&s).BuildEdges(BuildFakeNodeStore([]Node{}))
+
+	AssertEqual("StorageClass has no edges:", len(edges), 0, t)
+}
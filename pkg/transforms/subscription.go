@@ -92,15 +92,19 @@ func (s SubscriptionResource) BuildEdges(ns NodeStore) []Edge {
 		EdgeType:  "to",
 		Kind:      s.node.Properties["kind"].(string),
 		Name:      s.node.Properties["name"].(string)}
-	channelMap := make(map[string]struct{})
 
-	// TODO: This will work only for subscription in hub cluster - confirm logic
-	// TODO: Connect subscription and channel in remote cluster as they might not be in the same namespace
+	// On a managed cluster, the channel of a propagated subscription is on the hub, so it gets a remote edge.
 	if len(s.Spec.Channel) > 0 {
 		for _, channel := range strings.Split(s.Spec.Channel, ",") {
-			channelMap[channel] = struct{}{}
+			edges := edgesByDestinationName(map[string]struct{}{channel: {}}, "Channel", nodeInfo, ns, []string{})
+			if len(edges) == 0 {
+				namespace, name := splitNamespacedName(channel, nodeInfo.NameSpace)
+				if edge, ok := remoteEdge(nodeInfo, "Channel", namespace, name); ok {
+					edges = append(edges, edge)
+				}
+			}
+			ret = append(ret, edges...)
 		}
-		ret = append(ret, edgesByDestinationName(channelMap, "Channel", nodeInfo, ns, []string{})...)
 	}
 	// refersTo edges
 	// Builds edges between subscription and placement rules
@@ -108,7 +112,25 @@ func (s SubscriptionResource) BuildEdges(ns NodeStore) []Edge {
 		nodeInfo.EdgeType = "refersTo"
 		placementRuleMap := make(map[string]struct{})
 		placementRuleMap[s.Spec.Placement.PlacementRef.Name] = struct{}{}
-		ret = append(ret, edgesByDestinationName(placementRuleMap, "PlacementRule", nodeInfo, ns, []string{})...)
+		edges := edgesByDestinationName(placementRuleMap, "PlacementRule", nodeInfo, ns, []string{})
+		if len(edges) == 0 {
+			if edge, ok := remoteEdge(nodeInfo, "PlacementRule", nodeInfo.NameSpace,
+				s.Spec.Placement.PlacementRef.Name); ok {
+				edges = append(edges, edge)
+			}
+		}
+		ret = append(ret, edges...)
+	}
+	// deployedBy edge to the hub subscription a subscription was propagated from. The common edges link the
+	// subscriptions found here.
+	if hosting, ok := s.node.Properties["_hostingSubscription"].(string); ok && hosting != "" {
+		namespace, name := splitNamespacedName(hosting, nodeInfo.NameSpace)
+		if _, found := ns.ByKindNamespaceName["Subscription"][namespace][name]; !found {
+			nodeInfo.EdgeType = "deployedBy"
+			if edge, ok := remoteEdge(nodeInfo, "Subscription", namespace, name); ok {
+				ret = append(ret, edge)
+			}
+		}
 	}
 	//subscribesTo edges
 	if len(s.annotations["apps.open-cluster-management.io/deployables"]) > 0 {
@@ -13,6 +13,7 @@ package transforms
 import (
 	"testing"
 
+	"github.com/stolostron/search-collector/pkg/config"
 	v1 "open-cluster-management.io/multicloud-operators-subscription/pkg/apis/apps/v1"
 )
 
@@ -48,3 +49,38 @@ func TestTransformSubscriptionWithLocalPlacement(t *testing.T) {
 	// Test optional fields that exist in subscription - the common test will test the other bits
 	AssertEqual("localPlacement", node.Properties["localPlacement"], true, t)
 }
+
+func TestSubscriptionBuildEdgesRemote(t *testing.T) {
+	var s v1.Subscription
+	UnmarshalFile("subscription.json", &s, t)
+	s.Annotations["apps.open-cluster-management.io/hosting-subscription"] = "hubNs/test-subscription"
+	subscription := SubscriptionResourceBuilder(&s)
+	nodeStore := BuildFakeNodeStore([]Node{subscription.BuildNode()})
+
+	// Without REMOTE_EDGES_CLUSTER, the resources that aren't collected don't get edges.
+	AssertEqual("edges", len(subscription.BuildEdges(nodeStore)), 0, t)
+
+	config.Cfg.RemoteEdgesCluster = "hub"
+	defer func() { config.Cfg.RemoteEdgesCluster = "" }()
+	edges := subscription.BuildEdges(nodeStore)
+	AssertEqual("edges", len(edges), 3, t)
+
+	AssertEqual("channel type", string(edges[0].EdgeType), "to", t)
+	AssertEqual("channel", edges[0].DestUID, "hub/Channel/testNs/test-channel", t)
+	AssertDeepEqual("channel properties", edges[0].Properties, map[string]interface{}{
+		"remoteCluster": "hub", "remoteNamespace": "testNs", "remoteName": "test-channel"}, t)
+	AssertEqual("remote", IsRemoteEdge(edges[0]), true, t)
+
+	AssertEqual("placement type", string(edges[1].EdgeType), "refersTo", t)
+	AssertEqual("placement", edges[1].DestUID, "hub/PlacementRule/"+s.Namespace+"/test-placementrule", t)
+
+	AssertEqual("hosting type", string(edges[2].EdgeType), "deployedBy", t)
+	AssertEqual("hosting", edges[2].DestUID, "hub/Subscription/hubNs/test-subscription", t)
+
+	// The channel collected here gets a local edge.
+	channel := Node{UID: "local-cluster/uuid-channel", Properties: map[string]interface{}{
+		"kind": "Channel", "namespace": "testNs", "name": "test-channel"}}
+	edges = subscription.BuildEdges(BuildFakeNodeStore([]Node{subscription.BuildNode(), channel}))
+	AssertEqual("local channel", edges[0].DestUID, channel.UID, t)
+	AssertEqual("remote", IsRemoteEdge(edges[0]), false, t)
+}
@@ -0,0 +1,67 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+// SummaryKind is the kind of the summary nodes, so they aren't listed with the resources of the summarized kind.
+// The nodes also have the _synthetic property, because they don't exist as resources on the kube API server.
+const SummaryKind = "ResourceSummary"
+
+// Properties copied to the summary nodes. The identity of the resource plus the status fields used when listing.
+var summaryProperties = []string{
+	"name", "namespace", "created", "_clusterNamespace", "_hubClusterResource", "status", "ready", "available",
+	"current", "desired", "_ready",
+}
+
+// Builds the lightweight summary node of a resource. The detailed node keeps the resource's UID and its edges,
+// the summary gets the same UID with a /summary suffix and points back to it with _detailUID. The kind and api
+// group of the resource are in _detailKind and _detailApigroup.
+func summaryNode(detail Node) Node {
+	properties := make(map[string]interface{}, len(summaryProperties)+7)
+	for _, name := range summaryProperties {
+		if value, ok := detail.Properties[name]; ok {
+			properties[name] = value
+		}
+	}
+	properties["kind"] = SummaryKind
+	properties["kind_plural"] = "resourcesummaries"
+	properties["_detailKind"] = detail.Properties["kind"]
+	if apigroup, ok := detail.Properties["apigroup"]; ok {
+		properties["_detailApigroup"] = apigroup
+	}
+	properties["_summary"] = true
+	properties["_synthetic"] = true
+	properties["_detailUID"] = detail.UID
+	return Node{
+		UID:            detail.UID + "/summary",
+		ResourceString: "resourcesummaries",
+		Properties:     properties,
+		Metadata:       map[string]string{},
+	}
+}
+
+// The properties holding the UID of the node a dependent node was emitted along with.
+var dependentNodeProperties = []string{"_podUID", "_detailUID", "_involvedObjectUID", "_releaseStorageUID"}
+
+// IsDependentNode returns true if the node was emitted along with the node with the given UID, like its container,
+// summary, coalesced event or Helm release nodes. Dependent nodes don't have their own informer, so they're deleted
+// with that node.
+func IsDependentNode(node Node, uid string) bool {
+	for _, parent := range DependentNodeParents(node) {
+		if parent == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// DependentNodeParents returns the UIDs of the nodes the node was emitted along with, nil if it isn't a dependent
+// node.
+func DependentNodeParents(node Node) []string {
+	var parents []string
+	for _, name := range dependentNodeProperties {
+		if uid, ok := node.Properties[name].(string); ok && uid != "" {
+			parents = append(parents, uid)
+		}
+	}
+	return parents
+}
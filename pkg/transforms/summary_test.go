@@ -0,0 +1,54 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSummaryNode(t *testing.T) {
+	var p v1.Pod
+	UnmarshalFile("pod.json", &p, t)
+	detail := PodResourceBuilder(&p).BuildNode()
+
+	summary := summaryNode(detail)
+	AssertEqual("UID", summary.UID, detail.UID+"/summary", t)
+	AssertEqual("_detailUID", summary.Properties["_detailUID"], detail.UID, t)
+	AssertEqual("_summary", summary.Properties["_summary"], true, t)
+	AssertEqual("kind", summary.Properties["kind"], SummaryKind, t)
+	AssertEqual("_detailKind", summary.Properties["_detailKind"], "Pod", t)
+	AssertEqual("_synthetic", summary.Properties["_synthetic"], true, t)
+	AssertEqual("name", summary.Properties["name"], "fake-pod-dqqkm", t)
+	AssertEqual("namespace", summary.Properties["namespace"], "default", t)
+	AssertEqual("status", summary.Properties["status"], "Running", t)
+	AssertEqual("hostIP", summary.Properties["hostIP"], nil, t)
+
+	AssertEqual("dependent", IsDependentNode(summary, detail.UID), true, t)
+	AssertEqual("dependent", IsDependentNode(detail, detail.UID), false, t)
+	AssertDeepEqual("parents", DependentNodeParents(summary), []string{detail.UID}, t)
+	AssertDeepEqual("parents", DependentNodeParents(detail), []string(nil), t)
+}
+
+func TestTransformRoutineSummaryNodes(t *testing.T) {
+	config.Cfg.SummaryNodes = true
+	defer func() { config.Cfg.SummaryNodes = false }()
+
+	input := make(chan *Event)
+	output := make(chan NodeEvent)
+	go TransformRoutine(input, output)
+
+	var u unstructured.Unstructured
+	UnmarshalFile("pod.json", &u, t)
+	input <- &Event{Time: time.Now().Unix(), Operation: Update, Resource: &u, ResourceString: "pods"}
+
+	detail := <-output
+	summary := <-output
+	AssertEqual("_detailUID", summary.Properties["_detailUID"], detail.UID, t)
+	AssertEqual("kind_plural", summary.Properties["kind_plural"], "resourcesummaries", t)
+	AssertEqual("Operation", summary.Operation, Update, t)
+}
@@ -0,0 +1,177 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/stolostron/search-collector/pkg/config"
+)
+
+// SyncManifestKind is the kind of the synthetic node the transformer emits at the end of the initial sync.
+// It has the count and a checksum of the nodes emitted during the sync, so consumers can detect dropped nodes.
+const SyncManifestKind = "CollectorSyncManifest"
+
+// Tracks the UIDs of the nodes emitted during the initial sync.
+type syncManifest struct {
+	inFlight sync.RWMutex // Held for reading while an event is transformed, SyncComplete waits for those events
+	mutex    sync.Mutex
+	syncing  bool
+	uids     map[string]struct{}
+}
+
+func newSyncManifest() *syncManifest {
+	return &syncManifest{syncing: true, uids: make(map[string]struct{})}
+}
+
+// Transforms the event, recording its nodes if the initial sync isn't complete. A nil manifest doesn't record.
+func (m *syncManifest) transform(event *Event, output chan NodeEvent, throttle *kindThrottle) error {
+	if m == nil {
+		return transformEvent(event, output, nil, throttle)
+	}
+	m.inFlight.RLock()
+	defer m.inFlight.RUnlock() // The routine may panic, see handleRoutineExit
+	return transformEvent(event, output, m, throttle)
+}
+
+// Records the UID of a node emitted during the initial sync. Nodes emitted more than once are counted once, the
+// consumers only see the latest version.
+func (m *syncManifest) record(uid string) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.syncing {
+		m.uids[uid] = struct{}{}
+	}
+}
+
+// Interval at which SyncComplete checks whether the events passed in are done.
+const syncIdlePollInterval = 10 * time.Millisecond
+
+// Ends the initial sync, once idle returns true and the events being transformed are done. Returns the number of
+// nodes emitted during the sync and their checksum, or false if the sync was already complete.
+func (m *syncManifest) complete(idle func() bool) (count int, checksum uint64, ok bool) {
+	if m == nil || !m.isSyncing() {
+		return 0, 0, false
+	}
+	waitIdle(&m.inFlight, idle)
+	defer m.inFlight.Unlock()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.syncing {
+		return 0, 0, false
+	}
+	uids := make([]string, 0, len(m.uids))
+	for uid := range m.uids {
+		uids = append(uids, uid)
+	}
+	count, checksum = len(uids), uidsChecksum(uids)
+	m.syncing = false
+	m.uids = nil
+	return count, checksum, true
+}
+
+// Waits until idle returns true and the events being transformed, holding inFlight for reading, are done. Returns
+// with inFlight locked. The events being transformed can pass more nodes into the buffers, so idle is checked again
+// once they're done.
+func waitIdle(inFlight *sync.RWMutex, idle func() bool) {
+	for {
+		for !idle() {
+			time.Sleep(syncIdlePollInterval)
+		}
+		inFlight.Lock()
+		if idle() {
+			return
+		}
+		inFlight.Unlock()
+	}
+}
+
+func (m *syncManifest) isSyncing() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.syncing
+}
+
+// Returns the sum, modulo 2^64, of the FNV-1a 64-bit hash of each UID. The sum doesn't depend on the order the
+// nodes were emitted, which isn't defined with several routines.
+func uidsChecksum(uids []string) (checksum uint64) {
+	for _, uid := range uids {
+		checksum += uidChecksum(uid)
+	}
+	return checksum
+}
+
+// Returns the FNV-1a 64-bit hash of the UID.
+func uidChecksum(uid string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(uid)) // Never returns an error
+	return h.Sum64()
+}
+
+// Builds the sync manifest node.
+func syncManifestNode(count int, checksum uint64, now time.Time) Node {
+	return Node{
+		UID:            PrefixedUID(SyncManifestKind, "search-collector-sync-manifest"),
+		ResourceString: "collectorsyncmanifests",
+		Properties: map[string]interface{}{
+			"kind":              SyncManifestKind,
+			"kind_plural":       "collectorsyncmanifests",
+			"name":              "search-collector-sync-manifest",
+			"_clusterNamespace": config.Cfg.ClusterNamespace,
+			"_synthetic":        true,
+			"nodeCount":         int64(count),
+			"checksum":          fmt.Sprintf("%016x", checksum),
+			"_syncCompleted":    now.UTC().Format(time.RFC3339),
+		},
+		Metadata: map[string]string{},
+	}
+}
+
+// RecountSyncManifest returns a copy of the sync manifest node with the count and checksum of the given UIDs, for
+// a consumer of the transformer that drops some of the nodes, like the reconciler.
+func RecountSyncManifest(manifest Node, uids []string) Node {
+	properties := make(map[string]interface{}, len(manifest.Properties))
+	for key, value := range manifest.Properties {
+		properties[key] = value
+	}
+	properties["nodeCount"] = int64(len(uids))
+	properties["checksum"] = fmt.Sprintf("%016x", uidsChecksum(uids))
+	manifest.Properties = properties
+	return manifest
+}
+
+// SyncComplete tells the transformer the events of the initial sync were passed in. It waits until the events
+// left in Input or in the worker pools are transformed, and the nodes held back by the rate limits are passed on,
+// then emits the sync manifest node on Output, or CreateOutput when the output is split.
+// Only the first call emits the node, and only when SYNC_MANIFEST is enabled. The node is dropped once the
+// transformer is stopped.
+func (t Transformer) SyncComplete() {
+	count, checksum, ok := t.manifest.complete(t.idle)
+	if !ok {
+		return
+	}
+	glog.Infof("Initial sync complete, emitting the manifest of %d nodes", count)
+	now := time.Now()
+	t.emit(NodeEvent{
+		Node:         syncManifestNode(count, checksum, now),
+		ComputeEdges: func(ns NodeStore) []Edge { return []Edge{} },
+		Time:         now.Unix(),
+		Operation:    Create,
+	})
+}
+
+// Returns true when there are no events left in Input, waiting in a worker pool or waiting for a retry, and no nodes
+// held back by the rate limits. An event is still counted in its pool while it's transformed. A stopped transformer
+// is idle, the events left are dropped.
+func (t Transformer) idle() bool {
+	return isStopped(t.stopper) || len(t.Input) == 0 && atomic.LoadInt64(t.pooled) == 0 && t.pending.len() == 0 &&
+		t.throttle.idle()
+}
@@ -0,0 +1,97 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-collector/pkg/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSyncComplete(t *testing.T) {
+	config.Cfg.SyncManifest = true
+	defer func() { config.Cfg.SyncManifest = false }()
+	input := make(chan *Event)
+	output := make(chan NodeEvent)
+	transformer := NewTransformer(input, output, 2)
+	defer transformer.Stop()
+
+	var p unstructured.Unstructured
+	UnmarshalFile("pod.json", &p, t)
+	var d unstructured.Unstructured
+	UnmarshalFile("deployment.json", &d, t)
+	// The pod is updated during the sync, it's only counted once.
+	for _, e := range []*Event{
+		{Operation: Create, Resource: &p, ResourceString: "pods"},
+		{Operation: Create, Resource: &d, ResourceString: "deployments"},
+		{Operation: Update, Resource: &p, ResourceString: "pods"},
+	} {
+		input <- e
+		<-output
+	}
+
+	go transformer.SyncComplete()
+	manifest := <-output
+	podUID, deploymentUID := PrefixedUID("Pod", p.GetUID()), PrefixedUID("Deployment", d.GetUID())
+	AssertEqual("kind", manifest.Properties["kind"], SyncManifestKind, t)
+	AssertEqual("_synthetic", manifest.Properties["_synthetic"], true, t)
+	AssertEqual("nodeCount", manifest.Properties["nodeCount"], int64(2), t)
+	AssertEqual("checksum", manifest.Properties["checksum"],
+		fmt.Sprintf("%016x", uidChecksum(podUID)+uidChecksum(deploymentUID)), t)
+
+	// The manifest is only emitted once.
+	transformer.SyncComplete()
+	input <- &Event{Operation: Update, Resource: &p, ResourceString: "pods"}
+	AssertEqual("after the sync", (<-output).UID, podUID, t)
+}
+
+func TestSyncCompleteWaitsForPools(t *testing.T) {
+	config.Cfg.SyncManifest = true
+	config.Cfg.KindWorkerPools = map[string]string{"Pod": "1"}
+	defer func() {
+		config.Cfg.SyncManifest = false
+		config.Cfg.KindWorkerPools = nil
+	}()
+	input := make(chan *Event)
+	output := make(chan NodeEvent)
+	transformer := NewTransformer(input, output, 1)
+	defer transformer.Stop()
+
+	var p unstructured.Unstructured
+	UnmarshalFile("pod.json", &p, t)
+	other := p.DeepCopy()
+	other.SetUID("other-pod-uid")
+	// The routine of the pool waits on the output with the first pod, the second pod waits in the pool.
+	input <- &Event{Operation: Create, Resource: &p, ResourceString: "pods"}
+	input <- &Event{Operation: Create, Resource: other, ResourceString: "pods"}
+
+	go transformer.SyncComplete()
+	time.Sleep(50 * time.Millisecond) // SyncComplete waits for the pool, not only for the first pod
+	for _, uid := range []string{PrefixedUID("Pod", p.GetUID()), PrefixedUID("Pod", other.GetUID())} {
+		AssertEqual("pod before the manifest", (<-output).UID, uid, t)
+	}
+	manifest := <-output
+	AssertEqual("kind", manifest.Properties["kind"], SyncManifestKind, t)
+	AssertEqual("nodeCount", manifest.Properties["nodeCount"], int64(2), t)
+}
+
+func TestRecountSyncManifest(t *testing.T) {
+	manifest := syncManifestNode(3, 0, time.Now())
+	recounted := RecountSyncManifest(manifest, []string{"uid-1", "uid-2"})
+
+	AssertEqual("nodeCount", recounted.Properties["nodeCount"], int64(2), t)
+	AssertEqual("checksum", recounted.Properties["checksum"],
+		fmt.Sprintf("%016x", uidChecksum("uid-1")+uidChecksum("uid-2")), t)
+	AssertEqual("manifest unchanged", manifest.Properties["nodeCount"], int64(3), t)
+}
+
+func TestSyncCompleteDisabled(t *testing.T) {
+	output := make(chan NodeEvent)
+	transformer := NewTransformer(make(chan *Event), output, 1)
+	defer transformer.Stop()
+
+	transformer.SyncComplete() // Would block if the manifest was emitted, nothing reads the output
+}
@@ -21,7 +21,7 @@ import (
 )
 
 // UnmarshalFile takes a file path and unmarshals it into the given resource type.
-func UnmarshalFile(filepath string, resourceType interface{}, t *testing.T) {
+func UnmarshalFile(filepath string, resourceType interface{}, t testing.TB) {
 	// open given filepath string
 	rawBytes, err := ioutil.ReadFile("../../test-data/" + sanitize.Name(filepath))
 	if err != nil {
@@ -66,8 +66,12 @@ func BuildFakeNodeStore(nodes []Node) NodeStore {
 			namespace = n.Properties["namespace"].(string)
 		}
 
-		byKindNameNamespace[kind] = make(map[string]map[string]Node)
-		byKindNameNamespace[kind][namespace] = make(map[string]Node)
+		if _, ok := byKindNameNamespace[kind]; !ok {
+			byKindNameNamespace[kind] = make(map[string]map[string]Node)
+		}
+		if _, ok := byKindNameNamespace[kind][namespace]; !ok {
+			byKindNameNamespace[kind][namespace] = make(map[string]Node)
+		}
 		byKindNameNamespace[kind][namespace][n.Properties["name"].(string)] = n
 	}
 
@@ -0,0 +1,192 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/time/rate"
+)
+
+// Holds back the nodes of the kinds with a rate limit, so a burst of one kind doesn't overload the downstream.
+// Each kind has a buffer of one second of nodes, emptied into the output at the kind's rate. The nodes that don't
+// fit in the buffer are dropped, the routines never wait for a rate limited kind.
+type kindThrottle struct {
+	held     int64 // Nodes passed into a buffer and not into the output or dropped yet
+	buffers  map[string]chan NodeEvent
+	limiters map[string]*rate.Limiter
+	manifest *syncManifest // Records the buffered nodes once they're emitted, nil unless SYNC_MANIFEST is enabled
+
+	// Held while a buffered node or a delete of a limited kind is passed into the output, so a node buffered before
+	// the delete of its resource isn't passed on after it.
+	mutex    sync.Mutex
+	buffered map[string]int // Number of nodes of each UID in the buffers
+	stale    map[string]int // Number of the buffered nodes of each UID superseded by a delete, dropped when dequeued
+}
+
+// Returns the throttle of the kinds with a rate limit. The buffered nodes are recorded in the manifest, if not nil,
+// once they're emitted.
+func newKindThrottle(limits map[string]int, manifest *syncManifest) *kindThrottle {
+	throttle := &kindThrottle{
+		buffers:  make(map[string]chan NodeEvent, len(limits)),
+		limiters: make(map[string]*rate.Limiter, len(limits)),
+		manifest: manifest,
+		buffered: make(map[string]int),
+		stale:    make(map[string]int),
+	}
+	for kind, limit := range limits {
+		throttle.buffers[kind] = make(chan NodeEvent, limit)
+		throttle.limiters[kind] = rate.NewLimiter(rate.Limit(limit), limit)
+	}
+	return throttle
+}
+
+// Parses the max number of nodes per second of each kind. Kinds with an invalid limit aren't limited.
+func kindRateLimits(limits map[string]string) map[string]int {
+	parsed := make(map[string]int, len(limits))
+	for kind, value := range limits {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			glog.Warningf("%s is an invalid rate limit for kind %s. Not limiting it.", value, kind)
+			continue
+		}
+		parsed[kind] = limit
+	}
+	return parsed
+}
+
+// Passes the node into the output, or into the buffer of its kind if it's rate limited. Returns false if the node
+// was buffered, it's recorded in the manifest once it's emitted, or if the buffer is full and it was dropped.
+// Deletes are never held back or dropped, a dropped delete would leave the node behind. The nodes of the resource
+// still in the buffer are dropped instead. A nil throttle passes every node into the output.
+func (k *kindThrottle) emit(ne NodeEvent, output chan NodeEvent) bool {
+	kind, _ := ne.Properties["kind"].(string)
+	buffer, ok := k.buffer(kind)
+	if !ok {
+		output <- ne
+		return true
+	}
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if ne.Operation == Delete {
+		if k.buffered[ne.UID] > 0 {
+			k.stale[ne.UID] = k.buffered[ne.UID]
+		}
+		output <- ne
+		return true
+	}
+	atomic.AddInt64(&k.held, 1)
+	select {
+	case buffer <- ne:
+		k.buffered[ne.UID]++
+	default:
+		atomic.AddInt64(&k.held, -1)
+		glog.V(3).Infof("Dropping node %s, kind %s is over its rate limit", ne.UID, kind)
+		throttledNodes.WithLabelValues(kind).Inc()
+	}
+	return false
+}
+
+func (k *kindThrottle) buffer(kind string) (chan NodeEvent, bool) {
+	if k == nil {
+		return nil, false
+	}
+	buffer, ok := k.buffers[kind]
+	return buffer, ok
+}
+
+// Returns true when no node is held back. A nil throttle never holds nodes back.
+func (k *kindThrottle) idle() bool {
+	return k == nil || atomic.LoadInt64(&k.held) == 0
+}
+
+// Passes the nodes of the kind's buffer into the output at the kind's rate, until the stopper is closed. The nodes
+// passed on are recorded in the manifest. The nodes superseded by a delete are skipped, and the nodes left in the
+// buffer are dropped when the transformer stops.
+func (k *kindThrottle) emitBuffered(kind string, output chan NodeEvent, stopper chan struct{}) {
+	buffer, limiter := k.buffers[kind], k.limiters[kind]
+	for {
+		var ne NodeEvent
+		select {
+		case <-stopper:
+			k.dropBuffered(kind, nil)
+			return
+		case ne = <-buffer:
+		}
+		wait := time.NewTimer(limiter.Reserve().Delay())
+		select {
+		case <-wait.C:
+		case <-stopper:
+			wait.Stop()
+			k.dropBuffered(kind, &ne)
+			return
+		}
+		if !k.emitDequeued(ne, output, stopper) {
+			k.dropBuffered(kind, &ne)
+			return
+		}
+	}
+}
+
+// Passes the node taken out of the buffer into the output, unless a delete superseded it. Returns false if the
+// stopper was closed first.
+func (k *kindThrottle) emitDequeued(ne NodeEvent, output chan NodeEvent, stopper chan struct{}) bool {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if k.stale[ne.UID] > 0 {
+		k.uncount(ne.UID)
+		k.stale[ne.UID]--
+		if k.stale[ne.UID] == 0 {
+			delete(k.stale, ne.UID)
+		}
+		glog.V(5).Infof("Skipping node %s, its resource was deleted while it was rate limited", ne.UID)
+		return true
+	}
+	select {
+	case output <- ne:
+		k.uncount(ne.UID)
+		k.manifest.record(ne.UID)
+		countTransformedNode(ne)
+		return true
+	case <-stopper:
+		return false
+	}
+}
+
+// Drops the node taken out of the buffer, if not nil, and the nodes left in the buffer when the transformer stops.
+func (k *kindThrottle) dropBuffered(kind string, taken *NodeEvent) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	dropped := 0
+	if taken != nil {
+		k.uncount(taken.UID)
+		dropped++
+	}
+	for empty := false; !empty; {
+		select {
+		case ne := <-k.buffers[kind]:
+			k.uncount(ne.UID)
+			dropped++
+		default:
+			empty = true
+		}
+	}
+	if dropped > 0 {
+		glog.V(2).Infof("Dropping %d nodes of kind %s held back by its rate limit, the transformer stopped",
+			dropped, kind)
+		throttledNodes.WithLabelValues(kind).Add(float64(dropped))
+	}
+}
+
+// Uncounts a node of the UID no longer in the buffers. Mutex must be held.
+func (k *kindThrottle) uncount(uid string) {
+	atomic.AddInt64(&k.held, -1)
+	k.buffered[uid]--
+	if k.buffered[uid] <= 0 {
+		delete(k.buffered, uid)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stolostron/search-collector/pkg/config"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func throttleTestNode(uid, kind string, operation Operation) NodeEvent {
+	return NodeEvent{Node: Node{UID: uid, Properties: map[string]interface{}{"kind": kind}}, Operation: operation}
+}
+
+func TestKindRateLimits(t *testing.T) {
+	limits := kindRateLimits(map[string]string{"Event": "50", "Pod": "none", "Secret": "0"})
+
+	AssertDeepEqual("limits", limits, map[string]int{"Event": 50}, t)
+}
+
+func TestKindThrottleEmit(t *testing.T) {
+	throttle := newKindThrottle(map[string]int{"Event": 2}, nil)
+	output := make(chan NodeEvent, 10)
+	dropped := testutil.ToFloat64(throttledNodes.WithLabelValues("Event"))
+
+	// The nodes of a limited kind are buffered, or dropped when the buffer is full.
+	for _, uid := range []string{"event-1", "event-2", "event-3"} {
+		AssertEqual(uid+" emitted", throttle.emit(throttleTestNode(uid, "Event", Create), output), false, t)
+	}
+	AssertEqual("buffered events", len(throttle.buffers["Event"]), 2, t)
+	AssertEqual("idle", throttle.idle(), false, t)
+	AssertEqual("dropped events", testutil.ToFloat64(throttledNodes.WithLabelValues("Event")), dropped+1, t)
+
+	// Deletes and the kinds without a limit go straight to the output.
+	AssertEqual("delete emitted", throttle.emit(throttleTestNode("event-1", "Event", Delete), output), true, t)
+	AssertEqual("pod emitted", throttle.emit(throttleTestNode("pod-1", "Pod", Create), output), true, t)
+	AssertEqual("output", len(output), 2, t)
+	AssertEqual("first output", (<-output).UID, "event-1", t)
+	AssertEqual("second output", (<-output).UID, "pod-1", t)
+	AssertDeepEqual("stale", throttle.stale, map[string]int{"event-1": 1}, t)
+}
+
+func TestKindThrottleNil(t *testing.T) {
+	var throttle *kindThrottle
+	output := make(chan NodeEvent, 1)
+
+	AssertEqual("emitted", throttle.emit(throttleTestNode("event-1", "Event", Create), output), true, t)
+	AssertEqual("output", (<-output).UID, "event-1", t)
+}
+
+func TestKindThrottleEmitBuffered(t *testing.T) {
+	manifest := newSyncManifest()
+	recorded := func() int {
+		manifest.mutex.Lock()
+		defer manifest.mutex.Unlock()
+		return len(manifest.uids)
+	}
+	throttle := newKindThrottle(map[string]int{"Event": 3}, manifest)
+	throttle.limiters["Event"] = rate.NewLimiter(rate.Every(50*time.Millisecond), 1)
+	output := make(chan NodeEvent)
+	stopper := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		throttle.emitBuffered("Event", output, stopper)
+		close(done)
+	}()
+
+	start := time.Now()
+	for _, uid := range []string{"event-1", "event-2", "event-3"} {
+		throttle.emit(throttleTestNode(uid, "Event", Create), output)
+	}
+	AssertEqual("recorded before emitted", recorded(), 0, t)
+	for _, uid := range []string{"event-1", "event-2", "event-3"} {
+		AssertEqual("output", (<-output).UID, uid, t)
+	}
+	// The first node uses the burst, the next two wait for the limiter.
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected the nodes to be paced by the limiter, they took %v", elapsed)
+	}
+	// The node is recorded once it's passed on, wait for the last one.
+	for deadline := time.Now().Add(time.Second); !throttle.idle() && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	AssertEqual("recorded", recorded(), 3, t)
+	AssertEqual("idle", throttle.idle(), true, t)
+
+	close(stopper)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected emitBuffered to return when stopped")
+	}
+}
+
+func TestKindThrottleDeleteSupersedesBuffered(t *testing.T) {
+	throttle := newKindThrottle(map[string]int{"Event": 3}, nil)
+	throttle.limiters["Event"] = rate.NewLimiter(rate.Every(time.Hour), 1)
+	output := make(chan NodeEvent, 10)
+	stopper := make(chan struct{})
+	defer close(stopper)
+
+	// The burst is used up, the next nodes wait in the buffer.
+	throttle.limiters["Event"].Allow()
+	throttle.emit(throttleTestNode("event-1", "Event", Create), output)
+	throttle.emit(throttleTestNode("event-2", "Event", Create), output)
+	throttle.emit(throttleTestNode("event-1", "Event", Delete), output)
+	throttle.limiters["Event"].SetLimit(rate.Inf)
+	go throttle.emitBuffered("Event", output, stopper)
+
+	// The update of event-1 buffered before its delete isn't passed on after it.
+	AssertEqual("delete", (<-output).Operation, Delete, t)
+	ne := <-output
+	AssertEqual("next output", ne.UID, "event-2", t)
+	select {
+	case ne := <-output:
+		t.Fatalf("Expected the node of the deleted resource to be dropped, got %s", ne.UID)
+	case <-time.After(50 * time.Millisecond):
+	}
+	AssertEqual("idle", throttle.idle(), true, t)
+}
+
+func TestKindThrottleStopDropsBuffered(t *testing.T) {
+	throttle := newKindThrottle(map[string]int{"Event": 3}, nil)
+	throttle.limiters["Event"] = rate.NewLimiter(rate.Every(time.Hour), 1)
+	throttle.limiters["Event"].Allow()
+	output := make(chan NodeEvent)
+	stopper := make(chan struct{})
+	dropped := testutil.ToFloat64(throttledNodes.WithLabelValues("Event"))
+	for _, uid := range []string{"event-1", "event-2", "event-3"} {
+		throttle.emit(throttleTestNode(uid, "Event", Create), output)
+	}
+	done := make(chan struct{})
+	go func() {
+		throttle.emitBuffered("Event", output, stopper)
+		close(done)
+	}()
+
+	close(stopper)
+	<-done
+	AssertEqual("dropped events", testutil.ToFloat64(throttledNodes.WithLabelValues("Event")), dropped+3, t)
+	AssertEqual("idle", throttle.idle(), true, t)
+	AssertEqual("buffered", len(throttle.buffered), 0, t)
+}
+
+func TestTransformerKindRateLimits(t *testing.T) {
+	defer func(limits map[string]string) { config.Cfg.KindRateLimits = limits }(config.Cfg.KindRateLimits)
+	config.Cfg.KindRateLimits = map[string]string{"Pod": "1"}
+	dropped := testutil.ToFloat64(throttledNodes.WithLabelValues("Pod"))
+
+	input := make(chan *Event)
+	output := make(chan NodeEvent, 10)
+	transformer := NewTransformer(input, output, 1)
+	defer transformer.Stop()
+
+	var p unstructured.Unstructured
+	UnmarshalFile("pod.json", &p, t)
+	// One pod per second is sent, one waits for the limiter and one is buffered. The other updates are dropped.
+	for i := 0; i < 5; i++ {
+		input <- &Event{Resource: &p, ResourceString: "pods", Operation: Update}
+	}
+	input <- &Event{Resource: &p, ResourceString: "pods", Operation: Delete}
+
+	// The delete isn't held back by the pods in the buffer.
+	for deleted := false; !deleted; {
+		select {
+		case ne := <-output:
+			deleted = ne.Operation == Delete
+		case <-time.After(500 * time.Millisecond):
+			t.Fatal("Expected the delete to be sent without waiting for the rate limit")
+		}
+	}
+	if droppedPods := testutil.ToFloat64(throttledNodes.WithLabelValues("Pod")) - dropped; droppedPods < 2 {
+		t.Errorf("Expected at least 2 pods to be dropped, got %v", droppedPods)
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package transforms
+
+import (
+	"strings"
+	"sync"
+
+	ocpapp "github.com/openshift/api/apps/v1"
+	policy "github.com/stolostron/governance-policy-propagator/api/v1"
+	klusterletaddon "github.com/stolostron/klusterlet-addon-controller/pkg/apis/agent/v1"
+	appDeployable "github.com/stolostron/multicloud-operators-deployable/pkg/apis/apps/v1"
+	rule "github.com/stolostron/multicloud-operators-placementrule/pkg/apis/apps/v1"
+	"github.com/stolostron/search-collector/pkg/config"
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	batchBeta "k8s.io/api/batch/v1beta1"
+	core "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	storage "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	acmapp "open-cluster-management.io/multicloud-operators-channel/pkg/apis/apps/v1"
+	appHelmRelease "open-cluster-management.io/multicloud-operators-subscription/pkg/apis/apps/helmrelease/v1"
+	subscription "open-cluster-management.io/multicloud-operators-subscription/pkg/apis/apps/v1"
+	application "sigs.k8s.io/application/api/v1beta1"
+)
+
+// Builds the transform of a resource, and the synthetic nodes emitted along with its node.
+type transformBuilder func(r *unstructured.Unstructured) (Transform, []Node)
+
+// The transform builders keyed by kind and api group. Built once, so the transformer routines find the builder
+// of each resource with a single lookup. Resources without a builder use the GenericResourceBuilder.
+// Might have to add more builders if resources like DaemonSet, StatefulSet etc. have other apigroups.
+var transformBuilders = map[[2]string]transformBuilder{
+	{"Application", "app.k8s.io"}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := application.Application{}
+		fromUnstructured(r, &typedResource)
+		return ApplicationResourceBuilder(&typedResource), nil
+	},
+	{"Application", "argoproj.io"}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := ArgoApplication{}
+		fromUnstructured(r, &typedResource)
+		return ArgoApplicationResourceBuilder(&typedResource), nil
+	},
+	{"Channel", APPS_OPEN_CLUSTER_MANAGEMENT_IO}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := acmapp.Channel{}
+		fromUnstructured(r, &typedResource)
+		return ChannelResourceBuilder(&typedResource), nil
+	},
+	{"ConfigMap", ""}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := core.ConfigMap{}
+		fromUnstructured(r, &typedResource)
+		configMap := ConfigMapResourceBuilder(&typedResource)
+		return configMap, configMap.release.nodes()
+	},
+	{"CronJob", "batch"}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := batchBeta.CronJob{}
+		fromUnstructured(r, &typedResource)
+		return CronJobResourceBuilder(&typedResource), nil
+	},
+	{"DaemonSet", "apps"}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := apps.DaemonSet{}
+		fromUnstructured(r, &typedResource)
+		daemonSet := DaemonSetResourceBuilder(&typedResource)
+		addWorkloadDrift(r, &daemonSet.node)
+		return daemonSet, nil
+	},
+	{"DaemonSet", "extensions"}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := apps.DaemonSet{}
+		fromUnstructured(r, &typedResource)
+		daemonSet := DaemonSetResourceBuilder(&typedResource)
+		addWorkloadDrift(r, &daemonSet.node)
+		return daemonSet, nil
+	},
+	{"Deployable", APPS_OPEN_CLUSTER_MANAGEMENT_IO}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := appDeployable.Deployable{}
+		fromUnstructured(r, &typedResource)
+		return AppDeployableResourceBuilder(&typedResource), nil
+	},
+	{"Deployment", "apps"}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := apps.Deployment{}
+		fromUnstructured(r, &typedResource)
+		deployment := DeploymentResourceBuilder(&typedResource)
+		addWorkloadDrift(r, &deployment.node)
+		return deployment, nil
+	},
+	{"Deployment", "extensions"}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := apps.Deployment{}
+		fromUnstructured(r, &typedResource)
+		deployment := DeploymentResourceBuilder(&typedResource)
+		addWorkloadDrift(r, &deployment.node)
+		return deployment, nil
+	},
+	// This is an ocp specific resource
+	{"DeploymentConfig", "apps.openshift.io"}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := ocpapp.DeploymentConfig{}
+		fromUnstructured(r, &typedResource)
+		return DeploymentConfigResourceBuilder(&typedResource), nil
+	},
+	{"Event", ""}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := core.Event{}
+		fromUnstructured(r, &typedResource)
+		return EventResourceBuilder(&typedResource), nil
+	},
+	// This is the application's HelmCR of kind HelmRelease.
+	{"HelmRelease", APPS_OPEN_CLUSTER_MANAGEMENT_IO}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := appHelmRelease.HelmRelease{}
+		fromUnstructured(r, &typedResource)
+		return AppHelmCRResourceBuilder(&typedResource), nil
+	},
+	{"ImageManifestVuln", "secscan.quay.redhat.com"}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := ImageManifestVuln{}
+		fromUnstructured(r, &typedResource)
+		return ImageManifestVulnResourceBuilder(&typedResource), nil
+	},
+	{"IngressClass", "networking.k8s.io"}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := networking.IngressClass{}
+		fromUnstructured(r, &typedResource)
+		return IngressClassResourceBuilder(&typedResource), nil
+	},
+	{"KlusterletAddonConfig", "agent.open-cluster-management.io"}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := klusterletaddon.KlusterletAddonConfig{}
+		fromUnstructured(r, &typedResource)
+		return KlusterletAddonConfigResourceBuilder(&typedResource), nil
+	},
+	{"Job", "batch"}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := batch.Job{}
+		fromUnstructured(r, &typedResource)
+		job := JobResourceBuilder(&typedResource)
+		job.addPodFailurePolicy(r.Object)
+		job.addSuccessPolicy(r.Object)
+		return job, nil
+	},
+	{"LimitRange", ""}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := core.LimitRange{}
+		fromUnstructured(r, &typedResource)
+		return LimitRangeResourceBuilder(&typedResource), nil
+	},
+	{"Namespace", ""}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := core.Namespace{}
+		fromUnstructured(r, &typedResource)
+		return NamespaceResourceBuilder(&typedResource), nil
+	},
+	{"NetworkPolicy", "networking.k8s.io"}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := networking.NetworkPolicy{}
+		fromUnstructured(r, &typedResource)
+		return NetworkPolicyResourceBuilder(&typedResource), nil
+	},
+	{"Node", ""}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := core.Node{}
+		fromUnstructured(r, &typedResource)
+		return NodeResourceBuilder(&typedResource), nil
+	},
+	{"PersistentVolume", ""}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := core.PersistentVolume{}
+		fromUnstructured(r, &typedResource)
+		return PersistentVolumeResourceBuilder(&typedResource), nil
+	},
+	{"PersistentVolumeClaim", ""}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := core.PersistentVolumeClaim{}
+		fromUnstructured(r, &typedResource)
+		return PersistentVolumeClaimResourceBuilder(&typedResource), nil
+	},
+	{"PlacementBinding", APPS_OPEN_CLUSTER_MANAGEMENT_IO}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := policy.PlacementBinding{}
+		fromUnstructured(r, &typedResource)
+		return PlacementBindingResourceBuilder(&typedResource), nil
+	},
+	{"PlacementRule", APPS_OPEN_CLUSTER_MANAGEMENT_IO}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := rule.PlacementRule{}
+		fromUnstructured(r, &typedResource)
+		return PlacementRuleResourceBuilder(&typedResource), nil
+	},
+	{"Pod", ""}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := core.Pod{}
+		fromUnstructured(r, &typedResource)
+		podResource := PodResourceBuilder(&typedResource)
+		podResource.addAllocatedResources(r.Object)
+		podResource.addAppArmorProfile(r.Object)
+		if config.Cfg.ContainerNodes {
+			return podResource, containerNodes(&typedResource, podResource.node)
+		}
+		return podResource, nil
+	},
+	{"Policy", "policy.open-cluster-management.io"}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := policy.Policy{}
+		fromUnstructured(r, &typedResource)
+		return PolicyResourceBuilder(&typedResource), nil
+	},
+	{"Policy", "policies.open-cluster-management.io"}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := policy.Policy{}
+		fromUnstructured(r, &typedResource)
+		return PolicyResourceBuilder(&typedResource), nil
+	},
+	{"PolicyReport", "wgpolicyk8s.io"}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := PolicyReport{}
+		fromUnstructured(r, &typedResource)
+		return PolicyReportResourceBuilder(&typedResource), nil
+	},
+	{"ReplicaSet", "apps"}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := apps.ReplicaSet{}
+		fromUnstructured(r, &typedResource)
+		return ReplicaSetResourceBuilder(&typedResource), nil
+	},
+	{"ReplicaSet", "extensions"}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := apps.ReplicaSet{}
+		fromUnstructured(r, &typedResource)
+		return ReplicaSetResourceBuilder(&typedResource), nil
+	},
+	{"ResourceQuota", ""}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := core.ResourceQuota{}
+		fromUnstructured(r, &typedResource)
+		return ResourceQuotaResourceBuilder(&typedResource), nil
+	},
+	{"Secret", ""}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := core.Secret{}
+		fromUnstructured(r, &typedResource)
+		secret := SecretResourceBuilder(&typedResource)
+		return secret, secret.release.nodes()
+	},
+	{"Service", ""}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := core.Service{}
+		fromUnstructured(r, &typedResource)
+		return ServiceResourceBuilder(&typedResource), nil
+	},
+	{"StatefulSet", "apps"}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := apps.StatefulSet{}
+		fromUnstructured(r, &typedResource)
+		statefulSet := StatefulSetResourceBuilder(&typedResource)
+		statefulSet.addOrdinalsStart(r.Object)
+		addWorkloadDrift(r, &statefulSet.node)
+		return statefulSet, nil
+	},
+	{"StorageClass", "storage.k8s.io"}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := storage.StorageClass{}
+		fromUnstructured(r, &typedResource)
+		return StorageClassResourceBuilder(&typedResource), nil
+	},
+	{"Subscription", APPS_OPEN_CLUSTER_MANAGEMENT_IO}: func(r *unstructured.Unstructured) (Transform, []Node) {
+		typedResource := subscription.Subscription{}
+		fromUnstructured(r, &typedResource)
+		return SubscriptionResourceBuilder(&typedResource), nil
+	},
+}
+
+// TransformFunc builds the transform of a resource of a kind registered with RegisterTransform.
+type TransformFunc func(r *unstructured.Unstructured) Transform
+
+var (
+	registeredTransforms      = map[schema.GroupVersionKind]TransformFunc{}
+	registeredTransformsMutex = sync.RWMutex{}
+)
+
+// RegisterTransform sets the function that builds the transform of the resources of the given kind, for the kinds
+// that don't have a transform in this package or to replace the built-in one. An empty version matches every
+// version of the kind. Register the transforms before passing in resources, those already transformed aren't
+// updated. If the function panics the resource is skipped and the error is reported, like any resource that fails
+// to transform.
+func RegisterTransform(gvk schema.GroupVersionKind, build TransformFunc) {
+	registeredTransformsMutex.Lock()
+	defer registeredTransformsMutex.Unlock()
+	registeredTransforms[gvk] = build
+}
+
+// Returns the builder of the resource's transform. The transform registered for the resource's version is used
+// first, then the one registered for any version and then the built-in one.
+func findTransformBuilder(r *unstructured.Unstructured) (transformBuilder, bool) {
+	registeredTransformsMutex.RLock()
+	if len(registeredTransforms) > 0 {
+		gvk := r.GroupVersionKind()
+		build, ok := registeredTransforms[gvk]
+		if !ok {
+			gvk.Version = ""
+			build, ok = registeredTransforms[gvk]
+		}
+		if ok {
+			registeredTransformsMutex.RUnlock()
+			return func(r *unstructured.Unstructured) (Transform, []Node) { return build(r), nil }, true
+		}
+	}
+	registeredTransformsMutex.RUnlock()
+
+	build, ok := transformBuilders[[2]string{r.GetKind(), resourceAPIGroup(r)}]
+	return build, ok
+}
+
+// Converts the unstructured resource into its typed struct.
+func fromUnstructured(r *unstructured.Unstructured, typedResource interface{}) {
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(r.UnstructuredContent(), typedResource)
+	if err != nil {
+		panic(err) // Will be caught by transformNodeEvents
+	}
+}
+
+// Returns the api group of the resource from its apiVersion, or an empty string for the core group.
+// Avoids splitting the apiVersion, this runs for every resource.
+func resourceAPIGroup(r *unstructured.Unstructured) string {
+	apiVersion, _ := r.Object["apiVersion"].(string)
+	i := strings.IndexByte(apiVersion, '/')
+	if i < 0 || strings.IndexByte(apiVersion[i+1:], '/') >= 0 {
+		return ""
+	}
+	return apiVersion[:i]
+}
@@ -11,26 +11,18 @@ Copyright (c) 2020 Red Hat, Inc.
 package transforms
 
 import (
+	"context"
+	"fmt"
 	"runtime/debug"
-	"strings"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/golang/glog"
-	ocpapp "github.com/openshift/api/apps/v1"
-	policy "github.com/stolostron/governance-policy-propagator/api/v1"
-	klusterletaddon "github.com/stolostron/klusterlet-addon-controller/pkg/apis/agent/v1"
-	appDeployable "github.com/stolostron/multicloud-operators-deployable/pkg/apis/apps/v1"
-	rule "github.com/stolostron/multicloud-operators-placementrule/pkg/apis/apps/v1"
-	apps "k8s.io/api/apps/v1"
-	batch "k8s.io/api/batch/v1"
-	batchBeta "k8s.io/api/batch/v1beta1"
-	core "k8s.io/api/core/v1"
+	"github.com/stolostron/search-collector/pkg/config"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
-	acmapp "open-cluster-management.io/multicloud-operators-channel/pkg/apis/apps/v1"
-	appHelmRelease "open-cluster-management.io/multicloud-operators-subscription/pkg/apis/apps/helmrelease/v1"
-	subscription "open-cluster-management.io/multicloud-operators-subscription/pkg/apis/apps/v1"
-	application "sigs.k8s.io/application/api/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 // Operation is the event operation
@@ -44,7 +36,7 @@ const (
 	Delete                  // 2
 )
 
-// This type is used for add and update events.
+// This type is used for add and update events. The Operation is passed on to the NodeEvent built from it.
 type Event struct {
 	Time           int64
 	Operation      Operation
@@ -71,8 +63,17 @@ func (n Node) GetMetadata(md string) string {
 	return ""
 }
 
+// OutputNode returns the node as it leaves the collector, with the labels filtered, anonymized and with the property
+// names of the pinned schema. The edges are built from the nodes as they're transformed, so this is only applied to
+// the copies sent or written out.
+func OutputNode(n Node) Node {
+	return PinSchemaVersion(AnonymizeNode(FilterLabelKeys(n)))
+}
+
 // These are the input to the sender. They have the node, and then they keep the time which is used for reconciling
 // this version with other versions that the sender may already have.
+// The Operation tells the reconciler whether to upsert or delete the node. Deletes only need the node's UID, the
+// informer's delete handler sends them straight to the reconciler without transforming the resource.
 type NodeEvent struct {
 	Node
 	ComputeEdges func(ns NodeStore) []Edge
@@ -81,7 +82,18 @@ type NodeEvent struct {
 }
 
 type Deletion struct {
-	UID string `json:"uid,omitempty"`
+	UID          string `json:"uid,omitempty"`
+	TombstoneTTL int64  `json:"tombstoneTTL,omitempty"` // Time(ms) the consumer should keep the delete marker
+}
+
+// NewDeletion returns the deletion of the node with the given UID. The tombstone TTL is only set when
+// TOMBSTONE_TTL_MS is enabled, consumers keep the delete markers without a TTL as long as they want.
+func NewDeletion(uid string) Deletion {
+	deletion := Deletion{UID: uid}
+	if config.Cfg.TombstoneTTLMS > 0 {
+		deletion.TombstoneTTL = int64(config.Cfg.TombstoneTTLMS)
+	}
+	return deletion
 }
 
 // make new constructor here.
@@ -95,6 +107,24 @@ func NewNodeEvent(event *Event, trans Transform, resourceString string) NodeEven
 	ne.ResourceString = resourceString
 	// Search v-2 , types is expected part of properties
 	ne.Node.Properties["kind_plural"] = resourceString
+	if config.Cfg.CollectAPIPath {
+		if apiPath := resourceAPIPath(ne.Node.Properties, resourceString); apiPath != "" {
+			ne.Node.Properties["_apiPath"] = apiPath
+		}
+	}
+	if config.Cfg.CollectCategory {
+		kind, _ := ne.Node.Properties["kind"].(string)
+		group, _ := ne.Node.Properties["apigroup"].(string)
+		if category, ok := kindCategory(schema.GroupKind{Group: group, Kind: kind}); ok {
+			ne.Node.Properties["_category"] = category
+		}
+	}
+	if config.Cfg.CompressPropertySize > 0 {
+		compressLargeProperties(ne.Node.Properties, config.Cfg.CompressPropertySize)
+	}
+	if config.Cfg.InternProperties {
+		internProperties(ne.Node.Properties)
+	}
 	return ne
 }
 
@@ -110,11 +140,50 @@ type EdgeType string
 // 	selects    EdgeType = "selects"
 // )
 
+// EdgeDirection tells consumers whether an edge goes from its source to its destination, or links both ways.
+type EdgeDirection string
+
+const (
+	Directed  EdgeDirection = "directed"
+	Symmetric EdgeDirection = "symmetric"
+)
+
+// Edge types that link both resources the same way. Any other type is directed from the source to the destination.
+// A PersistentVolume and its claim reference each other, so boundTo doesn't have a natural direction.
+var symmetricEdgeTypes = map[EdgeType]struct{}{
+	"boundTo": {},
+}
+
 // Structure to hold Edge, containing the type and UIDs to relationships
+// Direction is only set when EDGE_DIRECTION is enabled.
 type Edge struct {
 	EdgeType
 	SourceUID, DestUID   string
 	SourceKind, DestKind string
+	Direction            EdgeDirection          `json:",omitempty"`
+	Properties           map[string]interface{} `json:",omitempty"` // Describes the relationship, e.g. devicePath
+}
+
+// SetEdgeDirection sets the direction of the edge from its type, unless the edge builder already set it.
+func SetEdgeDirection(edge *Edge) {
+	if edge.Direction != "" {
+		return
+	}
+	if IsSymmetricEdge(*edge) {
+		edge.Direction = Symmetric
+	} else {
+		edge.Direction = Directed
+	}
+}
+
+// IsSymmetricEdge returns true if the edge links both resources the same way: its builder set it as symmetric,
+// or didn't set a direction and its type is symmetric.
+func IsSymmetricEdge(edge Edge) bool {
+	if edge.Direction != "" {
+		return edge.Direction == Symmetric
+	}
+	_, ok := symmetricEdgeTypes[edge.EdgeType]
+	return ok
 }
 
 // interface for each tranform
@@ -124,10 +193,34 @@ type Transform interface {
 }
 
 // Object that handles transformation of k8s objects.
-// To use, create one, call Start(), and begin passing in objects.
+// To use, create one with NewTransformer, and begin passing in objects. Call Stop() to stop its routines, or close
+// Input and call Drain() to stop them once the objects passed in are transformed.
+// A transformer created with NewSplitTransformer has an output for each operation instead of Output.
+// A transformer created with NewDumpTransformer also writes the node events to a writer.
 type Transformer struct {
 	Input  chan *Event    // Put your k8s resources and corresponding times in here.
 	Output chan NodeEvent // And receive your aggregator-ready nodes (and times) from here.
+	Errors chan error     // The resources given up on, as *TransformError. Optional, dropped when it's full.
+
+	CreateOutput chan NodeEvent // The Create node events, only when the output is split
+	UpdateOutput chan NodeEvent // The Update node events, only when the output is split
+	DeleteOutput chan NodeEvent // The Delete node events, only when the output is split
+
+	output   chan NodeEvent  // Where the routines pass the node events, Output unless it's split or dumped
+	forward  *sync.WaitGroup // Routines forwarding the output to the split outputs or the dump, nil unless used
+	stopper  chan struct{}   // Closed to tell the routines to stop
+	stopOnce *sync.Once      // Stop can be called more than once
+	emitting *sync.RWMutex   // Held for reading while a node of the caller is emitted, Stop closes output after
+	routines *sync.WaitGroup // Routines that haven't returned yet
+	draining *sync.WaitGroup // Transform routines that haven't returned yet, they return once Input is closed
+	manifest *syncManifest   // Tracks the nodes of the initial sync, nil unless SYNC_MANIFEST is enabled
+	pooled   *int64          // Events dispatched to a worker pool and not transformed yet
+	throttle *kindThrottle   // Holds back the rate limited kinds, nil unless KIND_RATE_LIMITS is set
+	resync   *resyncMarkers  // Tracks the resync signaled by the caller, nil unless RESYNC_MARKERS is enabled
+
+	retries     chan failedEvent  // The resources due for a retry, nil unless TRANSFORM_RETRIES is set
+	pending     *pendingRetries   // The event to retry of each resource, nil unless TRANSFORM_RETRIES is set
+	subscribers *errorSubscribers // The consumers subscribed to the transform errors
 }
 
 var (
@@ -136,315 +229,500 @@ var (
 )
 
 func NewTransformer(inputChan chan *Event, outputChan chan NodeEvent, numRoutines int) Transformer {
+	t := Transformer{Output: outputChan}
+	t.start(inputChan, outputChan, numRoutines)
+	return t
+}
+
+// NewSplitTransformer creates a transformer that passes the node events to CreateOutput, UpdateOutput or
+// DeleteOutput depending on their operation, for consumers that handle each operation separately.
+// The events of each output are in the order they were transformed. There's no order across the outputs: an
+// Update can be read before the Create of the same node if the outputs are read by different routines, and an
+// output that isn't read blocks the others. The outputs are closed when Stop returns.
+func NewSplitTransformer(inputChan chan *Event, numRoutines int) Transformer {
+	t := Transformer{
+		CreateOutput: make(chan NodeEvent),
+		UpdateOutput: make(chan NodeEvent),
+		DeleteOutput: make(chan NodeEvent),
+		forward:      &sync.WaitGroup{},
+	}
+	output := make(chan NodeEvent)
+	t.forward.Add(1)
+	go func() {
+		defer t.forward.Done()
+		splitByOperation(output, t.CreateOutput, t.UpdateOutput, t.DeleteOutput)
+	}()
+	t.start(inputChan, output, numRoutines)
+	return t
+}
+
+// Passes each node event to the output of its operation, until the output is closed. Then closes the outputs.
+func splitByOperation(output, createOutput, updateOutput, deleteOutput chan NodeEvent) {
+	defer func() {
+		close(createOutput)
+		close(updateOutput)
+		close(deleteOutput)
+	}()
+	for ne := range output {
+		switch ne.Operation {
+		case Create:
+			createOutput <- ne
+		case Update:
+			updateOutput <- ne
+		case Delete:
+			deleteOutput <- ne
+		default:
+			glog.Warningf("Dropping node %s with unknown operation %d", ne.UID, ne.Operation)
+		}
+	}
+}
+
+// Starts the routines of the transformer, passing the node events into the output.
+func (t *Transformer) start(inputChan chan *Event, outputChan chan NodeEvent, numRoutines int) {
 	glog.Info("Transformer started")
 	nr := numRoutines
 	if numRoutines < 1 {
 		glog.Warning(numRoutines, "is an invalid number of routines for Transformer. Using 1 instead.")
 		nr = 1
 	}
+	if config.Cfg.SchemaVersion > CurrentSchemaVersion {
+		glog.Warningf("Schema version %d isn't supported, the latest is %d. Using %d instead.",
+			config.Cfg.SchemaVersion, CurrentSchemaVersion, CurrentSchemaVersion)
+	}
+
+	t.Input = inputChan
+	t.Errors = make(chan error, transformerErrorsBufferSize)
+	t.output = outputChan
+	t.stopper = make(chan struct{})
+	t.stopOnce = &sync.Once{}
+	t.emitting = &sync.RWMutex{}
+	t.routines = &sync.WaitGroup{}
+	t.draining = &sync.WaitGroup{}
+	t.subscribers = &errorSubscribers{}
+	t.pooled = new(int64)
+	if config.Cfg.SyncManifest {
+		t.manifest = newSyncManifest()
+	}
+	if config.Cfg.ResyncMarkers {
+		t.resync = &resyncMarkers{}
+	}
+	if limits := kindRateLimits(config.Cfg.KindRateLimits); len(limits) > 0 {
+		t.throttle = newKindThrottle(limits, t.manifest)
+		for kind := range limits {
+			glog.Infof("Limiting kind %s to %d nodes per second", kind, limits[kind])
+			kind := kind
+			t.goStoppable(func() { t.throttle.emitBuffered(kind, outputChan, t.stopper) })
+		}
+	}
+
+	if config.Cfg.TransformRetries > 0 {
+		t.retries = make(chan failedEvent)
+		t.pending = newPendingRetries()
+		t.goStoppable(func() { retryRoutine(t, outputChan) })
+	}
+
+	// Kinds with a dedicated worker pool are routed to their pool, the rest go to the default pool.
+	// The priority kinds without a dedicated pool go ahead of the other kinds in the default pool.
+	routineInput := inputChan
+	if len(config.Cfg.KindWorkerPools) > 0 || len(config.Cfg.PriorityKinds) > 0 {
+		defaultPool := make(chan *Event, kindPoolBufferSize)
+		routineInput = defaultPool
+		pools := make(map[string]chan *Event)
+		for kind, size := range kindWorkerPoolSizes(config.Cfg.KindWorkerPools) {
+			glog.Infof("Starting %d transformer routines for kind %s", size, kind)
+			pools[kind] = make(chan *Event, kindPoolBufferSize)
+			for i := 0; i < size; i++ {
+				t.countTransformRoutine()
+				go transformRoutine(pools[kind], outputChan, t)
+			}
+		}
+		// The priority pool is only used, and closed by the dispatch, if a priority kind doesn't have its own pool.
+		var priorityPool chan *Event
+		for _, kind := range config.Cfg.PriorityKinds {
+			if _, ok := pools[kind]; !ok {
+				glog.Infof("Transforming kind %s ahead of the other kinds of the default pool", kind)
+				if priorityPool == nil {
+					priorityPool = make(chan *Event, kindPoolBufferSize)
+				}
+				pools[kind] = priorityPool
+			}
+		}
+		if priorityPool != nil {
+			prioritized := make(chan *Event) // Unbuffered, so an event is picked when a routine is ready for it
+			routineInput = prioritized
+			t.goStoppable(func() { prioritize(priorityPool, defaultPool, prioritized, t.stopper) })
+		}
+		t.goStoppable(func() { dispatchByKind(inputChan, defaultPool, pools, t.pooled, t.stopper) })
+	}
 
 	// start numRoutines threads to handle transformation.
 	for i := 0; i < nr; i++ {
-		go TransformRoutine(inputChan, outputChan)
+		t.countTransformRoutine()
+		go transformRoutine(routineInput, outputChan, t)
 	}
-	return Transformer{
-		Input:  inputChan,
-		Output: outputChan,
+	if config.Cfg.HeartbeatNodeMS > 0 {
+		interval := time.Duration(config.Cfg.HeartbeatNodeMS) * time.Millisecond
+		t.goStoppable(func() { sendHeartbeats(outputChan, interval, t.stopper) })
 	}
+}
 
+// Runs the function in a routine that Stop waits for. The function must return when the stopper is closed.
+func (t Transformer) goStoppable(f func()) {
+	t.routines.Add(1)
+	go func() {
+		defer t.routines.Done()
+		f()
+	}()
 }
 
-// This function processes k8s objects into Nodes, then pass them into the output channel.
-// If anything goes wrong in here that requires you to skip the current resource, call panic()
-// and the routine will be spun back up by handleRoutineExit and the bad resource won't be in there
-// because it was already taken out by the previous run.
-func TransformRoutine(input chan *Event, output chan NodeEvent) {
-	defer handleRoutineExit(input, output)
-	glog.Info("Starting transformer routine")
+// Counts a transform routine in the routines Stop waits for, and in the ones Drain waits for.
+func (t Transformer) countTransformRoutine() {
+	t.routines.Add(1)
+	t.draining.Add(1)
+}
 
-	for {
-		var trans Transform
+// Stop tells the transformer routines to stop, and blocks until all of them have returned.
+// A routine finishes the object it's transforming before it returns, so Output, or the split outputs, must still
+// be read until Stop returns. The objects left in Input aren't transformed.
+func (t Transformer) Stop() {
+	t.stopOnce.Do(func() {
+		glog.Info("Stopping transformer")
+		close(t.stopper)
+		t.routines.Wait()
+		t.subscribers.close() // The routines don't report errors anymore
+		if t.forward != nil {
+			t.emitting.Lock() // The nodes emitted by the caller are dropped once the stopper is closed
+			close(t.output)   // The routines don't pass anything anymore
+			t.emitting.Unlock()
+			t.forward.Wait()
+		}
+	})
+}
 
-		event := <-input // Read from the input channel
+// Drain waits for the routines to transform the objects left in Input, then stops the transformer like Stop.
+// Close Input before calling Drain, the routines wait for more objects until it's closed. Output, or the split
+// outputs, must still be read until Drain returns.
+// If the context is done first, the routines are told to stop without transforming the objects left, and Drain
+// returns the context's error without waiting for them.
+func (t Transformer) Drain(ctx context.Context) error {
+	drained := make(chan struct{})
+	go func() {
+		t.draining.Wait()
+		t.Stop()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		glog.Warningf("Transformer didn't drain its input: %v", ctx.Err())
+		go t.Stop()
+		return ctx.Err()
+	}
+}
 
-		// Determine apiGroup and version of the resource
-		apiGroup := ""
+// Passes a node emitted by the caller of the transformer, like the sync manifest, into the output. The node is
+// dropped once the transformer is stopped, the output may be closed then.
+func (t Transformer) emit(ne NodeEvent) {
+	t.emitting.RLock()
+	defer t.emitting.RUnlock()
+	if !isStopped(t.stopper) {
+		select {
+		case t.output <- ne:
+			return
+		case <-t.stopper:
+		}
+	}
+	glog.V(2).Infof("Dropping node %s, the transformer is stopped", ne.UID)
+}
 
-		if event.Resource.Object["apiVersion"] != nil && event.Resource.Object["apiVersion"] != "" {
-			if apiVersionStr, ok := event.Resource.Object["apiVersion"].(string); ok {
-				if len(strings.Split(apiVersionStr, "/")) == 2 {
-					apiGroup = strings.Split(apiVersionStr, "/")[0]
-				}
-			}
+// Returns true once the stopper is closed. A nil stopper is never closed.
+func isStopped(stopper chan struct{}) bool {
+	select {
+	case <-stopper:
+		return true
+	default:
+		return false
+	}
+}
+
+// Number of errors kept in the Errors channel until they're read.
+const transformerErrorsBufferSize = 100
+
+// Number of events each worker pool can queue before the dispatch waits for the pool to catch up.
+const kindPoolBufferSize = 1000
+
+// Parses the size of the worker pool for each kind. Invalid sizes use a single routine.
+func kindWorkerPoolSizes(pools map[string]string) map[string]int {
+	sizes := make(map[string]int, len(pools))
+	for kind, value := range pools {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 1 {
+			glog.Warningf("%s is an invalid number of routines for the %s worker pool. Using 1 instead.", value, kind)
+			size = 1
 		}
-		kindApigroup := [2]string{event.Resource.GetKind(), apiGroup}
-		// Might have to add more transform cases if resources like DaemonSet, StatefulSet etc. have other apigroups
-		switch kindApigroup {
-		case [2]string{"Application", "app.k8s.io"}:
-			typedResource := application.Application{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
-			}
-			trans = ApplicationResourceBuilder(&typedResource)
-
-		case [2]string{"Application", "argoproj.io"}:
-			typedResource := ArgoApplication{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
-			}
-			trans = ArgoApplicationResourceBuilder(&typedResource)
-
-		case [2]string{"Channel", APPS_OPEN_CLUSTER_MANAGEMENT_IO}:
-			typedResource := acmapp.Channel{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
-			}
-			trans = ChannelResourceBuilder(&typedResource)
-
-		case [2]string{"CronJob", "batch"}:
-			typedResource := batchBeta.CronJob{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
-			}
-			trans = CronJobResourceBuilder(&typedResource)
-
-		case [2]string{"DaemonSet", "extensions"}:
-			typedResource := apps.DaemonSet{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
-			}
-			trans = DaemonSetResourceBuilder(&typedResource)
-
-		case [2]string{"DaemonSet", "apps"}:
-			typedResource := apps.DaemonSet{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
-			}
-			trans = DaemonSetResourceBuilder(&typedResource)
-
-		case [2]string{"Deployable", APPS_OPEN_CLUSTER_MANAGEMENT_IO}:
-			typedResource := appDeployable.Deployable{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
-			}
-			trans = AppDeployableResourceBuilder(&typedResource)
-
-		case [2]string{"Deployment", "apps"}:
-			typedResource := apps.Deployment{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
-			}
-			trans = DeploymentResourceBuilder(&typedResource)
-
-		case [2]string{"Deployment", "extensions"}:
-			typedResource := apps.Deployment{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
-			}
-			trans = DeploymentResourceBuilder(&typedResource)
-
-			//This is an ocp specific resource
-		case [2]string{"DeploymentConfig", "apps.openshift.io"}:
-			typedResource := ocpapp.DeploymentConfig{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
-			}
-			trans = DeploymentConfigResourceBuilder(&typedResource)
-
-			//This is the application's HelmCR of kind HelmRelease.
-		case [2]string{"HelmRelease", APPS_OPEN_CLUSTER_MANAGEMENT_IO}:
-			typedResource := appHelmRelease.HelmRelease{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
-			}
-			trans = AppHelmCRResourceBuilder(&typedResource)
-
-		case [2]string{"KlusterletAddonConfig", "agent.open-cluster-management.io"}:
-			typedResource := klusterletaddon.KlusterletAddonConfig{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
-			}
-			trans = KlusterletAddonConfigResourceBuilder(&typedResource)
-
-		case [2]string{"Job", "batch"}:
-			typedResource := batch.Job{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
-			}
-			trans = JobResourceBuilder(&typedResource)
-
-		case [2]string{"Namespace", ""}:
-			typedResource := core.Namespace{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
-			}
-			trans = NamespaceResourceBuilder(&typedResource)
-
-		case [2]string{"Node", ""}:
-			typedResource := core.Node{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
-			}
-			trans = NodeResourceBuilder(&typedResource)
-
-		case [2]string{"PersistentVolume", ""}:
-			typedResource := core.PersistentVolume{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
-			}
-			trans = PersistentVolumeResourceBuilder(&typedResource)
-
-		case [2]string{"PersistentVolumeClaim", ""}:
-			typedResource := core.PersistentVolumeClaim{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
-			}
-			trans = PersistentVolumeClaimResourceBuilder(&typedResource)
-
-		case [2]string{"PlacementBinding", APPS_OPEN_CLUSTER_MANAGEMENT_IO}:
-			typedResource := policy.PlacementBinding{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
-			}
-			trans = PlacementBindingResourceBuilder(&typedResource)
-
-		case [2]string{"PlacementRule", APPS_OPEN_CLUSTER_MANAGEMENT_IO}:
-			typedResource := rule.PlacementRule{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
-			}
-			trans = PlacementRuleResourceBuilder(&typedResource)
-
-		case [2]string{"Pod", ""}:
-			typedResource := core.Pod{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
-			}
-			trans = PodResourceBuilder(&typedResource)
-
-		case [2]string{"Policy", "policy.open-cluster-management.io"},
-			[2]string{"Policy", "policies.open-cluster-management.io"}:
-			typedResource := policy.Policy{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
-			}
-			trans = PolicyResourceBuilder(&typedResource)
-
-		case [2]string{"ReplicaSet", "apps"}:
-			typedResource := apps.ReplicaSet{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
+		sizes[kind] = size
+	}
+	return sizes
+}
+
+// Routes each event to the worker pool of its kind, or to the default pool if its kind doesn't have one.
+// The pools are buffered so a slow pool doesn't block the dispatch of other kinds until its buffer is full.
+// Several kinds can share a pool. The events are counted in pooled until they're transformed.
+// Returns when the input is closed or the stopper is closed, and closes the pools so their routines return once
+// they're empty.
+func dispatchByKind(input chan *Event, defaultPool chan *Event, pools map[string]chan *Event, pooled *int64,
+	stopper chan struct{}) {
+	defer func() {
+		close(defaultPool)
+		closed := make(map[chan *Event]bool, len(pools))
+		for _, pool := range pools {
+			if !closed[pool] {
+				close(pool)
+				closed[pool] = true
 			}
-			trans = ReplicaSetResourceBuilder(&typedResource)
-
-		case [2]string{"ReplicaSet", "extensions"}:
-			typedResource := apps.ReplicaSet{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
+		}
+	}()
+	for {
+		var event *Event
+		select {
+		case <-stopper:
+			return
+		case e, ok := <-input:
+			if !ok {
+				return
 			}
-			trans = ReplicaSetResourceBuilder(&typedResource)
-
-		case [2]string{"Service", ""}:
-			typedResource := core.Service{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
+			event = e
+		}
+		inputDepth.Set(float64(len(input)))
+		pool, ok := pools[event.Resource.GetKind()]
+		if !ok {
+			pool = defaultPool
+		}
+		// The pool's routines stop too, don't wait for them to make room.
+		atomic.AddInt64(pooled, 1)
+		select {
+		case pool <- event:
+		case <-stopper:
+			return
+		}
+	}
+}
+
+// Passes the events of the priority and the normal pools into the output, the priority events first. With an
+// unbuffered output, an event is picked once a routine is ready for it, so the priority events go ahead of all the
+// normal events waiting then.
+// Returns when both pools are closed and empty, or when the stopper is closed, and closes the output.
+func prioritize(priority chan *Event, normal chan *Event, output chan *Event, stopper chan struct{}) {
+	defer close(output)
+	for priority != nil || normal != nil {
+		var event *Event
+		var ok bool
+		select {
+		case event, ok = <-priority:
+			if !ok {
+				priority = nil // Never ready again
+				continue
 			}
-			trans = ServiceResourceBuilder(&typedResource)
-
-		case [2]string{"StatefulSet", "apps"}:
-			typedResource := apps.StatefulSet{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
+		default:
+			select {
+			case <-stopper:
+				return
+			case event, ok = <-priority:
+				if !ok {
+					priority = nil
+					continue
+				}
+			case event, ok = <-normal:
+				if !ok {
+					normal = nil
+					continue
+				}
 			}
-			trans = StatefulSetResourceBuilder(&typedResource)
-
-		case [2]string{"Subscription", APPS_OPEN_CLUSTER_MANAGEMENT_IO}:
-			typedResource := subscription.Subscription{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
+		}
+		select {
+		case output <- event:
+		case <-stopper:
+			return
+		}
+	}
+}
+
+// This function processes k8s objects into Nodes, then pass them into the output channel.
+// If anything goes wrong in here that requires you to skip the current resource, call panic()
+// and the resource will be skipped by transformNodeEvents, the routine goes on with the next resource.
+// A panic outside of the transform is handled by handleRoutineExit, which spins the routine back up.
+// The routine stops once the input is closed, routines started by NewTransformer also stop with Transformer.Stop().
+func TransformRoutine(input chan *Event, output chan NodeEvent) {
+	transformRoutine(input, output, nil)
+}
+
+// Transforms the events from the input until the input or the transformer's stopper is closed. The routine is counted in the
+// transformer's routines, and the resources that fail to transform are reported on its Errors channel.
+// Without a transformer, the routine never stops.
+func transformRoutine(input chan *Event, output chan NodeEvent, t *Transformer) {
+	defer handleRoutineExit(input, output, t)
+	glog.Info("Starting transformer routine")
+
+	var stopper chan struct{}
+	var manifest *syncManifest
+	var throttle *kindThrottle
+	var resync *resyncMarkers
+	var pending *pendingRetries
+	if t != nil {
+		stopper, manifest, throttle, resync, pending = t.stopper, t.manifest, t.throttle, t.resync, t.pending
+	}
+	for {
+		select {
+		case <-stopper:
+			glog.Info("Stopping transformer routine")
+			return
+		case event, ok := <-input: // Read from the input channel
+			if !ok {
+				glog.Info("Transformer routine input closed")
+				return
 			}
-			trans = SubscriptionResourceBuilder(&typedResource)
-
-		case [2]string{"PolicyReport", "wgpolicyk8s.io"}:
-			typedResource := PolicyReport{}
-			err := runtime.DefaultUnstructuredConverter.
-				FromUnstructured(event.Resource.UnstructuredContent(), &typedResource)
-			if err != nil {
-				panic(err) // Will be caught by handleRoutineExit
+			if t != nil && input == t.Input {
+				inputDepth.Set(float64(len(input)))
 			}
-			trans = PolicyReportResourceBuilder(&typedResource)
+			pending.remove(event) // The pending retry of the resource is older than this event
+			func() {
+				if t != nil && input != t.Input {
+					defer atomic.AddInt64(t.pooled, -1) // Dispatched by dispatchByKind, the routine may panic
+				}
+				if err := resync.transform(event, output, manifest, throttle); err != nil {
+					glog.Error(err)
+					countTransformError(event)
+					t.failed(event, err, 0)
+				}
+			}()
+		}
+	}
+}
 
-		default:
-			trans = GenericResourceBuilder(event.Resource)
+// Transforms the event and passes the nodes into the output channel, through the throttle if not nil. The nodes
+// passed on are recorded in the manifest, if not nil, the throttle records the nodes it buffered once they're emitted.
+// Returns an error if the resource failed to transform, nothing is passed into the output then.
+func transformEvent(event *Event, output chan NodeEvent, manifest *syncManifest, throttle *kindThrottle) error {
+	events, err := transformNodeEvents(event)
+	if err != nil {
+		return err
+	}
+	for _, ne := range events {
+		if throttle.emit(ne, output) {
+			manifest.record(ne.UID)
+			countTransformedNode(ne)
+		}
+	}
+	return nil
+}
+
+// Returns the node events of the resource: its node, then the synthetic nodes emitted along with it.
+// A panic while transforming the resource is recovered and returned as an error identifying the resource.
+func transformNodeEvents(event *Event) (events []NodeEvent, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			glog.Error(string(debug.Stack()))
+			err = fmt.Errorf("error transforming %s: %v", describeResource(event.Resource), r)
+		}
+	}()
+
+	if isExcludedNamespace(event.Resource.GetNamespace()) {
+		glog.V(5).Infof("Skipping %s, its namespace is excluded", describeResource(event.Resource))
+		return nil, nil
+	}
+
+	var trans Transform
+	var extraNodes []Node // Synthetic nodes emitted along with the resource's node
+	if build, ok := findTransformBuilder(event.Resource); ok {
+		trans, extraNodes = build(event.Resource)
+	} else {
+		trans = GenericResourceBuilder(event.Resource)
+	}
+
+	ne := NewNodeEvent(event, trans, event.ResourceString)
+	if config.Cfg.ValidateNodes {
+		if err := ValidateNode(ne.Node); err != nil {
+			// Reported like the resources that fail to transform, the properties are only logged.
+			glog.V(2).Infof("Properties of the invalid node %s: %v", ne.UID, ne.Node.Properties)
+			return nil, fmt.Errorf("invalid node of %s: %v", describeResource(event.Resource), err)
 		}
+	}
+	var appEvent NodeEvent
+	hasApp := false
+	if config.Cfg.LabelApplications {
+		appEvent, hasApp = labelApplicationEvent(&ne)
+	}
+	if config.Cfg.SummaryNodes {
+		extraNodes = append(extraNodes, summaryNode(ne.Node))
+	}
+	events = append(make([]NodeEvent, 0, len(extraNodes)+2), ne)
+	for _, node := range extraNodes {
+		events = append(events, NodeEvent{
+			Node:         node,
+			ComputeEdges: func(ns NodeStore) []Edge { return []Edge{} },
+			Time:         event.Time,
+			Operation:    event.Operation,
+		})
+	}
+	if hasApp {
+		events = append(events, appEvent)
+	}
+	return events, nil
+}
 
-		output <- NewNodeEvent(event, trans, event.ResourceString)
+// Returns the kind, namespace, name and UID of the resource for the logs.
+func describeResource(r *unstructured.Unstructured) string {
+	if r == nil {
+		return "nil resource"
 	}
+	return fmt.Sprintf("%s %s/%s (UID %s)", r.GetKind(), r.GetNamespace(), r.GetName(), r.GetUID())
 }
 
-// Handles a panic from inside transformRoutine.
+// Passes the error into the Errors channel and to the subscribers, unless their buffer is full. Errors aren't
+// reported without a transformer.
+func (t *Transformer) reportError(err *TransformError) {
+	if t == nil {
+		return
+	}
+	select {
+	case t.Errors <- err:
+	default:
+		glog.V(3).Info("Transformer errors channel is full, dropping the error")
+	}
+	t.subscribers.mutex.Lock()
+	defer t.subscribers.mutex.Unlock()
+	for _, sub := range t.subscribers.subs {
+		select {
+		case sub <- err:
+		default:
+			glog.V(3).Info("Transformer errors subscriber is full, dropping the error")
+		}
+	}
+}
+
+// Handles a panic from inside transformRoutine, outside of the transform of a resource. It's the last resort.
 // If the panic was due to an error, starts another transformRoutine with the same channels as this one.
-// If not, just lets it die.
-func handleRoutineExit(input chan *Event, output chan NodeEvent) {
+// If not, or if the transformer is stopping, just lets it die.
+func handleRoutineExit(input chan *Event, output chan NodeEvent, t *Transformer) {
 	// Recover and check the value. If we are here because of a panic, something will be in it.
 	if r := recover(); r != nil { // Case where we got here from a panic
 		glog.Errorf("Error in transformer routine: %v\n", r)
 		glog.Error(string(debug.Stack()))
+		routinePanics.Inc()
 
 		// Start up a new routine with the same channels as the old one. The bad input will be gone since the
 		// old routine (the one that just crashed) took it out of the channel.
-		go TransformRoutine(input, output)
+		// The new routine is counted before this one is done, so Stop can't return in between.
+		if t == nil {
+			go transformRoutine(input, output, nil)
+		} else if !isStopped(t.stopper) {
+			t.countTransformRoutine()
+			go transformRoutine(input, output, t)
+		}
+	}
+	if t != nil {
+		t.routines.Done()
+		t.draining.Done()
 	}
 }
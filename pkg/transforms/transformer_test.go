@@ -11,11 +11,16 @@ Copyright (c) 2020 Red Hat, Inc.
 package transforms
 
 import (
+	"context"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	agentv1 "github.com/stolostron/klusterlet-addon-controller/pkg/apis/agent/v1"
+	"github.com/stolostron/search-collector/pkg/config"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	app "sigs.k8s.io/application/api/v1beta1"
 )
 
@@ -124,3 +129,429 @@ func TestTransformRoutine(t *testing.T) {
 		AssertEqual(test.name, actual.Operation, test.expected.Operation, t)
 	}
 }
+
+func TestKindWorkerPoolSizes(t *testing.T) {
+	sizes := kindWorkerPoolSizes(map[string]string{"Event": "4", "Pod": "0", "Deployment": "many"})
+	AssertEqual("Event", sizes["Event"], 4, t)
+	AssertEqual("Pod", sizes["Pod"], 1, t)
+	AssertEqual("Deployment", sizes["Deployment"], 1, t)
+}
+
+func TestDispatchByKind(t *testing.T) {
+	input := make(chan *Event)
+	defaultPool := make(chan *Event, 1)
+	eventPool := make(chan *Event, 1)
+	go dispatchByKind(input, defaultPool, map[string]chan *Event{"Event": eventPool}, new(int64), nil)
+
+	event := &Event{Resource: &unstructured.Unstructured{Object: map[string]interface{}{"kind": "Event"}}}
+	deployment := &Event{Resource: &unstructured.Unstructured{Object: map[string]interface{}{"kind": "Deployment"}}}
+	input <- event
+	input <- deployment
+
+	if actual := <-eventPool; actual != event {
+		t.Errorf("Expected the Event to be routed to its pool, got %v", actual.Resource.GetKind())
+	}
+	if actual := <-defaultPool; actual != deployment {
+		t.Errorf("Expected the Deployment to be routed to the default pool, got %v", actual.Resource.GetKind())
+	}
+}
+
+func TestDispatchByKindSharedPool(t *testing.T) {
+	input := make(chan *Event)
+	defaultPool := make(chan *Event, 1)
+	priorityPool := make(chan *Event, 2)
+	done := make(chan struct{})
+	go func() {
+		pools := map[string]chan *Event{"Deployment": priorityPool, "Policy": priorityPool}
+		dispatchByKind(input, defaultPool, pools, new(int64), nil)
+		close(done)
+	}()
+
+	input <- &Event{Resource: &unstructured.Unstructured{Object: map[string]interface{}{"kind": "Deployment"}}}
+	input <- &Event{Resource: &unstructured.Unstructured{Object: map[string]interface{}{"kind": "Policy"}}}
+	close(input)
+	<-done // The shared pool is closed once, without a panic
+	AssertEqual("priority pool", len(priorityPool), 2, t)
+}
+
+func TestPrioritize(t *testing.T) {
+	priority := make(chan *Event, 2)
+	normal := make(chan *Event, 2)
+	output := make(chan *Event)
+	endpoints := &Event{Resource: &unstructured.Unstructured{Object: map[string]interface{}{"kind": "Endpoints"}}}
+	deployment := &Event{Resource: &unstructured.Unstructured{Object: map[string]interface{}{"kind": "Deployment"}}}
+	normal <- endpoints
+	normal <- endpoints
+	priority <- deployment
+	close(normal)
+	close(priority)
+	go prioritize(priority, normal, output, nil)
+
+	// The priority event goes ahead of the normal events queued before it.
+	kinds := []string{}
+	for event := range output {
+		kinds = append(kinds, event.Resource.GetKind())
+	}
+	AssertDeepEqual("order", kinds, []string{"Deployment", "Endpoints", "Endpoints"}, t)
+}
+
+func TestTransformerPriorityKinds(t *testing.T) {
+	config.Cfg.PriorityKinds = []string{"Pod"}
+	defer func() { config.Cfg.PriorityKinds = nil }()
+	input := make(chan *Event, 2)
+	output := make(chan NodeEvent)
+	transformer := NewTransformer(input, output, 1)
+
+	var p unstructured.Unstructured
+	UnmarshalFile("pod.json", &p, t)
+	var s unstructured.Unstructured
+	UnmarshalFile("service.json", &s, t)
+	input <- &Event{Resource: &s, ResourceString: "services"}
+	input <- &Event{Resource: &p, ResourceString: "pods"}
+	close(input)
+
+	kinds := map[string]int{}
+	for i := 0; i < 2; i++ {
+		select {
+		case ne := <-output:
+			kinds[ne.Properties["kind"].(string)]++
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected both kinds to be transformed")
+		}
+	}
+	AssertDeepEqual("transformed", kinds, map[string]int{"Pod": 1, "Service": 1}, t)
+	AssertEqual("drain error", transformer.Drain(context.Background()), nil, t)
+}
+
+func TestTransformerStop(t *testing.T) {
+	config.Cfg.KindWorkerPools = map[string]string{"Event": "1"}
+	defer func() { config.Cfg.KindWorkerPools = nil }()
+	input := make(chan *Event)
+	output := make(chan NodeEvent)
+	transformer := NewTransformer(input, output, 2)
+
+	// A resource that panics is skipped, the transformer keeps transforming.
+	input <- &Event{Resource: &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1", "kind": "Pod", "spec": "not a pod spec"}}}
+	var p unstructured.Unstructured
+	UnmarshalFile("pod.json", &p, t)
+	input <- &Event{Resource: &p, ResourceString: "pods"}
+	AssertEqual("transformed", (<-output).Properties["kind"], "Pod", t)
+
+	stopped := make(chan struct{})
+	go func() {
+		transformer.Stop()
+		transformer.Stop() // Stopping again doesn't panic
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Stop to return once the routines returned")
+	}
+
+	// Nothing reads the input after the routines returned.
+	select {
+	case input <- &Event{Resource: &p, ResourceString: "pods"}:
+		t.Error("Expected the stopped transformer to not read its input")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestTransformerDrain(t *testing.T) {
+	config.Cfg.KindWorkerPools = map[string]string{"Pod": "1"}
+	defer func() { config.Cfg.KindWorkerPools = nil }()
+	input := make(chan *Event, 3)
+	output := make(chan NodeEvent)
+	transformer := NewTransformer(input, output, 2)
+
+	var p unstructured.Unstructured
+	UnmarshalFile("pod.json", &p, t)
+	var s unstructured.Unstructured
+	UnmarshalFile("service.json", &s, t)
+	input <- &Event{Resource: &p, ResourceString: "pods"}
+	input <- &Event{Resource: &s, ResourceString: "services"}
+	input <- &Event{Resource: &p, ResourceString: "pods"}
+	close(input)
+
+	drained := make(chan error)
+	go func() { drained <- transformer.Drain(context.Background()) }()
+	// The objects left in the input are transformed before Drain returns.
+	kinds := map[string]int{}
+	for i := 0; i < 3; i++ {
+		select {
+		case ne := <-output:
+			kinds[ne.Properties["kind"].(string)]++
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the objects left in the input to be transformed")
+		}
+	}
+	AssertDeepEqual("transformed", kinds, map[string]int{"Pod": 2, "Service": 1}, t)
+	select {
+	case err := <-drained:
+		AssertEqual("drain error", err, nil, t)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Drain to return once the input was drained")
+	}
+}
+
+func TestTransformerDrainPriorityKindsWithPools(t *testing.T) {
+	config.Cfg.KindWorkerPools = map[string]string{"Pod": "1"}
+	config.Cfg.PriorityKinds = []string{"Pod"}
+	defer func() {
+		config.Cfg.KindWorkerPools = nil
+		config.Cfg.PriorityKinds = nil
+	}()
+	input := make(chan *Event)
+	transformer := NewTransformer(input, make(chan NodeEvent), 1)
+	close(input)
+
+	// Every priority kind has its own pool, so there's no priority pool to wait for.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	AssertEqual("drain error", transformer.Drain(ctx), nil, t)
+}
+
+func TestTransformerDrainContextDone(t *testing.T) {
+	input := make(chan *Event)
+	output := make(chan NodeEvent)
+	transformer := NewTransformer(input, output, 1)
+
+	// The input isn't closed, so the routines wait for more objects until the context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	AssertEqual("drain error", transformer.Drain(ctx), context.DeadlineExceeded, t)
+
+	// The routines are told to stop anyway.
+	transformer.Stop() // Waits for the routines to return
+	var p unstructured.Unstructured
+	UnmarshalFile("pod.json", &p, t)
+	select {
+	case input <- &Event{Resource: &p, ResourceString: "pods"}:
+		t.Error("Expected the stopped transformer to not read its input")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSplitTransformer(t *testing.T) {
+	input := make(chan *Event)
+	transformer := NewSplitTransformer(input, 1)
+	AssertEqual("Output", transformer.Output == nil, true, t)
+
+	var p unstructured.Unstructured
+	UnmarshalFile("pod.json", &p, t)
+	outputs := map[Operation]chan NodeEvent{
+		Create: transformer.CreateOutput,
+		Update: transformer.UpdateOutput,
+		Delete: transformer.DeleteOutput,
+	}
+	for _, operation := range []Operation{Create, Update, Delete} {
+		input <- &Event{Resource: &p, ResourceString: "pods", Operation: operation}
+		select {
+		case ne := <-outputs[operation]:
+			AssertEqual("operation", ne.Operation, operation, t)
+			AssertEqual("kind", ne.Properties["kind"], "Pod", t)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected the node event on the output of operation %d", operation)
+		}
+	}
+
+	transformer.Stop()
+	for operation, output := range outputs {
+		if _, ok := <-output; ok {
+			t.Errorf("Expected the output of operation %d to be closed once stopped", operation)
+		}
+	}
+}
+
+func TestSplitTransformerStoppedMarkers(t *testing.T) {
+	config.Cfg.SyncManifest, config.Cfg.ResyncMarkers = true, true
+	defer func() { config.Cfg.SyncManifest, config.Cfg.ResyncMarkers = false, false }()
+	transformer := NewSplitTransformer(make(chan *Event), 1)
+	transformer.Stop()
+
+	// The outputs are closed, the nodes of the caller are dropped instead of panicking.
+	transformer.SyncComplete()
+	transformer.ResyncStart()
+	transformer.ResyncComplete()
+}
+
+func TestSplitByOperationKeepsOrder(t *testing.T) {
+	output := make(chan NodeEvent, 4)
+	createOutput := make(chan NodeEvent, 4)
+	updateOutput := make(chan NodeEvent, 4)
+	deleteOutput := make(chan NodeEvent, 4)
+	for i, operation := range []Operation{Create, Update, Update, Delete} {
+		output <- NodeEvent{Node: Node{UID: fmt.Sprint(i)}, Operation: operation}
+	}
+	close(output)
+	splitByOperation(output, createOutput, updateOutput, deleteOutput)
+
+	AssertEqual("create", (<-createOutput).UID, "0", t)
+	AssertEqual("first update", (<-updateOutput).UID, "1", t)
+	AssertEqual("second update", (<-updateOutput).UID, "2", t)
+	AssertEqual("delete", (<-deleteOutput).UID, "3", t)
+}
+
+func TestTransformRoutineSkipsBadResource(t *testing.T) {
+	input := make(chan *Event)
+	output := make(chan NodeEvent)
+	transformer := NewTransformer(input, output, 1)
+	defer transformer.Stop()
+
+	bad := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]interface{}{"name": "bad-pod", "namespace": "default", "uid": "bad-uid"},
+		"spec":       "not a pod spec",
+	}}
+	var p unstructured.Unstructured
+	UnmarshalFile("pod.json", &p, t)
+	for i := 0; i < 3; i++ {
+		input <- &Event{Operation: Create, Resource: bad, ResourceString: "pods"}
+		input <- &Event{Operation: Create, Resource: &p, ResourceString: "pods"}
+		AssertEqual("next resource", (<-output).UID, PrefixedUID("Pod", p.GetUID()), t)
+
+		err := <-transformer.Errors
+		if !strings.Contains(err.Error(), "Pod default/bad-pod (UID bad-uid)") {
+			t.Errorf("Expected the error to identify the resource, got %v", err)
+		}
+	}
+}
+
+func TestTransformNodeEventsRecovers(t *testing.T) {
+	events, err := transformNodeEvents(&Event{Resource: nil})
+	if err == nil || len(events) != 0 {
+		t.Fatalf("Expected an error and no events for a nil resource, got %v and %v", err, events)
+	}
+	AssertEqual("error", strings.Contains(err.Error(), "nil resource"), true, t)
+}
+
+func TestSetEdgeDirection(t *testing.T) {
+	owned := Edge{EdgeType: "ownedBy", SourceUID: "local-cluster/1", DestUID: "local-cluster/2"}
+	SetEdgeDirection(&owned)
+	AssertEqual("ownedBy", owned.Direction, Directed, t)
+
+	bound := Edge{EdgeType: "boundTo", SourceUID: "local-cluster/1", DestUID: "local-cluster/2"}
+	SetEdgeDirection(&bound)
+	AssertEqual("boundTo", bound.Direction, Symmetric, t)
+
+	// The direction set by the edge builder is kept.
+	preset := Edge{EdgeType: "uses", Direction: Symmetric}
+	SetEdgeDirection(&preset)
+	AssertEqual("preset", preset.Direction, Symmetric, t)
+}
+
+// Transforms a representative mix of the resources collected at high volume, mostly pods and events.
+func BenchmarkTransformRoutine(b *testing.B) {
+	resources := map[string]*unstructured.Unstructured{}
+	for _, file := range []string{"pod.json", "deployment.json", "service.json", "namespace.json"} {
+		var resource unstructured.Unstructured
+		UnmarshalFile(file, &resource, b)
+		resources[file] = &resource
+	}
+	event := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Event",
+		"metadata":   map[string]interface{}{"name": "fake-pod.1", "namespace": "default", "uid": "event-uid"},
+		"involvedObject": map[string]interface{}{
+			"kind": "Pod", "name": "fake-pod", "namespace": "default", "uid": "pod-uid"},
+		"reason":  "BackOff",
+		"message": "Back-off restarting failed container",
+		"type":    "Warning",
+		"count":   int64(3),
+	}}
+	generic := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"metadata":   map[string]interface{}{"name": "foo", "namespace": "default", "uid": "widget-uid"},
+	}}
+	mix := []*Event{
+		{Resource: resources["pod.json"], ResourceString: "pods"},
+		{Resource: event, ResourceString: "events"},
+		{Resource: resources["pod.json"], ResourceString: "pods"},
+		{Resource: event, ResourceString: "events"},
+		{Resource: resources["pod.json"], ResourceString: "pods"},
+		{Resource: event, ResourceString: "events"},
+		{Resource: resources["deployment.json"], ResourceString: "deployments"},
+		{Resource: resources["service.json"], ResourceString: "services"},
+		{Resource: resources["namespace.json"], ResourceString: "namespaces"},
+		{Resource: generic, ResourceString: "widgets"},
+	}
+
+	input := make(chan *Event)
+	output := make(chan NodeEvent)
+	go TransformRoutine(input, output)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e := *mix[i%len(mix)]
+		e.Operation = Create
+		input <- &e
+		<-output
+	}
+}
+
+// A transform registered by a consumer of the package.
+type widgetTransform struct {
+	node Node
+}
+
+func (w widgetTransform) BuildNode() Node                { return w.node }
+func (w widgetTransform) BuildEdges(ns NodeStore) []Edge { return []Edge{} }
+
+func TestRegisterTransform(t *testing.T) {
+	widget := func(version string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "example.com/" + version,
+			"kind":       "Widget",
+			"metadata":   map[string]interface{}{"name": "foo", "namespace": "default", "uid": "widget-uid"},
+			"spec":       map[string]interface{}{"size": "large"},
+		}}
+	}
+	transform := func(size string) TransformFunc {
+		return func(r *unstructured.Unstructured) Transform {
+			node := transformCommon(r)
+			node.Properties["size"] = size
+			return widgetTransform{node: node}
+		}
+	}
+	defer func() { registeredTransforms = map[schema.GroupVersionKind]TransformFunc{} }()
+
+	input := make(chan *Event)
+	output := make(chan NodeEvent)
+	go TransformRoutine(input, output)
+	transformed := func(r *unstructured.Unstructured) Node {
+		input <- &Event{Operation: Create, Resource: r, ResourceString: "widgets"}
+		return (<-output).Node
+	}
+
+	AssertEqual("not registered", transformed(widget("v1")).Properties["size"], nil, t)
+
+	RegisterTransform(schema.GroupVersionKind{Group: "example.com", Kind: "Widget"}, transform("any version"))
+	RegisterTransform(schema.GroupVersionKind{Group: "example.com", Version: "v2", Kind: "Widget"}, transform("v2"))
+	AssertEqual("any version", transformed(widget("v1")).Properties["size"], "any version", t)
+	AssertEqual("v2", transformed(widget("v2")).Properties["size"], "v2", t)
+
+	// A registered transform replaces the built-in one.
+	var p unstructured.Unstructured
+	UnmarshalFile("pod.json", &p, t)
+	RegisterTransform(schema.GroupVersionKind{Version: "v1", Kind: "Pod"}, transform("pod"))
+	node := transformed(&p)
+	AssertEqual("replaced", node.Properties["size"], "pod", t)
+	AssertEqual("replaced", node.Properties["restarts"], nil, t)
+}
+
+func TestResourceAPIGroup(t *testing.T) {
+	for apiVersion, expected := range map[string]string{
+		"v1":                    "",
+		"apps/v1":               "apps",
+		"policy.example.com/v1": "policy.example.com",
+		"a/b/c":                 "",
+		"":                      "",
+	} {
+		resource := unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": apiVersion}}
+		AssertEqual(apiVersion, resourceAPIGroup(&resource), expected, t)
+	}
+}